@@ -3,13 +3,16 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 
 	"github.com/joho/godotenv"
+	"xq-agent/internal/audit"
 	"xq-agent/internal/channels"
 	"xq-agent/internal/config"
 	"xq-agent/internal/core"
 	"xq-agent/internal/cron"
 	"xq-agent/internal/llm"
+	"xq-agent/internal/mcp"
 	"xq-agent/internal/skills"
 	"xq-agent/internal/tools"
 )
@@ -18,6 +21,14 @@ func main() {
 	configFile := flag.String("config", "config.yaml", "Path to configuration file")
 	flag.Parse()
 
+	// "agent mcp-serve" offers the tools to MCP clients instead of chatting.
+	// stdout then carries the protocol, so everything else goes to stderr.
+	serveMCP := flag.Arg(0) == "mcp-serve"
+	stdout := os.Stdout
+	if serveMCP {
+		os.Stdout = os.Stderr
+	}
+
 	// Load .env if present
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
@@ -29,26 +40,43 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Audit log and workspace path policy shared by all file tools
+	if err := audit.SetOutput(cfg.Tools.AuditLog); err != nil {
+		log.Printf("Failed to open audit log: %v", err)
+	}
+	policy, err := tools.NewPathPolicy(cfg.Tools.Workspace, cfg.Tools.AuditLog)
+	if err != nil {
+		log.Fatalf("Invalid workspace config: %v", err)
+	}
+
 	// Initialize LLM
 	llmProvider := llm.NewOpenAI(cfg.LLM)
 
 	// Initialize Channels
 	cm := channels.NewManager()
 
-	// Add Console Channel
-	consoleCh := channels.NewConsoleChannel()
-	cm.Register(consoleCh)
-
-	// Add Webview Channel (GUI)
-	// We always register it, but we need to handle its run loop specially
-	webviewCh := channels.NewWebviewChannel()
-	cm.Register(webviewCh)
-
-	if cfg.Channels.Telegram.Enabled {
-		cm.Register(channels.NewTelegramChannel(cfg.Channels.Telegram))
-	}
-	if cfg.Channels.WeCom.Enabled {
-		cm.Register(channels.NewWeComChannel(cfg.Channels.WeCom))
+	var webviewCh *channels.WebviewChannel
+	var mcpCh *channels.CaptureChannel
+	if serveMCP {
+		// ask_agent turns reply here
+		mcpCh = channels.NewCaptureChannel("mcp")
+		cm.Register(mcpCh)
+	} else {
+		// Add Console Channel
+		consoleCh := channels.NewConsoleChannel()
+		cm.Register(consoleCh)
+
+		// Add Webview Channel (GUI)
+		// We always register it, but we need to handle its run loop specially
+		webviewCh = channels.NewWebviewChannel()
+		cm.Register(webviewCh)
+
+		if cfg.Channels.Telegram.Enabled {
+			cm.Register(channels.NewTelegramChannel(cfg.Channels.Telegram))
+		}
+		if cfg.Channels.WeCom.Enabled {
+			cm.Register(channels.NewWeComChannel(cfg.Channels.WeCom))
+		}
 	}
 
 	// Initialize Skills Manager
@@ -66,14 +94,78 @@ func main() {
 	agent := core.NewAgent(cfg, llmProvider, cm)
 
 	// Register Native Tools
+	// Every file the agent writes is journaled so it can be undone
+	journal := tools.NewJournal(cfg.Tools.Journal)
+	agent.RegisterCommand("undo", "Revert the last file change ('/undo all' reverts the whole session)", journal.UndoCommand)
+	agent.RegisterCommand("diff", "Show the file changes made in this session", journal.DiffCommand)
+
+	if !serveMCP {
+		// MCP clients cannot answer questions
+		agent.RegisterTool(agent.AskUserTool(cfg.Tools.AskTimeout))
+	}
+
+	todos := tools.NewTodoList()
+	agent.SetTodoList(todos)
+	agent.RegisterTool(&tools.TodoWriteTool{Todos: todos})
+	agent.RegisterTool(&tools.TodoReadTool{Todos: todos})
+
 	if cfg.Tools.BrowserEnabled {
-		agent.RegisterTool(&tools.BrowserOpenTool{})
-		agent.RegisterTool(&tools.BrowserScreenshotTool{})
+		// One Chrome process shared by all conversations, tabs persist between calls
+		browsers := tools.NewBrowserManager(cfg.Tools.Browser)
+		defer browsers.Close()
+		agent.RegisterTool(&tools.BrowserOpenTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserClickTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserTypeTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserSelectTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserScrollTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserWaitTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserEvalTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserBackTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserLinksTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserFormsTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserTabsTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserCloseTool{Browser: browsers})
+		agent.RegisterTool(&tools.BrowserScreenshotTool{Browser: browsers, Policy: policy, Journal: journal})
 	}
 	if cfg.Tools.FileEnabled {
-		agent.RegisterTool(&tools.FileReadTool{})
-		agent.RegisterTool(&tools.FileListTool{})
-		agent.RegisterTool(&tools.FileWriteTool{})
+		agent.RegisterTool(&tools.FileReadTool{Policy: policy})
+		agent.RegisterTool(&tools.FileListTool{Policy: policy})
+		agent.RegisterTool(&tools.FileWriteTool{Policy: policy, Journal: journal})
+		agent.RegisterTool(&tools.ImageViewTool{Policy: policy})
+		agent.RegisterTool(&tools.DocumentReadTool{Policy: policy})
+		agent.RegisterTool(&tools.DataQueryTool{Policy: policy, Journal: journal})
+		agent.RegisterTool(&tools.ArchiveTool{Config: cfg.Tools.Archive, Policy: policy, Journal: journal})
+	}
+	if cfg.Tools.HTTPEnabled {
+		agent.RegisterTool(&tools.HTTPRequestTool{Config: cfg.Tools.HTTP, Policy: policy, Journal: journal})
+	}
+	if cfg.Tools.CodeEnabled {
+		agent.RegisterTool(&tools.CodeRunTool{Config: cfg.Tools.Code, Policy: policy})
+	}
+	if cfg.Tools.GitEnabled {
+		git := tools.NewGit(cfg.Tools.Git, policy)
+		agent.RegisterTool(&tools.GitStatusTool{Git: git})
+		agent.RegisterTool(&tools.GitDiffTool{Git: git})
+		agent.RegisterTool(&tools.GitLogTool{Git: git})
+		agent.RegisterTool(&tools.GitShowTool{Git: git})
+		agent.RegisterTool(&tools.GitBranchTool{Git: git})
+		agent.RegisterTool(&tools.GitCommitTool{Git: git})
+		agent.RegisterTool(&tools.GitStashTool{Git: git})
+		agent.RegisterTool(&tools.GitPushTool{Git: git})
+	}
+	if cfg.Tools.EmailEnabled {
+		email := tools.NewEmail(cfg.Tools.Email, policy, journal)
+		agent.RegisterTool(&tools.EmailSendTool{Email: email})
+		agent.RegisterTool(&tools.EmailSearchTool{Email: email})
+		agent.RegisterTool(&tools.EmailReadTool{Email: email})
+	}
+	if cfg.Tools.MCPEnabled {
+		// Servers start in the background, their tools appear once connected
+		mcpMgr := mcp.NewManager(cfg.MCP, agent, cm, llmProvider)
+		mcpMgr.Start()
+		defer mcpMgr.Close()
+		agent.RegisterTool(mcpMgr.ResourceTool())
+		agent.RegisterCommand("mcp", "Show MCP server status ('/mcp restart <name>' reconnects one)", mcpMgr.StatusCommand)
 	}
 	if cfg.Tools.ShellEnabled {
 		agent.RegisterTool(&tools.ShellRunTool{})
@@ -99,6 +191,18 @@ func main() {
 		agent.SetSystemPrompt("You are a helpful AI agent. " + skillContext)
 	}
 
+	if serveMCP {
+		// The agent still handles cron jobs and resource updates
+		go agent.Run()
+		if err := runMCPServer(cfg, agent, agent.AskAgentTool(mcpCh, func(name string) bool {
+			return mcp.Offered(cfg.MCP.Serve, name)
+		}), stdout, flag.Args()[1:]); err != nil {
+			log.Printf("MCP server: %v", err)
+		}
+		cm.Stop()
+		return
+	}
+
 	// Start Agent in a goroutine because Webview needs the main thread
 	log.Println("Starting agent...")
 	go func() {
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"xq-agent/internal/config"
+	"xq-agent/internal/core"
+	"xq-agent/internal/mcp"
+	"xq-agent/internal/tools"
+)
+
+// runMCPServer offers the agent's tools and ask_agent to MCP clients, on
+// stdin and out or over Streamable HTTP at /mcp when an address is set.
+func runMCPServer(cfg *config.Config, agent *core.Agent, askAgent tools.Tool, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("mcp-serve", flag.ExitOnError)
+	addr := fs.String("http", cfg.MCP.Serve.Addr, "Serve Streamable HTTP on this address instead of stdio")
+	fs.Parse(args)
+
+	server := mcp.NewServer(cfg.MCP.Serve, func() []tools.Tool {
+		return append(agent.Tools(), askAgent)
+	})
+	if *addr == "" {
+		log.Println("Serving MCP on stdio")
+		return server.ServeStdio(context.Background(), os.Stdin, out)
+	}
+
+	if host, _, err := net.SplitHostPort(*addr); err == nil && !isLoopback(host) && cfg.MCP.Serve.BearerToken == "" {
+		log.Printf("Warning: MCP server on %s is reachable from the network without mcp.serve.bearer_token", *addr)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", server)
+	srv := &http.Server{Addr: *addr, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Printf("Serving MCP on http://%s/mcp", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is a security-relevant action taken (or refused) on behalf of the model.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"` // e.g. "path_denied"
+	Tool   string    `json:"tool,omitempty"`
+	Target string    `json:"target,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+var (
+	mu   sync.Mutex
+	file *os.File
+)
+
+// SetOutput appends subsequent events to the given file as JSON lines.
+// An empty path keeps events in the process log only.
+func SetOutput(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	file = f
+	return nil
+}
+
+// Record logs the event and, if an audit file is configured, appends it there.
+func Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	log.Printf("[Audit] %s tool=%s target=%s reason=%s", e.Kind, e.Tool, e.Target, e.Reason)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	file.Write(append(line, '\n'))
+}
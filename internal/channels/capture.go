@@ -0,0 +1,47 @@
+package channels
+
+import (
+	"strings"
+	"sync"
+)
+
+// CaptureChannel collects the agent's replies instead of showing them, for
+// callers that run a turn and want its answer, such as MCP clients.
+type CaptureChannel struct {
+	name    string
+	handler func(Message)
+
+	mu      sync.Mutex
+	replies []string
+}
+
+func NewCaptureChannel(name string) *CaptureChannel {
+	return &CaptureChannel{name: name}
+}
+
+func (c *CaptureChannel) Name() string { return c.name }
+func (c *CaptureChannel) Start() error { return nil }
+func (c *CaptureChannel) Stop() error  { return nil }
+
+func (c *CaptureChannel) SendMessage(content string) error {
+	c.mu.Lock()
+	c.replies = append(c.replies, content)
+	c.mu.Unlock()
+	return nil
+}
+
+// Take returns the replies collected so far and clears them.
+func (c *CaptureChannel) Take() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := strings.Join(c.replies, "\n\n")
+	c.replies = nil
+	return out
+}
+
+func (c *CaptureChannel) SendToken(token string) error             { return nil }
+func (c *CaptureChannel) ShowThinking() error                      { return nil }
+func (c *CaptureChannel) SendReasoning(content string) error       { return nil }
+func (c *CaptureChannel) SendToolCall(toolName, args string) error { return nil }
+func (c *CaptureChannel) IsStreamable() bool                       { return false }
+func (c *CaptureChannel) OnMessage(handler func(Message))          { c.handler = handler }
@@ -1,10 +1,61 @@
 package channels
 
+import "strings"
+
 type Message struct {
 	ID      string
 	Content string
 	Sender  string
 	Channel string // e.g. "wecom", "dingtalk"
+	ChatID  string // The chat it came from, on channels with several
+	Images  []Image
+	// Injected is set for messages from internal components, such as cron
+	// jobs, rather than from the user.
+	Injected bool
+}
+
+// Address names where replies to the message go: the channel, followed by
+// ":" and the chat on channels with several. The Manager sends to it.
+func (m Message) Address() string {
+	if m.ChatID == "" {
+		return m.Channel
+	}
+	return m.Channel + ":" + m.ChatID
+}
+
+// SplitAddress splits an address into the channel name and the chat.
+func SplitAddress(address string) (channel, chat string) {
+	channel, chat, _ = strings.Cut(address, ":")
+	return channel, chat
+}
+
+// Image is a picture sent by the user along with a message.
+type Image struct {
+	MIMEType string
+	Data     []byte
+}
+
+// FileSender is implemented by channels that can deliver files to the user.
+type FileSender interface {
+	SendFile(name, path string) error
+}
+
+// Todo is one step of the agent's task list.
+type Todo struct {
+	Content string
+	Status  string // pending, in_progress or done
+}
+
+// TodoRenderer is implemented by channels that can show the agent's task
+// list while it works.
+type TodoRenderer interface {
+	SendTodos(todos []Todo) error
+}
+
+// ChatChannel is implemented by channels that talk to several chats at
+// once. Chat returns the Channel that sends to one of them.
+type ChatChannel interface {
+	Chat(id string) Channel
 }
 
 type Channel interface {
@@ -77,6 +77,30 @@ func (c *ConsoleChannel) SendToolCall(toolName, args string) error {
 	return nil
 }
 
+func (c *ConsoleChannel) SendFile(name, path string) error {
+	fmt.Printf("[File] %s: %s\n", name, path)
+	return nil
+}
+
+func (c *ConsoleChannel) SendTodos(todos []Todo) error {
+	if len(todos) == 0 {
+		fmt.Println("\n[Todo] cleared")
+		return nil
+	}
+	fmt.Println("\n[Todo]")
+	for _, t := range todos {
+		mark := "[ ]"
+		switch t.Status {
+		case "in_progress":
+			mark = "[>]"
+		case "done":
+			mark = "[x]"
+		}
+		fmt.Printf("  %s %s\n", mark, t.Content)
+	}
+	return nil
+}
+
 func (c *ConsoleChannel) IsStreamable() bool {
 	return true
 }
@@ -1,5 +1,7 @@
 package channels
 
+import "fmt"
+
 type Manager struct {
 	channels []Channel
 	msgChan  chan Message
@@ -20,7 +22,9 @@ func (m *Manager) Register(c Channel) {
 
 func (m *Manager) Start() {
 	for _, c := range m.channels {
-		c.Start()
+		if err := c.Start(); err != nil {
+			fmt.Printf("[%s] Failed to start: %v\n", c.Name(), err)
+		}
 	}
 }
 
@@ -34,6 +38,24 @@ func (m *Manager) Messages() <-chan Message {
 	return m.msgChan
 }
 
+// lookup returns the channels an address names. The methods below take a
+// channel name or a Message.Address; with a chat, channels that have
+// several give the one for that chat.
+func (m *Manager) lookup(address string) []Channel {
+	name, chat := SplitAddress(address)
+	var found []Channel
+	for _, c := range m.channels {
+		if c.Name() != name {
+			continue
+		}
+		if cc, ok := c.(ChatChannel); ok && chat != "" {
+			c = cc.Chat(chat)
+		}
+		found = append(found, c)
+	}
+	return found
+}
+
 func (m *Manager) Broadcast(content string) {
 	for _, c := range m.channels {
 		c.SendMessage(content)
@@ -41,55 +63,65 @@ func (m *Manager) Broadcast(content string) {
 }
 
 func (m *Manager) SendToChannel(channelName, content string) {
-	for _, c := range m.channels {
-		if c.Name() == channelName {
-			c.SendMessage(content)
-		}
+	for _, c := range m.lookup(channelName) {
+		c.SendMessage(content)
 	}
 }
 
 func (m *Manager) SendTokenToChannel(channelName, token string) {
-	for _, c := range m.channels {
-		if c.Name() == channelName {
-			c.SendToken(token)
-		}
+	for _, c := range m.lookup(channelName) {
+		c.SendToken(token)
 	}
 }
 
 func (m *Manager) SendReasoningToChannel(channelName, content string) {
-	for _, c := range m.channels {
-		if c.Name() == channelName {
-			c.SendReasoning(content)
-		}
+	for _, c := range m.lookup(channelName) {
+		c.SendReasoning(content)
 	}
 }
 
 func (m *Manager) SendToolCallToChannel(channelName, toolName, args string) {
-	for _, c := range m.channels {
-		if c.Name() == channelName {
-			c.SendToolCall(toolName, args)
+	for _, c := range m.lookup(channelName) {
+		c.SendToolCall(toolName, args)
+	}
+}
+
+// SendFileToChannel delivers a file, or its path on channels that cannot
+// send files.
+func (m *Manager) SendFileToChannel(channelName, name, path string) {
+	for _, c := range m.lookup(channelName) {
+		if fs, ok := c.(FileSender); ok {
+			fs.SendFile(name, path)
+		} else {
+			c.SendMessage(fmt.Sprintf("File %s: %s", name, path))
 		}
 	}
 }
 
-func (m *Manager) ShowThinking(channelName string) {
-	for _, c := range m.channels {
-		if c.Name() == channelName {
-			c.ShowThinking()
+// SendTodosToChannel shows the task list on channels that can render it.
+func (m *Manager) SendTodosToChannel(channelName string, todos []Todo) {
+	for _, c := range m.lookup(channelName) {
+		if tr, ok := c.(TodoRenderer); ok {
+			tr.SendTodos(todos)
 		}
 	}
 }
 
+func (m *Manager) ShowThinking(channelName string) {
+	for _, c := range m.lookup(channelName) {
+		c.ShowThinking()
+	}
+}
+
 func (m *Manager) IsChannelStreamable(channelName string) bool {
-	for _, c := range m.channels {
-		if c.Name() == channelName {
-			return c.IsStreamable()
-		}
+	for _, c := range m.lookup(channelName) {
+		return c.IsStreamable()
 	}
 	return false
 }
 
 // InjectMessage allows internal components to send messages as if they came from a channel
 func (m *Manager) InjectMessage(msg Message) {
+	msg.Injected = true
 	m.msgChan <- msg
 }
@@ -0,0 +1,237 @@
+package channels
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// MessageEditor is implemented by channels that can change a message after
+// sending it, such as Telegram with editMessageText.
+type MessageEditor interface {
+	// SendEditable sends content and returns an ID to edit it by.
+	SendEditable(content string) (string, error)
+	EditMessage(id, content string) error
+}
+
+// Streamer streams replies on channels that cannot show tokens as they
+// arrive. With a MessageEditor the reply is one message, edited as text
+// comes in; otherwise complete lines are sent as separate messages. Either
+// way there is at most one request per interval.
+//
+// Channels keep one Streamer per chat, so that replies to different chats
+// never mix. The in-flight message ends with Finish, which channels call
+// before sending anything else and when a new message comes in.
+type Streamer struct {
+	editor   MessageEditor
+	send     func(string) error
+	interval time.Duration
+	limit    int
+
+	sendMu sync.Mutex // Serializes flushes
+	mu     sync.Mutex
+	text   string // The in-flight message
+	shown  string // What the user sees of it
+	id     string // Its ID once sent, with an editor
+	last   time.Time
+	timer  *time.Timer
+}
+
+// NewEditStreamer streams into a message that editor edits. limit is the
+// longest message the channel accepts.
+func NewEditStreamer(editor MessageEditor, interval time.Duration, limit int) *Streamer {
+	return &Streamer{editor: editor, interval: interval, limit: limit}
+}
+
+// NewChunkStreamer streams by sending each batch of complete lines with
+// send.
+func NewChunkStreamer(send func(string) error, interval time.Duration, limit int) *Streamer {
+	return &Streamer{send: send, interval: interval, limit: limit}
+}
+
+// Token adds streamed text to the in-flight message.
+func (s *Streamer) Token(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text += token
+	s.schedule()
+}
+
+// Status adds a line, such as a tool call, to the in-flight message.
+func (s *Streamer) Status(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.text != "" && !strings.HasSuffix(s.text, "\n") {
+		s.text += "\n"
+	}
+	s.text += line + "\n"
+	s.schedule()
+}
+
+// Finish shows everything still pending and starts a new message for the
+// next text.
+func (s *Streamer) Finish() {
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+	s.flush(true)
+}
+
+// schedule flushes after the interval since the last request, giving the
+// text at least half an interval to collect. s.mu must be held.
+func (s *Streamer) schedule() {
+	if s.timer != nil {
+		return
+	}
+	delay := max(s.interval-time.Since(s.last), s.interval/2)
+	s.timer = time.AfterFunc(delay, func() { s.flush(false) })
+}
+
+func (s *Streamer) flush(final bool) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	if !final {
+		s.timer = nil
+	}
+	text, id := s.text, s.id
+	if text == s.shown && !final {
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	var rest string
+	if s.editor != nil {
+		rest, id = s.flushEdit(text, id)
+	} else {
+		rest = s.flushChunks(text, final)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = time.Now()
+	// Text that came in meanwhile follows what was flushed, or starts the
+	// next message once this one is finished.
+	added := s.text[len(text):]
+	if final {
+		s.text, s.shown, s.id = added, "", ""
+	} else {
+		s.text, s.shown, s.id = rest+added, rest, id
+	}
+	if s.text != s.shown {
+		s.schedule()
+	}
+}
+
+// flushEdit shows text in the in-flight message, moving what does not fit
+// into new ones, and returns the text and ID of the last message.
+func (s *Streamer) flushEdit(text, id string) (string, string) {
+	if strings.TrimSpace(text) == "" {
+		return text, id
+	}
+	parts := splitMessage(text, s.limit)
+	for i, part := range parts {
+		if i > 0 {
+			id = ""
+		}
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		var err error
+		if id == "" {
+			id, err = s.editor.SendEditable(part)
+		} else {
+			err = s.editor.EditMessage(id, part)
+		}
+		if err != nil {
+			log.Printf("Streaming update failed: %v", err)
+		}
+	}
+	return parts[len(parts)-1], id
+}
+
+// flushChunks sends the complete lines of text, or all of it when final,
+// and returns what is left.
+func (s *Streamer) flushChunks(text string, final bool) string {
+	ready, rest := text, ""
+	if !final {
+		i := strings.LastIndexByte(text, '\n')
+		if i < 0 && utf16Len(text) <= s.limit {
+			return text
+		}
+		if i >= 0 {
+			ready, rest = text[:i+1], text[i+1:]
+		}
+	}
+	if strings.TrimSpace(ready) == "" {
+		return rest
+	}
+	for _, part := range splitMessage(strings.TrimRight(ready, "\n"), s.limit) {
+		if err := s.send(part); err != nil {
+			log.Printf("Streaming update failed: %v", err)
+		}
+	}
+	return rest
+}
+
+// statusLine describes a tool call for chat channels.
+func statusLine(toolName, args string) string {
+	args = strings.Join(strings.Fields(args), " ")
+	if r := []rune(args); len(r) > 80 {
+		args = string(r[:80]) + "..."
+	}
+	return fmt.Sprintf("🔧 %s(%s)", toolName, args)
+}
+
+// splitMessage splits text into parts of at most limit UTF-16 code units,
+// as Telegram counts, preferring line breaks, then spaces. A code block cut
+// in two is closed and reopened.
+func splitMessage(text string, limit int) []string {
+	const fenceRoom = 8 // "\n```" closing one part and "```\n" opening the next
+	var parts []string
+	for utf16Len(text) > limit {
+		cut := utf16Prefix(text, limit-fenceRoom)
+		if nl := strings.LastIndexByte(text[:cut], '\n'); nl > cut/2 {
+			cut = nl
+		} else if sp := strings.LastIndexByte(text[:cut], ' '); sp > cut/2 {
+			cut = sp + 1
+		}
+		part, rest := text[:cut], strings.TrimPrefix(text[cut:], "\n")
+		if strings.Count(part, "```")%2 == 1 {
+			part += "\n```"
+			rest = "```\n" + rest
+		}
+		parts = append(parts, part)
+		text = rest
+	}
+	return append(parts, text)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// utf16Prefix returns the length in bytes of the longest prefix of s that
+// fits in n UTF-16 code units.
+func utf16Prefix(s string, n int) int {
+	units := 0
+	for i, r := range s {
+		units += utf16.RuneLen(r)
+		if units > n {
+			return i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,175 @@
+package channels
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEditor records the messages a Streamer shows. If hold is set, the
+// first SendEditable signals sending and waits for hold to be closed.
+type fakeEditor struct {
+	hold    chan struct{}
+	sending chan struct{}
+
+	mu       sync.Mutex
+	messages []string
+	held     bool
+}
+
+func (e *fakeEditor) SendEditable(content string) (string, error) {
+	e.mu.Lock()
+	wait := e.hold != nil && !e.held
+	e.held = true
+	e.mu.Unlock()
+	if wait {
+		e.sending <- struct{}{}
+		<-e.hold
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.messages = append(e.messages, content)
+	return fmt.Sprint(len(e.messages) - 1), nil
+}
+
+func (e *fakeEditor) EditMessage(id, content string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var i int
+	fmt.Sscan(id, &i)
+	e.messages[i] = content
+	return nil
+}
+
+func (e *fakeEditor) shown() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.messages...)
+}
+
+// waitFor polls until cond holds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEditStreamer(t *testing.T) {
+	e := &fakeEditor{}
+	s := NewEditStreamer(e, 10*time.Millisecond, 100)
+
+	s.Token("Hello")
+	waitFor(t, func() bool { return len(e.shown()) == 1 })
+	s.Token(", world")
+	s.Status("🔧 clock()")
+	s.Finish()
+	if got := e.shown(); !reflect.DeepEqual(got, []string{"Hello, world\n🔧 clock()\n"}) {
+		t.Errorf("messages = %q", got)
+	}
+
+	// After Finish, text goes to a new message.
+	s.Token("Next")
+	s.Finish()
+	if got := e.shown(); len(got) != 2 || got[1] != "Next" {
+		t.Errorf("messages = %q", got)
+	}
+}
+
+func TestEditStreamerSplitsLongText(t *testing.T) {
+	e := &fakeEditor{}
+	s := NewEditStreamer(e, 10*time.Millisecond, 20)
+	s.Token(strings.Repeat("word ", 10))
+	s.Finish()
+	got := e.shown()
+	if len(got) < 2 || strings.Join(got, "") != strings.Repeat("word ", 10) {
+		t.Errorf("messages = %q", got)
+	}
+	for _, m := range got {
+		if utf16Len(m) > 20 {
+			t.Errorf("%q is longer than the limit", m)
+		}
+	}
+}
+
+func TestFinishKeepsTokensAddedWhileFlushing(t *testing.T) {
+	e := &fakeEditor{hold: make(chan struct{}), sending: make(chan struct{})}
+	s := NewEditStreamer(e, 10*time.Millisecond, 100)
+
+	s.Token("first")
+	done := make(chan struct{})
+	go func() {
+		s.Finish()
+		close(done)
+	}()
+	<-e.sending // Finish is sending "first"
+	s.Token("late")
+	close(e.hold)
+	<-done
+
+	waitFor(t, func() bool { return len(e.shown()) == 2 })
+	if got := e.shown(); got[0] != "first" || got[1] != "late" {
+		t.Errorf("messages = %q, want the late token in a new message", got)
+	}
+}
+
+func TestChunkStreamer(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	s := NewChunkStreamer(func(text string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, text)
+		return nil
+	}, 10*time.Millisecond, 100)
+	got := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), sent...)
+	}
+
+	// Complete lines are sent, the rest waits.
+	s.Token("line one\nline t")
+	waitFor(t, func() bool { return len(got()) == 1 })
+	s.Token("wo")
+	s.Finish()
+	if want := []string{"line one", "line two"}; !reflect.DeepEqual(got(), want) {
+		t.Errorf("sent %q, want %q", got(), want)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	if got := splitMessage("short", 10); !reflect.DeepEqual(got, []string{"short"}) {
+		t.Errorf("short text split into %q", got)
+	}
+
+	text := "first line\nsecond line\nthird line"
+	parts := splitMessage(text, 20)
+	if len(parts) < 2 || strings.Join(parts, "\n") != text {
+		t.Errorf("split into %q", parts)
+	}
+
+	// A code block cut in two is closed and reopened.
+	code := "```\n" + strings.Repeat("x := 1\n", 10) + "```"
+	parts = splitMessage(code, 40)
+	for _, p := range parts {
+		if strings.Count(p, "```")%2 != 0 {
+			t.Errorf("part %q leaves a code block open", p)
+		}
+		if utf16Len(p) > 40 {
+			t.Errorf("part %q is longer than the limit", p)
+		}
+	}
+
+	// Limits count UTF-16 code units, as Telegram does.
+	if got := splitMessage(strings.Repeat("😀", 10), 10); len(got) < 2 {
+		t.Errorf("20 code units fit in 10: %q", got)
+	}
+}
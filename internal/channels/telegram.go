@@ -1,68 +1,410 @@
 package channels
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"xq-agent/internal/config"
 )
 
+const (
+	telegramAPI     = "https://api.telegram.org"
+	telegramMaxText = 4096
+	pollTimeout     = 30 * time.Second
+	sendTimeout     = 30 * time.Second
+	uploadTimeout   = 2 * time.Minute
+	// The typing indicator lasts 5 seconds, so it is renewed until the
+	// reply is sent, for at most typingMax.
+	typingInterval = 4 * time.Second
+	typingMax      = 2 * time.Minute
+	maxPhotoBytes  = 10 << 20
+	maxUploadBytes = 50 << 20
+	// Telegram allows about one edit per second in a chat.
+	streamInterval = time.Second
+)
+
+// TelegramChannel talks to users through a Telegram bot, receiving updates
+// by long polling or, when webhook_url is set, by webhook.
+//
+// Messages carry their chat as ChatID, and replies go to that chat through
+// Chat. What is sent to the channel itself goes to the first allowed chat.
 type TelegramChannel struct {
-	cfg     config.TelegramConfig
-	handler func(Message)
-	stop    chan struct{}
+	cfg      config.TelegramConfig
+	handler  func(Message)
+	client   *http.Client
+	ctx      context.Context
+	cancel   context.CancelFunc
+	server   *http.Server
+	secret   string // X-Telegram-Bot-Api-Secret-Token that webhook deliveries carry
+	username string
+
+	mu     sync.Mutex
+	offset int64 // The next update_id, older ones were handled already
+	chats  map[int64]*telegramChat
+}
+
+// telegramChat sends to one chat, with its own streamed reply and typing
+// indicator.
+type telegramChat struct {
+	c      *TelegramChannel
+	id     int64
+	stream *Streamer
+
+	mu     sync.Mutex
+	typing chan struct{} // Closed to stop the typing indicator
 }
 
 func NewTelegramChannel(cfg config.TelegramConfig) *TelegramChannel {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &TelegramChannel{
-		cfg:  cfg,
-		stop: make(chan struct{}),
+		cfg:    cfg,
+		client: &http.Client{},
+		ctx:    ctx,
+		cancel: cancel,
+		chats:  make(map[int64]*telegramChat),
 	}
 }
 
 func (c *TelegramChannel) Name() string { return "telegram" }
 
+// Chat returns the channel for the chat with the given ID.
+func (c *TelegramChannel) Chat(id string) Channel {
+	chatID, _ := strconv.ParseInt(id, 10, 64)
+	return c.chat(chatID)
+}
+
+func (c *TelegramChannel) chat(id int64) *telegramChat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chat, ok := c.chats[id]
+	if !ok {
+		chat = &telegramChat{c: c, id: id}
+		chat.stream = NewEditStreamer(chat, streamInterval, telegramMaxText)
+		c.chats[id] = chat
+	}
+	return chat
+}
+
+// defaultChat is where messages without a chat go: the first allowed chat.
+func (c *TelegramChannel) defaultChat() *telegramChat {
+	if len(c.cfg.AllowedChats) == 0 {
+		return c.chat(0)
+	}
+	return c.chat(c.cfg.AllowedChats[0])
+}
+
 func (c *TelegramChannel) Start() error {
 	if !c.cfg.Enabled {
 		return nil
 	}
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-		for {
+	if c.token() == "" {
+		return fmt.Errorf("telegram: token is not set")
+	}
+	if len(c.cfg.AllowedChats) == 0 {
+		log.Printf("[Telegram] Warning: allowed_chats is empty, anyone who finds the bot can use the agent")
+	}
+
+	var me struct {
+		Username string `json:"username"`
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, sendTimeout)
+	defer cancel()
+	if err := c.call(ctx, "getMe", nil, &me); err != nil {
+		return fmt.Errorf("telegram: %v", err)
+	}
+	c.username = me.Username
+	log.Printf("[Telegram] Connected as @%s", me.Username)
+
+	if c.cfg.WebhookURL != "" {
+		if err := c.startWebhook(); err != nil {
+			return fmt.Errorf("telegram: %v", err)
+		}
+		return nil
+	}
+	go c.poll()
+	return nil
+}
+
+func (c *TelegramChannel) Stop() error {
+	c.mu.Lock()
+	chats := make([]*telegramChat, 0, len(c.chats))
+	for _, chat := range c.chats {
+		chats = append(chats, chat)
+	}
+	c.mu.Unlock()
+	for _, chat := range chats {
+		chat.stream.Finish()
+		chat.stopTyping()
+	}
+	c.cancel()
+	if c.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.server.Shutdown(ctx)
+	}
+	return nil
+}
+
+// poll receives updates with getUpdates until the channel stops.
+func (c *TelegramChannel) poll() {
+	// getUpdates is refused while a webhook is set.
+	ctx, cancel := context.WithTimeout(c.ctx, sendTimeout)
+	if err := c.call(ctx, "deleteWebhook", nil, nil); err != nil {
+		log.Printf("[Telegram] %v", err)
+	}
+	cancel()
+
+	backoff := time.Second
+	for c.ctx.Err() == nil {
+		c.mu.Lock()
+		offset := c.offset
+		c.mu.Unlock()
+
+		var updates []telegramUpdate
+		ctx, cancel := context.WithTimeout(c.ctx, pollTimeout+10*time.Second)
+		err := c.call(ctx, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         int(pollTimeout.Seconds()),
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		cancel()
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			log.Printf("[Telegram] %v, retrying in %s", err, backoff)
 			select {
-			case <-c.stop:
+			case <-time.After(backoff):
+			case <-c.ctx.Done():
 				return
-			case <-ticker.C:
-				// Implement polling here
-				// For now, it's a placeholder
 			}
+			backoff = min(backoff*2, time.Minute)
+			continue
 		}
-	}()
-	return nil
+		backoff = time.Second
+		for _, u := range updates {
+			c.handleUpdate(u)
+		}
+	}
 }
 
-func (c *TelegramChannel) Stop() error {
-	close(c.stop)
+// startWebhook listens on webhook_addr and tells Telegram to deliver
+// updates to webhook_url, whose path is served. Deliveries must carry
+// webhook_secret, or a random secret when it is not set, so that nobody
+// else can post updates.
+func (c *TelegramChannel) startWebhook() error {
+	u, err := url.Parse(c.cfg.WebhookURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook_url: %v", err)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	addr := c.cfg.WebhookAddr
+	if addr == "" {
+		addr = ":8443"
+	}
+	c.secret = os.ExpandEnv(c.cfg.WebhookSecret)
+	if c.secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("generate webhook secret: %v", err)
+		}
+		c.secret = hex.EncodeToString(b)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, c.serveWebhook)
+	c.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go c.server.Serve(ln)
+
+	params := map[string]interface{}{
+		"url":             c.cfg.WebhookURL,
+		"allowed_updates": []string{"message"},
+		"secret_token":    c.secret,
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, sendTimeout)
+	defer cancel()
+	if err := c.call(ctx, "setWebhook", params, nil); err != nil {
+		c.server.Close()
+		return err
+	}
+	log.Printf("[Telegram] Receiving updates at %s (listening on %s)", c.cfg.WebhookURL, addr)
 	return nil
 }
 
+func (c *TelegramChannel) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	got := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if c.secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(c.secret)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var u telegramUpdate
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&u); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+	c.handleUpdate(u)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUpdate passes a message on to the agent. Updates seen before, such
+// as webhook deliveries Telegram retries, are dropped.
+func (c *TelegramChannel) handleUpdate(u telegramUpdate) {
+	c.mu.Lock()
+	if u.UpdateID < c.offset {
+		c.mu.Unlock()
+		return
+	}
+	c.offset = u.UpdateID + 1
+	c.mu.Unlock()
+
+	m := u.Message
+	if m == nil || c.handler == nil {
+		return
+	}
+	if !c.allowed(m.Chat.ID) {
+		log.Printf("[Telegram] Ignoring message from chat %d, which is not in allowed_chats", m.Chat.ID)
+		return
+	}
+
+	msg := Message{
+		ID:      fmt.Sprintf("telegram-%d-%d", m.Chat.ID, m.MessageID),
+		Content: c.stripMention(firstNonEmpty(m.Text, m.Caption)),
+		Sender:  m.sender(),
+		Channel: c.Name(),
+		ChatID:  strconv.FormatInt(m.Chat.ID, 10),
+	}
+	if len(m.Photo) > 0 {
+		img, err := c.downloadPhoto(m.Photo)
+		if err != nil {
+			log.Printf("[Telegram] Failed to download photo: %v", err)
+		} else {
+			msg.Images = append(msg.Images, img)
+		}
+	}
+	if msg.Content == "" && len(msg.Images) == 0 {
+		return
+	}
+
+	// A new turn starts, replies go to a new message.
+	c.chat(m.Chat.ID).stream.Finish()
+	c.handler(msg)
+}
+
+func (c *TelegramChannel) allowed(chatID int64) bool {
+	if len(c.cfg.AllowedChats) == 0 {
+		return true
+	}
+	for _, id := range c.cfg.AllowedChats {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// stripMention turns "/cmd@thisbot args", as sent in groups, into
+// "/cmd args".
+func (c *TelegramChannel) stripMention(text string) string {
+	if c.username == "" || !strings.HasPrefix(text, "/") {
+		return text
+	}
+	cmd, rest, found := strings.Cut(text, " ")
+	if name, bot, ok := strings.Cut(cmd, "@"); ok && strings.EqualFold(bot, c.username) {
+		cmd = name
+	}
+	if found {
+		return cmd + " " + rest
+	}
+	return cmd
+}
+
+// downloadPhoto fetches the largest size of a photo that is small enough.
+func (c *TelegramChannel) downloadPhoto(sizes []telegramPhotoSize) (Image, error) {
+	best := sizes[0]
+	for _, s := range sizes[1:] {
+		if s.FileSize <= maxPhotoBytes && s.Width*s.Height > best.Width*best.Height {
+			best = s
+		}
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, uploadTimeout)
+	defer cancel()
+	var file struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := c.call(ctx, "getFile", map[string]string{"file_id": best.FileID}, &file); err != nil {
+		return Image{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiBase()+"/file/bot"+c.token()+"/"+file.FilePath, nil)
+	if err != nil {
+		return Image{}, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Image{}, hideURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Image{}, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoBytes+1))
+	if err != nil {
+		return Image{}, err
+	}
+	if len(data) > maxPhotoBytes {
+		return Image{}, fmt.Errorf("photo is larger than %d bytes", maxPhotoBytes)
+	}
+	// Telegram re-encodes photos as JPEG.
+	return Image{MIMEType: "image/jpeg", Data: data}, nil
+}
+
+// errNoChat is returned when there is no chat to send to.
+var errNoChat = errors.New("telegram: no chat to send to, set allowed_chats")
+
 func (c *TelegramChannel) SendMessage(content string) error {
 	if !c.cfg.Enabled {
 		return nil
 	}
-	fmt.Printf("[Telegram] Sending: %s\n", content)
-	return nil
+	return c.defaultChat().SendMessage(content)
+}
+
+func (c *TelegramChannel) SendFile(name, path string) error {
+	return c.defaultChat().SendFile(name, path)
 }
 
 func (c *TelegramChannel) SendToken(token string) error {
-	// Not supported yet
-	return nil
+	return c.defaultChat().SendToken(token)
 }
 
 func (c *TelegramChannel) ShowThinking() error {
-	// Not supported yet
-	return nil
+	return c.defaultChat().ShowThinking()
 }
 
 func (c *TelegramChannel) SendReasoning(content string) error {
@@ -71,14 +413,336 @@ func (c *TelegramChannel) SendReasoning(content string) error {
 }
 
 func (c *TelegramChannel) SendToolCall(toolName, args string) error {
-	// Not supported
-	return nil
+	return c.defaultChat().SendToolCall(toolName, args)
 }
 
 func (c *TelegramChannel) IsStreamable() bool {
-	return false
+	return true
 }
 
 func (c *TelegramChannel) OnMessage(handler func(Message)) {
 	c.handler = handler
 }
+
+func (t *telegramChat) Name() string                    { return t.c.Name() }
+func (t *telegramChat) Start() error                    { return nil }
+func (t *telegramChat) Stop() error                     { return nil }
+func (t *telegramChat) IsStreamable() bool              { return true }
+func (t *telegramChat) OnMessage(handler func(Message)) {}
+
+func (t *telegramChat) SendMessage(content string) error {
+	if !t.c.cfg.Enabled {
+		return nil
+	}
+	t.stream.Finish()
+	t.stopTyping()
+	if t.id == 0 {
+		return errNoChat
+	}
+	for _, part := range splitMessage(content, telegramMaxText) {
+		if _, err := t.c.sendText(t.id, part); err != nil {
+			log.Printf("[Telegram] Failed to send message: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// sendText sends one message and returns its ID.
+func (c *TelegramChannel) sendText(chat int64, text string) (int64, error) {
+	var sent struct {
+		MessageID int64 `json:"message_id"`
+	}
+	err := c.callFormatted("sendMessage", map[string]interface{}{"chat_id": chat}, text, &sent)
+	return sent.MessageID, err
+}
+
+// callFormatted calls a method that takes a text, formatted as MarkdownV2,
+// or as plain text if Telegram cannot parse the formatting.
+func (c *TelegramChannel) callFormatted(method string, params map[string]interface{}, text string, result interface{}) error {
+	ctx, cancel := context.WithTimeout(c.ctx, sendTimeout)
+	defer cancel()
+	params["text"] = toMarkdownV2(text)
+	params["parse_mode"] = "MarkdownV2"
+	err := c.call(ctx, method, params, result)
+	var te *telegramError
+	if errors.As(err, &te) && te.Code == http.StatusBadRequest && !strings.Contains(te.Description, "not modified") {
+		params["text"] = text
+		delete(params, "parse_mode")
+		err = c.call(ctx, method, params, result)
+	}
+	if errors.As(err, &te) && strings.Contains(te.Description, "not modified") {
+		return nil
+	}
+	return err
+}
+
+// SendEditable sends a message that streamed text is added to.
+func (t *telegramChat) SendEditable(content string) (string, error) {
+	if t.id == 0 {
+		return "", errNoChat
+	}
+	id, err := t.c.sendText(t.id, content)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", t.id, id), nil
+}
+
+func (t *telegramChat) EditMessage(id, content string) error {
+	chat, msg, ok := strings.Cut(id, ":")
+	if !ok {
+		return fmt.Errorf("telegram: invalid message ID %q", id)
+	}
+	return t.c.callFormatted("editMessageText", map[string]interface{}{
+		"chat_id":    chat,
+		"message_id": msg,
+	}, content, nil)
+}
+
+// SendFile sends images as photos and anything else as a document.
+func (t *telegramChat) SendFile(name, path string) error {
+	if t.id == 0 {
+		return errNoChat
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxUploadBytes {
+		return t.SendMessage(fmt.Sprintf("File %s is too large to send: %s", name, path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	method, field := "sendDocument", "document"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".webp":
+		if len(data) <= maxPhotoBytes {
+			method, field = "sendPhoto", "photo"
+		}
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("chat_id", strconv.FormatInt(t.id, 10))
+	if name != "" && name != filepath.Base(path) {
+		w.WriteField("caption", name)
+	}
+	fw, err := w.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	fw.Write(data)
+	w.Close()
+
+	ctx, cancel := context.WithTimeout(t.c.ctx, uploadTimeout)
+	defer cancel()
+	if err := t.c.do(ctx, method, w.FormDataContentType(), buf.Bytes(), nil); err != nil {
+		log.Printf("[Telegram] Failed to send %s: %v", path, err)
+		return t.SendMessage(fmt.Sprintf("File %s: %s", name, path))
+	}
+	return nil
+}
+
+// SendToken streams the reply by editing the message it is shown in.
+func (t *telegramChat) SendToken(token string) error {
+	t.stopTyping()
+	t.stream.Token(token)
+	return nil
+}
+
+// ShowThinking shows "typing..." in the chat until the reply is sent.
+func (t *telegramChat) ShowThinking() error {
+	if t.id == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	if t.typing != nil {
+		t.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	t.typing = stop
+	t.mu.Unlock()
+
+	go func() {
+		deadline := time.After(typingMax)
+		for {
+			ctx, cancel := context.WithTimeout(t.c.ctx, sendTimeout)
+			t.c.call(ctx, "sendChatAction", map[string]interface{}{"chat_id": t.id, "action": "typing"}, nil)
+			cancel()
+			select {
+			case <-time.After(typingInterval):
+			case <-stop:
+				return
+			case <-t.c.ctx.Done():
+				return
+			case <-deadline:
+				t.mu.Lock()
+				if t.typing == stop {
+					t.typing = nil
+				}
+				t.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *telegramChat) stopTyping() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.typing != nil {
+		close(t.typing)
+		t.typing = nil
+	}
+}
+
+func (t *telegramChat) SendReasoning(content string) error {
+	// Not supported
+	return nil
+}
+
+func (t *telegramChat) SendToolCall(toolName, args string) error {
+	t.stream.Status(statusLine(toolName, args))
+	return nil
+}
+
+func (c *TelegramChannel) token() string {
+	return os.ExpandEnv(c.cfg.Token)
+}
+
+func (c *TelegramChannel) apiBase() string {
+	if c.cfg.APIBase != "" {
+		return strings.TrimRight(c.cfg.APIBase, "/")
+	}
+	return telegramAPI
+}
+
+// telegramError is an error returned by the Bot API.
+type telegramError struct {
+	Method      string
+	Code        int
+	Description string
+}
+
+func (e *telegramError) Error() string {
+	return fmt.Sprintf("%s failed (%d): %s", e.Method, e.Code, e.Description)
+}
+
+// call invokes a Bot API method with JSON parameters and decodes its result
+// into result, if not nil.
+func (c *TelegramChannel) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	if params == nil {
+		params = struct{}{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, method, "application/json", body, result)
+}
+
+// do posts body to a Bot API method. Requests Telegram rate-limits are
+// retried after the delay it asks for.
+func (c *TelegramChannel) do(ctx context.Context, method, contentType string, body []byte, result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiBase()+"/bot"+c.token()+"/"+method, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s failed: %v", method, hideURL(err))
+		}
+		var r struct {
+			OK          bool            `json:"ok"`
+			Result      json.RawMessage `json:"result"`
+			ErrorCode   int             `json:"error_code"`
+			Description string          `json:"description"`
+			Parameters  struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&r)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("%s failed: %s", method, resp.Status)
+		}
+		if r.OK {
+			if result == nil {
+				return nil
+			}
+			return json.Unmarshal(r.Result, result)
+		}
+		if r.ErrorCode == http.StatusTooManyRequests && r.Parameters.RetryAfter > 0 && attempt < 3 {
+			select {
+			case <-time.After(time.Duration(r.Parameters.RetryAfter) * time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return &telegramError{Method: method, Code: r.ErrorCode, Description: r.Description}
+	}
+}
+
+// hideURL drops the request URL, which contains the bot token, from
+// transport errors.
+func hideURL(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Err
+	}
+	return err
+}
+
+type telegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	From      *struct {
+		ID        int64  `json:"id"`
+		Username  string `json:"username"`
+		FirstName string `json:"first_name"`
+	} `json:"from"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text    string              `json:"text"`
+	Caption string              `json:"caption"`
+	Photo   []telegramPhotoSize `json:"photo"`
+}
+
+type telegramPhotoSize struct {
+	FileID   string `json:"file_id"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	FileSize int    `json:"file_size"`
+}
+
+func (m *telegramMessage) sender() string {
+	if m.From == nil {
+		return strconv.FormatInt(m.Chat.ID, 10)
+	}
+	if m.From.Username != "" {
+		return "@" + m.From.Username
+	}
+	return firstNonEmpty(m.From.FirstName, strconv.FormatInt(m.From.ID, 10))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package channels
+
+import "strings"
+
+// markdownV2Special are the characters MarkdownV2 requires to be escaped
+// outside of code.
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// toMarkdownV2 converts the Markdown the model writes to Telegram's
+// MarkdownV2: code blocks, inline code, **bold**, headings, bullets and
+// links are kept, everything else is escaped.
+func toMarkdownV2(text string) string {
+	var sb strings.Builder
+	inCode := false
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				sb.WriteString("```")
+			} else {
+				sb.WriteString("```" + escapeCode(strings.TrimPrefix(trimmed, "```")))
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			sb.WriteString(escapeCode(line))
+			continue
+		}
+		if heading := strings.TrimLeft(trimmed, "#"); heading != trimmed && strings.HasPrefix(heading, " ") {
+			sb.WriteString("*" + escapeMarkdownV2(strings.TrimSpace(heading)) + "*")
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		if rest, ok := strings.CutPrefix(trimmed, "- "); ok {
+			line = indent + "• " + rest
+		} else if rest, ok := strings.CutPrefix(trimmed, "* "); ok {
+			line = indent + "• " + rest
+		}
+		sb.WriteString(inlineMarkdownV2(line))
+	}
+	if inCode {
+		sb.WriteString("\n```")
+	}
+	return sb.String()
+}
+
+// inlineMarkdownV2 converts one line outside code blocks.
+func inlineMarkdownV2(line string) string {
+	var sb strings.Builder
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				sb.WriteString("`" + escapeCode(rest[1:end+1]) + "`")
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				sb.WriteString("*" + escapeMarkdownV2(rest[2:end+2]) + "*")
+				i += end + 4
+				continue
+			}
+		case rest[0] == '[':
+			if mid := strings.Index(rest, "]("); mid > 0 {
+				if end := strings.IndexByte(rest[mid:], ')'); end > 0 {
+					label, target := rest[1:mid], rest[mid+2:mid+end]
+					sb.WriteString("[" + escapeMarkdownV2(label) + "](" + escapeLink(target) + ")")
+					i += mid + end + 1
+					continue
+				}
+			}
+		}
+		if strings.IndexByte(markdownV2Special, rest[0]) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(rest[0])
+		i++
+	}
+	return sb.String()
+}
+
+func escapeMarkdownV2(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(markdownV2Special, s[i]) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// escapeCode escapes the inside of code, where only ` and \ are special.
+func escapeCode(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(s)
+}
+
+// escapeLink escapes a link target, where only ) and \ are special.
+func escapeLink(s string) string {
+	return strings.NewReplacer("\\", "\\\\", ")", "\\)").Replace(s)
+}
@@ -0,0 +1,291 @@
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xq-agent/internal/config"
+)
+
+// botCall is a Bot API request the fake server received.
+type botCall struct {
+	method string
+	params map[string]interface{}
+}
+
+// fakeBotAPI serves the Bot API methods the channel uses. The first
+// getUpdates returns updates, later ones return nothing.
+type fakeBotAPI struct {
+	updates []telegramUpdate
+
+	mu     sync.Mutex
+	calls  []botCall
+	polled bool
+	nextID int
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/file/botTOKEN/photos/1.jpg" {
+		io.WriteString(w, "jpeg data")
+		return
+	}
+	method, ok := strings.CutPrefix(r.URL.Path, "/botTOKEN/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var params map[string]interface{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, botCall{method, params})
+	var result interface{} = true
+	wait := false
+	switch method {
+	case "getMe":
+		result = map[string]string{"username": "xqbot"}
+	case "getUpdates":
+		result, wait = []telegramUpdate{}, f.polled
+		if !f.polled {
+			f.polled, result = true, f.updates
+		}
+	case "getFile":
+		result = map[string]string{"file_path": "photos/1.jpg"}
+	case "sendMessage":
+		f.nextID++
+		result = map[string]int{"message_id": f.nextID}
+	}
+	f.mu.Unlock()
+
+	if wait {
+		// Long polling: wait a little before answering with nothing.
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+// sent returns the texts sent to each chat, in order.
+func (f *fakeBotAPI) sent() map[string][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[string][]string)
+	for _, c := range f.calls {
+		if c.method == "sendMessage" {
+			chat := fmt.Sprint(c.params["chat_id"])
+			out[chat] = append(out[chat], fmt.Sprint(c.params["text"]))
+		}
+	}
+	return out
+}
+
+func textUpdate(id, chat int64, text string) telegramUpdate {
+	m := &telegramMessage{MessageID: id, Text: text}
+	m.Chat.ID = chat
+	return telegramUpdate{UpdateID: id, Message: m}
+}
+
+// startTelegram starts a channel against a fake Bot API and returns the
+// manager its messages arrive at.
+func startTelegram(t *testing.T, api *fakeBotAPI, allowed ...int64) (*TelegramChannel, *Manager) {
+	t.Helper()
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	c := NewTelegramChannel(config.TelegramConfig{
+		Enabled:      true,
+		Token:        "TOKEN",
+		APIBase:      srv.URL,
+		AllowedChats: allowed,
+	})
+	m := NewManager()
+	m.Register(c)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop() })
+	return c, m
+}
+
+func receive(t *testing.T, m *Manager) Message {
+	t.Helper()
+	select {
+	case msg := <-m.Messages():
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message arrived")
+		return Message{}
+	}
+}
+
+func TestTelegramRepliesGoToTheirChat(t *testing.T) {
+	api := &fakeBotAPI{updates: []telegramUpdate{
+		textUpdate(1, 100, "hi from 100"),
+		textUpdate(2, 200, "hi from 200"),
+	}}
+	_, m := startTelegram(t, api, 100, 200)
+
+	first, second := receive(t, m), receive(t, m)
+	if first.ChatID != "100" || first.Address() != "telegram:100" || first.Content != "hi from 100" {
+		t.Errorf("first message = %+v", first)
+	}
+	if second.ChatID != "200" || second.Address() != "telegram:200" {
+		t.Errorf("second message = %+v", second)
+	}
+
+	// The reply to the earlier message still goes to its own chat.
+	m.SendToChannel(second.Address(), "answer 200")
+	m.SendToChannel(first.Address(), "answer 100")
+	sent := api.sent()
+	if got := sent["100"]; len(got) != 1 || got[0] != "answer 100" {
+		t.Errorf("chat 100 got %q", got)
+	}
+	if got := sent["200"]; len(got) != 1 || got[0] != "answer 200" {
+		t.Errorf("chat 200 got %q", got)
+	}
+}
+
+func TestTelegramStreamsPerChat(t *testing.T) {
+	api := &fakeBotAPI{}
+	_, m := startTelegram(t, api, 100, 200)
+
+	m.SendTokenToChannel("telegram:100", "one ")
+	m.SendTokenToChannel("telegram:200", "two ")
+	m.SendTokenToChannel("telegram:100", "three")
+	m.SendToChannel("telegram:200", "done")
+	m.SendToChannel("telegram:100", "done")
+
+	sent := api.sent()
+	if got := sent["100"]; len(got) != 2 || got[0] != "one three" || got[1] != "done" {
+		t.Errorf("chat 100 got %q", got)
+	}
+	if got := sent["200"]; len(got) != 2 || got[0] != "two " || got[1] != "done" {
+		t.Errorf("chat 200 got %q", got)
+	}
+}
+
+func TestTelegramIgnoresOtherChats(t *testing.T) {
+	api := &fakeBotAPI{updates: []telegramUpdate{
+		textUpdate(1, 300, "let me in"),
+		textUpdate(2, 100, "/help@xqbot now"),
+	}}
+	_, m := startTelegram(t, api, 100)
+
+	msg := receive(t, m)
+	if msg.ChatID != "100" {
+		t.Errorf("got a message from chat %s", msg.ChatID)
+	}
+	if msg.Content != "/help now" {
+		t.Errorf("content = %q, want the mention stripped", msg.Content)
+	}
+}
+
+func TestTelegramPhoto(t *testing.T) {
+	update := textUpdate(1, 100, "")
+	update.Message.Caption = "what is this?"
+	update.Message.Photo = []telegramPhotoSize{
+		{FileID: "small", Width: 90, Height: 90},
+		{FileID: "large", Width: 800, Height: 800, FileSize: 1000},
+	}
+	api := &fakeBotAPI{updates: []telegramUpdate{update}}
+	_, m := startTelegram(t, api, 100)
+
+	msg := receive(t, m)
+	if msg.Content != "what is this?" || len(msg.Images) != 1 || string(msg.Images[0].Data) != "jpeg data" {
+		t.Errorf("message = %+v", msg)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	for _, c := range api.calls {
+		if c.method == "getFile" && c.params["file_id"] != "large" {
+			t.Errorf("downloaded %v, want the largest size", c.params["file_id"])
+		}
+	}
+}
+
+func TestTelegramDefaultChat(t *testing.T) {
+	api := &fakeBotAPI{}
+	c, _ := startTelegram(t, api, 100, 200)
+	if err := c.SendMessage("reminder"); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.sent()["100"]; len(got) != 1 || got[0] != "reminder" {
+		t.Errorf("the first allowed chat got %q", got)
+	}
+
+	c, _ = startTelegram(t, &fakeBotAPI{})
+	if err := c.SendMessage("reminder"); err != errNoChat {
+		t.Errorf("without allowed chats: %v", err)
+	}
+}
+
+// postUpdate delivers u to the channel's webhook handler with the given
+// secret header and returns the status code.
+func postUpdate(c *TelegramChannel, secret string, u telegramUpdate) int {
+	body, _ := json.Marshal(u)
+	req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(string(body)))
+	if secret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	}
+	w := httptest.NewRecorder()
+	c.serveWebhook(w, req)
+	return w.Code
+}
+
+func TestTelegramWebhookSecret(t *testing.T) {
+	for _, configured := range []string{"", "s3cret"} {
+		api := &fakeBotAPI{}
+		srv := httptest.NewServer(api)
+		c := NewTelegramChannel(config.TelegramConfig{
+			Enabled:       true,
+			Token:         "TOKEN",
+			APIBase:       srv.URL,
+			AllowedChats:  []int64{100},
+			WebhookURL:    "https://example.com/telegram",
+			WebhookAddr:   "127.0.0.1:0",
+			WebhookSecret: configured,
+		})
+		m := NewManager()
+		m.Register(c)
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+
+		var secret string
+		api.mu.Lock()
+		for _, call := range api.calls {
+			if call.method == "setWebhook" {
+				secret, _ = call.params["secret_token"].(string)
+			}
+		}
+		api.mu.Unlock()
+		if secret == "" || configured != "" && secret != configured {
+			t.Errorf("webhook_secret %q: setWebhook got secret_token %q", configured, secret)
+		}
+
+		// Forged updates are refused and do not move the offset.
+		for _, forged := range []string{"", "wrong"} {
+			if code := postUpdate(c, forged, textUpdate(1000, 100, "forged")); code != http.StatusForbidden {
+				t.Errorf("webhook_secret %q: update with secret %q got %d", configured, forged, code)
+			}
+		}
+		if code := postUpdate(c, secret, textUpdate(5, 100, "hello")); code != http.StatusOK {
+			t.Errorf("webhook_secret %q: genuine update got %d", configured, code)
+		}
+		if msg := receive(t, m); msg.Content != "hello" {
+			t.Errorf("webhook_secret %q: received %q", configured, msg.Content)
+		}
+		c.Stop()
+		srv.Close()
+	}
+}
@@ -135,6 +135,23 @@ func (c *WebviewChannel) SendToolCall(toolName, args string) error {
 	return nil
 }
 
+func (c *WebviewChannel) SendTodos(todos []Todo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := make([]map[string]string, len(todos))
+	for i, t := range todos {
+		items[i] = map[string]string{"content": t.Content, "status": t.Status}
+	}
+	jsTodos, _ := json.Marshal(items)
+	script := fmt.Sprintf("window.renderTodos(%s)", string(jsTodos))
+
+	c.w.Dispatch(func() {
+		c.w.Eval(script)
+	})
+	return nil
+}
+
 func (c *WebviewChannel) IsStreamable() bool {
 	return true
 }
@@ -2,7 +2,9 @@ package channels
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,45 +14,131 @@ import (
 	"xq-agent/internal/config"
 )
 
+const (
+	// WeCom text messages hold at most 2048 bytes, about 680 Chinese
+	// characters.
+	wecomMaxText = 680
+	// Applications may send each user about 30 messages a minute.
+	wecomStreamInterval = 3 * time.Second
+)
+
+// WeComChannel talks to the users of a WeCom application. Messages carry
+// their sender as ChatID, and replies go to that user through Chat.
 type WeComChannel struct {
 	cfg          config.WeComConfig
 	handler      func(Message)
 	accessToken  string
 	tokenExpires time.Time
 	mu           sync.Mutex
+
+	crypt  *wecomCrypt
+	server *http.Server
+	seen   idSet
+	userMu sync.Mutex
+	users  map[string]*wecomUser
+}
+
+// wecomUser sends to one user, with its own streamed reply.
+type wecomUser struct {
+	c      *WeComChannel
+	id     string
+	stream *Streamer
 }
 
 func NewWeComChannel(cfg config.WeComConfig) *WeComChannel {
 	return &WeComChannel{
-		cfg: cfg,
+		cfg:   cfg,
+		users: make(map[string]*wecomUser),
 	}
 }
 
 func (c *WeComChannel) Name() string { return "wecom" }
 
+// Chat returns the channel for the user with the given ID.
+func (c *WeComChannel) Chat(id string) Channel {
+	return c.user(id)
+}
+
+func (c *WeComChannel) user(id string) *wecomUser {
+	c.userMu.Lock()
+	defer c.userMu.Unlock()
+	u, ok := c.users[id]
+	if !ok {
+		u = &wecomUser{c: c, id: id}
+		u.stream = NewChunkStreamer(func(content string) error {
+			return c.send(id, content)
+		}, wecomStreamInterval, wecomMaxText)
+		c.users[id] = u
+	}
+	return u
+}
+
 func (c *WeComChannel) Start() error {
 	if !c.cfg.Enabled {
 		return nil
 	}
-	// In a real scenario, you would start an HTTP server here to receive callbacks
-	// For now, we just ensure we can get a token
 	if _, err := c.getAccessToken(); err != nil {
 		fmt.Printf("[WeCom] Warning: Failed to get access token on start: %v\n", err)
 	} else {
 		fmt.Println("[WeCom] Successfully connected (AccessToken acquired).")
 	}
+	if c.cfg.Token == "" || c.cfg.EncodingAESKey == "" {
+		fmt.Println("[WeCom] token or encoding_aes_key not set, only sending messages.")
+		return nil
+	}
+	if err := c.startCallback(); err != nil {
+		return fmt.Errorf("wecom: %v", err)
+	}
 	return nil
 }
 
 func (c *WeComChannel) Stop() error {
+	c.userMu.Lock()
+	users := make([]*wecomUser, 0, len(c.users))
+	for _, u := range c.users {
+		users = append(users, u)
+	}
+	c.userMu.Unlock()
+	for _, u := range users {
+		u.stream.Finish()
+	}
+	if c.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.server.Shutdown(ctx)
+	}
 	return nil
 }
 
+// errNoRecipient is returned for messages that are not addressed to a user.
+var errNoRecipient = errors.New("wecom: no recipient, replies can only go to the user who wrote")
+
+// SendMessage fails: WeCom messages go to a user, through Chat.
 func (c *WeComChannel) SendMessage(content string) error {
 	if !c.cfg.Enabled {
 		return nil
 	}
+	return errNoRecipient
+}
 
+func (u *wecomUser) SendMessage(content string) error {
+	if !u.c.cfg.Enabled {
+		return nil
+	}
+	u.stream.Finish()
+	for _, part := range splitMessage(content, wecomMaxText) {
+		if err := u.c.send(u.id, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends one text message to the user toUser.
+func (c *WeComChannel) send(toUser, content string) error {
+	if toUser == "" {
+		return errNoRecipient
+	}
 	token, err := c.getAccessToken()
 	if err != nil {
 		return fmt.Errorf("failed to get access token: %v", err)
@@ -59,7 +147,7 @@ func (c *WeComChannel) SendMessage(content string) error {
 	url := fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/message/send?access_token=%s", token)
 
 	payload := map[string]interface{}{
-		"touser":  "@all", // Send to all users in the app scope by default
+		"touser":  toUser,
 		"msgtype": "text",
 		"agentid": c.cfg.AgentID,
 		"text": map[string]string{
@@ -89,8 +177,7 @@ func (c *WeComChannel) SendMessage(content string) error {
 }
 
 func (c *WeComChannel) SendToken(token string) error {
-	// Not supported yet
-	return nil
+	return errNoRecipient
 }
 
 func (c *WeComChannel) ShowThinking() error {
@@ -104,19 +191,36 @@ func (c *WeComChannel) SendReasoning(content string) error {
 }
 
 func (c *WeComChannel) SendToolCall(toolName, args string) error {
-	// Maybe send a separate message?
-	// c.SendMessage(fmt.Sprintf("[Thinking: Using Tool %s]", toolName))
-	return nil
+	return errNoRecipient
 }
 
 func (c *WeComChannel) IsStreamable() bool {
-	return false
+	return true
 }
 
 func (c *WeComChannel) OnMessage(handler func(Message)) {
 	c.handler = handler
 }
 
+func (u *wecomUser) Name() string                    { return u.c.Name() }
+func (u *wecomUser) Start() error                    { return nil }
+func (u *wecomUser) Stop() error                     { return nil }
+func (u *wecomUser) ShowThinking() error             { return nil }
+func (u *wecomUser) SendReasoning(string) error      { return nil }
+func (u *wecomUser) IsStreamable() bool              { return true }
+func (u *wecomUser) OnMessage(handler func(Message)) {}
+
+// SendToken streams the reply, sending complete lines as they arrive.
+func (u *wecomUser) SendToken(token string) error {
+	u.stream.Token(token)
+	return nil
+}
+
+func (u *wecomUser) SendToolCall(toolName, args string) error {
+	u.stream.Status(statusLine(toolName, args))
+	return nil
+}
+
 func (c *WeComChannel) getAccessToken() (string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -0,0 +1,276 @@
+package channels
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// seenMsgIDs is how many message IDs are remembered to drop the copies
+// WeCom sends again when it gets no answer within 5 seconds.
+const seenMsgIDs = 1000
+
+// wecomCrypt verifies and decrypts callbacks as WeCom's WXBizMsgCrypt does.
+type wecomCrypt struct {
+	token  string
+	key    []byte
+	corpID string
+}
+
+func newWeComCrypt(token, encodingAESKey, corpID string) (*wecomCrypt, error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("encoding_aes_key must be the 43 characters shown by WeCom")
+	}
+	return &wecomCrypt{token: token, key: key, corpID: corpID}, nil
+}
+
+// verify checks msg_signature, the SHA-1 of the sorted token, timestamp,
+// nonce and encrypted message.
+func (w *wecomCrypt) verify(signature, timestamp, nonce, encrypted string) bool {
+	parts := []string{w.token, timestamp, nonce, encrypted}
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(signature)) == 1
+}
+
+// decrypt opens an encrypted message: AES-256-CBC with the key's first 16
+// bytes as IV, holding 16 random bytes, the message length, the message
+// and the corp ID.
+func (w *wecomCrypt) decrypt(encrypted string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid ciphertext length %d", len(data))
+	}
+	block, err := aes.NewCipher(w.key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, w.key[:aes.BlockSize]).CryptBlocks(plain, data)
+
+	// PKCS#7 padded to 32 bytes.
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > 32 || pad > len(plain) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	plain = plain[:len(plain)-pad]
+	if len(plain) < 20 {
+		return nil, fmt.Errorf("message too short")
+	}
+	n := int(binary.BigEndian.Uint32(plain[16:20]))
+	if n > len(plain)-20 {
+		return nil, fmt.Errorf("invalid message length")
+	}
+	msg, receiver := plain[20:20+n], string(plain[20+n:])
+	if receiver != w.corpID {
+		return nil, fmt.Errorf("message is for %q, not this corp", receiver)
+	}
+	return msg, nil
+}
+
+// wecomMessage is a decrypted message pushed to the callback URL.
+type wecomMessage struct {
+	FromUserName string `xml:"FromUserName"`
+	MsgType      string `xml:"MsgType"`
+	Content      string `xml:"Content"`
+	PicURL       string `xml:"PicUrl"`
+	MsgID        string `xml:"MsgId"`
+	AgentID      int    `xml:"AgentID"`
+}
+
+// startCallback serves the URL WeCom pushes user messages to.
+func (c *WeComChannel) startCallback() error {
+	crypt, err := newWeComCrypt(os.ExpandEnv(c.cfg.Token), os.ExpandEnv(c.cfg.EncodingAESKey), c.cfg.CorpID)
+	if err != nil {
+		return err
+	}
+	c.crypt = crypt
+	addr := c.cfg.CallbackAddr
+	if addr == "" {
+		addr = ":8080"
+	}
+	path := c.cfg.CallbackPath
+	if path == "" {
+		path = "/wecom"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, c.serveCallback)
+	c.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go c.server.Serve(ln)
+	fmt.Printf("[WeCom] Receiving messages on %s%s\n", addr, path)
+	return nil
+}
+
+func (c *WeComChannel) serveCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	signature, timestamp, nonce := q.Get("msg_signature"), q.Get("timestamp"), q.Get("nonce")
+
+	switch r.Method {
+	case http.MethodGet:
+		// URL verification when the callback is saved in the admin console.
+		echo := q.Get("echostr")
+		if !c.crypt.verify(signature, timestamp, nonce, echo) {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		plain, err := c.crypt.decrypt(echo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(plain)
+
+	case http.MethodPost:
+		var envelope struct {
+			Encrypt string `xml:"Encrypt"`
+		}
+		if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&envelope); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		if !c.crypt.verify(signature, timestamp, nonce, envelope.Encrypt) {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		plain, err := c.crypt.decrypt(envelope.Encrypt)
+		if err != nil {
+			log.Printf("[WeCom] Failed to decrypt message: %v", err)
+			http.Error(w, "invalid message", http.StatusBadRequest)
+			return
+		}
+		var m wecomMessage
+		if err := xml.Unmarshal(plain, &m); err != nil {
+			http.Error(w, "invalid message", http.StatusBadRequest)
+			return
+		}
+		// An empty reply tells WeCom the message arrived; answers are
+		// sent through the API.
+		w.WriteHeader(http.StatusOK)
+		c.receive(m)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// receive passes a user message on to the agent, once.
+func (c *WeComChannel) receive(m wecomMessage) {
+	if m.MsgType != "text" && m.MsgType != "image" {
+		return
+	}
+	if c.cfg.AgentID != 0 && m.AgentID != 0 && m.AgentID != c.cfg.AgentID {
+		return
+	}
+	if m.MsgID != "" && !c.seen.add(m.MsgID) {
+		return
+	}
+	if c.handler == nil {
+		return
+	}
+
+	msg := Message{
+		ID:      "wecom-" + m.MsgID,
+		Content: m.Content,
+		Sender:  m.FromUserName,
+		Channel: c.Name(),
+		ChatID:  m.FromUserName,
+	}
+	deliver := func() {
+		// A new turn starts, the reply begins anew.
+		c.user(m.FromUserName).stream.Finish()
+		c.handler(msg)
+	}
+	if m.MsgType == "text" {
+		deliver()
+		return
+	}
+	// Answer WeCom before downloading the picture.
+	go func() {
+		img, err := downloadImage(m.PicURL)
+		if err != nil {
+			log.Printf("[WeCom] Failed to download picture: %v", err)
+			return
+		}
+		msg.Images = []Image{img}
+		deliver()
+	}()
+}
+
+func downloadImage(url string) (Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Image{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Image{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Image{}, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoBytes+1))
+	if err != nil {
+		return Image{}, err
+	}
+	if len(data) > maxPhotoBytes {
+		return Image{}, fmt.Errorf("picture is larger than %d bytes", maxPhotoBytes)
+	}
+	mime := http.DetectContentType(data)
+	if !strings.HasPrefix(mime, "image/") {
+		mime = "image/jpeg"
+	}
+	return Image{MIMEType: mime, Data: data}, nil
+}
+
+// idSet remembers the most recent IDs it was given.
+type idSet struct {
+	mu    sync.Mutex
+	ids   map[string]bool
+	order []string
+}
+
+// add records id and reports whether it is new.
+func (s *idSet) add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids == nil {
+		s.ids = make(map[string]bool)
+	}
+	if s.ids[id] {
+		return false
+	}
+	s.ids[id] = true
+	s.order = append(s.order, id)
+	if len(s.order) > seenMsgIDs {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
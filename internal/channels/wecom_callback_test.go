@@ -0,0 +1,178 @@
+package channels
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"xq-agent/internal/config"
+)
+
+// The sample from WeCom's WXBizMsgCrypt library.
+const (
+	sampleToken   = "QDG6eK"
+	sampleAESKey  = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	sampleCorpID  = "wx5823bf96d3bd56c7"
+	sampleEchoStr = "P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ=="
+	sampleEncrypt = "RypEvHKD8QQKFhvQ6QleEB4J58tiPdvo+rtK1I9qca6aM/wvqnLSV5zEPeusUiX5L5X/0lWfrf0QADHHhGd3QczcdCUpj911L3vg3W/sYYvuJTs3TUUkSUXxaccAS0qhxchrRYt66wiSpGLYL42aM6A8dTT+6k4aSknmPj48kzJs8qLjvd4Xgpue06DOdnLxAUHzM6+kDZ+HMZfJYuR+LtwGc2hgf5gsijff0ekUNXZiqATP7PF5mZxZ3Izoun1s4zG4LUMnvw2r+KqCKIw+3IQH03v+BCA9nMELNqbSf6tiWSrXJB3LAVGUcallcrw8V2t9EL4EhzJWrQUax5wLVMNS0+rUPA3k22Ncx4XXZS9o0MBH27Bo6BpNelZpS+/uh9KsNlY6bHCmJU9p8g7m3fVKn28H3KDYA5Pl/T8Z1ptDAVe0lXdQ2YoyyH2uyPIGHBZZIs2pDBS8R07+qN+E7Q=="
+	sampleMessage = "<xml><ToUserName><![CDATA[wx5823bf96d3bd56c7]]></ToUserName>\n" +
+		"<FromUserName><![CDATA[mycreate]]></FromUserName>\n" +
+		"<CreateTime>1409659813</CreateTime>\n" +
+		"<MsgType><![CDATA[text]]></MsgType>\n" +
+		"<Content><![CDATA[hello]]></Content>\n" +
+		"<MsgId>4561255354251345929</MsgId>\n" +
+		"<AgentID>218</AgentID>\n" +
+		"</xml>"
+)
+
+func sampleCrypt(t *testing.T, corpID string) *wecomCrypt {
+	t.Helper()
+	crypt, err := newWeComCrypt(sampleToken, sampleAESKey, corpID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypt
+}
+
+// seal encrypts msg for corpID as WeCom does, padded to 32-byte blocks.
+func seal(w *wecomCrypt, msg, corpID string) string {
+	plain := append(bytes.Repeat([]byte("r"), 16), 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(plain[16:], uint32(len(msg)))
+	plain = append(append(plain, msg...), corpID...)
+	pad := 32 - len(plain)%32
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	block, _ := aes.NewCipher(w.key)
+	cipher.NewCBCEncrypter(block, w.key[:aes.BlockSize]).CryptBlocks(plain, plain)
+	return base64.StdEncoding.EncodeToString(plain)
+}
+
+func sign(token, timestamp, nonce, encrypted string) string {
+	parts := []string{token, timestamp, nonce, encrypted}
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestWeComCryptSample(t *testing.T) {
+	crypt := sampleCrypt(t, sampleCorpID)
+
+	// URL verification.
+	if !crypt.verify("5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3", "1409659589", "263014780", sampleEchoStr) {
+		t.Error("the sample echostr signature was rejected")
+	}
+	if got, err := crypt.decrypt(sampleEchoStr); err != nil || string(got) != "1616140317555161061" {
+		t.Errorf("decrypt(echostr) = %q, %v", got, err)
+	}
+
+	// A pushed message.
+	if !crypt.verify("477715d11cdb4164915debcba66cb864d751f3e6", "1409659813", "1372623149", sampleEncrypt) {
+		t.Error("the sample message signature was rejected")
+	}
+	if got, err := crypt.decrypt(sampleEncrypt); err != nil || string(got) != sampleMessage {
+		t.Errorf("decrypt(message) = %q, %v", got, err)
+	}
+
+	for _, bad := range []struct{ signature, timestamp, nonce string }{
+		{"477715d11cdb4164915debcba66cb864d751f3e7", "1409659813", "1372623149"},
+		{"477715d11cdb4164915debcba66cb864d751f3e6", "1409659814", "1372623149"},
+		{"", "1409659813", "1372623149"},
+	} {
+		if crypt.verify(bad.signature, bad.timestamp, bad.nonce, sampleEncrypt) {
+			t.Errorf("verify accepted %+v", bad)
+		}
+	}
+
+	// Messages for another corp are refused.
+	if got, err := sampleCrypt(t, "wx0000000000000000").decrypt(sampleEncrypt); err == nil {
+		t.Errorf("decrypt for another corp ID = %q", got)
+	}
+}
+
+func TestWeComCryptPadding(t *testing.T) {
+	crypt := sampleCrypt(t, sampleCorpID)
+
+	// Every padding length from 1 to 32 bytes, i.e. also more than one
+	// AES block.
+	for n := 0; n < 32; n++ {
+		msg := strings.Repeat("x", n)
+		if got, err := crypt.decrypt(seal(crypt, msg, sampleCorpID)); err != nil || string(got) != msg {
+			t.Errorf("round trip of %d bytes = %q, %v", n, got, err)
+		}
+	}
+
+	for name, encrypted := range map[string]string{
+		"not base64":    "not base64!",
+		"partial block": base64.StdEncoding.EncodeToString(make([]byte, 20)),
+		"empty":         "",
+		"other corp":    seal(crypt, "hello", "wx0000000000000000"),
+	} {
+		if got, err := crypt.decrypt(encrypted); err == nil {
+			t.Errorf("%s: decrypt = %q", name, got)
+		}
+	}
+}
+
+func TestWeComCallback(t *testing.T) {
+	c := NewWeComChannel(config.WeComConfig{CorpID: sampleCorpID, AgentID: 218})
+	c.crypt = sampleCrypt(t, sampleCorpID)
+	var received []Message
+	c.OnMessage(func(m Message) { received = append(received, m) })
+
+	call := func(method, signature, timestamp, nonce, echo, body string) *httptest.ResponseRecorder {
+		q := url.Values{"msg_signature": {signature}, "timestamp": {timestamp}, "nonce": {nonce}}
+		if echo != "" {
+			q.Set("echostr", echo)
+		}
+		r := httptest.NewRequest(method, "/wecom?"+q.Encode(), strings.NewReader(body))
+		w := httptest.NewRecorder()
+		c.serveCallback(w, r)
+		return w
+	}
+
+	w := call(http.MethodGet, "5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3", "1409659589", "263014780", sampleEchoStr, "")
+	if w.Code != http.StatusOK || w.Body.String() != "1616140317555161061" {
+		t.Errorf("URL verification: %d %q", w.Code, w.Body)
+	}
+	w = call(http.MethodGet, "5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3", "1409659590", "263014780", sampleEchoStr, "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("URL verification with a bad signature: %d %q", w.Code, w.Body)
+	}
+
+	body := "<xml><ToUserName><![CDATA[wx5823bf96d3bd56c7]]></ToUserName><Encrypt><![CDATA[" + sampleEncrypt + "]]></Encrypt><AgentID><![CDATA[218]]></AgentID></xml>"
+	if w := call(http.MethodPost, "0000000000000000000000000000000000000000", "1409659813", "1372623149", "", body); w.Code != http.StatusForbidden {
+		t.Errorf("message with a bad signature: %d", w.Code)
+	}
+	// WeCom pushes a message again when the answer is slow; the copy is
+	// dropped by its MsgId.
+	for i := 0; i < 2; i++ {
+		if w := call(http.MethodPost, "477715d11cdb4164915debcba66cb864d751f3e6", "1409659813", "1372623149", "", body); w.Code != http.StatusOK {
+			t.Errorf("message: %d %q", w.Code, w.Body)
+		}
+	}
+	// A new message from the same user is delivered.
+	encrypted := seal(c.crypt, strings.Replace(sampleMessage, "4561255354251345929", "4561255354251345930", 1), sampleCorpID)
+	body = "<xml><Encrypt><![CDATA[" + encrypted + "]]></Encrypt></xml>"
+	if w := call(http.MethodPost, sign(sampleToken, "1409659900", "1", encrypted), "1409659900", "1", "", body); w.Code != http.StatusOK {
+		t.Errorf("second message: %d %q", w.Code, w.Body)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("received %d messages, want 2: %+v", len(received), received)
+	}
+	for i, want := range []string{"wecom-4561255354251345929", "wecom-4561255354251345930"} {
+		if m := received[i]; m.ID != want || m.Content != "hello" || m.Sender != "mycreate" || m.ChatID != "mycreate" {
+			t.Errorf("message %d = %+v", i, m)
+		}
+	}
+}
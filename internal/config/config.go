@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,12 +11,16 @@ type Config struct {
 	LLM      LLMConfig      `yaml:"llm"`
 	Channels ChannelsConfig `yaml:"channels"`
 	Tools    ToolsConfig    `yaml:"tools"`
+	MCP      MCPConfig      `yaml:"mcp"`
 }
 
 type LLMConfig struct {
 	APIKey  string `yaml:"api_key"`
 	BaseURL string `yaml:"base_url"`
 	Model   string `yaml:"model"`
+	// Vision says whether the model accepts image input. When unset it is
+	// guessed from the model name.
+	Vision *bool `yaml:"vision"`
 }
 
 type ChannelsConfig struct {
@@ -30,6 +35,12 @@ type WeComConfig struct {
 	CorpID  string `yaml:"corp_id"`
 	AgentID int    `yaml:"agent_id"`
 	Secret  string `yaml:"secret"`
+	// Receiving messages. Token and EncodingAESKey are set on the
+	// application's "receive messages" page and support ${VAR}.
+	Token          string `yaml:"token"`
+	EncodingAESKey string `yaml:"encoding_aes_key"`
+	CallbackAddr   string `yaml:"callback_addr"` // Default ":8080"
+	CallbackPath   string `yaml:"callback_path"` // Default "/wecom"
 }
 
 type DingTalkConfig struct {
@@ -39,8 +50,13 @@ type DingTalkConfig struct {
 }
 
 type TelegramConfig struct {
-	Enabled bool   `yaml:"enabled"`
-	Token   string `yaml:"token"`
+	Enabled       bool    `yaml:"enabled"`
+	Token         string  `yaml:"token"`          // Supports ${VAR}
+	APIBase       string  `yaml:"api_base"`       // Default https://api.telegram.org
+	AllowedChats  []int64 `yaml:"allowed_chats"`  // Chats that may talk to the agent; empty allows all
+	WebhookURL    string  `yaml:"webhook_url"`    // Public URL; empty uses long polling
+	WebhookAddr   string  `yaml:"webhook_addr"`   // Address the webhook server listens on
+	WebhookSecret string  `yaml:"webhook_secret"` // Checked against X-Telegram-Bot-Api-Secret-Token, supports ${VAR}; random when empty
 }
 
 type LarkConfig struct {
@@ -50,10 +66,152 @@ type LarkConfig struct {
 }
 
 type ToolsConfig struct {
-	BrowserEnabled bool `yaml:"browser_enabled"`
-	ShellEnabled   bool `yaml:"shell_enabled"`
-	FileEnabled    bool `yaml:"file_enabled"`
-	MCPEnabled     bool `yaml:"mcp_enabled"`
+	BrowserEnabled bool            `yaml:"browser_enabled"`
+	ShellEnabled   bool            `yaml:"shell_enabled"`
+	FileEnabled    bool            `yaml:"file_enabled"`
+	MCPEnabled     bool            `yaml:"mcp_enabled"`
+	HTTPEnabled    bool            `yaml:"http_enabled"`
+	CodeEnabled    bool            `yaml:"code_enabled"`
+	GitEnabled     bool            `yaml:"git_enabled"`
+	EmailEnabled   bool            `yaml:"email_enabled"`
+	Workspace      WorkspaceConfig `yaml:"workspace"`
+	AuditLog       string          `yaml:"audit_log"`   // JSON-lines file for audit events, empty = log only
+	AskTimeout     time.Duration   `yaml:"ask_timeout"` // How long ask_user waits for an answer, default 10m
+	Journal        JournalConfig   `yaml:"journal"`
+	Browser        BrowserConfig   `yaml:"browser"`
+	HTTP           HTTPConfig      `yaml:"http"`
+	Code           CodeConfig      `yaml:"code"`
+	Git            GitConfig       `yaml:"git"`
+	Archive        ArchiveConfig   `yaml:"archive"`
+	Email          EmailConfig     `yaml:"email"`
+}
+
+// WorkspaceConfig limits which paths the file tools may touch.
+type WorkspaceConfig struct {
+	Roots    []string `yaml:"roots"`     // Allowed directories, defaults to the working directory
+	Deny     []string `yaml:"deny"`      // Glob patterns (with **) that are never accessible
+	ReadOnly bool     `yaml:"read_only"` // Refuse every write
+}
+
+// BrowserConfig tunes the shared Chrome instance used by the browser tools.
+type BrowserConfig struct {
+	ShowWindow  bool          `yaml:"show_window"`  // Run Chrome with a visible window instead of headless
+	ChromePath  string        `yaml:"chrome_path"`  // Defaults to the locally installed Chrome
+	Timeout     time.Duration `yaml:"timeout"`      // Per action, default 60s
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // Sessions unused this long are closed, default 30m
+}
+
+// HTTPConfig configures the http_request tool.
+type HTTPConfig struct {
+	Timeout      time.Duration             `yaml:"timeout"`        // Default 30s
+	MaxBodyBytes int64                     `yaml:"max_body_bytes"` // Responses larger than this are cut off, default 10MB
+	Credentials  map[string]HTTPCredential `yaml:"credentials"`    // Referenced by name, never shown to the model
+}
+
+// HTTPCredential is a secret the model can attach to a request by name.
+// Values may reference environment variables as ${NAME}.
+type HTTPCredential struct {
+	Type     string   `yaml:"type"`     // bearer, basic, header or query
+	Token    string   `yaml:"token"`    // bearer
+	Username string   `yaml:"username"` // basic
+	Password string   `yaml:"password"` // basic
+	Name     string   `yaml:"name"`     // Header or query parameter name
+	Value    string   `yaml:"value"`    // Header or query parameter value
+	Hosts    []string `yaml:"hosts"`    // Hosts the credential may be sent to, required
+}
+
+// CodeConfig limits the snippets run by code_run.
+type CodeConfig struct {
+	Dir      string        `yaml:"dir"`       // Parent of the per-session scratch directories, default <tmp>/xq-agent-code
+	Timeout  time.Duration `yaml:"timeout"`   // Wall clock time per run, default 60s
+	CPUTime  time.Duration `yaml:"cpu_time"`  // CPU time per run, default 30s
+	MemoryMB int           `yaml:"memory_mb"` // Default 512
+	Network  bool          `yaml:"network"`   // Allow network access, off by default
+	Python   string        `yaml:"python"`    // Interpreter commands, default python3 (python on Windows), node and go
+	Node     string        `yaml:"node"`
+	Go       string        `yaml:"go"`
+}
+
+// GitConfig configures the git_* tools.
+type GitConfig struct {
+	AllowDestructive bool `yaml:"allow_destructive"` // Permit force push, amend, force branch deletion and stash drop
+	MaxDiffBytes     int  `yaml:"max_diff_bytes"`    // Diffs are cut off after this, default 20000
+}
+
+// ArchiveConfig limits what the archive tool creates and extracts.
+type ArchiveConfig struct {
+	MaxSize    int64 `yaml:"max_size"`    // Total uncompressed bytes, default 512MB
+	MaxEntries int   `yaml:"max_entries"` // Default 10000
+}
+
+// EmailConfig is the mailbox used by the email_* tools. Username and
+// password may reference environment variables as ${NAME}.
+type EmailConfig struct {
+	Address            string            `yaml:"address"`              // Sender address
+	Name               string            `yaml:"name"`                 // Sender display name
+	Username           string            `yaml:"username"`             // Login, defaults to the address
+	Password           string            `yaml:"password"`             // Password or app authorization code
+	SMTP               EmailServerConfig `yaml:"smtp"`                 // Default port 587 with STARTTLS
+	IMAP               EmailServerConfig `yaml:"imap"`                 // Default port 993 with TLS
+	Timeout            time.Duration     `yaml:"timeout"`              // Per connection, default 60s
+	MaxAttachmentBytes int64             `yaml:"max_attachment_bytes"` // Per message, default 20MB
+}
+
+// EmailServerConfig is an SMTP or IMAP server.
+type EmailServerConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Security string `yaml:"security"` // tls, starttls or none; default tls on ports 465/993, otherwise starttls
+}
+
+// MCPConfig lists the MCP servers whose tools the agent can use. They are
+// only started when tools.mcp_enabled is set.
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `yaml:"servers"` // Keyed by name, which prefixes the tool names (name__tool)
+	Serve   MCPServeConfig             `yaml:"serve"`
+}
+
+// MCPServeConfig controls "agent mcp-serve", which offers the agent's own
+// tools to other MCP clients.
+type MCPServeConfig struct {
+	Addr         string   `yaml:"addr"`          // Streamable HTTP listen address, e.g. 127.0.0.1:8765; stdio if empty
+	BearerToken  string   `yaml:"bearer_token"`  // Required from HTTP clients, supports ${VAR}
+	Tools        []string `yaml:"tools"`         // Only offer these tools (glob patterns), default all
+	ExcludeTools []string `yaml:"exclude_tools"` // Never offer these tools (glob patterns)
+}
+
+// MCPServerConfig starts a local server (Command) or connects to a remote
+// one (URL). Env, header and token values may reference environment
+// variables as ${NAME}.
+type MCPServerConfig struct {
+	Disabled     bool              `yaml:"disabled"`
+	Command      string            `yaml:"command"`
+	Args         []string          `yaml:"args"`
+	Env          map[string]string `yaml:"env"`
+	Cwd          string            `yaml:"cwd"`
+	URL          string            `yaml:"url"`
+	Transport    string            `yaml:"transport"`     // For url: http (Streamable HTTP, default) or sse (older HTTP+SSE)
+	Headers      map[string]string `yaml:"headers"`       // Sent with every request to url
+	BearerToken  string            `yaml:"bearer_token"`  // Sent as "Authorization: Bearer ..."
+	Tools        []string          `yaml:"tools"`         // Only register these tools (glob patterns), default all
+	ExcludeTools []string          `yaml:"exclude_tools"` // Never register these tools (glob patterns)
+	Timeout      time.Duration     `yaml:"timeout"`       // Per tool call, default 60s
+	Sampling     MCPSamplingConfig `yaml:"sampling"`
+}
+
+// MCPSamplingConfig controls whether a server may have the agent's model
+// write completions for it (sampling).
+type MCPSamplingConfig struct {
+	Approval    string `yaml:"approval"`     // ask (the user approves each request, default), always or never
+	MaxTokens   int    `yaml:"max_tokens"`   // Per request, default 1024
+	TokenBudget int    `yaml:"token_budget"` // Total tokens while the agent runs, 0 for no limit
+}
+
+// JournalConfig controls how long file snapshots for /undo are kept.
+type JournalConfig struct {
+	MaxEntries  int           `yaml:"max_entries"`   // Per session, default 100
+	MaxAge      time.Duration `yaml:"max_age"`       // e.g. "24h" (default)
+	MaxFileSize int64         `yaml:"max_file_size"` // Bytes, larger files are not snapshotted (default 5MB)
 }
 
 func Load(path string) (*Config, error) {
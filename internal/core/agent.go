@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
 
 	"xq-agent/internal/channels"
 	"xq-agent/internal/config"
@@ -17,9 +18,18 @@ type Agent struct {
 	cfg          *config.Config
 	llm          llm.Provider
 	channels     *channels.Manager
+	toolsMu      sync.RWMutex
 	tools        map[string]tools.Tool
 	history      []openai.ChatCompletionMessage
 	systemPrompt string
+	commandsMu   sync.RWMutex
+	commands     map[string]command
+	todos        *tools.TodoList
+
+	askMu   sync.Mutex
+	pending map[string]chan string // session -> answer to a waiting ask_user
+
+	turn chan struct{} // One turn at a time, they share the history
 }
 
 func NewAgent(cfg *config.Config, llm llm.Provider, cm *channels.Manager) *Agent {
@@ -29,11 +39,41 @@ func NewAgent(cfg *config.Config, llm llm.Provider, cm *channels.Manager) *Agent
 		channels: cm,
 		tools:    make(map[string]tools.Tool),
 		history:  make([]openai.ChatCompletionMessage, 0),
+		commands: make(map[string]command),
+		pending:  make(map[string]chan string),
+		turn:     make(chan struct{}, 1),
 	}
 }
 
 func (a *Agent) RegisterTool(t tools.Tool) {
+	a.toolsMu.Lock()
 	a.tools[t.Name()] = t
+	a.toolsMu.Unlock()
+}
+
+// UnregisterTool removes a tool, e.g. when its MCP server goes away.
+func (a *Agent) UnregisterTool(name string) {
+	a.toolsMu.Lock()
+	delete(a.tools, name)
+	a.toolsMu.Unlock()
+}
+
+func (a *Agent) tool(name string) (tools.Tool, bool) {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+	t, ok := a.tools[name]
+	return t, ok
+}
+
+// toolList returns the registered tools as of now.
+func (a *Agent) toolList() []tools.Tool {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+	list := make([]tools.Tool, 0, len(a.tools))
+	for _, t := range a.tools {
+		list = append(list, t)
+	}
+	return list
 }
 
 func (a *Agent) SetSystemPrompt(prompt string) {
@@ -57,17 +97,43 @@ func (a *Agent) Run() {
 }
 
 func (a *Agent) handleMessage(msg channels.Message) {
+	a.handleMessageContext(context.Background(), msg, nil)
+}
+
+// handleMessageContext runs the turn for msg until it finishes or ctx is
+// done. If allow is set, the model only gets the tools it allows and slash
+// commands are not run, since they act with the agent's full privileges.
+func (a *Agent) handleMessageContext(ctx context.Context, msg channels.Message, allow func(name string) bool) {
 	log.Printf("Received message from %s: %s", msg.Sender, msg.Content)
 
-	// Add user message to history
-	a.history = append(a.history, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
-		Content: msg.Content,
-	})
+	if allow == nil && a.handleCommand(&msg) {
+		return
+	}
+	// The message answers a question the running turn is waiting for.
+	if a.deliverAnswer(msg) {
+		return
+	}
+
+	// Turns from channels, cron jobs, resource updates and ask_agent run
+	// concurrently but take turns on the history.
+	select {
+	case a.turn <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-a.turn }()
+
+	// Add user message to history. Images are only sent during this turn.
+	turnStart := len(a.history)
+	a.history = append(a.history, a.userMessage(msg))
+	defer func() { stripImages(a.history, turnStart) }()
 
 	// Prepare tools for LLM
 	llmTools := []openai.Tool{}
-	for _, t := range a.tools {
+	for _, t := range a.toolList() {
+		if allow != nil && !allow(t.Name()) {
+			continue
+		}
 		schema := t.Schema()
 		llmTools = append(llmTools, openai.Tool{
 			Type: openai.ToolTypeFunction,
@@ -79,26 +145,33 @@ func (a *Agent) handleMessage(msg channels.Message) {
 		})
 	}
 
-	ctx := context.Background()
+	session := sessionID(msg)
+	ctx = tools.WithSession(ctx, session)
+	ctx = context.WithValue(ctx, channelKey{}, msg.Address())
+	shownTodos := a.todoText(session)
 
 	// Loop to handle tool calls
 	maxTurns := 5
 	for i := 0; i < maxTurns; i++ {
+		if ctx.Err() != nil {
+			log.Printf("Turn stopped: %v", ctx.Err())
+			return
+		}
 		// Show thinking indicator
-		a.channels.ShowThinking(msg.Channel)
+		a.channels.ShowThinking(msg.Address())
 
 		// Use ChatStream for streaming response
-		stream, err := a.llm.ChatStream(ctx, a.history, llmTools)
+		stream, err := a.llm.ChatStream(ctx, a.withTodos(session), llmTools)
 		if err != nil {
 			log.Printf("LLM error: %v", err)
-			a.channels.SendToChannel(msg.Channel, "Error communicating with AI.")
+			a.channels.SendToChannel(msg.Address(), "Error communicating with AI.")
 			return
 		}
 		defer stream.Close()
 
 		var contentBuilder string
 		var toolCalls []openai.ToolCall
-		isStreamable := a.channels.IsChannelStreamable(msg.Channel)
+		isStreamable := a.channels.IsChannelStreamable(msg.Address())
 		// We don't need to send "[Agent]: " prefix here because the UI handles bubble creation.
 		// Sending it causes "Agent: " to appear inside the bubble or multiple bubbles if loop repeats.
 		// if isStreamable {
@@ -117,7 +190,7 @@ func (a *Agent) handleMessage(msg channels.Message) {
 				if delta.Content != "" {
 					contentBuilder += delta.Content
 					if isStreamable {
-						a.channels.SendTokenToChannel(msg.Channel, delta.Content)
+						a.channels.SendTokenToChannel(msg.Address(), delta.Content)
 					}
 				}
 
@@ -125,7 +198,7 @@ func (a *Agent) handleMessage(msg channels.Message) {
 				// Note: This field is available in recent go-openai versions
 				if rc := delta.ReasoningContent; rc != "" {
 					if isStreamable {
-						a.channels.SendReasoningToChannel(msg.Channel, rc)
+						a.channels.SendReasoningToChannel(msg.Address(), rc)
 					}
 				}
 
@@ -160,7 +233,11 @@ func (a *Agent) handleMessage(msg channels.Message) {
 		}
 
 		if isStreamable {
-			a.channels.SendTokenToChannel(msg.Channel, "\n")
+			a.channels.SendTokenToChannel(msg.Address(), "\n")
+		}
+		if ctx.Err() != nil {
+			log.Printf("Turn stopped: %v", ctx.Err())
+			return
 		}
 
 		// Construct the complete message
@@ -173,16 +250,20 @@ func (a *Agent) handleMessage(msg channels.Message) {
 
 		// Check for tool calls
 		if len(toolCalls) > 0 {
+			var images []tools.Image
 			for _, toolCall := range toolCalls {
 				log.Printf("Tool call: %s %s", toolCall.Function.Name, toolCall.Function.Arguments)
 
 				// Notify UI about tool execution
 				if isStreamable {
-					a.channels.SendToolCallToChannel(msg.Channel, toolCall.Function.Name, toolCall.Function.Arguments)
+					a.channels.SendToolCallToChannel(msg.Address(), toolCall.Function.Name, toolCall.Function.Arguments)
 				}
 
 				toolName := toolCall.Function.Name
-				tool, exists := a.tools[toolName]
+				tool, exists := a.tool(toolName)
+				if exists && allow != nil && !allow(toolName) {
+					exists = false
+				}
 				if !exists {
 					log.Printf("Tool not found: %s", toolName)
 					a.history = append(a.history, openai.ChatCompletionMessage{
@@ -193,13 +274,24 @@ func (a *Agent) handleMessage(msg channels.Message) {
 					continue
 				}
 
-				result, err := tool.Execute(json.RawMessage(toolCall.Function.Arguments))
+				toolCtx, attachments := tools.WithAttachments(ctx)
+				result, err := tools.Execute(toolCtx, tool, json.RawMessage(toolCall.Function.Arguments))
 				if err != nil {
 					result = fmt.Sprintf("Error: %v", err)
 					log.Printf("Tool error: %v", err)
 				} else {
 					log.Printf("Tool output: %s", result)
 				}
+				for _, f := range attachments.Files() {
+					a.channels.SendFileToChannel(msg.Address(), f.Name, f.Path)
+				}
+				for _, img := range attachments.Images() {
+					if a.llm.SupportsVision() {
+						images = append(images, img)
+					} else {
+						result += "\n" + img.Describe()
+					}
+				}
 
 				a.history = append(a.history, openai.ChatCompletionMessage{
 					Role:       openai.ChatMessageRoleTool,
@@ -207,11 +299,16 @@ func (a *Agent) handleMessage(msg channels.Message) {
 					ToolCallID: toolCall.ID,
 				})
 			}
+			shownTodos = a.showTodos(msg.Address(), session, shownTodos)
+			// Tool messages can only hold text, so images follow as a user message.
+			if len(images) > 0 {
+				a.history = append(a.history, imageMessage("Images returned by the tools above:", images))
+			}
 			// Continue loop to send tool outputs back to LLM
 		} else {
 			// Final response
 			if !isStreamable {
-				a.channels.SendToChannel(msg.Channel, contentBuilder)
+				a.channels.SendToChannel(msg.Address(), contentBuilder)
 			}
 			return
 		}
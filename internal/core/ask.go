@@ -0,0 +1,169 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"xq-agent/internal/channels"
+	"xq-agent/internal/tools"
+)
+
+const defaultAskTimeout = 10 * time.Minute
+
+type channelKey struct{}
+
+// askUser registers a pending question for session and returns the channel
+// its answer will arrive on, or nil if a question is already waiting.
+func (a *Agent) askUser(session string) chan string {
+	a.askMu.Lock()
+	defer a.askMu.Unlock()
+	if _, ok := a.pending[session]; ok {
+		return nil
+	}
+	ch := make(chan string, 1)
+	a.pending[session] = ch
+	return ch
+}
+
+func (a *Agent) cancelAsk(session string, ch chan string) {
+	a.askMu.Lock()
+	if a.pending[session] == ch {
+		delete(a.pending, session)
+	}
+	a.askMu.Unlock()
+}
+
+// deliverAnswer hands msg to an ask_user call waiting in its session and
+// reports whether there was one. Injected messages never answer; they start
+// a turn of their own.
+func (a *Agent) deliverAnswer(msg channels.Message) bool {
+	if msg.Injected {
+		return false
+	}
+	session := sessionID(msg)
+	a.askMu.Lock()
+	ch, ok := a.pending[session]
+	delete(a.pending, session)
+	a.askMu.Unlock()
+	if !ok {
+		return false
+	}
+	ch <- msg.Content
+	return true
+}
+
+// AskUserTool lets the model ask the user a question in the middle of a task
+// and continue with the answer, instead of ending the turn.
+type AskUserTool struct {
+	agent   *Agent
+	timeout time.Duration
+}
+
+// AskUserTool returns the ask_user tool. Questions wait for timeout (default
+// 10 minutes) before the model is told that nobody answered.
+func (a *Agent) AskUserTool(timeout time.Duration) *AskUserTool {
+	if timeout <= 0 {
+		timeout = defaultAskTimeout
+	}
+	return &AskUserTool{agent: a, timeout: timeout}
+}
+
+func (t *AskUserTool) Name() string { return "ask_user" }
+func (t *AskUserTool) Description() string {
+	return "Ask the user a question and wait for the answer, then continue the task. " +
+		"Use it when a decision or missing detail blocks progress; do not ask about things you can find out yourself."
+}
+func (t *AskUserTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"question": map[string]interface{}{
+				"type": "string",
+			},
+			"choices": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Suggested answers; the user may pick one by number or answer freely",
+			},
+		},
+		"required": []string{"question"},
+	}
+}
+
+func (t *AskUserTool) Execute(args json.RawMessage) (string, error) {
+	return "", fmt.Errorf("ask_user can only be used in a conversation")
+}
+func (t *AskUserTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Question string   `json:"question"`
+		Choices  []string `json:"choices"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(input.Question) == "" {
+		return "", fmt.Errorf("question is required")
+	}
+	if _, ok := ctx.Value(channelKey{}).(string); !ok {
+		return t.Execute(args)
+	}
+
+	text := input.Question
+	for i, c := range input.Choices {
+		text += fmt.Sprintf("\n%d. %s", i+1, c)
+	}
+	answer, err := t.agent.Ask(ctx, text, t.timeout)
+	if err == ErrNoAnswer {
+		return fmt.Sprintf("No answer within %s. Continue with a sensible default and say which one you chose, or stop and wait for the user.", t.timeout), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// A number picks one of the choices.
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(input.Choices) {
+		return fmt.Sprintf("The user chose: %s", input.Choices[n-1]), nil
+	}
+	return fmt.Sprintf("The user answered: %s", answer), nil
+}
+
+// ErrNoAnswer is returned by Ask when the user did not answer in time.
+var ErrNoAnswer = errors.New("no answer")
+
+// Ask sends question to the conversation ctx belongs to and waits up to
+// timeout for the user's reply. It serves components that need input in
+// the middle of a tool call, such as MCP servers asking for details.
+func (a *Agent) Ask(ctx context.Context, question string, timeout time.Duration) (string, error) {
+	channel, ok := ctx.Value(channelKey{}).(string)
+	if !ok {
+		return "", fmt.Errorf("not in a conversation")
+	}
+	if timeout <= 0 {
+		timeout = defaultAskTimeout
+	}
+	session := tools.SessionFrom(ctx)
+	answers := a.askUser(session)
+	if answers == nil {
+		return "", fmt.Errorf("another question is already waiting for an answer")
+	}
+	defer a.cancelAsk(session, answers)
+
+	a.channels.SendToChannel(channel, question)
+	log.Printf("Waiting for the answer to %q in %s", question, session)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case answer := <-answers:
+		return strings.TrimSpace(answer), nil
+	case <-timer.C:
+		return "", ErrNoAnswer
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
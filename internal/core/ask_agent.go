@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"xq-agent/internal/channels"
+	"xq-agent/internal/tools"
+)
+
+// Tools returns the registered tools as of now.
+func (a *Agent) Tools() []tools.Tool {
+	return a.toolList()
+}
+
+// AskAgentTool runs a whole agent turn, with the tools allow permits and
+// all skills, and returns the answer. It is offered to MCP clients, whose
+// conversation goes through out.
+type AskAgentTool struct {
+	agent *Agent
+	out   *channels.CaptureChannel
+	allow func(name string) bool
+	busy  chan struct{} // One call at a time, they share out
+}
+
+// AskAgentTool returns the ask_agent tool. out must be registered with the
+// agent's channel manager. allow decides which tools the turns may use, so
+// that they get no more than the client could call itself; slash commands
+// in its messages are passed to the model as text.
+func (a *Agent) AskAgentTool(out *channels.CaptureChannel, allow func(name string) bool) *AskAgentTool {
+	return &AskAgentTool{agent: a, out: out, allow: allow, busy: make(chan struct{}, 1)}
+}
+
+func (t *AskAgentTool) Name() string { return "ask_agent" }
+func (t *AskAgentTool) Description() string {
+	return "Give xq-agent a task in natural language. It plans and uses its own tools, skills and scheduler as needed, then returns its answer. " +
+		"The conversation continues across calls."
+}
+func (t *AskAgentTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "The task or question",
+			},
+		},
+		"required": []string{"message"},
+	}
+}
+
+func (t *AskAgentTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *AskAgentTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(input.Message) == "" {
+		return "", fmt.Errorf("message is required")
+	}
+
+	select {
+	case t.busy <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-t.busy }()
+	t.out.Take()
+	t.agent.handleMessageContext(ctx, channels.Message{
+		ID:      "mcp-ask",
+		Content: input.Message,
+		Sender:  "mcp_client",
+		Channel: t.out.Name(),
+	}, t.allow)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	answer := t.out.Take()
+	if answer == "" {
+		return "The agent finished without an answer.", nil
+	}
+	return answer, nil
+}
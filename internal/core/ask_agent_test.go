@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"xq-agent/internal/channels"
+	"xq-agent/internal/config"
+	"xq-agent/internal/llm"
+)
+
+// fakeModel is an OpenAI-compatible server that answers every request with
+// "ok: " and the last user message, and records how many requests overlap.
+type fakeModel struct {
+	mu       sync.Mutex
+	active   int
+	overlaps int
+	received []string
+}
+
+func (m *fakeModel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	last := req.Messages[len(req.Messages)-1].Content
+
+	m.mu.Lock()
+	m.active++
+	if m.active > 1 {
+		m.overlaps++
+	}
+	m.received = append(m.received, last)
+	m.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	m.mu.Lock()
+	m.active--
+	m.mu.Unlock()
+
+	chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+		Object:  "chat.completion.chunk",
+		Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Role: "assistant", Content: "ok: " + last}}},
+	})
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", chunk)
+}
+
+// testAgent returns an agent backed by a fake model, with an ask_agent tool
+// that may use no tools.
+func testAgent(t *testing.T) (*Agent, *AskAgentTool, *fakeModel) {
+	t.Helper()
+	model := &fakeModel{}
+	srv := httptest.NewServer(model)
+	t.Cleanup(srv.Close)
+
+	cm := channels.NewManager()
+	out := channels.NewCaptureChannel("mcp")
+	cm.Register(out)
+	cm.Register(channels.NewCaptureChannel("chat"))
+	a := NewAgent(&config.Config{}, llm.NewOpenAI(config.LLMConfig{BaseURL: srv.URL, Model: "test"}), cm)
+	a.SetSystemPrompt("You are a test.")
+	return a, a.AskAgentTool(out, func(string) bool { return false }), model
+}
+
+func askAgent(t *testing.T, tool *AskAgentTool, message string) string {
+	t.Helper()
+	args, _ := json.Marshal(map[string]string{"message": message})
+	out, err := tool.ExecuteContext(context.Background(), args)
+	if err != nil {
+		t.Fatalf("ask_agent %q: %v", message, err)
+	}
+	return out
+}
+
+func TestAskAgentDoesNotRunCommands(t *testing.T) {
+	a, tool, model := testAgent(t)
+	var ran []string
+	a.RegisterCommand("undo", "Undo changes", func(session, args string) (string, error) {
+		ran = append(ran, "undo "+args)
+		return "undone", nil
+	})
+	a.RegisterPrompt("review", "Review a file", func(session, args string) (string, error) {
+		ran = append(ran, "review "+args)
+		return "Review " + args, nil
+	})
+
+	for _, message := range []string{"/undo all", "/review main.go", "/help"} {
+		if got := askAgent(t, tool, message); got != "ok: "+message {
+			t.Errorf("ask_agent %q = %q", message, got)
+		}
+	}
+	if len(ran) != 0 {
+		t.Errorf("ask_agent ran commands: %q", ran)
+	}
+
+	// Users of the agent's own channels still have them.
+	a.handleMessage(channels.Message{Content: "/undo all", Channel: "chat"})
+	if len(ran) != 1 || ran[0] != "undo all" {
+		t.Errorf("a channel message ran %q", ran)
+	}
+	if len(model.received) != 3 {
+		t.Errorf("the model received %q", model.received)
+	}
+}
+
+func TestTurnsTakeTurns(t *testing.T) {
+	a, tool, model := testAgent(t)
+
+	// Channel messages, injected cron messages and ask_agent calls arrive
+	// at the same time.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			a.handleMessage(channels.Message{Content: fmt.Sprintf("message %d", i), Channel: "chat", Injected: i%2 == 0})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			message := fmt.Sprintf("task %d", i)
+			if got := askAgent(t, tool, message); got != "ok: "+message {
+				t.Errorf("ask_agent %q = %q", message, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if model.overlaps != 0 {
+		t.Errorf("%d requests overlapped", model.overlaps)
+	}
+	// Every user message is directly followed by its answer.
+	history := a.history[1:]
+	if len(history) != 16 {
+		t.Fatalf("history has %d messages, want 16", len(history))
+	}
+	for i := 0; i < len(history); i += 2 {
+		user, answer := history[i], history[i+1]
+		if user.Role != openai.ChatMessageRoleUser || answer.Content != "ok: "+user.Content {
+			t.Errorf("history[%d:%d] = %q, %q", i+1, i+3, user.Content, answer.Content)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"xq-agent/internal/channels"
+)
+
+// CommandFunc handles a slash command typed by the user. session identifies
+// the conversation and args is the text after the command name.
+type CommandFunc func(session, args string) (string, error)
+
+// PromptFunc expands a slash command into the text the model receives in
+// place of the user's message, e.g. an MCP prompt template.
+type PromptFunc func(session, args string) (string, error)
+
+type command struct {
+	description string
+	run         CommandFunc
+	prompt      PromptFunc
+}
+
+// RegisterCommand makes "/name" available in every channel. Commands are
+// answered directly and never reach the model.
+func (a *Agent) RegisterCommand(name, description string, fn CommandFunc) {
+	a.commandsMu.Lock()
+	a.commands[name] = command{description: description, run: fn}
+	a.commandsMu.Unlock()
+}
+
+// RegisterPrompt makes "/name" expand into a message for the model.
+func (a *Agent) RegisterPrompt(name, description string, fn PromptFunc) {
+	a.commandsMu.Lock()
+	a.commands[name] = command{description: description, prompt: fn}
+	a.commandsMu.Unlock()
+}
+
+// UnregisterCommand removes a command or prompt.
+func (a *Agent) UnregisterCommand(name string) {
+	a.commandsMu.Lock()
+	delete(a.commands, name)
+	a.commandsMu.Unlock()
+}
+
+// handleCommand runs msg as a slash command and reports whether it was
+// answered. Prompts replace msg.Content with their expansion and are left
+// for the model, as are unknown commands, since users also type paths.
+func (a *Agent) handleCommand(msg *channels.Message) bool {
+	text := strings.TrimSpace(msg.Content)
+	if !strings.HasPrefix(text, "/") {
+		return false
+	}
+	name, args, _ := strings.Cut(text[1:], " ")
+
+	if name == "help" {
+		a.channels.SendToChannel(msg.Address(), a.commandHelp())
+		return true
+	}
+	a.commandsMu.RLock()
+	cmd, ok := a.commands[name]
+	a.commandsMu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	log.Printf("Command /%s from %s", name, msg.Channel)
+	if cmd.prompt != nil {
+		expanded, err := cmd.prompt(sessionID(*msg), strings.TrimSpace(args))
+		if err != nil {
+			a.channels.SendToChannel(msg.Address(), "Error: "+err.Error())
+			return true
+		}
+		msg.Content = expanded
+		return false
+	}
+	out, err := cmd.run(sessionID(*msg), strings.TrimSpace(args))
+	if err != nil {
+		out = strings.TrimSpace(out + "\nError: " + err.Error())
+	}
+	a.channels.SendToChannel(msg.Address(), out)
+	return true
+}
+
+func (a *Agent) commandHelp() string {
+	a.commandsMu.RLock()
+	defer a.commandsMu.RUnlock()
+	names := make([]string, 0, len(a.commands))
+	for name := range a.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("Available commands:\n")
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("/%s - %s\n", name, a.commands[name].description))
+	}
+	return sb.String()
+}
+
+// sessionID identifies the conversation a message belongs to: its
+// channel, and the chat on channels with several.
+func sessionID(msg channels.Message) string {
+	return msg.Address()
+}
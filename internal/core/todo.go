@@ -0,0 +1,51 @@
+package core
+
+import (
+	"github.com/sashabaranov/go-openai"
+	"xq-agent/internal/channels"
+	"xq-agent/internal/tools"
+)
+
+// SetTodoList connects the list behind todo_write, so the agent can show it
+// to the user and remind the model of it on every turn.
+func (a *Agent) SetTodoList(l *tools.TodoList) {
+	a.todos = l
+}
+
+// todoText returns the session's list as text, "" when there is none.
+func (a *Agent) todoText(session string) string {
+	if a.todos == nil {
+		return ""
+	}
+	return a.todos.Format(session)
+}
+
+// withTodos returns the messages for the next request: the history followed
+// by the current todo list, which is not stored in the history itself.
+func (a *Agent) withTodos(session string) []openai.ChatCompletionMessage {
+	list := a.todoText(session)
+	if list == "" {
+		return a.history
+	}
+	messages := make([]openai.ChatCompletionMessage, len(a.history), len(a.history)+1)
+	copy(messages, a.history)
+	return append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "Your todo list for the current task (update it with todo_write as you go):\n" + list,
+	})
+}
+
+// showTodos sends the session's list to the channel if it differs from
+// shown, and returns the list now displayed.
+func (a *Agent) showTodos(channel, session, shown string) string {
+	list := a.todoText(session)
+	if list == shown {
+		return shown
+	}
+	var todos []channels.Todo
+	for _, t := range a.todos.Get(session) {
+		todos = append(todos, channels.Todo{Content: t.Content, Status: t.Status})
+	}
+	a.channels.SendTodosToChannel(channel, todos)
+	return list
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+
+	"xq-agent/internal/channels"
+	"xq-agent/internal/tools"
+	"github.com/sashabaranov/go-openai"
+)
+
+// imageMessage builds a user message showing images to the model. Each image
+// is preceded by a text part naming it, which is all that remains once
+// stripImages has run.
+func imageMessage(intro string, images []tools.Image) openai.ChatCompletionMessage {
+	parts := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: intro}}
+	for _, img := range images {
+		parts = append(parts,
+			openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: fmt.Sprintf("[Image %s: %dx%d]", img.Source, img.Width, img.Height),
+			},
+			openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{
+					URL:    "data:" + img.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+					Detail: openai.ImageURLDetailAuto,
+				},
+			},
+		)
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: parts}
+}
+
+// userMessage turns an incoming message into a history entry, attaching its
+// images when the model can see them.
+func (a *Agent) userMessage(msg channels.Message) openai.ChatCompletionMessage {
+	if len(msg.Images) == 0 {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: msg.Content}
+	}
+
+	var images []tools.Image
+	for i, in := range msg.Images {
+		img, err := tools.LoadImage(in.Data, fmt.Sprintf("attachment %d", i+1), tools.DefaultImageSize)
+		if err != nil {
+			log.Printf("Skipping image from %s: %v", msg.Sender, err)
+			continue
+		}
+		images = append(images, img)
+	}
+	if !a.llm.SupportsVision() {
+		text := msg.Content
+		for _, img := range images {
+			text += "\n" + img.Describe()
+		}
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text}
+	}
+	return imageMessage(msg.Content, images)
+}
+
+// stripImages replaces image parts in history[from:] with their text labels,
+// so that images are sent once instead of with every later request.
+func stripImages(history []openai.ChatCompletionMessage, from int) {
+	for i := from; i < len(history); i++ {
+		if len(history[i].MultiContent) == 0 {
+			continue
+		}
+		var texts []string
+		for _, part := range history[i].MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText && part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		history[i].MultiContent = nil
+		history[i].Content = strings.Join(texts, "\n")
+	}
+}
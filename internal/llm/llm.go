@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"strings"
 
 	"xq-agent/internal/config"
 	"github.com/sashabaranov/go-openai"
@@ -10,11 +11,33 @@ import (
 type Provider interface {
 	Chat(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionResponse, error)
 	ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (*openai.ChatCompletionStream, error)
+	// SupportsVision reports whether messages may contain image parts.
+	SupportsVision() bool
+}
+
+// Options limit a single completion. Zero values keep the defaults.
+type Options struct {
+	MaxTokens   int
+	Temperature float32
+	Stop        []string
+}
+
+type optionsKey struct{}
+
+// WithOptions applies o to the completions requested with ctx.
+func WithOptions(ctx context.Context, o Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, o)
+}
+
+func optionsFrom(ctx context.Context) Options {
+	o, _ := ctx.Value(optionsKey{}).(Options)
+	return o
 }
 
 type OpenAIProvider struct {
 	client *openai.Client
 	model  string
+	vision bool
 }
 
 func NewOpenAI(cfg config.LLMConfig) *OpenAIProvider {
@@ -25,13 +48,39 @@ func NewOpenAI(cfg config.LLMConfig) *OpenAIProvider {
 	return &OpenAIProvider{
 		client: openai.NewClientWithConfig(c),
 		model:  cfg.Model,
+		vision: supportsVision(cfg),
 	}
 }
 
+// visionModels are name fragments of common multimodal models.
+var visionModels = []string{
+	"gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-4-vision", "gpt-5",
+	"claude", "gemini", "vision", "-vl", "vl-", "glm-4v", "llava", "pixtral",
+}
+
+func supportsVision(cfg config.LLMConfig) bool {
+	if cfg.Vision != nil {
+		return *cfg.Vision
+	}
+	model := strings.ToLower(cfg.Model)
+	for _, m := range visionModels {
+		if strings.Contains(model, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *OpenAIProvider) SupportsVision() bool { return p.vision }
+
 func (p *OpenAIProvider) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionResponse, error) {
+	o := optionsFrom(ctx)
 	req := openai.ChatCompletionRequest{
-		Model:    p.model,
-		Messages: messages,
+		Model:       p.model,
+		Messages:    messages,
+		MaxTokens:   o.MaxTokens,
+		Temperature: o.Temperature,
+		Stop:        o.Stop,
 	}
 	if len(tools) > 0 {
 		req.Tools = tools
@@ -40,10 +89,14 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []openai.ChatComplet
 }
 
 func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (*openai.ChatCompletionStream, error) {
+	o := optionsFrom(ctx)
 	req := openai.ChatCompletionRequest{
-		Model:    p.model,
-		Messages: messages,
-		Stream:   true,
+		Model:       p.model,
+		Messages:    messages,
+		Stream:      true,
+		MaxTokens:   o.MaxTokens,
+		Temperature: o.Temperature,
+		Stop:        o.Stop,
 	}
 	if len(tools) > 0 {
 		req.Tools = tools
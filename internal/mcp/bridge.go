@@ -0,0 +1,194 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"xq-agent/internal/tools"
+)
+
+// maxToolName is the longest function name model APIs accept.
+const maxToolName = 64
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ToolName is the name a server's tool is registered under: server__tool,
+// with characters model APIs reject replaced by underscores.
+func ToolName(server, tool string) string {
+	name := invalidNameChars.ReplaceAllString(server+"__"+tool, "_")
+	if len(name) > maxToolName {
+		name = name[:maxToolName]
+	}
+	return name
+}
+
+// uniqueToolName returns ToolName(server, tool) unless it is taken, which
+// happens when sanitizing or truncating maps different names to the same
+// one. The name then ends in a hash of the server and tool names instead.
+func uniqueToolName(server, tool string, taken map[string]bool) string {
+	name := ToolName(server, tool)
+	if !taken[name] {
+		return name
+	}
+	sum := sha256.Sum256([]byte(server + "\x00" + tool))
+	for i := 1; ; i++ {
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		if i > 1 {
+			suffix += strconv.Itoa(i)
+		}
+		candidate := name[:min(len(name), maxToolName-len(suffix))] + suffix
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// ToolAdapter makes an MCP tool usable as an agent tool.
+type ToolAdapter struct {
+	name    string // Registered name, see uniqueToolName
+	server  string
+	client  *Client
+	tool    Tool
+	timeout time.Duration // Without progress, none if zero
+}
+
+func NewToolAdapter(name, server string, c *Client, t Tool, timeout time.Duration) *ToolAdapter {
+	return &ToolAdapter{name: name, server: server, client: c, tool: t, timeout: timeout}
+}
+
+func (a *ToolAdapter) Name() string { return a.name }
+func (a *ToolAdapter) Description() string {
+	desc := a.tool.Description
+	if desc == "" {
+		desc = a.tool.Title
+	}
+	if desc == "" {
+		desc = a.tool.Name
+	}
+	return fmt.Sprintf("[MCP server %s] %s", a.server, desc)
+}
+
+// Schema is the tool's inputSchema as sent by the server.
+func (a *ToolAdapter) Schema() interface{} {
+	if len(a.tool.InputSchema) == 0 || string(a.tool.InputSchema) == "null" {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return a.tool.InputSchema
+}
+
+func (a *ToolAdapter) Execute(args json.RawMessage) (string, error) {
+	return a.ExecuteContext(context.Background(), args)
+}
+func (a *ToolAdapter) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var lastProgress atomic.Int64
+	var expired atomic.Bool
+	lastProgress.Store(time.Now().UnixNano())
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go a.watch(ctx, cancel, &lastProgress, &expired)
+	}
+	progress := func(p Progress) {
+		lastProgress.Store(time.Now().UnixNano())
+		log.Printf("[MCP %s] %s progress %v/%v %s", a.server, a.tool.Name, p.Progress, p.Total, p.Message)
+	}
+	result, err := a.client.CallTool(ctx, a.tool.Name, args, progress)
+	if err != nil && expired.Load() {
+		return "", fmt.Errorf("%s: no result after %s, the call was cancelled", a.Name(), a.timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", a.Name(), err)
+	}
+	text := RenderContent(ctx, result.Content)
+	if text == "" && len(result.StructuredContent) > 0 {
+		text = string(result.StructuredContent)
+	}
+	if result.IsError {
+		if text == "" {
+			text = "the tool reported an error"
+		}
+		return "", fmt.Errorf("%s", text)
+	}
+	return text, nil
+}
+
+// watch cancels the call once it has gone a.timeout without progress. Time
+// the server spends waiting for the client, e.g. for the user to answer a
+// question, does not count.
+func (a *ToolAdapter) watch(ctx context.Context, cancel context.CancelFunc, lastProgress *atomic.Int64, expired *atomic.Bool) {
+	interval := min(a.timeout/10, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if a.client.answering.Load() > 0 {
+				lastProgress.Store(now.UnixNano())
+				continue
+			}
+			if now.Sub(time.Unix(0, lastProgress.Load())) >= a.timeout {
+				expired.Store(true)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// RenderContent turns MCP content into text for the model. Images are
+// attached to the tool result when the caller collects attachments.
+func RenderContent(ctx context.Context, content []Content) string {
+	var parts []string
+	for _, c := range content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "image":
+			data, err := base64.StdEncoding.DecodeString(c.Data)
+			if err != nil {
+				parts = append(parts, fmt.Sprintf("[invalid %s image]", c.MIMEType))
+				continue
+			}
+			img, err := tools.LoadImage(data, "MCP "+c.MIMEType, tools.DefaultImageSize)
+			if err != nil {
+				parts = append(parts, fmt.Sprintf("[%s image, %d bytes: %v]", c.MIMEType, len(data), err))
+				continue
+			}
+			tools.AttachImage(ctx, img)
+			parts = append(parts, fmt.Sprintf("[image %dx%d attached]", img.Width, img.Height))
+		case "audio":
+			parts = append(parts, fmt.Sprintf("[%s audio, not shown]", c.MIMEType))
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("Resource: %s (%s)", c.Name, c.URI))
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			r := c.Resource
+			switch {
+			case r.Text != "":
+				parts = append(parts, fmt.Sprintf("Resource %s:\n%s", r.URI, r.Text))
+			case strings.HasPrefix(r.MIMEType, "image/"):
+				parts = append(parts, RenderContent(ctx, []Content{{Type: "image", Data: r.Blob, MIMEType: r.MIMEType}}))
+			default:
+				parts = append(parts, fmt.Sprintf("[binary resource %s, %s]", r.URI, r.MIMEType))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[unsupported %s content]", c.Type))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
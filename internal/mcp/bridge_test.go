@@ -0,0 +1,93 @@
+package mcp
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"xq-agent/internal/config"
+	"xq-agent/internal/core"
+	"xq-agent/internal/tools"
+)
+
+// fakeRegistry records the registered tools by name.
+type fakeRegistry struct {
+	tools map[string]*ToolAdapter
+}
+
+func (r *fakeRegistry) RegisterTool(t tools.Tool)  { r.tools[t.Name()] = t.(*ToolAdapter) }
+func (r *fakeRegistry) UnregisterTool(name string) { delete(r.tools, name) }
+func (r *fakeRegistry) RegisterPrompt(name, description string, fn core.PromptFunc) {
+}
+func (r *fakeRegistry) UnregisterCommand(name string) {}
+
+func (r *fakeRegistry) names() []string {
+	var names []string
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func toolList(names ...string) []Tool {
+	list := make([]Tool, len(names))
+	for i, name := range names {
+		list[i] = Tool{Name: name}
+	}
+	return list
+}
+
+func TestToolName(t *testing.T) {
+	if got := ToolName("files", "read.file"); got != "files__read_file" {
+		t.Errorf("ToolName = %q", got)
+	}
+	if got := ToolName("s", strings.Repeat("x", 100)); len(got) != maxToolName {
+		t.Errorf("ToolName is %d characters, want %d", len(got), maxToolName)
+	}
+}
+
+func TestRegisterUniqueNames(t *testing.T) {
+	reg := &fakeRegistry{tools: make(map[string]*ToolAdapter)}
+	m := NewManager(config.MCPConfig{}, reg, nil, nil)
+	a := &server{name: "a"}
+	b := &server{name: "a__b"}
+	m.servers = map[string]*server{"a": a, "a__b": b}
+
+	long := strings.Repeat("x", 70)
+	m.register(a, toolList("read.file", "read_file", "b__c", long+"1", long+"2"))
+	m.register(b, toolList("c"))
+
+	names := reg.names()
+	if len(names) != 6 {
+		t.Fatalf("registered %v, want 6 distinct names", names)
+	}
+	for _, name := range names {
+		if len(name) > maxToolName {
+			t.Errorf("%q is longer than %d characters", name, maxToolName)
+		}
+	}
+	// The first tool to want a name gets it, and calls reach the right tool.
+	if got := reg.tools["a__read_file"].tool.Name; got != "read.file" {
+		t.Errorf("a__read_file calls %q", got)
+	}
+	if got := reg.tools["a__b__c"].tool.Name; got != "b__c" {
+		t.Errorf("a__b__c calls %q", got)
+	}
+	if got := b.tools["c"]; got == "a__b__c" || !strings.HasPrefix(got, "a__b__c_") {
+		t.Errorf("a__b's tool c registered as %q", got)
+	}
+
+	// Names stay the same when the tool list changes.
+	before := a.tools["read_file"]
+	m.register(a, toolList("read_file", "new.tool"))
+	if a.tools["read_file"] != before {
+		t.Errorf("read_file renamed from %q to %q", before, a.tools["read_file"])
+	}
+	if _, ok := reg.tools["a__read_file"]; ok {
+		t.Error("the removed tool is still registered")
+	}
+	if got := reg.names(); len(got) != 3 {
+		t.Errorf("registered %v after the change, want 3 tools", got)
+	}
+}
@@ -3,36 +3,486 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
-// Tool represents an MCP tool definition
-type Tool struct {
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	InputSchema json.RawMessage `json:"inputSchema"`
+// clientInfo identifies the agent to MCP servers.
+var clientInfo = Implementation{Name: "xq-agent", Version: "1.0"}
+
+// ErrClosed is returned for requests on a client whose connection is gone.
+var ErrClosed = errors.New("connection closed")
+
+// sessionTransport is implemented by transports that need to know when the
+// session is established and which protocol version it uses.
+type sessionTransport interface {
+	started(protocolVersion string)
+}
+
+// relatedTransport is implemented by transports that can tell which client
+// request a server request was sent for.
+type relatedTransport interface {
+	relatedRequest(id json.RawMessage) (json.RawMessage, bool)
 }
 
-// Client is a simplified MCP client structure
-// In a real implementation, this would handle JSON-RPC over Stdio or SSE
+// RequestHandler answers a request the server sends to the client, such as
+// sampling/createMessage. Its result is sent back as the response.
+type RequestHandler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// Client talks JSON-RPC 2.0 to one MCP server. Create it with NewClient,
+// register handlers, then call Initialize before anything else.
 type Client struct {
-	ServerName string
+	Name string // Server name from the configuration, used in logs
+
+	// Filled in by Initialize.
+	ServerInfo      Implementation
+	Capabilities    ServerCapabilities
+	Instructions    string
+	ProtocolVersion string
+
+	t        Transport
+	nextID   atomic.Int64
+	handlers map[string]RequestHandler
+	notify   func(method string, params json.RawMessage)
+
+	mu       sync.Mutex
+	pending  map[int64]chan *message
+	progress map[string]func(Progress)
+	calls    map[int64]context.Context // Running tool calls
+
+	answering atomic.Int32 // Server requests being handled
+
+	done     chan struct{}
+	doneOnce sync.Once
+	err      error
 }
 
-func NewClient(serverName string) *Client {
+func NewClient(name string, t Transport) *Client {
 	return &Client{
-		ServerName: serverName,
+		Name:     name,
+		t:        t,
+		handlers: make(map[string]RequestHandler),
+		pending:  make(map[int64]chan *message),
+		progress: make(map[string]func(Progress)),
+		calls:    make(map[int64]context.Context),
+		done:     make(chan struct{}),
+	}
+}
+
+// Handle registers the handler for requests the server sends to the client.
+// It must be called before Initialize.
+func (c *Client) Handle(method string, h RequestHandler) {
+	c.handlers[method] = h
+}
+
+// OnNotification sets a function called for server notifications other than
+// progress and log messages, e.g. notifications/tools/list_changed. It must
+// be set before Initialize.
+func (c *Client) OnNotification(fn func(method string, params json.RawMessage)) {
+	c.notify = fn
+}
+
+// Initialize starts reading from the server and performs the initialize
+// handshake.
+func (c *Client) Initialize(ctx context.Context) error {
+	go c.readLoop()
+
+	capabilities := map[string]interface{}{}
+	for method, capability := range map[string]string{
+		"roots/list":             "roots",
+		"sampling/createMessage": "sampling",
+		"elicitation/create":     "elicitation",
+	} {
+		if _, ok := c.handlers[method]; ok {
+			capabilities[capability] = map[string]interface{}{}
+		}
+	}
+	var result initializeResult
+	err := c.request(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    capabilities,
+		"clientInfo":      clientInfo,
+	}, &result, nil)
+	if err != nil {
+		return fmt.Errorf("initialize: %v", err)
+	}
+	supported := false
+	for _, v := range supportedVersions {
+		supported = supported || v == result.ProtocolVersion
+	}
+	if !supported {
+		return fmt.Errorf("server uses unsupported protocol version %q", result.ProtocolVersion)
+	}
+	c.ProtocolVersion = result.ProtocolVersion
+	c.ServerInfo = result.ServerInfo
+	c.Capabilities = result.Capabilities
+	c.Instructions = result.Instructions
+	// The negotiated version goes on every later request, the
+	// notification included.
+	if st, ok := c.t.(sessionTransport); ok {
+		st.started(c.ProtocolVersion)
+	}
+	return c.Notify(ctx, "notifications/initialized", nil)
+}
+
+// Done is closed when the connection to the server has ended.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err returns why the connection ended, or nil while it is open.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
 	}
 }
 
-// ListTools would request the available tools from the MCP server
+// Close shuts the connection down.
+func (c *Client) Close() error {
+	c.fail(ErrClosed)
+	return c.t.Close()
+}
+
+func (c *Client) fail(err error) {
+	c.doneOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+// Ping checks that the server is responsive.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.request(ctx, "ping", nil, nil, nil)
+}
+
+// ListTools returns all tools of the server.
 func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
-	// Placeholder: In a real app, send 'tools/list' request
-	return []Tool{}, nil
+	return listAll[Tool](ctx, c, "tools/list", "tools")
+}
+
+// ListResources returns all resources of the server.
+func (c *Client) ListResources(ctx context.Context) ([]ResourceInfo, error) {
+	return listAll[ResourceInfo](ctx, c, "resources/list", "resources")
+}
+
+// ListResourceTemplates returns the server's templates for parameterized
+// resources.
+func (c *Client) ListResourceTemplates(ctx context.Context) ([]ResourceTemplate, error) {
+	return listAll[ResourceTemplate](ctx, c, "resources/templates/list", "resourceTemplates")
+}
+
+// ReadResource returns the contents of the resource at uri. A directory-like
+// resource may have several.
+func (c *Client) ReadResource(ctx context.Context, uri string) ([]Resource, error) {
+	var result struct {
+		Contents []Resource `json:"contents"`
+	}
+	if err := c.request(ctx, "resources/read", map[string]interface{}{"uri": uri}, &result, nil); err != nil {
+		return nil, err
+	}
+	return result.Contents, nil
+}
+
+// Subscribe asks the server to send notifications/resources/updated when the
+// resource at uri changes.
+func (c *Client) Subscribe(ctx context.Context, uri string) error {
+	return c.request(ctx, "resources/subscribe", map[string]interface{}{"uri": uri}, nil, nil)
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, uri string) error {
+	return c.request(ctx, "resources/unsubscribe", map[string]interface{}{"uri": uri}, nil, nil)
+}
+
+// ListPrompts returns all prompts of the server.
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	return listAll[Prompt](ctx, c, "prompts/list", "prompts")
 }
 
-// CallTool executes a tool on the MCP server
-func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
-	// Placeholder: In a real app, send 'tools/call' request
-	return fmt.Sprintf("Executed MCP tool %s on server %s (Placeholder)", name, c.ServerName), nil
+// GetPrompt expands a prompt with the given arguments.
+func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]string) (*GetPromptResult, error) {
+	params := map[string]interface{}{"name": name}
+	if len(args) > 0 {
+		params["arguments"] = args
+	}
+	var result GetPromptResult
+	if err := c.request(ctx, "prompts/get", params, &result, nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// listAll runs a list method, following pagination, and collects the items
+// under key from every page.
+func listAll[T any](ctx context.Context, c *Client, method, key string) ([]T, error) {
+	var all []T
+	cursor := ""
+	for {
+		var params map[string]interface{}
+		if cursor != "" {
+			params = map[string]interface{}{"cursor": cursor}
+		}
+		var page map[string]json.RawMessage
+		if err := c.request(ctx, method, params, &page, nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		var items []T
+		if raw, ok := page[key]; ok {
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return nil, fmt.Errorf("invalid %s result: %v", method, err)
+			}
+		}
+		all = append(all, items...)
+		var next string
+		json.Unmarshal(page["nextCursor"], &next)
+		if next == "" || next == cursor {
+			return all, nil
+		}
+		cursor = next
+	}
+}
+
+// CallTool runs a tool on the server. args is the JSON object of arguments;
+// progress, if not nil, receives the server's progress notifications.
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage, progress func(Progress)) (*CallToolResult, error) {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	err := c.request(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	}, &result, progress)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Notify sends a notification to the server.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	return c.send(ctx, msg)
+}
+
+func (c *Client) send(ctx context.Context, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return c.t.Send(ctx, data)
+}
+
+// request sends a request and decodes the result into result (if not nil).
+// When ctx ends first, the server is told to cancel the request.
+func (c *Client) request(ctx context.Context, method string, params map[string]interface{}, result interface{}, progress func(Progress)) error {
+	id := c.nextID.Add(1)
+	ch := make(chan *message, 1)
+	token := strconv.FormatInt(id, 10)
+	c.mu.Lock()
+	c.pending[id] = ch
+	if progress != nil {
+		c.progress[token] = progress
+	}
+	if method == "tools/call" {
+		c.calls[id] = ctx
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		delete(c.progress, token)
+		delete(c.calls, id)
+		c.mu.Unlock()
+	}()
+
+	if progress != nil {
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		params["_meta"] = map[string]interface{}{"progressToken": id}
+	}
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	if err := c.send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("invalid %s result: %v", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		c.Notify(context.Background(), "notifications/cancelled", map[string]interface{}{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return ctx.Err()
+	case <-c.done:
+		return c.err
+	}
+}
+
+// readLoop dispatches messages from the server until the transport fails.
+func (c *Client) readLoop() {
+	for {
+		raw, err := c.t.Receive()
+		if err != nil {
+			c.fail(fmt.Errorf("server %s disconnected: %v", c.Name, err))
+			return
+		}
+		var batch []message
+		if len(raw) > 0 && raw[0] == '[' {
+			err = json.Unmarshal(raw, &batch)
+		} else {
+			batch = make([]message, 1)
+			err = json.Unmarshal(raw, &batch[0])
+		}
+		if err != nil {
+			log.Printf("[MCP %s] invalid message: %v", c.Name, err)
+			continue
+		}
+		for i := range batch {
+			c.dispatch(&batch[i])
+		}
+	}
+}
+
+func (c *Client) dispatch(m *message) {
+	switch {
+	case m.isRequest():
+		go c.answer(m)
+	case m.isNotification():
+		c.notification(m)
+	case len(m.ID) > 0:
+		id, err := strconv.ParseInt(string(m.ID), 10, 64)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		c.mu.Unlock()
+		if ok {
+			ch <- m
+		}
+	}
+}
+
+func (c *Client) notification(m *message) {
+	switch m.Method {
+	case "notifications/progress":
+		var p struct {
+			Token json.RawMessage `json:"progressToken"`
+			Progress
+		}
+		if json.Unmarshal(m.Params, &p) != nil {
+			return
+		}
+		c.mu.Lock()
+		fn := c.progress[string(p.Token)]
+		c.mu.Unlock()
+		if fn != nil {
+			fn(p.Progress)
+		}
+	case "notifications/message":
+		var p struct {
+			Level string          `json:"level"`
+			Data  json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(m.Params, &p)
+		log.Printf("[MCP %s] %s: %s", c.Name, p.Level, p.Data)
+	default:
+		if c.notify != nil {
+			c.notify(m.Method, m.Params)
+		}
+	}
+}
+
+// handlerContext is the context the handler of server request m runs
+// with. A server asks while it runs a tool, so the context carries the
+// values of that tool call, such as the conversation it belongs to. The
+// call is the one the transport says the request was sent for, or the
+// only one running; with several running, the request is refused rather
+// than answered on behalf of the wrong conversation.
+func (c *Client) handlerContext(m *message) (context.Context, error) {
+	if rt, ok := c.t.(relatedTransport); ok {
+		if origin, ok := rt.relatedRequest(m.ID); ok {
+			id, _ := strconv.ParseInt(string(origin), 10, 64)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if callCtx, ok := c.calls[id]; ok {
+				return context.WithoutCancel(callCtx), nil
+			}
+			return context.Background(), nil
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch len(c.calls) {
+	case 0:
+		return context.Background(), nil
+	case 1:
+		for _, callCtx := range c.calls {
+			return context.WithoutCancel(callCtx), nil
+		}
+	}
+	return nil, &RPCError{
+		Code:    codeInvalidRequest,
+		Message: fmt.Sprintf("%s: %d tool calls are running and the request does not say which one it belongs to", m.Method, len(c.calls)),
+	}
+}
+
+// answer runs the handler for a request from the server and responds.
+func (c *Client) answer(m *message) {
+	reply := map[string]interface{}{"jsonrpc": "2.0", "id": m.ID}
+	var result interface{}
+	var err error
+	if h, ok := c.handlers[m.Method]; ok {
+		var ctx context.Context
+		if ctx, err = c.handlerContext(m); err == nil {
+			c.answering.Add(1)
+			result, err = h(ctx, m.Params)
+			c.answering.Add(-1)
+		} else {
+			log.Printf("[MCP %s] refused %s: %v", c.Name, m.Method, err)
+		}
+	} else if m.Method == "ping" {
+		result = struct{}{}
+	} else {
+		err = &RPCError{Code: codeMethodNotFound, Message: "method not found: " + m.Method}
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: codeInternalError, Message: err.Error()}
+		}
+		reply["error"] = rpcErr
+	} else {
+		if result == nil {
+			result = struct{}{}
+		}
+		reply["result"] = result
+	}
+	if err := c.send(context.Background(), reply); err != nil {
+		log.Printf("[MCP %s] failed to answer %s: %v", c.Name, m.Method, err)
+	}
 }
@@ -0,0 +1,370 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xq-agent/internal/tools"
+)
+
+// testServer is the binary built from testdata/server.
+var testServer string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "mcp-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testServer = filepath.Join(dir, "server")
+	build := exec.Command("go", "build", "-o", testServer, "./testdata/server")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build the test server: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startClient starts the test server and initializes a client for it.
+func startClient(t *testing.T, env ...string) *Client {
+	t.Helper()
+	transport, err := NewStdioTransport("test", testServer, nil, env, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient("test", transport)
+	t.Cleanup(func() { c.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestInitialize(t *testing.T) {
+	c := startClient(t)
+
+	if c.ProtocolVersion != ProtocolVersion {
+		t.Errorf("protocol version = %q, want %q", c.ProtocolVersion, ProtocolVersion)
+	}
+	if c.ServerInfo.Name != "testserver" || c.ServerInfo.Version != "0.1" {
+		t.Errorf("server info = %+v", c.ServerInfo)
+	}
+	if c.Instructions != "Use echo to test." {
+		t.Errorf("instructions = %q", c.Instructions)
+	}
+	if c.Capabilities.Tools == nil || !c.Capabilities.Tools.ListChanged {
+		t.Errorf("tools capability = %+v", c.Capabilities.Tools)
+	}
+	if c.Capabilities.Resources != nil {
+		t.Errorf("resources capability = %+v, the server has none", c.Capabilities.Resources)
+	}
+	if err := c.Ping(testContext(t)); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+}
+
+func TestListToolsFollowsPages(t *testing.T) {
+	c := startClient(t)
+
+	list, err := c.ListTools(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range list {
+		names = append(names, tool.Name)
+	}
+	want := []string{"echo", "content", "progress", "fail", "slow", "cancelled", "env"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("tools = %v, want %v", names, want)
+	}
+	if list[0].Description != "The echo tool" || string(list[0].InputSchema) != `{"type":"object"}` {
+		t.Errorf("echo = %+v", list[0])
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	c := startClient(t)
+	ctx := testContext(t)
+
+	result, err := c.CallTool(ctx, "echo", json.RawMessage(`{"text":"hi there"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Type != "text" || result.Content[0].Text != "hi there" {
+		t.Errorf("content = %+v", result.Content)
+	}
+	if string(result.StructuredContent) != `{"echo":"hi there"}` {
+		t.Errorf("structured content = %s", result.StructuredContent)
+	}
+
+	result, err = c.CallTool(ctx, "fail", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || result.Content[0].Text != "something broke" {
+		t.Errorf("fail = %+v", result)
+	}
+
+	_, err = c.CallTool(ctx, "missing", nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != codeInvalidParams {
+		t.Errorf("unknown tool: %v", err)
+	}
+}
+
+func TestCallToolContentTypes(t *testing.T) {
+	c := startClient(t)
+	ctx := testContext(t)
+
+	result, err := c.CallTool(ctx, "content", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, item := range result.Content {
+		types = append(types, item.Type)
+	}
+	if want := []string{"text", "image", "audio", "resource_link", "resource", "resource"}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("content types = %v, want %v", types, want)
+	}
+	if link := result.Content[3]; link.URI != "file:///notes.txt" || link.Name != "notes" {
+		t.Errorf("resource link = %+v", link)
+	}
+	if r := result.Content[4].Resource; r == nil || r.URI != "file:///a.txt" || r.Text != "embedded" {
+		t.Errorf("embedded resource = %+v", r)
+	}
+
+	ctx, attachments := tools.WithAttachments(ctx)
+	text := RenderContent(ctx, result.Content)
+	want := "hello\n" +
+		"[image 4x2 attached]\n" +
+		"[audio/wav audio, not shown]\n" +
+		"Resource: notes (file:///notes.txt)\n" +
+		"Resource file:///a.txt:\nembedded\n" +
+		"[binary resource file:///b.bin, application/octet-stream]"
+	if text != want {
+		t.Errorf("rendered:\n%s\nwant:\n%s", text, want)
+	}
+	if images := attachments.Images(); len(images) != 1 || images[0].Width != 4 || images[0].Height != 2 {
+		t.Errorf("attached images = %+v", images)
+	}
+}
+
+func TestCallToolProgress(t *testing.T) {
+	c := startClient(t)
+
+	var mu sync.Mutex
+	var got []Progress
+	result, err := c.CallTool(testContext(t), "progress", nil, func(p Progress) {
+		mu.Lock()
+		got = append(got, p)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Content[0].Text != "done" {
+		t.Errorf("result = %+v", result)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []Progress{{1, 3, "step"}, {2, 3, "step"}, {3, 3, "step"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("progress = %+v, want %+v", got, want)
+	}
+}
+
+func TestCallToolCancel(t *testing.T) {
+	c := startClient(t)
+
+	ctx, cancel := context.WithTimeout(testContext(t), 200*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallTool(ctx, "slow", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("slow call: %v", err)
+	}
+	// The server was told which request to stop.
+	result, err := c.CallTool(testContext(t), "cancelled", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := result.Content[0].Text; ids == "" || strings.Contains(ids, ",") {
+		t.Errorf("cancelled requests = %q, want the slow call", ids)
+	}
+}
+
+func TestStdioEnvironment(t *testing.T) {
+	c := startClient(t, "MCP_TEST_VALUE=from the config")
+	result, err := c.CallTool(testContext(t), "env", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Content[0].Text; got != "from the config" {
+		t.Errorf("env = %q", got)
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	c := startClient(t)
+	c.Close()
+	if _, err := c.ListTools(testContext(t)); err == nil {
+		t.Error("request on a closed client succeeded")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("Done not closed")
+	}
+}
+
+// pipeTransport is a Transport whose server side the test plays.
+type pipeTransport struct {
+	sent      chan message
+	incoming  chan json.RawMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeTransport() *pipeTransport {
+	return &pipeTransport{
+		sent:     make(chan message, 16),
+		incoming: make(chan json.RawMessage, 16),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (p *pipeTransport) Send(ctx context.Context, data json.RawMessage) error {
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	p.sent <- m
+	return nil
+}
+
+func (p *pipeTransport) Receive() (json.RawMessage, error) {
+	select {
+	case msg := <-p.incoming:
+		return msg, nil
+	case <-p.closed:
+		return nil, io.EOF
+	}
+}
+
+func (p *pipeTransport) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
+// next returns the next message the client sent.
+func (p *pipeTransport) next(t *testing.T) message {
+	t.Helper()
+	select {
+	case m := <-p.sent:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client sent nothing")
+		return message{}
+	}
+}
+
+// relatedPipe also tells which client request a server request is for.
+type relatedPipe struct {
+	*pipeTransport
+	related map[string]json.RawMessage
+}
+
+func (p *relatedPipe) relatedRequest(id json.RawMessage) (json.RawMessage, bool) {
+	origin, ok := p.related[string(id)]
+	return origin, ok
+}
+
+// startPipeClient initializes a client over p, playing the server side.
+func startPipeClient(t *testing.T, transport Transport, p *pipeTransport, handlers map[string]RequestHandler) *Client {
+	t.Helper()
+	c := NewClient("test", transport)
+	for method, h := range handlers {
+		c.Handle(method, h)
+	}
+	t.Cleanup(func() { c.Close() })
+	done := make(chan error, 1)
+	go func() { done <- c.Initialize(testContext(t)) }()
+	init := p.next(t)
+	p.incoming <- json.RawMessage(`{"jsonrpc":"2.0","id":` + string(init.ID) + `,"result":{"protocolVersion":"` + ProtocolVersion + `","capabilities":{},"serverInfo":{"name":"pipe","version":"1"}}}`)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if m := p.next(t); m.Method != "notifications/initialized" {
+		t.Fatalf("sent %s after initialize", m.Method)
+	}
+	return c
+}
+
+type conversationKey struct{}
+
+func TestServerRequestContext(t *testing.T) {
+	p := newPipeTransport()
+	related := &relatedPipe{pipeTransport: p, related: make(map[string]json.RawMessage)}
+	c := startPipeClient(t, related, p, map[string]RequestHandler{
+		"roots/list": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			return map[string]interface{}{"conversation": ctx.Value(conversationKey{})}, nil
+		},
+	})
+
+	// ask sends a server request and returns the client's answer.
+	ask := func(id string) message {
+		t.Helper()
+		p.incoming <- json.RawMessage(`{"jsonrpc":"2.0","id":"` + id + `","method":"roots/list"}`)
+		return p.next(t)
+	}
+	call := func(conversation string) json.RawMessage {
+		t.Helper()
+		ctx := context.WithValue(testContext(t), conversationKey{}, conversation)
+		go c.CallTool(ctx, "tool", nil, nil)
+		return p.next(t).ID
+	}
+
+	first := call("first")
+	if reply := ask("s1"); string(reply.Result) != `{"conversation":"first"}` {
+		t.Errorf("with one call running: %s %v", reply.Result, reply.Error)
+	}
+
+	second := call("second")
+	if reply := ask("s2"); reply.Error == nil || reply.Error.Code != codeInvalidRequest {
+		t.Errorf("with two calls running: %s, want a refusal", reply.Result)
+	}
+
+	// The transport knows which call a request belongs to.
+	related.related[`"s3"`] = second
+	related.related[`"s4"`] = first
+	if reply := ask("s3"); string(reply.Result) != `{"conversation":"second"}` {
+		t.Errorf("request for the second call: %s %v", reply.Result, reply.Error)
+	}
+	if reply := ask("s4"); string(reply.Result) != `{"conversation":"first"}` {
+		t.Errorf("request for the first call: %s %v", reply.Result, reply.Error)
+	}
+}
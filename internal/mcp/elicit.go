@@ -0,0 +1,211 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxAttempts is how often a field is asked again after an invalid answer.
+const maxAttempts = 3
+
+// elicitField is one property of a requested schema. Servers may only ask
+// for flat objects of strings, numbers, integers, booleans and enums.
+type elicitField struct {
+	Type        string   `json:"type"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	EnumNames   []string `json:"enumNames,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+}
+
+// elicit answers elicitation/create by asking the user of the conversation
+// whose tool call led to the request, one question per field.
+func (m *Manager) elicit(s *server, asker Asker) RequestHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var req struct {
+			Message         string `json:"message"`
+			RequestedSchema struct {
+				Properties json.RawMessage `json:"properties"`
+				Required   []string        `json:"required"`
+			} `json:"requestedSchema"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		var fields map[string]elicitField
+		if len(req.RequestedSchema.Properties) > 0 {
+			if err := json.Unmarshal(req.RequestedSchema.Properties, &fields); err != nil {
+				return nil, &RPCError{Code: codeInvalidParams, Message: "invalid requestedSchema: " + err.Error()}
+			}
+		}
+		required := make(map[string]bool)
+		for _, name := range req.RequestedSchema.Required {
+			required[name] = true
+		}
+		cancel := map[string]interface{}{"action": "cancel"}
+		decline := map[string]interface{}{"action": "decline"}
+
+		intro := fmt.Sprintf("MCP server %s asks: %s\n", s.name, req.Message)
+		if len(fields) == 0 {
+			answer, err := asker.Ask(ctx, intro+"Reply yes to accept or no to decline.", 0)
+			if err != nil {
+				return cancel, nil
+			}
+			if isYes(answer) {
+				return map[string]interface{}{"action": "accept", "content": map[string]interface{}{}}, nil
+			}
+			return decline, nil
+		}
+
+		content := make(map[string]interface{})
+		for i, name := range propertyOrder(req.RequestedSchema.Properties) {
+			f := fields[name]
+			question := f.question(name, required[name])
+			if i == 0 {
+				question = intro + "(Reply decline to refuse or cancel to stop.)\n\n" + question
+			}
+			for attempt := 0; ; attempt++ {
+				answer, err := asker.Ask(ctx, question, 0)
+				if err != nil {
+					return cancel, nil
+				}
+				switch strings.ToLower(answer) {
+				case "decline":
+					return decline, nil
+				case "cancel":
+					return cancel, nil
+				}
+				if answer == "-" && !required[name] {
+					break
+				}
+				v, err := f.parse(answer)
+				if err == nil {
+					content[name] = v
+					break
+				}
+				if attempt+1 == maxAttempts {
+					return cancel, nil
+				}
+				question = fmt.Sprintf("%v. %s", err, f.question(name, required[name]))
+			}
+		}
+		return map[string]interface{}{"action": "accept", "content": content}, nil
+	}
+}
+
+// question asks for the field's value.
+func (f *elicitField) question(name string, required bool) string {
+	var sb strings.Builder
+	sb.WriteString(firstNonEmpty(f.Title, name))
+	if f.Description != "" {
+		fmt.Fprintf(&sb, " (%s)", f.Description)
+	}
+	switch {
+	case len(f.Enum) > 0:
+		sb.WriteString(":")
+		for i, v := range f.Enum {
+			label := v
+			if i < len(f.EnumNames) {
+				label = f.EnumNames[i]
+			}
+			fmt.Fprintf(&sb, "\n%d. %s", i+1, label)
+		}
+	case f.Type == "boolean":
+		sb.WriteString(" [yes/no]")
+	case f.Type == "number" || f.Type == "integer":
+		fmt.Fprintf(&sb, " [%s]", f.Type)
+	case f.Format != "":
+		fmt.Fprintf(&sb, " [%s]", f.Format)
+	}
+	if !required {
+		sb.WriteString("\nOptional, reply - to skip.")
+	}
+	return sb.String()
+}
+
+// parse converts an answer to the field's type.
+func (f *elicitField) parse(answer string) (interface{}, error) {
+	answer = strings.TrimSpace(answer)
+	if len(f.Enum) > 0 {
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(f.Enum) {
+			return f.Enum[n-1], nil
+		}
+		for i, v := range f.Enum {
+			if strings.EqualFold(answer, v) || (i < len(f.EnumNames) && strings.EqualFold(answer, f.EnumNames[i])) {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("please pick one of the choices")
+	}
+	switch f.Type {
+	case "boolean":
+		if isYes(answer) {
+			return true, nil
+		}
+		if isNo(answer) {
+			return false, nil
+		}
+		return nil, fmt.Errorf("please answer yes or no")
+	case "number", "integer":
+		n, err := strconv.ParseFloat(answer, 64)
+		if err != nil || (f.Type == "integer" && n != float64(int64(n))) {
+			return nil, fmt.Errorf("please answer with a %s", f.Type)
+		}
+		if (f.Minimum != nil && n < *f.Minimum) || (f.Maximum != nil && n > *f.Maximum) {
+			return nil, fmt.Errorf("%v is out of range", n)
+		}
+		if f.Type == "integer" {
+			return int64(n), nil
+		}
+		return n, nil
+	}
+	if answer == "" {
+		return nil, fmt.Errorf("please enter a value")
+	}
+	return answer, nil
+}
+
+// propertyOrder returns the keys of a JSON object in the order they
+// appear, which is the order the server wants the fields asked in.
+func propertyOrder(raw json.RawMessage) []string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, t.(string))
+		var skip json.RawMessage
+		if dec.Decode(&skip) != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+func isYes(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes", "true", "ok", "是", "好", "对", "可以", "同意":
+		return true
+	}
+	return false
+}
+
+func isNo(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "n", "no", "false", "否", "不", "不是", "不同意":
+		return true
+	}
+	return false
+}
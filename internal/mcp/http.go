@@ -0,0 +1,519 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reconnectDelay is how long the HTTP transports wait before reopening an
+// event stream that ended.
+const reconnectDelay = 2 * time.Second
+
+// maxResumes is how often in a row a response stream is resumed without
+// receiving a new event before giving up.
+const maxResumes = 3
+
+// HTTPTransport implements the Streamable HTTP transport: every message is
+// POSTed to one endpoint and the server answers with JSON or an event
+// stream. A long-lived GET stream carries messages the server sends on its
+// own, and interrupted streams are resumed with Last-Event-ID.
+type HTTPTransport struct {
+	name    string
+	url     string
+	headers http.Header
+	client  *http.Client
+
+	incoming chan json.RawMessage
+	ctx      context.Context // Ends when the transport is closed
+	cancel   context.CancelFunc
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+	listening       bool
+	related         map[string]json.RawMessage // Client request by server request ID
+}
+
+// NewHTTPTransport connects to the MCP endpoint at url. headers are sent
+// with every request, e.g. Authorization.
+func NewHTTPTransport(name, endpoint string, headers http.Header) *HTTPTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPTransport{
+		name:     name,
+		url:      endpoint,
+		headers:  headers,
+		client:   &http.Client{},
+		incoming: make(chan json.RawMessage, 64),
+		ctx:      ctx,
+		cancel:   cancel,
+		related:  make(map[string]json.RawMessage),
+	}
+}
+
+// newRequest builds a request carrying the configured headers and the
+// session state.
+func (t *HTTPTransport) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, t.url, r)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+func (t *HTTPTransport) Send(ctx context.Context, msg json.RawMessage) error {
+	req, err := t.newRequest(ctx, http.MethodPost, msg)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if err := httpError(resp); err != nil {
+		resp.Body.Close()
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		resp.Body.Close()
+	case mediaType == "text/event-stream":
+		// The response and related messages arrive as events; read them in
+		// the background so Send does not wait for the whole stream.
+		var m message
+		json.Unmarshal(msg, &m)
+		if !m.isRequest() {
+			m.ID = nil
+		}
+		go t.readStream(resp.Body, m.ID)
+	default:
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			t.deliver(body)
+		}
+	}
+	return nil
+}
+
+// readStream delivers the messages of the event stream answering request
+// id. A stream that ends before the response arrives was interrupted and is
+// resumed from the last event received.
+func (t *HTTPTransport) readStream(body io.ReadCloser, id json.RawMessage) {
+	answered := id == nil
+	onEvent := func(e event) {
+		if e.name != "" && e.name != "message" {
+			return
+		}
+		if !answered {
+			var m message
+			if json.Unmarshal([]byte(e.data), &m) == nil {
+				switch {
+				case m.Method == "" && bytes.Equal(m.ID, id):
+					answered = true
+				case m.isRequest():
+					// Requests on this stream are made for request id.
+					t.mu.Lock()
+					t.related[string(m.ID)] = id
+					t.mu.Unlock()
+				}
+			}
+		}
+		t.deliver([]byte(e.data))
+	}
+	lastID, err := readEvents(body, onEvent)
+	body.Close()
+	for failed := 0; !answered && t.ctx.Err() == nil; {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		if lastID == "" {
+			log.Printf("[MCP %s] event stream ended before the response (%v) and cannot be resumed", t.name, err)
+			return
+		}
+		if failed == maxResumes {
+			log.Printf("[MCP %s] giving up on the event stream: %v", t.name, err)
+			return
+		}
+		log.Printf("[MCP %s] event stream interrupted (%v), resuming", t.name, err)
+		var next string
+		next, err = t.stream(lastID, onEvent)
+		if err == errNoStream {
+			log.Printf("[MCP %s] failed to resume: the server has no event stream", t.name)
+			return
+		}
+		if next != "" && next != lastID {
+			lastID, failed = next, 0
+		} else {
+			failed++
+			select {
+			case <-t.ctx.Done():
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}
+}
+
+func (t *HTTPTransport) relatedRequest(id json.RawMessage) (json.RawMessage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	origin, ok := t.related[string(id)]
+	delete(t.related, string(id))
+	return origin, ok
+}
+
+// onEvent delivers the message an event carries.
+func (t *HTTPTransport) onEvent(e event) {
+	if e.name == "" || e.name == "message" {
+		t.deliver([]byte(e.data))
+	}
+}
+
+// started is called by the client once the session is initialized.
+func (t *HTTPTransport) started(protocolVersion string) {
+	t.mu.Lock()
+	t.protocolVersion = protocolVersion
+	listening := t.listening
+	t.listening = true
+	t.mu.Unlock()
+	if !listening {
+		go t.listen("")
+	}
+}
+
+// listen keeps a GET event stream open for messages the server sends on its
+// own, reconnecting whenever it ends.
+func (t *HTTPTransport) listen(lastID string) {
+	for t.ctx.Err() == nil {
+		id, err := t.stream(lastID, t.onEvent)
+		if err == errNoStream {
+			return
+		}
+		if id != "" {
+			lastID = id
+		}
+		if err != nil && t.ctx.Err() == nil {
+			log.Printf("[MCP %s] event stream: %v", t.name, err)
+		}
+		select {
+		case <-t.ctx.Done():
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// errNoStream means the server does not offer a GET event stream.
+var errNoStream = errors.New("no event stream")
+
+// stream opens a GET event stream, replaying the events after lastID if it
+// is set, and passes its events to fn until it ends. It returns the ID of
+// the last event received.
+func (t *HTTPTransport) stream(lastID string, fn func(event)) (string, error) {
+	req, err := t.newRequest(t.ctx, http.MethodGet, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return "", errNoStream
+	}
+	if err := httpError(resp); err != nil {
+		return "", err
+	}
+	return readEvents(resp.Body, fn)
+}
+
+func (t *HTTPTransport) deliver(msg []byte) {
+	select {
+	case t.incoming <- append(json.RawMessage(nil), msg...):
+	case <-t.ctx.Done():
+	}
+}
+
+func (t *HTTPTransport) Receive() (json.RawMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+// Close ends the session on the server and stops all streams.
+func (t *HTTPTransport) Close() error {
+	if t.ctx.Err() != nil {
+		return nil
+	}
+	t.mu.Lock()
+	session := t.sessionID
+	t.mu.Unlock()
+	if session != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if req, err := t.newRequest(ctx, http.MethodDelete, nil); err == nil {
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+		cancel()
+	}
+	t.cancel()
+	return nil
+}
+
+// SSETransport implements the older HTTP+SSE transport: the server sends
+// messages over a GET event stream whose first event names the URL that
+// the client POSTs its messages to.
+type SSETransport struct {
+	name    string
+	headers http.Header
+	client  *http.Client
+
+	endpoint string
+	ready    chan struct{} // Closed once endpoint is known
+	err      error         // Why the stream was given up, set before cancel
+
+	incoming chan json.RawMessage
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewSSETransport opens the event stream at url.
+func NewSSETransport(name, streamURL string, headers http.Header) (*SSETransport, error) {
+	base, err := url.Parse(streamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &SSETransport{
+		name:     name,
+		headers:  headers,
+		client:   &http.Client{},
+		ready:    make(chan struct{}),
+		incoming: make(chan json.RawMessage, 64),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := httpError(resp); err != nil {
+		resp.Body.Close()
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		defer resp.Body.Close()
+		defer cancel() // The session ends with the stream.
+		_, err := readEvents(resp.Body, func(e event) {
+			switch e.name {
+			case "endpoint":
+				if t.endpoint != "" {
+					return
+				}
+				u, err := base.Parse(strings.TrimSpace(e.data))
+				if err == nil && !sameOrigin(u, base) {
+					// The headers carry credentials, so messages only go
+					// to the server the stream came from.
+					err = fmt.Errorf("endpoint %s is on another origin than %s", u.Redacted(), base.Redacted())
+				}
+				if err != nil {
+					log.Printf("[MCP %s] invalid endpoint: %v", name, err)
+					t.err = err
+					cancel()
+					return
+				}
+				t.endpoint = u.String()
+				close(t.ready)
+			case "", "message":
+				select {
+				case t.incoming <- json.RawMessage(e.data):
+				case <-ctx.Done():
+				}
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[MCP %s] event stream: %v", name, err)
+		}
+	}()
+	return t, nil
+}
+
+func (t *SSETransport) Send(ctx context.Context, msg json.RawMessage) error {
+	select {
+	case <-t.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.ctx.Done():
+		if t.err != nil {
+			return t.err
+		}
+		return io.ErrClosedPipe
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	return httpError(resp)
+}
+
+func (t *SSETransport) Receive() (json.RawMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+func (t *SSETransport) Close() error {
+	t.cancel()
+	return nil
+}
+
+// sameOrigin reports whether a and b have the same scheme, host and port.
+func sameOrigin(a, b *url.URL) bool {
+	port := func(u *url.URL) string {
+		if p := u.Port(); p != "" {
+			return p
+		}
+		if strings.EqualFold(u.Scheme, "https") {
+			return "443"
+		}
+		return "80"
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		port(a) == port(b)
+}
+
+// httpError describes an unsuccessful response.
+func httpError(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("HTTP %d, check the server's bearer_token or headers: %s", resp.StatusCode, msg)
+	case http.StatusNotFound:
+		if resp.Request != nil && resp.Request.Header.Get("Mcp-Session-Id") != "" {
+			return fmt.Errorf("session expired (HTTP 404)")
+		}
+	}
+	return fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg)
+}
+
+// event is one server-sent event.
+type event struct {
+	id   string
+	name string
+	data string
+}
+
+// readEvents parses a text/event-stream and calls fn for each event. It
+// returns the ID of the last event that had one, and nil once the stream
+// has ended normally.
+func readEvents(r io.Reader, fn func(event)) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxMessageSize)
+	var lastID string
+	var e event
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				e.data = strings.Join(data, "\n")
+				fn(e)
+			}
+			e, data = event{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment, used as keep-alive
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			e.name = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			e.id, lastID = value, value
+		}
+	}
+	return lastID, scanner.Err()
+}
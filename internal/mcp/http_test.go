@@ -0,0 +1,271 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rpcReply answers a JSON-RPC request from a fake server.
+func rpcReply(t *testing.T, body []byte) (message, string) {
+	t.Helper()
+	var m message
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Errorf("invalid message %s: %v", body, err)
+	}
+	var result string
+	switch m.Method {
+	case "initialize":
+		result = `{"protocolVersion":"` + ProtocolVersion + `","capabilities":{},"serverInfo":{"name":"fake","version":"1"}}`
+	default:
+		result = `{}`
+	}
+	return m, `{"jsonrpc":"2.0","id":` + string(m.ID) + `,"result":` + result + `}`
+}
+
+func writeEvent(w http.ResponseWriter, id, data string) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	w.(http.Flusher).Flush()
+}
+
+func TestHTTPTransportSession(t *testing.T) {
+	var mu sync.Mutex
+	var headers []http.Header
+	deleted := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case http.MethodDelete:
+			deleted <- r.Header.Get("Mcp-Session-Id")
+		case http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			m, reply := rpcReply(t, body)
+			mu.Lock()
+			headers = append(headers, r.Header.Clone())
+			mu.Unlock()
+			if !m.isRequest() {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.Header().Set("Mcp-Session-Id", "session-1")
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, reply)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient("test", NewHTTPTransport("test", srv.URL, http.Header{"Authorization": {"Bearer secret"}}))
+	if err := c.Initialize(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(headers) != 3 {
+		t.Fatalf("got %d POSTs, want initialize, initialized and ping", len(headers))
+	}
+	if h := headers[0]; h.Get("Mcp-Session-Id") != "" || h.Get("Authorization") != "Bearer secret" {
+		t.Errorf("initialize headers = %v", h)
+	}
+	for _, h := range headers[1:] {
+		if h.Get("Mcp-Session-Id") != "session-1" || h.Get("MCP-Protocol-Version") != ProtocolVersion {
+			t.Errorf("headers after initialize = %v", h)
+		}
+	}
+	if id := <-deleted; id != "session-1" {
+		t.Errorf("DELETE for session %q", id)
+	}
+}
+
+func TestHTTPTransportResumesStream(t *testing.T) {
+	var mu sync.Mutex
+	var pending string // The ping response held back for the resumed stream
+	var resumedFrom []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			mu.Lock()
+			reply := pending
+			if last := r.Header.Get("Last-Event-ID"); last != "" {
+				resumedFrom = append(resumedFrom, last)
+			}
+			mu.Unlock()
+			if r.Header.Get("Last-Event-ID") != "1" || reply == "" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			writeEvent(w, "2", reply)
+		case http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			m, reply := rpcReply(t, body)
+			switch {
+			case !m.isRequest():
+				w.WriteHeader(http.StatusAccepted)
+			case m.Method == "ping":
+				// The stream ends cleanly before the response is sent.
+				mu.Lock()
+				pending = reply
+				mu.Unlock()
+				w.Header().Set("Content-Type", "text/event-stream")
+				writeEvent(w, "1", `{"jsonrpc":"2.0","method":"notifications/message","params":{"level":"info","data":"working"}}`)
+			default:
+				w.Header().Set("Content-Type", "text/event-stream")
+				writeEvent(w, "", reply)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient("test", NewHTTPTransport("test", srv.URL, nil))
+	defer c.Close()
+	if err := c.Initialize(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(testContext(t)); err != nil {
+		t.Fatalf("ping over an interrupted stream: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(resumedFrom) != 1 || resumedFrom[0] != "1" {
+		t.Errorf("resumed from %q, want event 1 once", resumedFrom)
+	}
+}
+
+// sseServer is a fake HTTP+SSE server that announces endpoint.
+func sseServer(t *testing.T, endpoint string, posts chan<- *http.Request) *httptest.Server {
+	t.Helper()
+	replies := make(chan string, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", endpoint)
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case reply := <-replies:
+					writeEvent(w, "", reply)
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case "/messages":
+			body, _ := io.ReadAll(r.Body)
+			posts <- r
+			m, reply := rpcReply(t, body)
+			if m.isRequest() {
+				replies <- reply
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSSETransport(t *testing.T) {
+	posts := make(chan *http.Request, 8)
+	srv := sseServer(t, "/messages?session=1", posts)
+
+	transport, err := NewSSETransport("test", srv.URL+"/sse", http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient("test", transport)
+	defer c.Close()
+	if err := c.Initialize(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	r := <-posts
+	if r.URL.Query().Get("session") != "1" || r.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("POST to %s with headers %v", r.URL, r.Header)
+	}
+}
+
+func TestSSETransportRefusesForeignEndpoint(t *testing.T) {
+	hits := make(chan *http.Request, 1)
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits <- r
+	}))
+	defer foreign.Close()
+	srv := sseServer(t, foreign.URL+"/messages", make(chan *http.Request, 8))
+
+	transport, err := NewSSETransport("test", srv.URL+"/sse", http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	err = transport.Send(testContext(t), json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if err == nil || !strings.Contains(err.Error(), "another origin") {
+		t.Errorf("send to a foreign endpoint: %v", err)
+	}
+	select {
+	case r := <-hits:
+		t.Errorf("the foreign server got %s with headers %v", r.URL, r.Header)
+	default:
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://example.com/sse", "https://example.com/messages?id=1", true},
+		{"https://example.com/sse", "https://EXAMPLE.com:443/messages", true},
+		{"http://example.com/sse", "https://example.com/messages", false},
+		{"https://example.com/sse", "https://example.com:8443/messages", false},
+		{"https://example.com/sse", "https://evil.example/messages", false},
+	}
+	for _, tt := range tests {
+		a, _ := url.Parse(tt.a)
+		b, _ := url.Parse(tt.b)
+		if got := sameOrigin(a, b); got != tt.want {
+			t.Errorf("sameOrigin(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPTransportRelatesServerRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeEvent(w, "", `{"jsonrpc":"2.0","id":"r1","method":"sampling/createMessage","params":{}}`)
+		writeEvent(w, "", `{"jsonrpc":"2.0","id":5,"result":{}}`)
+	}))
+	defer srv.Close()
+
+	transport := NewHTTPTransport("test", srv.URL, nil)
+	defer transport.Close()
+	if err := transport.Send(testContext(t), json.RawMessage(`{"jsonrpc":"2.0","id":5,"method":"tools/call"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := transport.Receive(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if origin, ok := transport.relatedRequest(json.RawMessage(`"r1"`)); !ok || string(origin) != "5" {
+		t.Errorf("r1 relates to %s, want request 5", origin)
+	}
+	if _, ok := transport.relatedRequest(json.RawMessage(`"r1"`)); ok {
+		t.Error("the relation was kept after it was looked up")
+	}
+}
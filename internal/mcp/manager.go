@@ -0,0 +1,465 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xq-agent/internal/channels"
+	"xq-agent/internal/config"
+	"xq-agent/internal/core"
+	"xq-agent/internal/llm"
+	"xq-agent/internal/tools"
+)
+
+const (
+	// connectTimeout bounds starting a server and listing its tools.
+	connectTimeout = 30 * time.Second
+	// defaultCallTimeout bounds a tool call unless the server sets timeout.
+	defaultCallTimeout = 60 * time.Second
+	// healthInterval is how often connected servers are pinged.
+	healthInterval = 30 * time.Second
+	pingTimeout    = 10 * time.Second
+
+	// Restarts back off from minBackoff to maxBackoff, and start over once a
+	// server has stayed up for stableAfter.
+	minBackoff  = time.Second
+	maxBackoff  = 5 * time.Minute
+	stableAfter = 2 * time.Minute
+)
+
+// Server states shown by /mcp.
+const (
+	stateStarting   = "starting"
+	stateConnected  = "connected"
+	stateRestarting = "restarting"
+	stateStopped    = "stopped"
+)
+
+// Registry receives the tools and prompts of the connected servers.
+// core.Agent implements it.
+type Registry interface {
+	RegisterTool(t tools.Tool)
+	UnregisterTool(name string)
+	RegisterPrompt(name, description string, fn core.PromptFunc)
+	UnregisterCommand(name string)
+}
+
+// Manager runs the configured MCP servers and keeps their tools registered.
+// Servers that crash, stop answering pings or cannot be reached are
+// restarted with backoff, and tool list changes are picked up as they are
+// announced.
+type Manager struct {
+	cfg      config.MCPConfig
+	registry Registry
+	channels *channels.Manager // Receives resource updates, may be nil
+	llm      llm.Provider      // Answers sampling requests, may be nil
+	ctx      context.Context   // Ends when the manager is closed
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	servers map[string]*server
+}
+
+// server is one configured MCP server and the tools and prompts registered
+// for it.
+type server struct {
+	name      string
+	cfg       config.MCPServerConfig
+	client    *Client
+	tools     map[string]string // Registered name by MCP tool name
+	prompts   []string          // Command names
+	resources []ResourceInfo
+	templates []ResourceTemplate
+	// Sessions to tell when a resource changes, by URI. Kept across
+	// reconnects.
+	subscribers map[string]map[string]bool
+	// Sampling use while the agent runs.
+	sampledTokens   int
+	samplingAllowed bool // The user allowed all requests
+
+	state    string
+	err      error // Why the last connection ended
+	since    time.Time
+	restarts int
+}
+
+// NewManager prepares the servers of cfg. Their tools and prompts go to
+// registry; if it also implements Asker, servers can ask the user for input.
+func NewManager(cfg config.MCPConfig, registry Registry, cm *channels.Manager, provider llm.Provider) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		cfg:      cfg,
+		registry: registry,
+		channels: cm,
+		llm:      provider,
+		ctx:      ctx,
+		cancel:   cancel,
+		servers:  make(map[string]*server),
+	}
+}
+
+// Start connects to every enabled server in the background.
+func (m *Manager) Start() {
+	for name, cfg := range m.cfg.Servers {
+		if cfg.Disabled {
+			continue
+		}
+		s := &server{
+			name:        name,
+			cfg:         cfg,
+			subscribers: make(map[string]map[string]bool),
+			state:       stateStarting,
+			since:       time.Now(),
+		}
+		m.mu.Lock()
+		m.servers[name] = s
+		m.mu.Unlock()
+		go m.supervise(s)
+	}
+}
+
+// Close unregisters all tools and stops the servers.
+func (m *Manager) Close() {
+	m.cancel()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.servers {
+		m.drop(s)
+		s.state, s.since = stateStopped, time.Now()
+	}
+}
+
+// supervise keeps s connected until the manager is closed.
+func (m *Manager) supervise(s *server) {
+	backoff := minBackoff
+	for m.ctx.Err() == nil {
+		c, err := m.connect(s)
+		if err == nil {
+			started := time.Now()
+			err = m.watch(c)
+			m.mu.Lock()
+			m.drop(s)
+			m.mu.Unlock()
+			if time.Since(started) > stableAfter {
+				backoff = minBackoff
+			}
+		}
+		if m.ctx.Err() != nil {
+			return
+		}
+		log.Printf("MCP server %s: %v, restarting in %s", s.name, err, backoff)
+		m.mu.Lock()
+		s.state, s.err, s.since = stateRestarting, err, time.Now()
+		s.restarts++
+		m.mu.Unlock()
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		m.mu.Lock()
+		s.state = stateStarting
+		m.mu.Unlock()
+	}
+}
+
+// watch blocks until the connection to c is lost or c stops answering
+// pings, and returns why.
+func (m *Manager) watch(c *Client) error {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return nil
+		case <-c.Done():
+			return c.Err()
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(m.ctx, pingTimeout)
+			err := c.Ping(ctx)
+			cancel()
+			if err != nil && m.ctx.Err() == nil {
+				return fmt.Errorf("health check failed: %v", err)
+			}
+		}
+	}
+}
+
+// drop unregisters the tools and prompts of s and closes its connection.
+// The caller holds m.mu.
+func (m *Manager) drop(s *server) {
+	for _, name := range s.tools {
+		m.registry.UnregisterTool(name)
+	}
+	for _, name := range s.prompts {
+		m.registry.UnregisterCommand(name)
+	}
+	s.tools, s.prompts = nil, nil
+	s.resources, s.templates = nil, nil
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// connect starts s, lists its tools and registers the ones its filters let
+// through. Resources and prompts are read in the background.
+func (m *Manager) connect(s *server) (*Client, error) {
+	ctx, cancel := context.WithTimeout(m.ctx, connectTimeout)
+	defer cancel()
+
+	t, err := newTransport(s.name, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(s.name, t)
+	if m.llm != nil && s.cfg.Sampling.Approval != "never" {
+		c.Handle("sampling/createMessage", m.sample(s))
+	}
+	if asker, ok := m.registry.(Asker); ok {
+		c.Handle("elicitation/create", m.elicit(s, asker))
+	}
+	c.OnNotification(func(method string, params json.RawMessage) {
+		switch method {
+		case "notifications/tools/list_changed":
+			go m.syncTools(s, c)
+		case "notifications/prompts/list_changed":
+			go m.syncPrompts(s, c)
+		case "notifications/resources/list_changed":
+			go m.syncResources(s, c)
+		case "notifications/resources/updated":
+			go m.resourceUpdated(s, params)
+		}
+	})
+	if err := c.Initialize(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	list, err := c.ListTools(ctx)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx.Err() != nil {
+		c.Close()
+		return nil, m.ctx.Err()
+	}
+	s.client = c
+	s.state, s.since = stateConnected, time.Now()
+	m.register(s, list)
+	log.Printf("MCP server %s (%s %s) connected, %d of %d tools registered",
+		s.name, c.ServerInfo.Name, c.ServerInfo.Version, len(s.tools), len(list))
+	go func() {
+		m.syncPrompts(s, c)
+		m.syncResources(s, c)
+		m.resubscribe(s, c)
+	}()
+	return c, nil
+}
+
+// register replaces the registered tools of s with list. Tools keep the
+// names they were registered under; new ones get a name no other tool of
+// any server has. The caller holds m.mu.
+func (m *Manager) register(s *server, list []Tool) {
+	taken := make(map[string]bool)
+	for _, other := range m.servers {
+		if other != s {
+			for _, name := range other.tools {
+				taken[name] = true
+			}
+		}
+	}
+	var allowed []Tool
+	names := make(map[string]string)
+	for _, tool := range list {
+		if !matchTools(s.cfg.Tools, s.cfg.ExcludeTools, tool.Name) {
+			continue
+		}
+		if _, dup := names[tool.Name]; dup {
+			continue
+		}
+		allowed = append(allowed, tool)
+		names[tool.Name] = ""
+		if name, ok := s.tools[tool.Name]; ok && !taken[name] {
+			names[tool.Name] = name
+			taken[name] = true
+		}
+	}
+	for _, tool := range allowed {
+		if names[tool.Name] != "" {
+			continue
+		}
+		name := uniqueToolName(s.name, tool.Name, taken)
+		if name != ToolName(s.name, tool.Name) {
+			log.Printf("MCP server %s: tool %s registered as %s, %s is taken", s.name, tool.Name, name, ToolName(s.name, tool.Name))
+		}
+		names[tool.Name] = name
+		taken[name] = true
+	}
+
+	// Names given up go first, another tool may take them over.
+	for tool, name := range s.tools {
+		if names[tool] != name {
+			m.registry.UnregisterTool(name)
+		}
+	}
+	for _, tool := range allowed {
+		m.registry.RegisterTool(NewToolAdapter(names[tool.Name], s.name, s.client, tool, s.callTimeout()))
+	}
+	s.tools = names
+}
+
+// syncTools re-reads the tools of s after the server announced a change.
+func (m *Manager) syncTools(s *server, c *Client) {
+	ctx, cancel := context.WithTimeout(m.ctx, connectTimeout)
+	defer cancel()
+	list, err := c.ListTools(ctx)
+	if err != nil {
+		log.Printf("MCP server %s: failed to update tools: %v", s.name, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.client != c {
+		return // Reconnected meanwhile, which listed the tools anyway.
+	}
+	m.register(s, list)
+	log.Printf("MCP server %s: tools changed, %d registered", s.name, len(s.tools))
+}
+
+func (s *server) callTimeout() time.Duration {
+	if s.cfg.Timeout > 0 {
+		return s.cfg.Timeout
+	}
+	return defaultCallTimeout
+}
+
+// StatusCommand implements /mcp: it shows each server's state, and
+// "/mcp restart <name>" reconnects a server.
+func (m *Manager) StatusCommand(session, args string) (string, error) {
+	args = strings.TrimSpace(args)
+	if name, ok := strings.CutPrefix(args, "restart"); ok {
+		return m.restart(strings.TrimSpace(name))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.cfg.Servers))
+	for name := range m.cfg.Servers {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "No MCP servers configured (mcp.servers in config.yaml).", nil
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("MCP servers:\n")
+	for _, name := range names {
+		s, ok := m.servers[name]
+		if !ok {
+			fmt.Fprintf(&sb, "- %s: disabled\n", name)
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s: %s for %s", name, s.state, time.Since(s.since).Round(time.Second))
+		if s.client != nil {
+			fmt.Fprintf(&sb, ", %s %s, %d tools", s.client.ServerInfo.Name, s.client.ServerInfo.Version, len(s.tools))
+			if len(s.prompts) > 0 {
+				fmt.Fprintf(&sb, ", %d prompts", len(s.prompts))
+			}
+			if len(s.resources)+len(s.templates) > 0 {
+				fmt.Fprintf(&sb, ", %d resources", len(s.resources)+len(s.templates))
+			}
+		}
+		if s.restarts > 0 {
+			fmt.Fprintf(&sb, ", %d restarts", s.restarts)
+		}
+		if s.err != nil {
+			fmt.Fprintf(&sb, "\n  last error: %v", s.err)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// restart drops the connection to a server, which the supervisor then
+// re-establishes.
+func (m *Manager) restart(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.servers[name]
+	if !ok {
+		return "", fmt.Errorf("no running MCP server named %q", name)
+	}
+	if s.client == nil {
+		return "", fmt.Errorf("%s is not connected (%s)", name, s.state)
+	}
+	s.client.Close()
+	return fmt.Sprintf("Restarting %s.", name), nil
+}
+
+// newTransport starts a local server or connects to a remote one.
+func newTransport(name string, cfg config.MCPServerConfig) (Transport, error) {
+	switch {
+	case cfg.Command != "":
+		keys := make([]string, 0, len(cfg.Env))
+		for k := range cfg.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		env := make([]string, len(keys))
+		for i, k := range keys {
+			env[i] = k + "=" + os.ExpandEnv(cfg.Env[k])
+		}
+		return NewStdioTransport(name, cfg.Command, cfg.Args, env, cfg.Cwd)
+	case cfg.URL != "":
+		headers := make(http.Header)
+		for k, v := range cfg.Headers {
+			headers.Set(k, os.ExpandEnv(v))
+		}
+		if cfg.BearerToken != "" {
+			headers.Set("Authorization", "Bearer "+os.ExpandEnv(cfg.BearerToken))
+		}
+		switch cfg.Transport {
+		case "", "http":
+			return NewHTTPTransport(name, cfg.URL, headers), nil
+		case "sse":
+			return NewSSETransport(name, cfg.URL, headers)
+		}
+		return nil, fmt.Errorf("unknown transport %q, use http or sse", cfg.Transport)
+	}
+	return nil, fmt.Errorf("neither command nor url is set")
+}
+
+// matchTools reports whether name matches one of the include patterns (or
+// there are none) and none of the exclude patterns.
+func matchTools(include, exclude []string, name string) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(include) > 0 && !match(include) {
+		return false
+	}
+	return !match(exclude)
+}
@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// syncPrompts re-reads the prompts of a server that offers them and
+// registers one slash command per prompt. The caller must not hold m.mu.
+func (m *Manager) syncPrompts(s *server, c *Client) {
+	if c.Capabilities.Prompts == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, connectTimeout)
+	defer cancel()
+	list, err := c.ListPrompts(ctx)
+	if err != nil {
+		log.Printf("MCP server %s: failed to list prompts: %v", s.name, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.client != c {
+		return
+	}
+	taken := make(map[string]bool)
+	for _, other := range m.servers {
+		if other != s {
+			for _, name := range other.prompts {
+				taken[name] = true
+			}
+		}
+	}
+	keep := make(map[string]bool)
+	var names []string
+	for _, p := range list {
+		name := uniqueToolName(s.name, p.Name, taken)
+		taken[name] = true
+		help := fmt.Sprintf("[MCP server %s prompt] %s", s.name, firstNonEmpty(p.Description, p.Title, p.Name))
+		if usage := promptUsage(p); usage != "" {
+			help += " " + usage
+		}
+		m.registry.RegisterPrompt(name, help, m.expandPrompt(s, p, name))
+		keep[name] = true
+		names = append(names, name)
+	}
+	for _, name := range s.prompts {
+		if !keep[name] {
+			m.registry.UnregisterCommand(name)
+		}
+	}
+	s.prompts = names
+}
+
+// expandPrompt returns the slash command for p: its arguments are taken
+// from the text after the command, and the prompt the server returns is
+// sent to the model in place of the user's message.
+func (m *Manager) expandPrompt(s *server, p Prompt, command string) func(session, line string) (string, error) {
+	return func(session, line string) (string, error) {
+		args, err := promptArgs(p, line)
+		if err != nil {
+			return "", fmt.Errorf("%v, usage: /%s %s", err, command, promptUsage(p))
+		}
+		m.mu.Lock()
+		c := s.client
+		m.mu.Unlock()
+		if c == nil {
+			return "", fmt.Errorf("MCP server %s is not connected", s.name)
+		}
+		ctx, cancel := context.WithTimeout(m.ctx, s.callTimeout())
+		defer cancel()
+		result, err := c.GetPrompt(ctx, p.Name, args)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", p.Name, err)
+		}
+		return renderPrompt(ctx, result.Messages), nil
+	}
+}
+
+// promptArgs assigns the words after the command to the prompt's arguments
+// in order; the last argument takes the rest of the line.
+func promptArgs(p Prompt, line string) (map[string]string, error) {
+	args := make(map[string]string)
+	rest := strings.TrimSpace(line)
+	for i, arg := range p.Arguments {
+		if rest == "" {
+			break
+		}
+		if i == len(p.Arguments)-1 {
+			args[arg.Name] = rest
+			break
+		}
+		word, after, _ := strings.Cut(rest, " ")
+		args[arg.Name] = word
+		rest = strings.TrimSpace(after)
+	}
+	for _, arg := range p.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return nil, fmt.Errorf("missing %s", arg.Name)
+		}
+	}
+	return args, nil
+}
+
+// promptUsage lists the arguments of p, optional ones in brackets.
+func promptUsage(p Prompt) string {
+	parts := make([]string, len(p.Arguments))
+	for i, arg := range p.Arguments {
+		if arg.Required {
+			parts[i] = "<" + arg.Name + ">"
+		} else {
+			parts[i] = "[" + arg.Name + "]"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// renderPrompt turns the messages of a prompt into one message. A prompt of
+// several messages keeps its turns labelled.
+func renderPrompt(ctx context.Context, messages []PromptMessage) string {
+	if len(messages) == 1 && messages[0].Role == "user" {
+		return promptContent(ctx, messages[0].Content)
+	}
+	parts := make([]string, len(messages))
+	for i, msg := range messages {
+		role := "User"
+		if msg.Role == "assistant" {
+			role = "Assistant"
+		}
+		parts[i] = role + ": " + promptContent(ctx, msg.Content)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// promptContent renders one content item. Images and audio cannot be added
+// to the user's message and are only mentioned.
+func promptContent(ctx context.Context, c Content) string {
+	switch c.Type {
+	case "image", "audio":
+		return fmt.Sprintf("[%s %s omitted]", c.MIMEType, c.Type)
+	}
+	return RenderContent(ctx, []Content{c})
+}
@@ -0,0 +1,335 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"xq-agent/internal/channels"
+	"xq-agent/internal/tools"
+)
+
+// maxResourceText caps the text of a resource returned to the model.
+const maxResourceText = 100000
+
+// syncResources re-reads the resources and templates of a server that
+// offers them. The caller must not hold m.mu.
+func (m *Manager) syncResources(s *server, c *Client) {
+	if c.Capabilities.Resources == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, connectTimeout)
+	defer cancel()
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		log.Printf("MCP server %s: failed to list resources: %v", s.name, err)
+		return
+	}
+	// Templates are optional even for servers with resources.
+	templates, err := c.ListResourceTemplates(ctx)
+	if err != nil {
+		templates = nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.client == c {
+		s.resources, s.templates = resources, templates
+	}
+}
+
+// resubscribe renews the subscriptions of s on a new connection.
+func (m *Manager) resubscribe(s *server, c *Client) {
+	m.mu.Lock()
+	uris := make([]string, 0, len(s.subscribers))
+	for uri := range s.subscribers {
+		uris = append(uris, uri)
+	}
+	m.mu.Unlock()
+	for _, uri := range uris {
+		ctx, cancel := context.WithTimeout(m.ctx, connectTimeout)
+		if err := c.Subscribe(ctx, uri); err != nil {
+			log.Printf("MCP server %s: failed to resubscribe to %s: %v", s.name, uri, err)
+		}
+		cancel()
+	}
+}
+
+// resourceUpdated tells the conversations subscribed to a resource that it
+// changed, the same way cron jobs trigger the agent.
+func (m *Manager) resourceUpdated(s *server, params json.RawMessage) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if json.Unmarshal(params, &p) != nil || p.URI == "" {
+		return
+	}
+	m.mu.Lock()
+	sessions := make([]string, 0, len(s.subscribers[p.URI]))
+	for session := range s.subscribers[p.URI] {
+		sessions = append(sessions, session)
+	}
+	m.mu.Unlock()
+	if m.channels == nil {
+		return
+	}
+	for _, session := range sessions {
+		// Sessions are addresses, the update goes to the chat that
+		// subscribed.
+		channel, chat := channels.SplitAddress(session)
+		m.channels.InjectMessage(channels.Message{
+			ID:      fmt.Sprintf("mcp-%s-%s", s.name, p.URI),
+			Content: fmt.Sprintf("The MCP resource %s on server %s was updated.", p.URI, s.name),
+			Sender:  "mcp_" + s.name,
+			Channel: channel,
+			ChatID:  chat,
+		})
+	}
+}
+
+// ResourceTool returns the mcp_read_resource tool for the servers of m.
+func (m *Manager) ResourceTool() *ResourceTool {
+	return &ResourceTool{manager: m}
+}
+
+// ResourceTool lets the model list, read and subscribe to the resources of
+// the connected MCP servers.
+type ResourceTool struct {
+	manager *Manager
+}
+
+func (t *ResourceTool) Name() string { return "mcp_read_resource" }
+func (t *ResourceTool) Description() string {
+	desc := "Read resources (files, records, documents) offered by MCP servers. Use action list to see what each server offers, including URI templates whose {placeholders} you fill in. Subscribe to be told when a resource changes."
+	if names := t.manager.resourceServers(); len(names) > 0 {
+		desc += " Servers with resources: " + strings.Join(names, ", ") + "."
+	}
+	return desc
+}
+func (t *ResourceTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"read", "list", "subscribe", "unsubscribe"},
+				"description": "read (default) returns the resource at uri, list shows the resources and templates of server (or all servers)",
+			},
+			"server": map[string]interface{}{
+				"type":        "string",
+				"description": "MCP server name, may be omitted when only one server has resources",
+			},
+			"uri": map[string]interface{}{
+				"type":        "string",
+				"description": "Resource URI, from list or a template with its placeholders filled in",
+			},
+		},
+	}
+}
+
+func (t *ResourceTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *ResourceTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Action string `json:"action"`
+		Server string `json:"server"`
+		URI    string `json:"uri"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	m := t.manager
+	if input.Action == "list" {
+		return m.listResources(input.Server)
+	}
+	if input.URI == "" {
+		return "", fmt.Errorf("uri is required")
+	}
+	s, c, err := m.resourceServer(input.Server, input.URI)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.callTimeout())
+	defer cancel()
+
+	session := tools.SessionFrom(ctx)
+	switch input.Action {
+	case "", "read":
+		contents, err := c.ReadResource(ctx, input.URI)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", input.URI, err)
+		}
+		if len(contents) == 0 {
+			return "The resource is empty.", nil
+		}
+		items := make([]Content, len(contents))
+		for i := range contents {
+			items[i] = Content{Type: "resource", Resource: &contents[i]}
+		}
+		text := RenderContent(ctx, items)
+		if len(text) > maxResourceText {
+			text = text[:maxResourceText] + "\n[truncated]"
+		}
+		return text, nil
+	case "subscribe":
+		if c.Capabilities.Resources == nil || !c.Capabilities.Resources.Subscribe {
+			return "", fmt.Errorf("MCP server %s does not support subscriptions", s.name)
+		}
+		m.mu.Lock()
+		first := len(s.subscribers[input.URI]) == 0
+		if s.subscribers[input.URI] == nil {
+			s.subscribers[input.URI] = make(map[string]bool)
+		}
+		s.subscribers[input.URI][session] = true
+		m.mu.Unlock()
+		if first {
+			if err := c.Subscribe(ctx, input.URI); err != nil {
+				m.unsubscribe(s, input.URI, session)
+				return "", fmt.Errorf("%s: %v", input.URI, err)
+			}
+		}
+		return fmt.Sprintf("Subscribed to %s, you will be told when it changes.", input.URI), nil
+	case "unsubscribe":
+		if m.unsubscribe(s, input.URI, session) {
+			if err := c.Unsubscribe(ctx, input.URI); err != nil {
+				return "", fmt.Errorf("%s: %v", input.URI, err)
+			}
+		}
+		return fmt.Sprintf("Unsubscribed from %s.", input.URI), nil
+	}
+	return "", fmt.Errorf("unknown action %q", input.Action)
+}
+
+// unsubscribe removes session from the subscribers of uri and reports
+// whether nobody is subscribed any more.
+func (m *Manager) unsubscribe(s *server, uri, session string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs, ok := s.subscribers[uri]
+	if !ok {
+		return false
+	}
+	delete(subs, session)
+	if len(subs) > 0 {
+		return false
+	}
+	delete(s.subscribers, uri)
+	return true
+}
+
+// resourceServers names the connected servers that offer resources.
+func (m *Manager) resourceServers() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name, s := range m.servers {
+		if s.client != nil && s.client.Capabilities.Resources != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resourceServer finds the server to ask for uri: the named one, the only
+// one with resources, or the one that listed uri.
+func (m *Manager) resourceServer(name, uri string) (*server, *Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name != "" {
+		s, ok := m.servers[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("no MCP server named %q", name)
+		}
+		if s.client == nil {
+			return nil, nil, fmt.Errorf("MCP server %s is not connected (%s)", name, s.state)
+		}
+		return s, s.client, nil
+	}
+	var candidates []*server
+	for _, s := range m.servers {
+		if s.client == nil || s.client.Capabilities.Resources == nil {
+			continue
+		}
+		for _, r := range s.resources {
+			if r.URI == uri {
+				return s, s.client, nil
+			}
+		}
+		candidates = append(candidates, s)
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, nil, fmt.Errorf("no connected MCP server offers resources")
+	case 1:
+		return candidates[0], candidates[0].client, nil
+	}
+	return nil, nil, fmt.Errorf("several MCP servers offer resources, set server")
+}
+
+// listResources describes the resources and templates of one or all
+// servers.
+func (m *Manager) listResources(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.servers))
+	for n := range m.servers {
+		if name == "" || n == name {
+			names = append(names, n)
+		}
+	}
+	if name != "" && len(names) == 0 {
+		return "", fmt.Errorf("no MCP server named %q", name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, n := range names {
+		s := m.servers[n]
+		if s.client == nil || s.client.Capabilities.Resources == nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "Server %s:\n", n)
+		for _, r := range s.resources {
+			fmt.Fprintf(&sb, "- %s", r.URI)
+			if title := firstNonEmpty(r.Title, r.Name); title != "" {
+				fmt.Fprintf(&sb, " %s", title)
+			}
+			if r.MIMEType != "" {
+				fmt.Fprintf(&sb, " (%s)", r.MIMEType)
+			}
+			if r.Description != "" {
+				fmt.Fprintf(&sb, ": %s", r.Description)
+			}
+			sb.WriteString("\n")
+		}
+		for _, r := range s.templates {
+			fmt.Fprintf(&sb, "- template %s %s", r.URITemplate, firstNonEmpty(r.Title, r.Name))
+			if r.Description != "" {
+				fmt.Fprintf(&sb, ": %s", r.Description)
+			}
+			sb.WriteString("\n")
+		}
+		if len(s.resources) == 0 && len(s.templates) == 0 {
+			sb.WriteString("(no resources listed)\n")
+		}
+	}
+	if sb.Len() == 0 {
+		return "No connected MCP server offers resources.", nil
+	}
+	return sb.String(), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"xq-agent/internal/audit"
+	"xq-agent/internal/llm"
+)
+
+const (
+	defaultSamplingTokens = 1024
+	samplingTimeout       = 2 * time.Minute
+	// approvalTimeout is how long the user has to allow a sampling request.
+	approvalTimeout = 5 * time.Minute
+)
+
+// codeUserRejected is the error servers get when the user or the policy
+// refuses a request.
+const codeUserRejected = -1
+
+// Asker asks the user of the conversation ctx belongs to and returns the
+// answer. core.Agent implements it.
+type Asker interface {
+	Ask(ctx context.Context, question string, timeout time.Duration) (string, error)
+}
+
+// samplingRequest is the params of sampling/createMessage.
+type samplingRequest struct {
+	Messages []struct {
+		Role    string  `json:"role"`
+		Content Content `json:"content"`
+	} `json:"messages"`
+	SystemPrompt  string   `json:"systemPrompt,omitempty"`
+	MaxTokens     int      `json:"maxTokens"`
+	Temperature   float32  `json:"temperature,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+// sample answers sampling/createMessage with the agent's model, within the
+// server's approval policy and token limits. The agent's own conversation
+// is never shared with the server.
+func (m *Manager) sample(s *server) RequestHandler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var req samplingRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		if len(req.Messages) == 0 {
+			return nil, &RPCError{Code: codeInvalidParams, Message: "no messages"}
+		}
+
+		cfg := s.cfg.Sampling
+		maxTokens := cfg.MaxTokens
+		if maxTokens <= 0 {
+			maxTokens = defaultSamplingTokens
+		}
+		if req.MaxTokens > 0 && req.MaxTokens < maxTokens {
+			maxTokens = req.MaxTokens
+		}
+		// maxTokens is charged up front so that concurrent requests cannot
+		// overrun the budget together. It is settled with the actual use.
+		m.mu.Lock()
+		if cfg.TokenBudget > 0 {
+			left := cfg.TokenBudget - s.sampledTokens
+			if left <= 0 {
+				m.mu.Unlock()
+				return nil, &RPCError{Code: codeUserRejected, Message: fmt.Sprintf("token budget of %d exhausted", cfg.TokenBudget)}
+			}
+			maxTokens = min(maxTokens, left)
+		}
+		charged := maxTokens
+		s.sampledTokens += charged
+		m.mu.Unlock()
+		defer func() {
+			m.mu.Lock()
+			s.sampledTokens -= charged
+			m.mu.Unlock()
+		}()
+
+		if err := m.approveSampling(ctx, s, &req, maxTokens); err != nil {
+			audit.Record(audit.Event{Kind: "mcp_sampling_denied", Tool: s.name, Reason: err.Error()})
+			return nil, &RPCError{Code: codeUserRejected, Message: err.Error()}
+		}
+
+		ctx = llm.WithOptions(ctx, llm.Options{
+			MaxTokens:   maxTokens,
+			Temperature: req.Temperature,
+			Stop:        req.StopSequences,
+		})
+		ctx, cancel := context.WithTimeout(ctx, samplingTimeout)
+		defer cancel()
+		resp, err := m.llm.Chat(ctx, m.samplingMessages(&req), nil)
+		if err != nil {
+			return nil, fmt.Errorf("completion failed: %v", err)
+		}
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("the model returned no completion")
+		}
+		m.mu.Lock()
+		s.sampledTokens += resp.Usage.TotalTokens - charged
+		charged = 0
+		m.mu.Unlock()
+		audit.Record(audit.Event{
+			Kind:   "mcp_sampling",
+			Tool:   s.name,
+			Target: resp.Model,
+			Reason: fmt.Sprintf("%d tokens", resp.Usage.TotalTokens),
+		})
+
+		choice := resp.Choices[0]
+		stopReason := string(choice.FinishReason)
+		switch choice.FinishReason {
+		case openai.FinishReasonStop:
+			stopReason = "endTurn"
+		case openai.FinishReasonLength:
+			stopReason = "maxTokens"
+		}
+		return map[string]interface{}{
+			"role":       "assistant",
+			"content":    Content{Type: "text", Text: choice.Message.Content},
+			"model":      resp.Model,
+			"stopReason": stopReason,
+		}, nil
+	}
+}
+
+// approveSampling applies the server's approval policy. With "ask", the
+// user of the conversation whose tool call led to the request decides;
+// answering "always" allows the server's further requests until the agent
+// restarts.
+func (m *Manager) approveSampling(ctx context.Context, s *server, req *samplingRequest, maxTokens int) error {
+	switch s.cfg.Sampling.Approval {
+	case "always":
+		return nil
+	case "never":
+		return fmt.Errorf("sampling is disabled for this server")
+	}
+	m.mu.Lock()
+	allowed := s.samplingAllowed
+	m.mu.Unlock()
+	if allowed {
+		return nil
+	}
+	asker, ok := m.registry.(Asker)
+	if !ok {
+		return fmt.Errorf("nobody to approve the request")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "MCP server %s wants to use the model (up to %d tokens).\n", s.name, maxTokens)
+	if req.SystemPrompt != "" {
+		fmt.Fprintf(&sb, "System prompt: %s\n", truncate(req.SystemPrompt, 300))
+	}
+	last := req.Messages[len(req.Messages)-1]
+	fmt.Fprintf(&sb, "Last message (%d in total): %s\n", len(req.Messages), truncate(promptContent(context.Background(), last.Content), 500))
+	sb.WriteString("Allow? Reply yes, no, or always to allow this server until restart.")
+
+	answer, err := asker.Ask(ctx, sb.String(), approvalTimeout)
+	if err != nil {
+		return fmt.Errorf("not approved: %v", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "always", "总是", "始终":
+		m.mu.Lock()
+		s.samplingAllowed = true
+		m.mu.Unlock()
+		return nil
+	case "allow", "允许":
+		return nil
+	}
+	if isYes(answer) {
+		return nil
+	}
+	log.Printf("MCP server %s: sampling request refused by the user", s.name)
+	return fmt.Errorf("the user refused the request")
+}
+
+// samplingMessages converts the request for the model. Images are only
+// passed on to models that can see them.
+func (m *Manager) samplingMessages(req *samplingRequest) []openai.ChatCompletionMessage {
+	var messages []openai.ChatCompletionMessage
+	if req.SystemPrompt != "" {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: req.SystemPrompt})
+	}
+	for _, msg := range req.Messages {
+		role := openai.ChatMessageRoleUser
+		if msg.Role == "assistant" {
+			role = openai.ChatMessageRoleAssistant
+		}
+		c := msg.Content
+		if c.Type == "image" && role == openai.ChatMessageRoleUser && m.llm.SupportsVision() {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role: role,
+				MultiContent: []openai.ChatMessagePart{{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: "data:" + c.MIMEType + ";base64," + c.Data},
+				}},
+			})
+			continue
+		}
+		messages = append(messages, openai.ChatCompletionMessage{Role: role, Content: promptContent(context.Background(), c)})
+	}
+	return messages
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"xq-agent/internal/config"
+)
+
+// blockingLLM answers once release is closed, reporting usage tokens.
+type blockingLLM struct {
+	started chan struct{}
+	release chan struct{}
+	usage   int
+}
+
+func (l *blockingLLM) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionResponse, error) {
+	l.started <- struct{}{}
+	<-l.release
+	return openai.ChatCompletionResponse{
+		Model:   "test",
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "ok"}, FinishReason: openai.FinishReasonStop}},
+		Usage:   openai.Usage{TotalTokens: l.usage},
+	}, nil
+}
+
+func (l *blockingLLM) ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (*openai.ChatCompletionStream, error) {
+	return nil, errors.New("not supported")
+}
+
+func (l *blockingLLM) SupportsVision() bool { return false }
+
+func TestSamplingReservesBudget(t *testing.T) {
+	provider := &blockingLLM{started: make(chan struct{}), release: make(chan struct{}), usage: 30}
+	m := NewManager(config.MCPConfig{}, nil, nil, provider)
+	s := &server{name: "s", cfg: config.MCPServerConfig{Sampling: config.MCPSamplingConfig{
+		Approval:    "always",
+		MaxTokens:   80,
+		TokenBudget: 100,
+	}}}
+	sample := m.sample(s)
+	params := json.RawMessage(`{"messages":[{"role":"user","content":{"type":"text","text":"hi"}}]}`)
+	used := func() int {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return s.sampledTokens
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := sample(context.Background(), params)
+			errs <- err
+		}()
+		select {
+		case <-provider.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the request did not reach the model")
+		}
+	}
+	// Both running requests hold their share: 80, then the 20 left.
+	if got := used(); got != 100 {
+		t.Errorf("reserved %d tokens, want 100", got)
+	}
+	if _, err := sample(context.Background(), params); err == nil {
+		t.Error("a request beyond the budget was answered")
+	}
+
+	close(provider.release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if got := used(); got != 60 {
+		t.Errorf("charged %d tokens after the requests, want the 60 used", got)
+	}
+}
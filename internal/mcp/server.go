@@ -0,0 +1,460 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"xq-agent/internal/config"
+	"xq-agent/internal/tools"
+)
+
+// serverInfo identifies the agent to MCP clients.
+var serverInfo = Implementation{Name: "xq-agent", Version: "1.0"}
+
+// sessionIdleTimeout is how long an HTTP session is kept without requests.
+// Clients that go away without ending their session leave it behind.
+const sessionIdleTimeout = 30 * time.Minute
+
+// Server offers the agent's tools to MCP clients over stdio or Streamable
+// HTTP. The tools apply the same workspace policy as in conversations.
+type Server struct {
+	cfg   config.MCPServeConfig
+	tools func() []tools.Tool
+
+	mu          sync.Mutex
+	sessions    map[string]*serverSession // HTTP sessions by Mcp-Session-Id
+	idleTimeout time.Duration
+}
+
+// serverSession tracks the running requests of one client so they can be
+// cancelled.
+type serverSession struct {
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc // By request ID
+	lastUsed time.Time                     // When the last request started or ended
+}
+
+// NewServer serves the tools list returns, filtered by the tools and
+// exclude_tools patterns of cfg.
+func NewServer(cfg config.MCPServeConfig, list func() []tools.Tool) *Server {
+	return &Server{
+		cfg:         cfg,
+		tools:       list,
+		sessions:    make(map[string]*serverSession),
+		idleTimeout: sessionIdleTimeout,
+	}
+}
+
+func newServerSession() *serverSession {
+	return &serverSession{running: make(map[string]context.CancelFunc), lastUsed: time.Now()}
+}
+
+// idle returns how long the session has had no running requests.
+func (ss *serverSession) idle(now time.Time) time.Duration {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.running) > 0 {
+		return 0
+	}
+	return now.Sub(ss.lastUsed)
+}
+
+// close cancels everything the session is still running.
+func (ss *serverSession) close() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, cancel := range ss.running {
+		cancel()
+	}
+}
+
+// Offered reports whether cfg lets clients use the tool called name.
+func Offered(cfg config.MCPServeConfig, name string) bool {
+	return matchTools(cfg.Tools, cfg.ExcludeTools, name)
+}
+
+// toolList returns the tools clients may use.
+func (s *Server) toolList() []tools.Tool {
+	var list []tools.Tool
+	for _, t := range s.tools() {
+		if Offered(s.cfg, t.Name()) {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func (s *Server) tool(name string) (tools.Tool, bool) {
+	for _, t := range s.toolList() {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// ServeStdio answers the messages read from r on w, one JSON message per
+// line, until r ends or ctx is done. Requests run concurrently so that they
+// can be cancelled.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ss := newServerSession()
+	defer ss.close()
+
+	var writeMu sync.Mutex
+	write := func(v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		w.Write(append(data, '\n'))
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxMessageSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		batch, isBatch, err := parseMessages(line)
+		if err != nil {
+			write(errorResponse(nil, codeParseError, err.Error()))
+			continue
+		}
+		// Notifications, such as cancellations, are handled right away.
+		if !isBatch && !batch[0].isRequest() {
+			s.handle(ctx, ss, &batch[0])
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if replies := s.handleAll(ctx, ss, batch); len(replies) > 0 {
+				if isBatch {
+					write(replies)
+				} else {
+					write(replies[0])
+				}
+			}
+		}()
+	}
+	return scanner.Err()
+}
+
+// ServeHTTP implements the Streamable HTTP transport. Every response is a
+// plain JSON body, the server never starts streams of its own.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowedOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if token := os.ExpandEnv(s.cfg.BearerToken); token != "" {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.post(w, r)
+	case http.MethodDelete:
+		s.mu.Lock()
+		ss, ok := s.sessions[r.Header.Get("Mcp-Session-Id")]
+		delete(s.sessions, r.Header.Get("Mcp-Session-Id"))
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		ss.close()
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// expireSessions ends the HTTP sessions that have been idle for longer
+// than idleTimeout.
+func (s *Server) expireSessions() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, ss := range s.sessions {
+		if ss.idle(now) > s.idleTimeout {
+			delete(s.sessions, id)
+			ss.close()
+			log.Printf("MCP session %s expired", id[:8])
+		}
+	}
+}
+
+func (s *Server) post(w http.ResponseWriter, r *http.Request) {
+	s.expireSessions()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	batch, isBatch, err := parseMessages(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(nil, codeParseError, err.Error()))
+		return
+	}
+
+	initializing := false
+	for i := range batch {
+		initializing = initializing || batch[i].Method == "initialize"
+	}
+	var ss *serverSession
+	if initializing {
+		id := make([]byte, 16)
+		rand.Read(id)
+		sessionID := hex.EncodeToString(id)
+		ss = newServerSession()
+		s.mu.Lock()
+		s.sessions[sessionID] = ss
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", sessionID)
+	} else {
+		sessionID := r.Header.Get("Mcp-Session-Id")
+		if sessionID == "" {
+			http.Error(w, "missing Mcp-Session-Id", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		ss = s.sessions[sessionID]
+		s.mu.Unlock()
+		if ss == nil {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	replies := s.handleAll(r.Context(), ss, batch)
+	switch {
+	case len(replies) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case isBatch:
+		writeJSON(w, http.StatusOK, replies)
+	default:
+		writeJSON(w, http.StatusOK, replies[0])
+	}
+}
+
+// handleAll handles the messages of a batch concurrently and returns the
+// responses to its requests.
+func (s *Server) handleAll(ctx context.Context, ss *serverSession, batch []message) []*message {
+	replies := make([]*message, len(batch))
+	var wg sync.WaitGroup
+	for i := range batch {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replies[i] = s.handle(ctx, ss, &batch[i])
+		}(i)
+	}
+	wg.Wait()
+	var out []*message
+	for _, r := range replies {
+		if r != nil {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// handle answers one message. Notifications and responses return nil.
+func (s *Server) handle(ctx context.Context, ss *serverSession, m *message) *message {
+	if !m.isRequest() {
+		if m.Method == "notifications/cancelled" {
+			var p struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			if json.Unmarshal(m.Params, &p) == nil {
+				ss.mu.Lock()
+				if cancel, ok := ss.running[string(p.RequestID)]; ok {
+					cancel()
+				}
+				ss.mu.Unlock()
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ss.mu.Lock()
+	ss.running[string(m.ID)] = cancel
+	ss.lastUsed = time.Now()
+	ss.mu.Unlock()
+	defer func() {
+		ss.mu.Lock()
+		delete(ss.running, string(m.ID))
+		ss.lastUsed = time.Now()
+		ss.mu.Unlock()
+	}()
+
+	result, err := s.call(ctx, m.Method, m.Params)
+	if err != nil {
+		if rpcErr, ok := err.(*RPCError); ok {
+			return &message{JSONRPC: "2.0", ID: m.ID, Error: rpcErr}
+		}
+		return errorResponse(m.ID, codeInternalError, err.Error())
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(m.ID, codeInternalError, err.Error())
+	}
+	return &message{JSONRPC: "2.0", ID: m.ID, Result: data}
+}
+
+// call runs a request and returns its result.
+func (s *Server) call(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string         `json:"protocolVersion"`
+			ClientInfo      Implementation `json:"clientInfo"`
+		}
+		json.Unmarshal(params, &p)
+		version := ProtocolVersion
+		for _, v := range supportedVersions {
+			if v == p.ProtocolVersion {
+				version = v
+			}
+		}
+		log.Printf("MCP client %s %s connected", p.ClientInfo.Name, p.ClientInfo.Version)
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      serverInfo,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		list := s.toolList()
+		out := make([]Tool, 0, len(list))
+		for _, t := range list {
+			schema, err := json.Marshal(t.Schema())
+			if err != nil {
+				continue
+			}
+			out = append(out, Tool{Name: t.Name(), Description: t.Description(), InputSchema: schema})
+		}
+		return map[string]interface{}{"tools": out}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		t, ok := s.tool(p.Name)
+		if !ok {
+			return nil, &RPCError{Code: codeInvalidParams, Message: "unknown tool: " + p.Name}
+		}
+		return s.runTool(ctx, t, p.Arguments), nil
+	}
+	return nil, &RPCError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+// runTool runs t for a client. Tool errors are results the client's model
+// should see, not protocol errors.
+func (s *Server) runTool(ctx context.Context, t tools.Tool, args json.RawMessage) *CallToolResult {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	log.Printf("MCP tool call: %s %s", t.Name(), args)
+	ctx, attachments := tools.WithAttachments(tools.WithSession(ctx, "mcp"))
+	out, err := tools.Execute(ctx, t, args)
+	if err != nil {
+		return &CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	content := []Content{{Type: "text", Text: out}}
+	for _, img := range attachments.Images() {
+		content = append(content, Content{
+			Type:     "image",
+			Data:     base64.StdEncoding.EncodeToString(img.Data),
+			MIMEType: img.MIMEType,
+		})
+	}
+	for _, f := range attachments.Files() {
+		content = append(content, Content{Type: "text", Text: fmt.Sprintf("File %s: %s", f.Name, f.Path)})
+	}
+	return &CallToolResult{Content: content}
+}
+
+// parseMessages decodes a message or a batch of them.
+func parseMessages(data []byte) ([]message, bool, error) {
+	if len(data) > 0 && data[0] == '[' {
+		var batch []message
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, true, err
+		}
+		if len(batch) == 0 {
+			return nil, true, fmt.Errorf("empty batch")
+		}
+		return batch, true, nil
+	}
+	batch := make([]message, 1)
+	if err := json.Unmarshal(data, &batch[0]); err != nil {
+		return nil, false, err
+	}
+	return batch, false, nil
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *message {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &message{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: msg}}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// allowedOrigin rejects browser requests from other sites, which could
+// otherwise reach a server on localhost (DNS rebinding).
+func allowedOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,66 @@
+package mcp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"xq-agent/internal/config"
+	"xq-agent/internal/tools"
+)
+
+// postMCP sends body to s and returns the response.
+func postMCP(s *Server, session, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set("Mcp-Session-Id", session)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestServerExpiresIdleSessions(t *testing.T) {
+	s := NewServer(config.MCPServeConfig{}, func() []tools.Tool { return nil })
+	s.idleTimeout = 50 * time.Millisecond
+
+	w := postMCP(s, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+ProtocolVersion+`"}}`)
+	session := w.Header().Get("Mcp-Session-Id")
+	if w.Code != http.StatusOK || session == "" {
+		t.Fatalf("initialize: %d %s", w.Code, w.Body)
+	}
+	ping := `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+	if w := postMCP(s, session, ping); w.Code != http.StatusOK {
+		t.Fatalf("ping: %d %s", w.Code, w.Body)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if w := postMCP(s, session, ping); w.Code != http.StatusNotFound {
+		t.Errorf("ping after the session idled: %d %s", w.Code, w.Body)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sessions) != 0 {
+		t.Errorf("%d sessions left", len(s.sessions))
+	}
+}
+
+func TestOffered(t *testing.T) {
+	cfg := config.MCPServeConfig{ExcludeTools: []string{"shell_*"}}
+	for name, want := range map[string]bool{
+		"read_file":    true,
+		"shell_exec":   false,
+		"github__list": true,
+	} {
+		if got := Offered(cfg, name); got != want {
+			t.Errorf("Offered(%q) = %v, want %v", name, got, want)
+		}
+	}
+	cfg.Tools = []string{"github__*"}
+	if Offered(cfg, "read_file") || !Offered(cfg, "github__list") {
+		t.Error("the tools patterns are not applied")
+	}
+}
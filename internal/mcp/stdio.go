@@ -0,0 +1,157 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// maxMessageSize bounds a single message read from a server.
+const maxMessageSize = 32 << 20
+
+// Transport carries JSON-RPC messages between the client and one server.
+type Transport interface {
+	// Send delivers one message to the server.
+	Send(ctx context.Context, msg json.RawMessage) error
+	// Receive blocks until the next message from the server arrives. It
+	// returns io.EOF once the server has gone away.
+	Receive() (json.RawMessage, error)
+	Close() error
+}
+
+// StdioTransport runs the server as a child process and exchanges
+// newline-delimited JSON over its standard input and output. Anything the
+// server writes to standard error is logged.
+type StdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	out    *os.File
+
+	writeMu sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewStdioTransport starts command with args. env entries ("KEY=value") are
+// added to the agent's environment, and dir is the working directory.
+func NewStdioTransport(name, command string, args, env []string, dir string) (*StdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Plain pipes rather than StdoutPipe, so that Wait does not close them
+	// before the last messages have been read.
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, stderrW, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	err = cmd.Start()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdout.Close()
+		stderr.Close()
+		return nil, fmt.Errorf("failed to start %s: %v", command, err)
+	}
+
+	t := &StdioTransport{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReaderSize(stdout, 64<<10),
+		out:    stdout,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer stderr.Close()
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		for scanner.Scan() {
+			log.Printf("[MCP %s] %s", name, scanner.Text())
+		}
+	}()
+	go func() {
+		cmd.Wait()
+		close(t.done)
+	}()
+	return t, nil
+}
+
+func (t *StdioTransport) Send(ctx context.Context, msg json.RawMessage) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	select {
+	case <-t.done:
+		return io.ErrClosedPipe
+	default:
+	}
+	// Messages must not contain embedded newlines.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, msg); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := t.stdin.Write(buf.Bytes())
+	return err
+}
+
+func (t *StdioTransport) Receive() (json.RawMessage, error) {
+	for {
+		line, err := t.stdout.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Long line: collect the rest of it.
+			buf := append([]byte(nil), line...)
+			for err == bufio.ErrBufferFull {
+				if len(buf) > maxMessageSize {
+					return nil, fmt.Errorf("message larger than %d bytes", maxMessageSize)
+				}
+				line, err = t.stdout.ReadSlice('\n')
+				buf = append(buf, line...)
+			}
+			line = buf
+		}
+		if err != nil && (err != io.EOF || len(bytes.TrimSpace(line)) == 0) {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		return append(json.RawMessage(nil), line...), nil
+	}
+}
+
+// Close closes the server's input, which asks it to exit, and kills it if it
+// is still running after a few seconds.
+func (t *StdioTransport) Close() error {
+	t.once.Do(func() {
+		t.stdin.Close()
+		select {
+		case <-t.done:
+		case <-time.After(3 * time.Second):
+			t.cmd.Process.Kill()
+			<-t.done
+		}
+		// Unblock Receive even if a child of the server still holds the pipe.
+		t.out.Close()
+	})
+	return nil
+}
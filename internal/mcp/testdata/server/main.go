@@ -0,0 +1,216 @@
+// Command server is a small MCP server over stdio for the client tests.
+//
+// tools/list is split over three pages. The tools are:
+//
+//	echo       returns its "text" argument as text and structured content
+//	content    returns one item of every content type
+//	progress   reports progress three times before returning
+//	fail       returns a result marked as an error
+//	slow       waits until the call is cancelled
+//	cancelled  lists the request IDs the client cancelled
+//	env        returns the MCP_TEST_VALUE environment variable
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"sync"
+)
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var (
+	writeMu sync.Mutex
+	out     = bufio.NewWriter(os.Stdout)
+
+	mu        sync.Mutex
+	cancelled []string
+	waiting   = map[string]chan struct{}{}
+)
+
+func write(v interface{}) {
+	data, _ := json.Marshal(v)
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	out.Write(data)
+	out.WriteByte('\n')
+	out.Flush()
+}
+
+func reply(id json.RawMessage, result interface{}, err *rpcError) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if err != nil {
+		msg["error"] = err
+	} else {
+		msg["result"] = result
+	}
+	write(msg)
+}
+
+func main() {
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(make([]byte, 1<<20), 1<<20)
+	for in.Scan() {
+		var m message
+		if json.Unmarshal(in.Bytes(), &m) != nil {
+			continue
+		}
+		if len(m.ID) == 0 {
+			notification(m)
+			continue
+		}
+		go request(m)
+	}
+}
+
+func notification(m message) {
+	if m.Method != "notifications/cancelled" {
+		return
+	}
+	var p struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	json.Unmarshal(m.Params, &p)
+	mu.Lock()
+	defer mu.Unlock()
+	id := string(p.RequestID)
+	cancelled = append(cancelled, id)
+	if ch, ok := waiting[id]; ok {
+		close(ch)
+		delete(waiting, id)
+	}
+}
+
+func request(m message) {
+	switch m.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(m.Params, &p)
+		reply(m.ID, map[string]interface{}{
+			"protocolVersion": p.ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{"listChanged": true}},
+			"serverInfo":      map[string]string{"name": "testserver", "version": "0.1"},
+			"instructions":    "Use echo to test.",
+		}, nil)
+	case "ping":
+		reply(m.ID, struct{}{}, nil)
+	case "tools/list":
+		var p struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(m.Params, &p)
+		pages := map[string][]string{"": {"echo", "content"}, "2": {"progress", "fail"}, "3": {"slow", "cancelled", "env"}}
+		next := map[string]string{"": "2", "2": "3"}
+		names, ok := pages[p.Cursor]
+		if !ok {
+			reply(m.ID, nil, &rpcError{Code: -32602, Message: "invalid cursor"})
+			return
+		}
+		var tools []map[string]interface{}
+		for _, name := range names {
+			tools = append(tools, map[string]interface{}{
+				"name":        name,
+				"description": "The " + name + " tool",
+				"inputSchema": map[string]interface{}{"type": "object"},
+			})
+		}
+		result := map[string]interface{}{"tools": tools}
+		if n := next[p.Cursor]; n != "" {
+			result["nextCursor"] = n
+		}
+		reply(m.ID, result, nil)
+	case "tools/call":
+		call(m)
+	default:
+		reply(m.ID, nil, &rpcError{Code: -32601, Message: "method not found: " + m.Method})
+	}
+}
+
+func call(m message) {
+	var p struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+		Meta      struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	json.Unmarshal(m.Params, &p)
+	text := func(s string) map[string]interface{} {
+		return map[string]interface{}{"content": []map[string]interface{}{{"type": "text", "text": s}}}
+	}
+
+	switch p.Name {
+	case "echo":
+		result := text(p.Arguments["text"])
+		result["structuredContent"] = map[string]string{"echo": p.Arguments["text"]}
+		reply(m.ID, result, nil)
+	case "content":
+		reply(m.ID, map[string]interface{}{"content": []map[string]interface{}{
+			{"type": "text", "text": "hello"},
+			{"type": "image", "mimeType": "image/png", "data": pngData()},
+			{"type": "audio", "mimeType": "audio/wav", "data": base64.StdEncoding.EncodeToString([]byte("RIFF"))},
+			{"type": "resource_link", "uri": "file:///notes.txt", "name": "notes"},
+			{"type": "resource", "resource": map[string]string{"uri": "file:///a.txt", "mimeType": "text/plain", "text": "embedded"}},
+			{"type": "resource", "resource": map[string]string{"uri": "file:///b.bin", "mimeType": "application/octet-stream", "blob": "AAE="}},
+		}}, nil)
+	case "progress":
+		for i := 1; i <= 3; i++ {
+			write(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/progress", "params": map[string]interface{}{
+				"progressToken": p.Meta.ProgressToken, "progress": i, "total": 3, "message": "step",
+			}})
+		}
+		reply(m.ID, text("done"), nil)
+	case "fail":
+		result := text("something broke")
+		result["isError"] = true
+		reply(m.ID, result, nil)
+	case "slow":
+		ch := make(chan struct{})
+		mu.Lock()
+		waiting[string(m.ID)] = ch
+		mu.Unlock()
+		<-ch
+		// A cancelled request gets no response.
+	case "cancelled":
+		mu.Lock()
+		ids := strings.Join(cancelled, ",")
+		mu.Unlock()
+		reply(m.ID, text(ids), nil)
+	case "env":
+		reply(m.ID, text(os.Getenv("MCP_TEST_VALUE")), nil)
+	default:
+		reply(m.ID, nil, &rpcError{Code: -32602, Message: "unknown tool: " + p.Name})
+	}
+}
+
+// pngData is a 4x2 red PNG, base64 encoded.
+func pngData() string {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
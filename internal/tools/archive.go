@@ -0,0 +1,619 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"xq-agent/internal/config"
+)
+
+const (
+	defaultArchiveSize    = 512 << 20
+	defaultArchiveEntries = 10000
+	archiveListLimit      = 200
+)
+
+// archiveEntry describes one member of an archive.
+type archiveEntry struct {
+	Name    string // slash-separated, as stored
+	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
+	Dir     bool
+	Regular bool // false for links, devices and other special files
+}
+
+// ArchiveTool creates, lists and extracts zip, tar, tar.gz and tar.zst
+// archives. Every file it reads or writes goes through the path policy, and
+// entries that would land outside the destination are refused.
+type ArchiveTool struct {
+	Config  config.ArchiveConfig
+	Policy  *PathPolicy
+	Journal *Journal
+}
+
+func (t *ArchiveTool) Name() string { return "archive" }
+func (t *ArchiveTool) Description() string {
+	return "Create, list or extract zip, tar, tar.gz (.tgz) and tar.zst archives. " +
+		"The format follows the archive's extension. Use this instead of shell commands for compressing or unpacking files."
+}
+func (t *ArchiveTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"create", "list", "extract"},
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "The archive file",
+			},
+			"sources": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Files and directories to put in the archive (create). Each is stored under its own name.",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to extract into (default a folder named after the archive, next to it)",
+			},
+			"files": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Only extract these entries: exact names, directories or glob patterns like '*.csv'",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"zip", "tar", "tar.gz", "tar.zst"},
+				"description": "Override the format derived from the extension",
+			},
+			"overwrite": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Replace an existing archive (create) or existing files (extract)",
+			},
+		},
+		"required": []string{"action", "path"},
+	}
+}
+
+func (t *ArchiveTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *ArchiveTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Action      string   `json:"action"`
+		Path        string   `json:"path"`
+		Sources     []string `json:"sources"`
+		Destination string   `json:"destination"`
+		Files       []string `json:"files"`
+		Format      string   `json:"format"`
+		Overwrite   bool     `json:"overwrite"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	format, err := archiveFormat(input.Path, input.Format)
+	if err != nil {
+		return "", err
+	}
+
+	switch input.Action {
+	case "create":
+		return t.create(ctx, input.Path, format, input.Sources, input.Overwrite)
+	case "list":
+		path, err := t.Policy.CheckRead(t.Name(), input.Path)
+		if err != nil {
+			return "", err
+		}
+		return t.list(path, format)
+	case "extract":
+		path, err := t.Policy.CheckRead(t.Name(), input.Path)
+		if err != nil {
+			return "", err
+		}
+		return t.extract(ctx, path, format, input.Destination, input.Files, input.Overwrite)
+	}
+	return "", fmt.Errorf("unknown action %q", input.Action)
+}
+
+func (t *ArchiveTool) maxSize() int64 {
+	if t.Config.MaxSize > 0 {
+		return t.Config.MaxSize
+	}
+	return defaultArchiveSize
+}
+
+func (t *ArchiveTool) maxEntries() int {
+	if t.Config.MaxEntries > 0 {
+		return t.Config.MaxEntries
+	}
+	return defaultArchiveEntries
+}
+
+// archiveFormat picks the format from an explicit choice or the file name.
+func archiveFormat(name, explicit string) (string, error) {
+	if explicit != "" {
+		switch explicit {
+		case "zip", "tar", "tar.gz", "tar.zst":
+			return explicit, nil
+		case "tgz":
+			return "tar.gz", nil
+		}
+		return "", fmt.Errorf("unsupported format %q", explicit)
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return "tar.zst", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	}
+	return "", fmt.Errorf("cannot tell the archive format of %q, use .zip, .tar, .tar.gz or .tar.zst or give format", name)
+}
+
+// archiveBase strips the archive extension: "reports.tar.gz" -> "reports".
+func archiveBase(name string) string {
+	base := filepath.Base(name)
+	lower := strings.ToLower(base)
+	for _, ext := range []string{".tar.gz", ".tar.zst", ".tgz", ".tzst", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return base[:len(base)-len(ext)]
+		}
+	}
+	return base
+}
+
+// walkArchive calls fn for every entry with a reader for its content.
+func walkArchive(path, format string, fn func(e archiveEntry, r io.Reader) error) error {
+	if format == "zip" {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return fmt.Errorf("failed to open zip: %v", err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			mode := f.Mode()
+			e := archiveEntry{
+				Name:    f.Name,
+				Size:    int64(f.UncompressedSize64),
+				ModTime: f.Modified,
+				Mode:    mode,
+				Dir:     mode.IsDir() || strings.HasSuffix(f.Name, "/"),
+				Regular: mode.IsRegular() || mode.IsDir() || strings.HasSuffix(f.Name, "/"),
+			}
+			rc := io.NopCloser(bytes.NewReader(nil))
+			if e.Regular && !e.Dir {
+				if rc, err = f.Open(); err != nil {
+					return fmt.Errorf("%s: %v", f.Name, err)
+				}
+			}
+			err = fn(e, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip stream: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	case "tar.zst":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open zstd stream: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar: %v", err)
+		}
+		e := archiveEntry{
+			Name:    h.Name,
+			Size:    h.Size,
+			ModTime: h.ModTime,
+			Mode:    h.FileInfo().Mode(),
+			Dir:     h.Typeflag == tar.TypeDir,
+			Regular: h.Typeflag == tar.TypeReg || h.Typeflag == tar.TypeDir,
+		}
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if err := fn(e, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *ArchiveTool) list(path, format string) (string, error) {
+	var entries []archiveEntry
+	var total int64
+	err := walkArchive(path, format, func(e archiveEntry, r io.Reader) error {
+		if len(entries) >= t.maxEntries() {
+			return fmt.Errorf("archive has more than %d entries", t.maxEntries())
+		}
+		entries = append(entries, e)
+		total += e.Size
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Archive: %s (%s, %d entries, %s uncompressed)\n", path, format, len(entries), formatSize(total)))
+	for i, e := range entries {
+		if i == archiveListLimit {
+			sb.WriteString(fmt.Sprintf("... and %d more entries\n", len(entries)-archiveListLimit))
+			break
+		}
+		switch {
+		case e.Dir:
+			sb.WriteString(fmt.Sprintf("%10s  %s  %s\n", "dir", e.ModTime.Format("2006-01-02 15:04"), e.Name))
+		case !e.Regular:
+			sb.WriteString(fmt.Sprintf("%10s  %s  %s\n", "link", e.ModTime.Format("2006-01-02 15:04"), e.Name))
+		default:
+			sb.WriteString(fmt.Sprintf("%10s  %s  %s\n", formatSize(e.Size), e.ModTime.Format("2006-01-02 15:04"), e.Name))
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// entryTarget returns where an entry is extracted to, refusing names that
+// would escape dest ("zip slip").
+func entryTarget(dest, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || (len(slashed) > 1 && slashed[1] == ':') {
+		return "", fmt.Errorf("entry %q has an absolute path", name)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("entry %q points outside the destination", name)
+		}
+	}
+	clean := path.Clean(slashed)
+	if clean == "." {
+		return "", nil
+	}
+	return filepath.Join(dest, filepath.FromSlash(clean)), nil
+}
+
+// matchEntry reports whether name is selected by the files filter.
+func matchEntry(name string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	name = strings.TrimSuffix(name, "/")
+	for _, f := range filters {
+		f = strings.TrimSuffix(filepath.ToSlash(f), "/")
+		if name == f || strings.HasPrefix(name, f+"/") {
+			return true
+		}
+		if ok, _ := path.Match(f, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(f, path.Base(name)); ok && !strings.Contains(f, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *ArchiveTool) extract(ctx context.Context, archive, format, destination string, filters []string, overwrite bool) (string, error) {
+	if destination == "" {
+		destination = filepath.Join(filepath.Dir(archive), archiveBase(archive))
+	}
+	dest, err := t.Policy.CheckWrite(t.Name(), destination)
+	if err != nil {
+		return "", err
+	}
+
+	// First pass: check every entry before anything is written.
+	var count int
+	var total int64
+	var conflicts, skipped []string
+	targets := make(map[string]string)
+	err = walkArchive(archive, format, func(e archiveEntry, r io.Reader) error {
+		if count++; count > t.maxEntries() {
+			return fmt.Errorf("archive has more than %d entries", t.maxEntries())
+		}
+		if !matchEntry(e.Name, filters) {
+			return nil
+		}
+		target, err := entryTarget(dest, e.Name)
+		if err != nil || target == "" {
+			return err
+		}
+		if !e.Regular {
+			skipped = append(skipped, e.Name)
+			return nil
+		}
+		if total += e.Size; total > t.maxSize() {
+			return fmt.Errorf("archive expands to more than %s, the limit", formatSize(t.maxSize()))
+		}
+		if _, err := t.Policy.CheckWrite(t.Name(), target); err != nil {
+			return err
+		}
+		if info, err := os.Stat(target); err == nil && !e.Dir {
+			if info.IsDir() {
+				return fmt.Errorf("%s already exists as a directory", target)
+			}
+			if !overwrite {
+				conflicts = append(conflicts, e.Name)
+			}
+		}
+		targets[e.Name] = target
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(conflicts) > 0 {
+		return "", fmt.Errorf("files already exist in %s: %s (set overwrite to replace them)", dest, shortList(conflicts))
+	}
+	if len(targets) == 0 {
+		return "", fmt.Errorf("no entries match %v", filters)
+	}
+
+	// Second pass: write. Sizes in headers can lie, so the content read is
+	// limited as well.
+	var files, dirs int
+	remaining := t.maxSize()
+	err = walkArchive(archive, format, func(e archiveEntry, r io.Reader) error {
+		target, ok := targets[e.Name]
+		if !ok {
+			return nil
+		}
+		if e.Dir {
+			dirs++
+			return os.MkdirAll(target, 0755)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(r, remaining+1))
+		if err != nil {
+			return fmt.Errorf("%s: %v", e.Name, err)
+		}
+		if remaining -= int64(len(data)); remaining < 0 {
+			return fmt.Errorf("archive expands to more than %s, the limit", formatSize(t.maxSize()))
+		}
+		if err := t.Journal.WriteFile(ctx, t.Name(), target, data); err != nil {
+			return err
+		}
+		if !e.ModTime.IsZero() {
+			os.Chtimes(target, e.ModTime, e.ModTime)
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("extraction stopped after %d files: %v", files, err)
+	}
+
+	result := "Extracted " + countNoun(files, "file")
+	if dirs > 0 {
+		result += " and " + countNoun(dirs, "directory")
+	}
+	result += fmt.Sprintf(" (%s) to %s", formatSize(t.maxSize()-remaining), dest)
+	if len(skipped) > 0 {
+		result += fmt.Sprintf("\nSkipped links and special files: %s", shortList(skipped))
+	}
+	return result, nil
+}
+
+func (t *ArchiveTool) create(ctx context.Context, name, format string, sources []string, overwrite bool) (string, error) {
+	if len(sources) == 0 {
+		return "", fmt.Errorf("sources is required for create")
+	}
+	target, err := t.Policy.CheckWrite(t.Name(), name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(target); err == nil && !overwrite {
+		return "", fmt.Errorf("%s already exists (set overwrite to replace it)", target)
+	}
+
+	type member struct {
+		path string
+		name string
+		info fs.FileInfo
+	}
+	var members []member
+	var total int64
+	var skipped []string
+	for _, src := range sources {
+		root, err := t.Policy.CheckRead(t.Name(), src)
+		if err != nil {
+			return "", err
+		}
+		parent := filepath.Dir(root)
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == target {
+				return nil // the archive itself
+			}
+			if t.Policy.Denied(p) {
+				skipped = append(skipped, p)
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() && !info.IsDir() {
+				skipped = append(skipped, p)
+				return nil
+			}
+			if len(members) >= t.maxEntries() {
+				return fmt.Errorf("more than %d files", t.maxEntries())
+			}
+			if !info.IsDir() {
+				total += info.Size()
+			}
+			if total > t.maxSize() {
+				return fmt.Errorf("sources are larger than %s, the limit", formatSize(t.maxSize()))
+			}
+			rel, _ := filepath.Rel(parent, p)
+			members = append(members, member{path: p, name: filepath.ToSlash(rel), info: info})
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	var files int
+	if format == "zip" {
+		zw := zip.NewWriter(&buf)
+		for _, m := range members {
+			h, err := zip.FileInfoHeader(m.info)
+			if err != nil {
+				return "", err
+			}
+			h.Name = m.name
+			if m.info.IsDir() {
+				h.Name += "/"
+			} else {
+				h.Method = zip.Deflate
+			}
+			w, err := zw.CreateHeader(h)
+			if err != nil {
+				return "", err
+			}
+			if !m.info.IsDir() {
+				if err := copyInto(w, m.path); err != nil {
+					return "", err
+				}
+				files++
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+	} else {
+		var w io.WriteCloser = nopWriteCloser{&buf}
+		switch format {
+		case "tar.gz":
+			w = gzip.NewWriter(&buf)
+		case "tar.zst":
+			if w, err = zstd.NewWriter(&buf); err != nil {
+				return "", err
+			}
+		}
+		tw := tar.NewWriter(w)
+		for _, m := range members {
+			h, err := tar.FileInfoHeader(m.info, "")
+			if err != nil {
+				return "", err
+			}
+			h.Name = m.name
+			if m.info.IsDir() {
+				h.Name += "/"
+			}
+			// Owner names of the local machine mean nothing elsewhere.
+			h.Uname, h.Gname, h.Uid, h.Gid = "", "", 0, 0
+			if err := tw.WriteHeader(h); err != nil {
+				return "", err
+			}
+			if !m.info.IsDir() {
+				if err := copyInto(tw, m.path); err != nil {
+					return "", err
+				}
+				files++
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := t.Journal.WriteFile(ctx, t.Name(), target, buf.Bytes()); err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("Created %s (%s, %s, %s from %s)", target, format, countNoun(files, "file"), formatSize(int64(buf.Len())), formatSize(total))
+	if len(skipped) > 0 {
+		result += fmt.Sprintf("\nSkipped links, special files and denied paths: %s", shortList(skipped))
+	}
+	return result, nil
+}
+
+// countNoun formats "1 file", "3 files" or "2 directories".
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "y") {
+		return fmt.Sprintf("%d %sies", n, noun[:len(noun)-1])
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// shortList joins the first ten items.
+func shortList(items []string) string {
+	if len(items) > 10 {
+		return strings.Join(items[:10], ", ") + fmt.Sprintf(" and %d more", len(items)-10)
+	}
+	return strings.Join(items, ", ")
+}
+
+func copyInto(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
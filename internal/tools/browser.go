@@ -4,18 +4,74 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
-	"time"
+	"unicode/utf8"
 
+	"github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
 )
 
-type BrowserOpenTool struct{}
+// All browser tools work on the tabs of the calling session. Tabs are
+// referenced by the IDs printed in every result ("t1", "t2", ...).
+
+func tabIDProperty() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "string",
+		"description": "Tab ID (e.g. 't1'). Defaults to the active tab.",
+	}
+}
+
+func selectorProperty(what string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "string",
+		"description": "CSS selector of the " + what,
+	}
+}
+
+// pageHeader describes the tab's current page for tool results.
+func pageHeader(ctx context.Context, m *BrowserManager, tab *browserTab) string {
+	var title, location string
+	m.run(ctx, tab, chromedp.Title(&title), chromedp.Location(&location))
+	return fmt.Sprintf("[Tab %s] %s\nURL: %s", tab.id, title, location)
+}
+
+// evalJSON evaluates a JavaScript expression in the tab and returns its result
+// as indented JSON.
+func evalJSON(ctx context.Context, m *BrowserManager, tab *browserTab, expression string) (string, error) {
+	var res interface{}
+	err := m.run(ctx, tab, chromedp.Evaluate(expression, &res, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}))
+	if err != nil {
+		return "", err
+	}
+	out, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// truncate cuts s to at most max bytes, on a rune boundary.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "...(truncated)"
+}
+
+type BrowserOpenTool struct {
+	Browser *BrowserManager
+}
 
 func (t *BrowserOpenTool) Name() string { return "browser_open" }
 func (t *BrowserOpenTool) Description() string {
-	return "Open a URL in a headless browser and return the text content of the page."
+	return "Open a URL in the browser and return the main content of the page as Markdown, in pages. " +
+		"Omit the url to keep reading the tab's current page. The tab stays open for follow-up actions (click, type, ...)."
 }
 func (t *BrowserOpenTool) Schema() interface{} {
 	return map[string]interface{}{
@@ -23,55 +79,685 @@ func (t *BrowserOpenTool) Schema() interface{} {
 		"properties": map[string]interface{}{
 			"url": map[string]interface{}{
 				"type":        "string",
-				"description": "The URL to visit",
+				"description": "The URL to visit (optional, defaults to the tab's current page)",
+			},
+			"tab_id": tabIDProperty(),
+			"new_tab": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Open the URL in a new tab instead of the active one",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"article", "full", "text"},
+				"description": "article: main content as Markdown (default); full: whole page as Markdown; text: plain visible text",
+			},
+			"page": map[string]interface{}{
+				"type":        "integer",
+				"description": "Page of the content to return, starting at 1",
+			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Character offset to continue reading from (alternative to page)",
 			},
 		},
-		"required": []string{"url"},
 	}
 }
 func (t *BrowserOpenTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserOpenTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
 	var input struct {
-		URL string `json:"url"`
+		URL    string `json:"url"`
+		TabID  string `json:"tab_id"`
+		NewTab bool   `json:"new_tab"`
+		Format string `json:"format"`
+		Page   int    `json:"page"`
+		Offset int    `json:"offset"`
 	}
 	if err := json.Unmarshal(args, &input); err != nil {
 		return "", fmt.Errorf("invalid arguments: %v", err)
 	}
 	input.URL = strings.TrimSpace(input.URL)
+	if input.URL == "" && input.NewTab {
+		return "", fmt.Errorf("url is required for a new tab")
+	}
 
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
-		chromedp.Flag("disable-software-rasterizer", true),
-	)
+	tab, err := t.Browser.tab(ctx, input.TabID, input.NewTab)
+	if err != nil {
+		return "", err
+	}
+	var actions []chromedp.Action
+	if input.URL != "" {
+		actions = append(actions, chromedp.Navigate(input.URL))
+	}
+	var location, res string
+	actions = append(actions, chromedp.Location(&location))
+	if input.Format == "text" {
+		actions = append(actions, chromedp.Text("body", &res, chromedp.ByQuery))
+	} else {
+		actions = append(actions, chromedp.OuterHTML("html", &res, chromedp.ByQuery))
+	}
+	if err := t.Browser.run(ctx, tab, actions...); err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
 
-	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancelAlloc()
+	content := res
+	switch input.Format {
+	case "", "article":
+		article, err := ExtractArticle(strings.NewReader(res), location)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse page: %v", err)
+		}
+		content = article.Markdown
+	case "full":
+		if content, err = PageToMarkdown(strings.NewReader(res), location); err != nil {
+			return "", fmt.Errorf("failed to parse page: %v", err)
+		}
+	case "text":
+	default:
+		return "", fmt.Errorf("unknown format %q", input.Format)
+	}
+	return pageHeader(ctx, t.Browser, tab) + "\n\n" + pageWindow(content, input.Page, input.Offset, 0), nil
+}
 
-	ctx, cancel := chromedp.NewContext(allocCtx)
-	defer cancel()
+type BrowserClickTool struct {
+	Browser *BrowserManager
+}
 
-	ctx, cancel = context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-	var res string
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(input.URL),
-		chromedp.Text("body", &res),
-	)
+func (t *BrowserClickTool) Name() string { return "browser_click" }
+func (t *BrowserClickTool) Description() string {
+	return "Click an element in a browser tab."
+}
+func (t *BrowserClickTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"selector": selectorProperty("element to click"),
+			"tab_id":   tabIDProperty(),
+		},
+		"required": []string{"selector"},
+	}
+}
+func (t *BrowserClickTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserClickTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Selector string `json:"selector"`
+		TabID    string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
 	if err != nil {
+		return "", err
+	}
+	if err := t.Browser.run(ctx, tab, chromedp.Click(input.Selector, chromedp.ByQuery, chromedp.NodeVisible)); err != nil {
 		return "", fmt.Errorf("browser error: %v", err)
 	}
-	if len(res) > 2000 {
-		res = res[:2000] + "...(truncated)"
+	return fmt.Sprintf("Clicked %s\n%s", input.Selector, pageHeader(ctx, t.Browser, tab)), nil
+}
+
+type BrowserTypeTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserTypeTool) Name() string { return "browser_type" }
+func (t *BrowserTypeTool) Description() string {
+	return "Type text into an input field in a browser tab, optionally clearing it first and pressing Enter afterwards."
+}
+func (t *BrowserTypeTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"selector": selectorProperty("input field"),
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "The text to type",
+			},
+			"clear": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Clear the field before typing",
+			},
+			"submit": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Press Enter after typing",
+			},
+			"tab_id": tabIDProperty(),
+		},
+		"required": []string{"selector", "text"},
+	}
+}
+func (t *BrowserTypeTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserTypeTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Selector string `json:"selector"`
+		Text     string `json:"text"`
+		Clear    bool   `json:"clear"`
+		Submit   bool   `json:"submit"`
+		TabID    string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	actions := []chromedp.Action{chromedp.WaitVisible(input.Selector, chromedp.ByQuery)}
+	if input.Clear {
+		actions = append(actions, chromedp.Clear(input.Selector, chromedp.ByQuery))
+	}
+	actions = append(actions, chromedp.SendKeys(input.Selector, input.Text, chromedp.ByQuery))
+	if input.Submit {
+		actions = append(actions, chromedp.SendKeys(input.Selector, kb.Enter, chromedp.ByQuery))
+	}
+	if err := t.Browser.run(ctx, tab, actions...); err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+	return fmt.Sprintf("Typed into %s\n%s", input.Selector, pageHeader(ctx, t.Browser, tab)), nil
+}
+
+type BrowserSelectTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserSelectTool) Name() string { return "browser_select" }
+func (t *BrowserSelectTool) Description() string {
+	return "Choose an option of a <select> element by its value or visible label."
+}
+func (t *BrowserSelectTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"selector": selectorProperty("<select> element"),
+			"value": map[string]interface{}{
+				"type":        "string",
+				"description": "Option value or visible label",
+			},
+			"tab_id": tabIDProperty(),
+		},
+		"required": []string{"selector", "value"},
+	}
+}
+func (t *BrowserSelectTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserSelectTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Selector string `json:"selector"`
+		Value    string `json:"value"`
+		TabID    string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	sel, _ := json.Marshal(input.Selector)
+	val, _ := json.Marshal(input.Value)
+	script := fmt.Sprintf(`(() => {
+		const el = document.querySelector(%s);
+		if (!el) return "error: element not found";
+		const want = %s;
+		const opt = Array.from(el.options || []).find(o => o.value === want || o.text.trim() === want);
+		if (!opt) return "error: no option " + want;
+		el.value = opt.value;
+		el.dispatchEvent(new Event("input", {bubbles: true}));
+		el.dispatchEvent(new Event("change", {bubbles: true}));
+		return "Selected " + opt.text.trim() + " (" + opt.value + ")";
+	})()`, sel, val)
+	var res string
+	if err := t.Browser.run(ctx, tab, chromedp.Evaluate(script, &res)); err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+	if strings.HasPrefix(res, "error: ") {
+		return "", fmt.Errorf("%s", strings.TrimPrefix(res, "error: "))
 	}
 	return res, nil
 }
 
-type BrowserScreenshotTool struct{}
+type BrowserScrollTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserScrollTool) Name() string { return "browser_scroll" }
+func (t *BrowserScrollTool) Description() string {
+	return "Scroll a browser tab up, down, to the top or bottom, or scroll an element into view."
+}
+func (t *BrowserScrollTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"direction": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"down", "up", "top", "bottom"},
+				"description": "Scroll direction (default: down)",
+			},
+			"amount": map[string]interface{}{
+				"type":        "integer",
+				"description": "Pixels to scroll for up/down (default: one screen)",
+			},
+			"selector": selectorProperty("element to scroll into view (overrides direction)"),
+			"tab_id":   tabIDProperty(),
+		},
+	}
+}
+func (t *BrowserScrollTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserScrollTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Direction string `json:"direction"`
+		Amount    int    `json:"amount"`
+		Selector  string `json:"selector"`
+		TabID     string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+
+	if input.Selector != "" {
+		if err := t.Browser.run(ctx, tab, chromedp.ScrollIntoView(input.Selector, chromedp.ByQuery)); err != nil {
+			return "", fmt.Errorf("browser error: %v", err)
+		}
+		return fmt.Sprintf("Scrolled %s into view", input.Selector), nil
+	}
+
+	amount := "window.innerHeight"
+	if input.Amount > 0 {
+		amount = fmt.Sprint(input.Amount)
+	}
+	var script string
+	switch input.Direction {
+	case "", "down":
+		script = "window.scrollBy(0, " + amount + ")"
+	case "up":
+		script = "window.scrollBy(0, -" + amount + ")"
+	case "top":
+		script = "window.scrollTo(0, 0)"
+	case "bottom":
+		script = "window.scrollTo(0, document.body.scrollHeight)"
+	default:
+		return "", fmt.Errorf("unknown direction %q", input.Direction)
+	}
+	var pos string
+	err = t.Browser.run(ctx, tab, chromedp.Evaluate(script+`; Math.round(window.scrollY) + " / " + document.body.scrollHeight`, &pos))
+	if err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+	return "Scroll position: " + pos, nil
+}
+
+type BrowserWaitTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserWaitTool) Name() string { return "browser_wait" }
+func (t *BrowserWaitTool) Description() string {
+	return "Wait until an element is visible, present, or gone in a browser tab."
+}
+func (t *BrowserWaitTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"selector": selectorProperty("element to wait for"),
+			"state": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"visible", "present", "gone"},
+				"description": "State to wait for (default: visible)",
+			},
+			"tab_id": tabIDProperty(),
+		},
+		"required": []string{"selector"},
+	}
+}
+func (t *BrowserWaitTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserWaitTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Selector string `json:"selector"`
+		State    string `json:"state"`
+		TabID    string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	if input.State == "" {
+		input.State = "visible"
+	}
+	var action chromedp.Action
+	switch input.State {
+	case "visible":
+		action = chromedp.WaitVisible(input.Selector, chromedp.ByQuery)
+	case "present":
+		action = chromedp.WaitReady(input.Selector, chromedp.ByQuery)
+	case "gone":
+		action = chromedp.WaitNotPresent(input.Selector, chromedp.ByQuery)
+	default:
+		return "", fmt.Errorf("unknown state %q", input.State)
+	}
+	if err := t.Browser.run(ctx, tab, action); err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+	return fmt.Sprintf("%s is %s", input.Selector, input.State), nil
+}
+
+type BrowserEvalTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserEvalTool) Name() string { return "browser_eval" }
+func (t *BrowserEvalTool) Description() string {
+	return "Evaluate a JavaScript expression in a browser tab and return the result as JSON. Promises are awaited."
+}
+func (t *BrowserEvalTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"expression": map[string]interface{}{
+				"type":        "string",
+				"description": "JavaScript expression, e.g. document.title",
+			},
+			"tab_id": tabIDProperty(),
+		},
+		"required": []string{"expression"},
+	}
+}
+func (t *BrowserEvalTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserEvalTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Expression string `json:"expression"`
+		TabID      string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	res, err := evalJSON(ctx, t.Browser, tab, input.Expression)
+	if err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+	return truncate(res, 4000), nil
+}
+
+type BrowserBackTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserBackTool) Name() string { return "browser_back" }
+func (t *BrowserBackTool) Description() string {
+	return "Go back to the previous page in a browser tab."
+}
+func (t *BrowserBackTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tab_id": tabIDProperty(),
+		},
+	}
+}
+func (t *BrowserBackTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserBackTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		TabID string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Browser.run(ctx, tab, chromedp.NavigateBack()); err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+	return pageHeader(ctx, t.Browser, tab), nil
+}
+
+type BrowserLinksTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserLinksTool) Name() string { return "browser_links" }
+func (t *BrowserLinksTool) Description() string {
+	return "List the links on the current page of a browser tab (text and absolute URL)."
+}
+func (t *BrowserLinksTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"description": "Only return links whose text or URL contains this string",
+			},
+			"tab_id": tabIDProperty(),
+		},
+	}
+}
+func (t *BrowserLinksTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserLinksTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Filter string `json:"filter"`
+		TabID  string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	var links []struct {
+		Text string `json:"text"`
+		Href string `json:"href"`
+	}
+	script := `Array.from(document.querySelectorAll("a[href]")).map(a => ({text: a.innerText.trim().replace(/\s+/g, " "), href: a.href}))`
+	if err := t.Browser.run(ctx, tab, chromedp.Evaluate(script, &links)); err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+
+	filter := strings.ToLower(input.Filter)
+	var sb strings.Builder
+	count := 0
+	for _, l := range links {
+		if filter != "" && !strings.Contains(strings.ToLower(l.Text+" "+l.Href), filter) {
+			continue
+		}
+		if count == 200 {
+			sb.WriteString("...(more links omitted, use filter)\n")
+			break
+		}
+		sb.WriteString(fmt.Sprintf("- [%s](%s)\n", l.Text, l.Href))
+		count++
+	}
+	if count == 0 {
+		return "No links found.", nil
+	}
+	return sb.String(), nil
+}
+
+type BrowserFormsTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserFormsTool) Name() string { return "browser_forms" }
+func (t *BrowserFormsTool) Description() string {
+	return "List the forms on the current page of a browser tab with their fields and CSS selectors for browser_type/browser_select/browser_click."
+}
+func (t *BrowserFormsTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tab_id": tabIDProperty(),
+		},
+	}
+}
+func (t *BrowserFormsTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserFormsTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		TabID string `json:"tab_id"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	script := `(() => {
+		const unique = (sel) => document.querySelectorAll(sel).length === 1;
+		// The shortest of id, name or a path from the nearest unique id;
+		// nth-of-type only counts siblings, so every step of the path needs one.
+		const selectorFor = (el) => {
+			if (el.id && unique("#" + CSS.escape(el.id))) return "#" + CSS.escape(el.id);
+			const tag = el.tagName.toLowerCase();
+			if (el.name && unique(tag + "[name=" + JSON.stringify(el.name) + "]")) return tag + "[name=" + JSON.stringify(el.name) + "]";
+			const parts = [];
+			for (let e = el; e && e !== document.documentElement; e = e.parentElement) {
+				if (e !== el && e.id && unique("#" + CSS.escape(e.id))) {
+					parts.unshift("#" + CSS.escape(e.id));
+					return parts.join(" > ");
+				}
+				let n = 1;
+				for (let s = e.previousElementSibling; s; s = s.previousElementSibling) {
+					if (s.tagName === e.tagName) n++;
+				}
+				parts.unshift(e.tagName.toLowerCase() + ":nth-of-type(" + n + ")");
+			}
+			return "html > " + parts.join(" > ");
+		};
+		const labelFor = (el) => {
+			if (el.labels && el.labels.length) return el.labels[0].innerText.trim();
+			return el.getAttribute("aria-label") || el.placeholder || "";
+		};
+		return Array.from(document.forms).map((f) => ({
+			form: selectorFor(f),
+			action: f.action,
+			method: (f.method || "get").toUpperCase(),
+			fields: Array.from(f.elements).filter(el => el.type !== "hidden").map(el => ({
+				selector: selectorFor(el),
+				tag: el.tagName.toLowerCase(),
+				type: el.type || "",
+				name: el.name || "",
+				label: labelFor(el),
+				options: el.tagName === "SELECT" ? Array.from(el.options).map(o => o.text.trim()).slice(0, 20) : undefined,
+			})),
+		}));
+	})()`
+	res, err := evalJSON(ctx, t.Browser, tab, script)
+	if err != nil {
+		return "", fmt.Errorf("browser error: %v", err)
+	}
+	if res == "[]" {
+		return "No forms found.", nil
+	}
+	return truncate(res, 6000), nil
+}
+
+type BrowserTabsTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserTabsTool) Name() string { return "browser_tabs" }
+func (t *BrowserTabsTool) Description() string {
+	return "List the open browser tabs of this conversation."
+}
+func (t *BrowserTabsTool) Schema() interface{} { return map[string]interface{}{"type": "object"} }
+func (t *BrowserTabsTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserTabsTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	tabs, active := t.Browser.tabs(ctx)
+	if len(tabs) == 0 {
+		return "No open tabs.", nil
+	}
+	var sb strings.Builder
+	for _, tab := range tabs {
+		sb.WriteString(pageHeader(ctx, t.Browser, tab))
+		if tab.id == active {
+			sb.WriteString("\n(active)")
+		}
+		sb.WriteString("\n\n")
+	}
+	return sb.String(), nil
+}
+
+type BrowserCloseTool struct {
+	Browser *BrowserManager
+}
+
+func (t *BrowserCloseTool) Name() string { return "browser_close" }
+func (t *BrowserCloseTool) Description() string {
+	return "Close a browser tab, or all tabs of this conversation (which also clears its cookies)."
+}
+func (t *BrowserCloseTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tab_id": tabIDProperty(),
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Close every tab and end the browser session",
+			},
+		},
+	}
+}
+func (t *BrowserCloseTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserCloseTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		TabID string `json:"tab_id"`
+		All   bool   `json:"all"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if input.All {
+		t.Browser.CloseSession(SessionFrom(ctx))
+		return "Browser session closed.", nil
+	}
+	if err := t.Browser.closeTab(ctx, input.TabID); err != nil {
+		return "", err
+	}
+	return "Tab closed.", nil
+}
+
+type BrowserScreenshotTool struct {
+	Browser *BrowserManager
+	Policy  *PathPolicy
+	Journal *Journal
+}
 
 func (t *BrowserScreenshotTool) Name() string { return "browser_screenshot" }
 func (t *BrowserScreenshotTool) Description() string {
-	return "Take a screenshot of a URL and save it to a file."
+	return "Take a screenshot of a browser tab (or of a URL, opened in the active tab) and look at it. Optionally save it to a file."
 }
 func (t *BrowserScreenshotTool) Schema() interface{} {
 	return map[string]interface{}{
@@ -79,51 +765,74 @@ func (t *BrowserScreenshotTool) Schema() interface{} {
 		"properties": map[string]interface{}{
 			"url": map[string]interface{}{
 				"type":        "string",
-				"description": "The URL to visit",
+				"description": "The URL to visit (optional, defaults to the tab's current page)",
 			},
 			"output": map[string]interface{}{
 				"type":        "string",
-				"description": "Output file path (e.g. screenshot.png)",
+				"description": "Output file path (e.g. screenshot.png), optional",
 			},
+			"full_page": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Capture the whole page instead of the visible viewport",
+			},
+			"tab_id": tabIDProperty(),
 		},
-		"required": []string{"url", "output"},
 	}
 }
 func (t *BrowserScreenshotTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *BrowserScreenshotTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
 	var input struct {
-		URL    string `json:"url"`
-		Output string `json:"output"`
+		URL      string `json:"url"`
+		Output   string `json:"output"`
+		FullPage bool   `json:"full_page"`
+		TabID    string `json:"tab_id"`
 	}
 	if err := json.Unmarshal(args, &input); err != nil {
 		return "", err
 	}
 	input.URL = strings.TrimSpace(input.URL)
+	output := ""
+	if input.Output != "" {
+		var err error
+		if output, err = t.Policy.CheckWrite(t.Name(), input.Output); err != nil {
+			return "", err
+		}
+	}
 
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
-		chromedp.Flag("disable-software-rasterizer", true),
-	)
-
-	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancelAlloc()
-
-	ctx, cancel := chromedp.NewContext(allocCtx)
-	defer cancel()
-
-	ctx, cancel = context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
+	tab, err := t.Browser.tab(ctx, input.TabID, false)
+	if err != nil {
+		return "", err
+	}
+	var actions []chromedp.Action
+	if input.URL != "" {
+		actions = append(actions, chromedp.Navigate(input.URL))
+	}
 	var buf []byte
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(input.URL),
-		chromedp.CaptureScreenshot(&buf),
-	)
+	var location string
+	if input.FullPage {
+		actions = append(actions, chromedp.FullScreenshot(&buf, 100))
+	} else {
+		actions = append(actions, chromedp.CaptureScreenshot(&buf))
+	}
+	actions = append(actions, chromedp.Location(&location))
+	if err := t.Browser.run(ctx, tab, actions...); err != nil {
+		return "", err
+	}
+
+	img, err := LoadImage(buf, location, DefaultImageSize)
 	if err != nil {
 		return "", err
 	}
-	if err := os.WriteFile(input.Output, buf, 0644); err != nil {
-		return "", fmt.Errorf("failed to save screenshot: %v", err)
+	AttachImage(ctx, img)
+
+	result := fmt.Sprintf("Screenshot of tab %s (%s)", tab.id, location)
+	if output != "" {
+		if err := t.Journal.WriteFile(ctx, t.Name(), output, buf); err != nil {
+			return "", fmt.Errorf("failed to save screenshot: %v", err)
+		}
+		result += " saved to " + output
 	}
-	return fmt.Sprintf("Screenshot saved to %s", input.Output), nil
+	return result, nil
 }
@@ -0,0 +1,269 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+
+	"xq-agent/internal/config"
+)
+
+// BrowserManager shares one headless Chrome between all conversations. Each
+// session gets its own browser context (separate cookies and storage) and a
+// set of tabs that survive between tool calls, so multi-page flows such as
+// logging in work.
+type BrowserManager struct {
+	mu         sync.Mutex
+	cfg        config.BrowserConfig
+	root       context.Context // first tab of the browser process
+	cancelRoot context.CancelFunc
+	sessions   map[string]*browserSession
+	stopSweep  chan struct{} // closed to stop expiring idle sessions
+}
+
+type browserSession struct {
+	owner    context.Context // hidden blank tab owning the browser context
+	cancel   context.CancelFunc
+	tabs     map[string]*browserTab
+	nextID   int
+	active   string
+	lastUsed time.Time
+}
+
+type browserTab struct {
+	id     string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewBrowserManager(cfg config.BrowserConfig) *BrowserManager {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 30 * time.Minute
+	}
+	return &BrowserManager{
+		cfg:      cfg,
+		sessions: make(map[string]*browserSession),
+	}
+}
+
+// Close shuts down every session and the browser process.
+func (m *BrowserManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sessions {
+		s.cancel()
+		delete(m.sessions, id)
+	}
+	m.stopLocked()
+}
+
+// stopLocked shuts down the browser process.
+func (m *BrowserManager) stopLocked() {
+	if m.stopSweep != nil {
+		close(m.stopSweep)
+		m.stopSweep = nil
+	}
+	if m.cancelRoot != nil {
+		m.cancelRoot()
+		m.cancelRoot = nil
+		m.root = nil
+	}
+}
+
+// sweep closes sessions that have been idle for longer than IdleTimeout,
+// and the browser once no session is left.
+func (m *BrowserManager) sweep(stop chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		for id, s := range m.sessions {
+			if time.Since(s.lastUsed) > m.cfg.IdleTimeout {
+				s.cancel()
+				delete(m.sessions, id)
+			}
+		}
+		if len(m.sessions) == 0 {
+			m.stopLocked()
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Unlock()
+	}
+}
+
+// CloseSession closes all tabs of a session and discards its cookies.
+func (m *BrowserManager) CloseSession(session string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[session]; ok {
+		s.cancel()
+		delete(m.sessions, session)
+	}
+}
+
+// startLocked launches Chrome if it is not running (or has died).
+func (m *BrowserManager) startLocked() error {
+	if m.root != nil && m.root.Err() == nil {
+		return nil
+	}
+	if m.cancelRoot != nil {
+		m.cancelRoot()
+	}
+	// Sessions belonged to the old process.
+	m.sessions = make(map[string]*browserSession)
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", !m.cfg.ShowWindow),
+		chromedp.Flag("disable-gpu", true),
+		chromedp.Flag("no-sandbox", true),
+		chromedp.Flag("disable-software-rasterizer", true),
+	)
+	if m.cfg.ChromePath != "" {
+		opts = append(opts, chromedp.ExecPath(m.cfg.ChromePath))
+	}
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	root, cancelRoot := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(root); err != nil {
+		cancelRoot()
+		cancelAlloc()
+		return fmt.Errorf("failed to start browser: %v", err)
+	}
+	m.root = root
+	m.cancelRoot = func() {
+		cancelRoot()
+		cancelAlloc()
+	}
+	if m.stopSweep == nil {
+		m.stopSweep = make(chan struct{})
+		go m.sweep(m.stopSweep)
+	}
+	return nil
+}
+
+func (m *BrowserManager) sessionLocked(session string) (*browserSession, error) {
+	if err := m.startLocked(); err != nil {
+		return nil, err
+	}
+	if s, ok := m.sessions[session]; ok {
+		s.lastUsed = time.Now()
+		return s, nil
+	}
+	owner, cancel := chromedp.NewContext(m.root, chromedp.WithNewBrowserContext())
+	if err := chromedp.Run(owner); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create browser session: %v", err)
+	}
+	s := &browserSession{
+		owner:    owner,
+		cancel:   cancel,
+		tabs:     make(map[string]*browserTab),
+		lastUsed: time.Now(),
+	}
+	m.sessions[session] = s
+	return s, nil
+}
+
+// tab returns the tab with the given ID. An empty ID selects the session's
+// active tab, or opens a new one if there is none. newTab forces a new tab.
+func (m *BrowserManager) tab(ctx context.Context, tabID string, newTab bool) (*browserTab, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.sessionLocked(SessionFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if tabID != "" {
+		tab, ok := s.tabs[tabID]
+		if !ok {
+			return nil, fmt.Errorf("unknown tab %q, use browser_tabs to list open tabs", tabID)
+		}
+		s.active = tabID
+		return tab, nil
+	}
+	if !newTab {
+		if tab, ok := s.tabs[s.active]; ok {
+			return tab, nil
+		}
+	}
+
+	tabCtx, cancel := chromedp.NewContext(s.owner)
+	if err := chromedp.Run(tabCtx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open tab: %v", err)
+	}
+	s.nextID++
+	tab := &browserTab{id: fmt.Sprintf("t%d", s.nextID), ctx: tabCtx, cancel: cancel}
+	s.tabs[tab.id] = tab
+	s.active = tab.id
+	return tab, nil
+}
+
+// closeTab closes one tab of the calling session.
+func (m *BrowserManager) closeTab(ctx context.Context, tabID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[SessionFrom(ctx)]
+	if !ok {
+		return fmt.Errorf("no open browser session")
+	}
+	if tabID == "" {
+		tabID = s.active
+	}
+	tab, ok := s.tabs[tabID]
+	if !ok {
+		return fmt.Errorf("unknown tab %q", tabID)
+	}
+	tab.cancel()
+	delete(s.tabs, tabID)
+	if s.active == tabID {
+		s.active = ""
+	}
+	return nil
+}
+
+// tabs lists the tab IDs of the calling session in creation order, and the
+// currently active one.
+func (m *BrowserManager) tabs(ctx context.Context) ([]*browserTab, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[SessionFrom(ctx)]
+	if !ok {
+		return nil, ""
+	}
+	tabs := make([]*browserTab, 0, len(s.tabs))
+	for _, tab := range s.tabs {
+		tabs = append(tabs, tab)
+	}
+	sort.Slice(tabs, func(i, j int) bool {
+		return len(tabs[i].id) < len(tabs[j].id) || (len(tabs[i].id) == len(tabs[j].id) && tabs[i].id < tabs[j].id)
+	})
+	return tabs, s.active
+}
+
+// run executes actions in the tab with the configured timeout. Cancelling ctx
+// (the tool call) aborts the actions but keeps the tab open.
+func (m *BrowserManager) run(ctx context.Context, tab *browserTab, actions ...chromedp.Action) error {
+	runCtx, cancel := context.WithTimeout(tab.ctx, m.cfg.Timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	return chromedp.Run(runCtx, actions...)
+}
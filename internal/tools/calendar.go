@@ -0,0 +1,149 @@
+package tools
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed holidays.json
+var holidaysJSON []byte
+
+// Calendar knows public holidays and the weekend days that are worked in
+// exchange for them.
+type Calendar struct {
+	Region   string    `json:"region"`
+	Source   string    `json:"source"`
+	Holidays []Holiday `json:"holidays"`
+
+	off  map[string]string // date -> holiday name
+	work map[string]string // weekend date worked -> holiday name
+}
+
+type Holiday struct {
+	Name     string   `json:"name"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Workdays []string `json:"workdays"`
+}
+
+var (
+	calendarOnce sync.Once
+	calendar     *Calendar
+)
+
+// defaultCalendar returns the calendar bundled with the binary.
+func defaultCalendar() *Calendar {
+	calendarOnce.Do(func() {
+		c, err := ParseCalendar(holidaysJSON)
+		if err != nil {
+			log.Printf("Failed to load holiday calendar: %v", err)
+			c = &Calendar{}
+		}
+		calendar = c
+	})
+	return calendar
+}
+
+// ParseCalendar reads a calendar in the format of holidays.json.
+func ParseCalendar(data []byte) (*Calendar, error) {
+	var c Calendar
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	c.off = make(map[string]string)
+	c.work = make(map[string]string)
+	for _, h := range c.Holidays {
+		start, err := time.Parse("2006-01-02", h.Start)
+		if err != nil {
+			return nil, fmt.Errorf("holiday %s: %v", h.Name, err)
+		}
+		end, err := time.Parse("2006-01-02", h.End)
+		if err != nil {
+			return nil, fmt.Errorf("holiday %s: %v", h.Name, err)
+		}
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+			c.off[d.Format("2006-01-02")] = h.Name
+		}
+		for _, w := range h.Workdays {
+			c.work[w] = h.Name
+		}
+	}
+	sort.Slice(c.Holidays, func(i, j int) bool { return c.Holidays[i].Start < c.Holidays[j].Start })
+	return &c, nil
+}
+
+// IsWorkingDay reports whether d is a working day, and the holiday that
+// makes it unusual, if any.
+func (c *Calendar) IsWorkingDay(d time.Time) (bool, string) {
+	key := d.Format("2006-01-02")
+	if name, ok := c.off[key]; ok {
+		return false, name
+	}
+	if name, ok := c.work[key]; ok {
+		return true, name
+	}
+	return d.Weekday() != time.Saturday && d.Weekday() != time.Sunday, ""
+}
+
+// WorkingDays counts working days from a up to but excluding b's date,
+// negative when b is earlier.
+func (c *Calendar) WorkingDays(a, b time.Time) int {
+	sign := 1
+	if b.Before(a) {
+		a, b, sign = b, a, -1
+	}
+	b = b.In(a.Location())
+	d := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, a.Location())
+	end := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, a.Location())
+	n := 0
+	for ; d.Before(end); d = d.AddDate(0, 0, 1) {
+		if ok, _ := c.IsWorkingDay(d); ok {
+			n++
+		}
+	}
+	return sign * n
+}
+
+// Describe lists the holidays of year. With showDay it also says whether day
+// is a working day.
+func (c *Calendar) Describe(year int, day time.Time, showDay bool) (string, error) {
+	var sb strings.Builder
+	if showDay {
+		working, name := c.IsWorkingDay(day)
+		status := "a working day"
+		if !working {
+			status = "a day off"
+		}
+		if name != "" {
+			status += " (" + name + ")"
+		}
+		sb.WriteString(fmt.Sprintf("%s is %s.\n\n", day.Format("2006-01-02 Monday"), status))
+	}
+
+	prefix := fmt.Sprintf("%d-", year)
+	found := false
+	for _, h := range c.Holidays {
+		if !strings.HasPrefix(h.Start, prefix) {
+			continue
+		}
+		if !found {
+			sb.WriteString(fmt.Sprintf("Holidays %d (%s):\n", year, c.Region))
+			found = true
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %s to %s", h.Name, h.Start, h.End))
+		if len(h.Workdays) > 0 {
+			sb.WriteString(", make-up working days " + strings.Join(h.Workdays, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	if !found {
+		sb.WriteString(fmt.Sprintf("No holiday data for %d, only weekends are treated as days off.", year))
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestIsWorkingDay(t *testing.T) {
+	c := defaultCalendar()
+	tests := []struct {
+		day     time.Time
+		working bool
+		holiday string
+	}{
+		{day(2026, 10, 19), true, ""},                 // Monday
+		{day(2026, 10, 18), false, ""},                // Sunday
+		{day(2026, 10, 1), false, "国庆节 National Day"}, // Thursday, holiday
+		{day(2026, 10, 7), false, "国庆节 National Day"},
+		{day(2026, 9, 20), true, "国庆节 National Day"}, // Sunday, worked
+		{day(2026, 10, 10), true, "国庆节 National Day"},
+		{day(2026, 2, 16), false, "春节 Spring Festival"},
+	}
+	for _, tt := range tests {
+		working, holiday := c.IsWorkingDay(tt.day)
+		if working != tt.working || holiday != tt.holiday {
+			t.Errorf("IsWorkingDay(%s) = %v, %q; want %v, %q", tt.day.Format("2006-01-02"), working, holiday, tt.working, tt.holiday)
+		}
+	}
+}
+
+func TestWorkingDays(t *testing.T) {
+	c := defaultCalendar()
+	// Three days before National Day, then the 8th, 9th and the worked Saturday.
+	a, b := day(2026, 9, 28), day(2026, 10, 12)
+	if got := c.WorkingDays(a, b); got != 6 {
+		t.Errorf("WorkingDays = %d, want 6", got)
+	}
+	if got := c.WorkingDays(b, a); got != -6 {
+		t.Errorf("WorkingDays backwards = %d, want -6", got)
+	}
+	// The time of day does not matter, b's date is excluded.
+	if got := c.WorkingDays(a.Add(20*time.Hour), a.Add(30*time.Hour)); got != 1 {
+		t.Errorf("WorkingDays across one midnight = %d, want 1", got)
+	}
+	if got := calendarDays(a, b); got != 14 {
+		t.Errorf("calendarDays = %d, want 14", got)
+	}
+}
+
+func TestParseCalendar(t *testing.T) {
+	c, err := ParseCalendar([]byte(`{"region": "XX", "holidays": [
+		{"name": "Later", "start": "2030-05-01", "end": "2030-05-02", "workdays": ["2030-05-04"]},
+		{"name": "Earlier", "start": "2030-01-01", "end": "2030-01-01"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Holidays[0].Name != "Earlier" {
+		t.Error("holidays are not sorted by start")
+	}
+	if working, _ := c.IsWorkingDay(day(2030, 5, 4)); !working {
+		t.Error("the make-up Saturday is not a working day")
+	}
+
+	desc, err := c.Describe(2030, day(2030, 5, 2), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"2030-05-02 Thursday is a day off (Later).",
+		"Holidays 2030 (XX):",
+		"- Earlier: 2030-01-01 to 2030-01-01\n- Later: 2030-05-01 to 2030-05-02, make-up working days 2030-05-04",
+	} {
+		if !strings.Contains(desc, want) {
+			t.Errorf("description lacks %q:\n%s", want, desc)
+		}
+	}
+	if desc, _ := c.Describe(2031, time.Time{}, false); !strings.HasPrefix(desc, "No holiday data for 2031") {
+		t.Errorf("description of a year without data: %s", desc)
+	}
+
+	if _, err := ParseCalendar([]byte(`{"holidays": [{"name": "Bad", "start": "2030-13-01", "end": "2030-13-02"}]}`)); err == nil {
+		t.Error("an invalid date was accepted")
+	}
+}
@@ -2,28 +2,249 @@ package tools
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
+	_ "time/tzdata" // IANA zones on systems without a zoneinfo database
 )
 
+// defaultTimeFormat is used when no format is given.
+const defaultTimeFormat = "2006-01-02 15:04:05 Monday (MST -07:00)"
+
 type ClockTool struct{}
 
 func (t *ClockTool) Name() string { return "clock_current" }
 func (t *ClockTool) Description() string {
-	return "Get the current date and time."
+	return "Get the current date and time, and do date calculations. Operations: " +
+		"now (current time), convert (between time zones), add (add or subtract a duration), " +
+		"diff (difference between two times), parse (resolve expressions like 'next Friday 9am' or '明天下午3点'), " +
+		"week (ISO week of a date) and holidays (public holidays and adjusted working days). " +
+		"Use parse before scheduling reminders or cron jobs."
 }
 
 func (t *ClockTool) Schema() interface{} {
 	return map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
+			"operation": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"now", "convert", "add", "diff", "parse", "week", "holidays"},
+				"description": "What to do (default now)",
+			},
 			"format": map[string]interface{}{
 				"type":        "string",
-				"description": "Optional format string (e.g. '2006-01-02 15:04:05'). Default is standard format.",
+				"description": "Optional output format, either a Go layout ('2006-01-02 15:04:05') or strftime ('%Y-%m-%d %H:%M'). Also accepts rfc3339, unix and iso.",
+			},
+			"timezone": map[string]interface{}{
+				"type":        "string",
+				"description": "IANA time zone for input and output, e.g. 'Asia/Shanghai' (default local time)",
+			},
+			"time": map[string]interface{}{
+				"type":        "string",
+				"description": "Input time: a date/time ('2025-03-01 14:00', RFC 3339, unix seconds) or an expression ('tomorrow 9am'). Default now.",
+			},
+			"to_timezone": map[string]interface{}{
+				"type":        "string",
+				"description": "Target zone for convert",
+			},
+			"duration": map[string]interface{}{
+				"type":        "string",
+				"description": "Duration for add, e.g. '90m', '1h30m', '3d', '-2w', '1y2mo'",
+			},
+			"end": map[string]interface{}{
+				"type":        "string",
+				"description": "Second time for diff (default now)",
+			},
+			"year": map[string]interface{}{
+				"type":        "integer",
+				"description": "Year for holidays (default the year of time)",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of consecutive ISO weeks to list for week (default 1)",
 			},
 		},
 	}
 }
 
 func (t *ClockTool) Execute(args json.RawMessage) (string, error) {
-	return time.Now().Format("2006-01-02 15:04:05 Monday"), nil
+	var input struct {
+		Operation  string `json:"operation"`
+		Format     string `json:"format"`
+		Timezone   string `json:"timezone"`
+		Time       string `json:"time"`
+		ToTimezone string `json:"to_timezone"`
+		Duration   string `json:"duration"`
+		End        string `json:"end"`
+		Year       int    `json:"year"`
+		Count      int    `json:"count"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+
+	loc, err := loadLocation(input.Timezone)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().In(loc)
+	at := now
+	if input.Time != "" {
+		if at, err = ParseTime(input.Time, now); err != nil {
+			return "", err
+		}
+		at = at.In(loc)
+	}
+	format := func(tm time.Time) string { return FormatTime(tm, input.Format) }
+
+	switch input.Operation {
+	case "", "now":
+		return format(at), nil
+
+	case "parse":
+		if input.Time == "" {
+			return "", fmt.Errorf("time is required for parse")
+		}
+		return fmt.Sprintf("%s\nRFC 3339: %s\nRelative: %s", format(at), at.Format(time.RFC3339), describeDiff(at.Sub(now))), nil
+
+	case "convert":
+		if input.ToTimezone == "" {
+			return "", fmt.Errorf("to_timezone is required for convert")
+		}
+		to, err := loadLocation(input.ToTimezone)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s\n= %s", format(at), format(at.In(to))), nil
+
+	case "add":
+		if input.Duration == "" {
+			return "", fmt.Errorf("duration is required for add")
+		}
+		result, err := AddDuration(at, input.Duration)
+		if err != nil {
+			return "", err
+		}
+		return format(result), nil
+
+	case "diff":
+		end := now
+		if input.End != "" {
+			if end, err = ParseTime(input.End, now); err != nil {
+				return "", err
+			}
+		}
+		d := end.Sub(at)
+		return fmt.Sprintf("From %s\nTo   %s\n%s (%.2f days, %.2f hours, %d seconds; %d calendar days, %d working days)",
+			format(at), format(end), describeDiff(d), d.Hours()/24, d.Hours(), int64(d.Seconds()),
+			calendarDays(at, end), defaultCalendar().WorkingDays(at, end)), nil
+
+	case "week":
+		count := input.Count
+		if count <= 0 {
+			count = 1
+		}
+		if count > 53 {
+			count = 53
+		}
+		var sb strings.Builder
+		for i := 0; i < count; i++ {
+			year, week := at.ISOWeek()
+			monday := startOfISOWeek(at)
+			sb.WriteString(fmt.Sprintf("%d-W%02d: %s to %s\n", year, week,
+				monday.Format("2006-01-02 Mon"), monday.AddDate(0, 0, 6).Format("2006-01-02 Mon")))
+			at = monday.AddDate(0, 0, 7)
+		}
+		return strings.TrimRight(sb.String(), "\n"), nil
+
+	case "holidays":
+		year := input.Year
+		if year == 0 {
+			year = at.Year()
+		}
+		return defaultCalendar().Describe(year, at, input.Time != "")
+	}
+	return "", fmt.Errorf("unknown operation %q", input.Operation)
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "local":
+		return time.Local, nil
+	case "utc", "z":
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(strings.TrimSpace(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q, use an IANA name such as Asia/Shanghai", name)
+	}
+	return loc, nil
+}
+
+// FormatTime formats tm with a Go layout, a strftime pattern (anything
+// containing %) or one of the names rfc3339, iso and unix.
+func FormatTime(tm time.Time, format string) string {
+	switch strings.ToLower(format) {
+	case "":
+		return tm.Format(defaultTimeFormat)
+	case "rfc3339", "iso", "iso8601":
+		return tm.Format(time.RFC3339)
+	case "unix":
+		return fmt.Sprint(tm.Unix())
+	}
+	if strings.Contains(format, "%") {
+		return strftime(tm, format)
+	}
+	return tm.Format(format)
+}
+
+// describeDiff renders d as "in 2 days 3 hours" or "5 minutes ago".
+func describeDiff(d time.Duration) string {
+	past := d < 0
+	if past {
+		d = -d
+	}
+	d = d.Round(time.Second)
+	if d < time.Second {
+		return "now"
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour}, {"hour", time.Hour}, {"minute", time.Minute}, {"second", time.Second},
+	}
+	var parts []string
+	for _, u := range units {
+		if n := d / u.size; n > 0 {
+			name := u.name
+			if n > 1 {
+				name += "s"
+			}
+			parts = append(parts, fmt.Sprintf("%d %s", n, name))
+			d -= n * u.size
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	if past {
+		return strings.Join(parts, " ") + " ago"
+	}
+	return "in " + strings.Join(parts, " ")
+}
+
+// calendarDays counts midnights crossed from a to b, negative if b is earlier.
+func calendarDays(a, b time.Time) int {
+	b = b.In(a.Location())
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+func startOfISOWeek(tm time.Time) time.Time {
+	offset := (int(tm.Weekday()) + 6) % 7 // days since Monday
+	return time.Date(tm.Year(), tm.Month(), tm.Day()-offset, 0, 0, 0, 0, tm.Location())
 }
@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func runClock(t *testing.T, args map[string]interface{}) (string, error) {
+	t.Helper()
+	data, _ := json.Marshal(args)
+	return (&ClockTool{}).Execute(data)
+}
+
+func TestClockConvert(t *testing.T) {
+	out, err := runClock(t, map[string]interface{}{
+		"operation":   "convert",
+		"time":        "2026-10-19 10:00",
+		"timezone":    "Asia/Shanghai",
+		"to_timezone": "America/New_York",
+		"format":      "%Y-%m-%d %H:%M %Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2026-10-19 10:00 CST\n= 2026-10-18 22:00 EDT"; out != want {
+		t.Errorf("convert = %q, want %q", out, want)
+	}
+
+	if _, err := runClock(t, map[string]interface{}{"timezone": "Mars/Olympus"}); err == nil {
+		t.Error("an unknown time zone was accepted")
+	}
+	if _, err := runClock(t, map[string]interface{}{"operation": "convert", "time": "2026-10-19"}); err == nil {
+		t.Error("convert without to_timezone succeeded")
+	}
+}
+
+func TestClockOperations(t *testing.T) {
+	tests := []struct {
+		args map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"operation": "add", "time": "2026-01-31 09:00", "duration": "1mo", "timezone": "UTC", "format": "iso"},
+			"2026-03-03T09:00:00Z"},
+		{map[string]interface{}{"operation": "diff", "time": "2026-09-28", "end": "2026-10-12", "timezone": "Asia/Shanghai"},
+			"in 14 days (14.00 days, 336.00 hours, 1209600 seconds; 14 calendar days, 6 working days)"},
+		{map[string]interface{}{"operation": "week", "time": "2026-01-01", "count": 2, "timezone": "UTC"},
+			"2026-W01: 2025-12-29 Mon to 2026-01-04 Sun\n2026-W02: 2026-01-05 Mon to 2026-01-11 Sun"},
+		{map[string]interface{}{"operation": "holidays", "time": "2026-10-10", "timezone": "Asia/Shanghai"},
+			"2026-10-10 Saturday is a working day (国庆节 National Day)."},
+	}
+	for _, tt := range tests {
+		out, err := runClock(t, tt.args)
+		if err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("%v = %q, want %q", tt.args, out, tt.want)
+		}
+	}
+
+	if _, err := runClock(t, map[string]interface{}{"operation": "sideways"}); err == nil {
+		t.Error("an unknown operation succeeded")
+	}
+}
@@ -0,0 +1,447 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xq-agent/internal/config"
+)
+
+const (
+	codeOutputLimit = 10000 // bytes kept of stdout and of stderr
+	maxArtifacts    = 20
+	codeDirMaxAge   = 24 * time.Hour
+	codeCacheDir    = ".cache" // in the scratch directory, not offered as artifacts
+)
+
+// codeLanguage describes how a snippet in one language is run.
+type codeLanguage struct {
+	file  string
+	build bool // compiled to ./main before running
+	// Node and Go reserve far more address space than they use, so their
+	// memory is limited by a heap flag or GOMEMLIMIT instead of ulimit -v.
+	ownMemoryLimit bool
+}
+
+var codeLanguages = map[string]codeLanguage{
+	"python":     {file: "main.py"},
+	"javascript": {file: "main.js", ownMemoryLimit: true},
+	"go":         {file: "main.go", build: true, ownMemoryLimit: true},
+}
+
+// sandboxSpec describes how a snippet is isolated: the filesystem is
+// read-only apart from dir, and the hidden paths appear empty.
+type sandboxSpec struct {
+	dir     string
+	hide    []string
+	network bool
+}
+
+// CodeRunTool runs Python, JavaScript or Go snippets in a scratch directory
+// kept for the session, with CPU, memory and network limits. Files the snippet
+// writes are offered to the user.
+type CodeRunTool struct {
+	Config config.CodeConfig
+	Policy *PathPolicy
+
+	mu   sync.Mutex
+	dirs map[string]string // session -> scratch directory
+}
+
+func (t *CodeRunTool) Name() string { return "code_run" }
+func (t *CodeRunTool) Description() string {
+	return "Run a Python, JavaScript (Node.js) or Go snippet for calculations, data processing or charts. " +
+		"The code runs in a scratch directory that persists for this conversation (files from earlier runs are still there), " +
+		"with CPU and memory limits and no network access. Prints stdout and stderr; files the code writes are returned to the user."
+}
+func (t *CodeRunTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"language": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"python", "javascript", "go"},
+			},
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "The program source. Go code must be a complete main package.",
+			},
+			"files": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Workspace files to copy into the scratch directory before running",
+			},
+			"timeout": map[string]interface{}{
+				"type":        "integer",
+				"description": "Seconds before the run is killed (default and maximum set by the configuration)",
+			},
+		},
+		"required": []string{"language", "code"},
+	}
+}
+
+func (t *CodeRunTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *CodeRunTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Language string   `json:"language"`
+		Code     string   `json:"code"`
+		Files    []string `json:"files"`
+		Timeout  int      `json:"timeout"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	lang := strings.ToLower(input.Language)
+	switch lang {
+	case "py", "python3":
+		lang = "python"
+	case "js", "node", "nodejs":
+		lang = "javascript"
+	case "golang":
+		lang = "go"
+	}
+	spec, ok := codeLanguages[lang]
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q, use python, javascript or go", input.Language)
+	}
+
+	isolationErr := sandboxError()
+	if isolationErr != nil && t.Policy.ReadOnly() {
+		return "", fmt.Errorf("code_run is disabled in a read-only workspace: snippets %v", isolationErr)
+	}
+
+	dir, err := t.scratchDir(SessionFrom(ctx))
+	if err != nil {
+		return "", err
+	}
+	for _, f := range input.Files {
+		src, err := t.Policy.CheckRead(t.Name(), f)
+		if err != nil {
+			return "", err
+		}
+		if err := copyFile(src, filepath.Join(dir, filepath.Base(src))); err != nil {
+			return "", fmt.Errorf("failed to copy %s: %v", f, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, spec.file), []byte(input.Code), 0644); err != nil {
+		return "", err
+	}
+	before := snapshotDir(dir)
+
+	timeout := t.Config.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	if input.Timeout > 0 && time.Duration(input.Timeout)*time.Second < timeout {
+		timeout = time.Duration(input.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var sb strings.Builder
+	start := time.Now()
+	var stdout, stderr *limitedBuffer
+	var runErr error
+	if spec.build {
+		binary := "main"
+		if runtime.GOOS == "windows" {
+			binary = "main.exe"
+		}
+		stdout, stderr, runErr = t.run(ctx, dir, nil, t.command(t.Config.Go, "go"), "build", "-o", binary, spec.file)
+		if runErr == nil {
+			stdout, stderr, runErr = t.run(ctx, dir, &spec, filepath.Join(dir, binary))
+		}
+		before[binary] = fileState{} // the binary is not an artifact
+	} else if lang == "python" {
+		stdout, stderr, runErr = t.run(ctx, dir, &spec, t.pythonCommand(), spec.file)
+	} else {
+		heap := fmt.Sprintf("--max-old-space-size=%d", t.memoryMB())
+		stdout, stderr, runErr = t.run(ctx, dir, &spec, t.command(t.Config.Node, "node"), heap, spec.file)
+	}
+	elapsed := time.Since(start).Round(10 * time.Millisecond)
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		sb.WriteString(fmt.Sprintf("Killed after %s (timeout)\n", timeout))
+	case runErr != nil:
+		if exitErr, ok := runErr.(*exec.ExitError); ok {
+			sb.WriteString(fmt.Sprintf("Exit code: %d (%s)%s\n", exitErr.ExitCode(), elapsed, limitHint(exitErr)))
+		} else {
+			return "", fmt.Errorf("failed to run %s: %v", lang, runErr)
+		}
+	default:
+		sb.WriteString(fmt.Sprintf("Exit code: 0 (%s)\n", elapsed))
+	}
+	if isolationErr != nil {
+		sb.WriteString("Note: the snippet ran without isolation, so it could reach the network and write outside its directory: " + isolationErr.Error() + "\n")
+	}
+	if stdout.Len() > 0 {
+		sb.WriteString("--- stdout ---\n" + stdout.String() + "\n")
+	}
+	if stderr.Len() > 0 {
+		sb.WriteString("--- stderr ---\n" + stderr.String() + "\n")
+	}
+
+	artifacts := changedFiles(dir, before)
+	if len(artifacts) > 0 {
+		sb.WriteString(fmt.Sprintf("Files written to %s:\n", dir))
+		for i, f := range artifacts {
+			if i == maxArtifacts {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(artifacts)-maxArtifacts))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("- %s (%s)\n", f.Name, formatSize(f.Size)))
+			AttachFile(ctx, f)
+			if isImageFile(f.Name) {
+				if data, err := os.ReadFile(f.Path); err == nil {
+					if img, err := LoadImage(data, f.Name, DefaultImageSize); err == nil {
+						AttachImage(ctx, img)
+					}
+				}
+			}
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// run executes name in dir. Snippets (lang set) get the configured CPU and
+// memory limits, a read-only view of the filesystem apart from dir and,
+// unless allowed, no network; build steps run unlimited.
+func (t *CodeRunTool) run(ctx context.Context, dir string, lang *codeLanguage, name string, args ...string) (*limitedBuffer, *limitedBuffer, error) {
+	limited := lang != nil
+	if limited && runtime.GOOS != "windows" {
+		// The shell sets the limits, then replaces itself with the program.
+		cpu := t.Config.CPUTime
+		if cpu <= 0 {
+			cpu = 30 * time.Second
+		}
+		limits := fmt.Sprintf("ulimit -t %d", int(cpu.Seconds()))
+		if !lang.ownMemoryLimit {
+			limits += fmt.Sprintf(" && ulimit -v %d", t.memoryMB()*1024)
+		}
+		args = append([]string{"-c", limits + ` && exec "$0" "$@"`, name}, args...)
+		name = "/bin/sh"
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(codeEnv(dir), fmt.Sprintf("GOMEMLIMIT=%dMiB", t.memoryMB()))
+	cmd.WaitDelay = 2 * time.Second
+	var spec *sandboxSpec
+	if limited {
+		spec = &sandboxSpec{dir: dir, hide: t.Policy.DeniedPaths(), network: t.Config.Network}
+	}
+	sandboxProcess(cmd, spec)
+
+	stdout := &limitedBuffer{limit: codeOutputLimit}
+	stderr := &limitedBuffer{limit: codeOutputLimit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return stdout, stderr, cmd.Run()
+}
+
+func (t *CodeRunTool) memoryMB() int {
+	if t.Config.MemoryMB > 0 {
+		return t.Config.MemoryMB
+	}
+	return 512
+}
+
+func (t *CodeRunTool) command(configured, fallback string) string {
+	if configured != "" {
+		return configured
+	}
+	return fallback
+}
+
+func (t *CodeRunTool) pythonCommand() string {
+	if t.Config.Python != "" {
+		return t.Config.Python
+	}
+	if runtime.GOOS == "windows" {
+		return "python"
+	}
+	return "python3"
+}
+
+// scratchDir returns the session's directory, removing directories of other
+// sessions that have not been used for a day.
+func (t *CodeRunTool) scratchDir(session string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if dir, ok := t.dirs[session]; ok {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+	root := t.Config.Dir
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "xq-agent-code")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	if entries, err := os.ReadDir(root); err == nil {
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > codeDirMaxAge {
+				os.RemoveAll(filepath.Join(root, e.Name()))
+			}
+		}
+	}
+	dir, err := os.MkdirTemp(root, identRe.ReplaceAllString(session, "_")+"-")
+	if err != nil {
+		return "", err
+	}
+	if t.dirs == nil {
+		t.dirs = make(map[string]string)
+	}
+	t.dirs[session] = dir
+	return dir, nil
+}
+
+// codeEnv is the environment of snippets: the agent's own, minus anything
+// that looks like a secret, with temporary files kept in the scratch
+// directory.
+func codeEnv(dir string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		upper := strings.ToUpper(name)
+		secret := false
+		for _, word := range []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "AUTH"} {
+			if strings.Contains(upper, word) {
+				secret = true
+				break
+			}
+		}
+		if !secret && upper != "TMPDIR" && upper != "TMP" && upper != "TEMP" {
+			env = append(env, kv)
+		}
+	}
+	// Caches go to the scratch directory, the only writable one.
+	cache := filepath.Join(dir, codeCacheDir)
+	return append(env, "TMPDIR="+dir, "TMP="+dir, "TEMP="+dir, "GOTOOLCHAIN=local", "PYTHONDONTWRITEBYTECODE=1", "MPLBACKEND=Agg",
+		"XDG_CACHE_HOME="+cache, "MPLCONFIGDIR="+filepath.Join(cache, "matplotlib"))
+}
+
+// limitHint explains exits caused by the resource limits.
+func limitHint(err *exec.ExitError) string {
+	switch code := err.ExitCode(); {
+	case code == -1:
+		return ", " + err.Error() + ", probably for exceeding the CPU time limit"
+	case code == 137:
+		return ", killed, possibly out of memory"
+	}
+	return ""
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func snapshotDir(dir string) map[string]fileState {
+	files := make(map[string]fileState)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			rel, _ := filepath.Rel(dir, path)
+			files[rel] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return files
+}
+
+// changedFiles lists the files that are new or modified since before.
+func changedFiles(dir string, before map[string]fileState) []File {
+	var files []File
+	for rel, now := range snapshotDir(dir) {
+		if old, ok := before[rel]; ok && (old == fileState{} || old == now) {
+			continue
+		}
+		if strings.Contains(rel, "__pycache__") || strings.HasPrefix(filepath.ToSlash(rel), codeCacheDir+"/") {
+			continue
+		}
+		files = append(files, File{Name: filepath.ToSlash(rel), Path: filepath.Join(dir, rel), Size: now.size})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+func isImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// limitedBuffer keeps the first limit bytes written to it and counts the rest.
+type limitedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		b.dropped += len(p) - max(room, 0)
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Len() int { return b.buf.Len() }
+
+func (b *limitedBuffer) String() string {
+	s := strings.TrimRight(b.buf.String(), "\n")
+	if b.dropped > 0 {
+		s += fmt.Sprintf("\n... (%d more bytes not shown)", b.dropped)
+	}
+	return s
+}
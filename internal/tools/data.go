@@ -0,0 +1,865 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultQueryRows = 100
+	maxQueryRows     = 1000
+	queryTimeout     = 60 * time.Second
+	maxDataSessions  = 8
+)
+
+// DataQueryTool runs SQL over CSV, TSV, JSON Lines and SQLite files using an
+// embedded SQLite engine. Imported files are cached per session and reloaded
+// when they change.
+type DataQueryTool struct {
+	Policy  *PathPolicy
+	Journal *Journal
+
+	mu       sync.Mutex
+	sessions map[string]*dataSession
+}
+
+type dataSession struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	tables  map[string]*dataTable // by resolved path
+	lastUse time.Time
+}
+
+type dataTable struct {
+	name     string
+	attached bool // SQLite file attached as a schema
+	modTime  time.Time
+	size     int64
+	rows     int64
+}
+
+func (t *DataQueryTool) Name() string { return "data_query" }
+func (t *DataQueryTool) Description() string {
+	return "Run SQL (SQLite dialect) over CSV, TSV, JSON Lines/JSON and SQLite files. " +
+		"Each CSV/TSV/JSON file becomes a table named after the file (or the given name); a SQLite file is attached as a schema, " +
+		"so its tables are queried as name.table. Only read-only statements (SELECT, WITH, VALUES, EXPLAIN) run. " +
+		"Use action=schema to inspect columns before querying. Results can be exported to a new file."
+}
+func (t *DataQueryTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"files": map[string]interface{}{
+				"type":        "array",
+				"description": "Files to load",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"path": map[string]interface{}{"type": "string"},
+						"name": map[string]interface{}{
+							"type":        "string",
+							"description": "Table (or schema) name, default derived from the file name",
+						},
+					},
+					"required": []string{"path"},
+				},
+			},
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"query", "schema"},
+				"description": "query (default) runs sql, schema lists tables, columns and row counts",
+			},
+			"sql": map[string]interface{}{
+				"type":        "string",
+				"description": "The SQL query to run",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum rows to return (default %d, at most %d). Does not apply to output.", defaultQueryRows, maxQueryRows),
+			},
+			"output": map[string]interface{}{
+				"type":        "string",
+				"description": "Write all result rows to this new file; the format follows the extension (.csv, .tsv, .jsonl, .json, .md)",
+			},
+		},
+		"required": []string{"files"},
+	}
+}
+
+func (t *DataQueryTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *DataQueryTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Files []struct {
+			Path string `json:"path"`
+			Name string `json:"name"`
+		} `json:"files"`
+		Action string `json:"action"`
+		SQL    string `json:"sql"`
+		Limit  int    `json:"limit"`
+		Output string `json:"output"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	s, err := t.session(SessionFrom(ctx))
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var loaded []string
+	for _, f := range input.Files {
+		path, err := t.Policy.CheckRead(t.Name(), f.Path)
+		if err != nil {
+			return "", err
+		}
+		name, err := s.load(ctx, path, f.Name)
+		if err != nil {
+			return "", fmt.Errorf("failed to load %s: %v", f.Path, err)
+		}
+		loaded = append(loaded, name)
+	}
+
+	if input.Action == "schema" || (input.Action == "" && strings.TrimSpace(input.SQL) == "") {
+		return s.describe(ctx, loaded)
+	}
+	if input.Action != "" && input.Action != "query" {
+		return "", fmt.Errorf("unknown action %q", input.Action)
+	}
+	if strings.TrimSpace(input.SQL) == "" {
+		return "", fmt.Errorf("sql is required")
+	}
+
+	if input.Output != "" {
+		return t.export(ctx, s, input.SQL, input.Output)
+	}
+
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultQueryRows
+	}
+	if limit > maxQueryRows {
+		limit = maxQueryRows
+	}
+	cols, rows, more, err := s.query(ctx, input.SQL, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(cols) == 0 {
+		return "Statement executed.", nil
+	}
+	if len(rows) == 0 {
+		return "Columns: " + strings.Join(cols, ", ") + "\n(no rows)", nil
+	}
+	result := renderTable(append([][]string{cols}, rows...), "markdown")
+	if more {
+		result += fmt.Sprintf("\n\n(only the first %d rows are shown, raise limit, aggregate, or use output to export all rows)", limit)
+	} else {
+		result += fmt.Sprintf("\n\n(%d rows)", len(rows))
+	}
+	return result, nil
+}
+
+// session returns the database of the calling conversation, closing the
+// least recently used one when there are too many.
+func (t *DataQueryTool) session(id string) (*dataSession, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessions == nil {
+		t.sessions = make(map[string]*dataSession)
+	}
+	if s, ok := t.sessions[id]; ok {
+		s.lastUse = time.Now()
+		return s, nil
+	}
+	if len(t.sessions) >= maxDataSessions {
+		var oldest string
+		for k, s := range t.sessions {
+			if oldest == "" || s.lastUse.Before(t.sessions[oldest].lastUse) {
+				oldest = k
+			}
+		}
+		t.sessions[oldest].db.Close()
+		delete(t.sessions, oldest)
+	}
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to :memory: is a separate database.
+	db.SetMaxOpenConns(1)
+	s := &dataSession{db: db, tables: make(map[string]*dataTable), lastUse: time.Now()}
+	t.sessions[id] = s
+	return s, nil
+}
+
+var identRe = regexp.MustCompile(`[^\pL\pN_]+`)
+
+// tableName derives a SQL identifier from a file name.
+func tableName(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name := strings.Trim(identRe.ReplaceAllString(strings.ToLower(base), "_"), "_")
+	if name == "" {
+		name = "data"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "t_" + name
+	}
+	return name
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// load imports (or attaches) a file unless it is already loaded and unchanged.
+func (s *dataSession) load(ctx context.Context, path, name string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = tableName(path)
+	}
+	if old, ok := s.tables[path]; ok {
+		if old.name == name && old.modTime.Equal(info.ModTime()) && old.size == info.Size() {
+			return name, nil
+		}
+		s.drop(ctx, old)
+		delete(s.tables, path)
+	}
+	for p, other := range s.tables {
+		if other.name == name {
+			s.drop(ctx, other)
+			delete(s.tables, p)
+		}
+	}
+
+	table := &dataTable{name: name, modTime: info.ModTime(), size: info.Size()}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3", ".db3":
+		uri := "file:" + filepath.ToSlash(path) + "?mode=ro"
+		if _, err := s.db.ExecContext(ctx, "ATTACH DATABASE ? AS "+quoteIdent(name), uri); err != nil {
+			return "", err
+		}
+		table.attached = true
+	case ".csv", ".tsv", ".tab", ".txt":
+		if table.rows, err = s.importCSV(ctx, path, name); err != nil {
+			return "", err
+		}
+	case ".jsonl", ".ndjson", ".json":
+		if table.rows, err = s.importJSON(ctx, path, name); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported file type %q (use .csv, .tsv, .jsonl, .json or a SQLite database)", filepath.Ext(path))
+	}
+	s.tables[path] = table
+	return name, nil
+}
+
+func (s *dataSession) drop(ctx context.Context, t *dataTable) {
+	if t.attached {
+		s.db.ExecContext(ctx, "DETACH DATABASE "+quoteIdent(t.name))
+	} else {
+		s.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+quoteIdent(t.name))
+	}
+}
+
+// rowSource yields the records of a file; it is called twice, once to infer
+// column types and once to insert.
+type rowSource func(yield func([]string) error) ([]string, error)
+
+func (s *dataSession) importCSV(ctx context.Context, path, name string) (int64, error) {
+	delim, err := sniffDelimiter(path)
+	if err != nil {
+		return 0, err
+	}
+	source := func(yield func([]string) error) ([]string, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		br := bufio.NewReader(f)
+		if bom, _ := br.Peek(3); bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+			br.Discard(3)
+		}
+		r := csv.NewReader(br)
+		r.Comma = delim
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		header, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header: %v", err)
+		}
+		for {
+			rec, err := r.Read()
+			if err == io.EOF {
+				return header, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := yield(rec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.importRows(ctx, name, source)
+}
+
+// sniffDelimiter picks the separator that splits the first line into the
+// most fields.
+func sniffDelimiter(path string) (rune, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".tsv" || ext == ".tab" {
+		return '\t', nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	best, count := ',', strings.Count(line, ",")
+	for _, d := range []rune{';', '\t', '|'} {
+		if n := strings.Count(line, string(d)); n > count {
+			best, count = d, n
+		}
+	}
+	return best, nil
+}
+
+func (s *dataSession) importJSON(ctx context.Context, path, name string) (int64, error) {
+	// A .json file may hold an array of objects; everything else is read as
+	// one object per line.
+	var objects []map[string]interface{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(trimmed, &objects); err != nil {
+				return 0, fmt.Errorf("expected an array of objects: %v", err)
+			}
+		}
+	}
+
+	forEach := func(fn func(map[string]interface{}) error) error {
+		if objects != nil {
+			for _, obj := range objects {
+				if err := fn(obj); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dec := json.NewDecoder(f)
+		dec.UseNumber()
+		for line := 1; ; line++ {
+			var obj map[string]interface{}
+			if err := dec.Decode(&obj); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("record %d: %v", line, err)
+			}
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Columns are the union of keys, in order of first appearance.
+	var columns []string
+	seen := map[string]bool{}
+	if err := forEach(func(obj map[string]interface{}) error {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			if !seen[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			seen[k] = true
+			columns = append(columns, k)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	source := func(yield func([]string) error) ([]string, error) {
+		err := forEach(func(obj map[string]interface{}) error {
+			rec := make([]string, len(columns))
+			for i, c := range columns {
+				rec[i] = jsonCell(obj[c])
+			}
+			return yield(rec)
+		})
+		return columns, err
+	}
+	return s.importRows(ctx, name, source)
+}
+
+func jsonCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// importRows creates the table with inferred column types and inserts every
+// record in one transaction.
+func (s *dataSession) importRows(ctx context.Context, name string, source rowSource) (int64, error) {
+	var types []string
+	header, err := source(func(rec []string) error {
+		for len(types) < len(rec) {
+			types = append(types, "")
+		}
+		for i, v := range rec {
+			types[i] = widenType(types[i], v)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	columns := uniqueColumns(header, len(types))
+	for len(types) < len(columns) {
+		types = append(types, "")
+	}
+
+	defs := make([]string, len(columns))
+	marks := make([]string, len(columns))
+	for i, c := range columns {
+		typ := types[i]
+		if typ == "" {
+			typ = "TEXT"
+		}
+		defs[i] = quoteIdent(c) + " " + typ
+		marks[i] = "?"
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(name), strings.Join(defs, ", "))); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteIdent(name), strings.Join(marks, ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var count int64
+	values := make([]interface{}, len(columns))
+	if _, err := source(func(rec []string) error {
+		for i := range values {
+			values[i] = nil
+			if i < len(rec) && rec[i] != "" {
+				values[i] = rec[i]
+			}
+		}
+		count++
+		_, err := stmt.ExecContext(ctx, values...)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// widenType returns the narrowest SQLite type holding both the type seen so
+// far and v. Empty values do not change it.
+func widenType(typ, v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" || typ == "TEXT" {
+		return typ
+	}
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil && (len(v) == 1 || v[0] != '0') {
+		if typ == "" {
+			return "INTEGER"
+		}
+		return typ
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil && (typ == "" || typ == "INTEGER" || typ == "REAL") {
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// uniqueColumns fills in blank header names and removes duplicates.
+func uniqueColumns(header []string, width int) []string {
+	n := len(header)
+	if width > n {
+		n = width
+	}
+	cols := make([]string, n)
+	seen := map[string]int{}
+	for i := range cols {
+		name := ""
+		if i < len(header) {
+			name = strings.TrimSpace(header[i])
+		}
+		if name == "" {
+			name = fmt.Sprintf("column%d", i+1)
+		}
+		key := strings.ToLower(name)
+		if seen[key] > 0 {
+			name = fmt.Sprintf("%s_%d", name, seen[key]+1)
+		}
+		seen[key]++
+		cols[i] = name
+	}
+	return cols
+}
+
+// writeKeywords start statements that change a database or the files it
+// uses. ATTACH and VACUUM INTO could otherwise create files anywhere.
+var writeKeywords = map[string]bool{
+	"ATTACH": true, "DETACH": true, "VACUUM": true, "PRAGMA": true,
+	"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true, "UPSERT": true,
+	"CREATE": true, "DROP": true, "ALTER": true, "REINDEX": true, "ANALYZE": true,
+	"BEGIN": true, "COMMIT": true, "END": true, "ROLLBACK": true, "SAVEPOINT": true, "RELEASE": true,
+}
+
+// checkReadOnlySQL accepts a single SELECT, WITH, VALUES or EXPLAIN
+// statement that does not contain a writing statement.
+func checkReadOnlySQL(query string) error {
+	tokens := sqlTokens(query)
+	for len(tokens) > 0 && tokens[len(tokens)-1] == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("empty statement")
+	}
+	for i, tok := range tokens {
+		if tok == ";" {
+			return fmt.Errorf("only one statement can be run at a time")
+		}
+		// replace() is a function, REPLACE INTO a statement.
+		if writeKeywords[tok] && !(tok == "REPLACE" && i+1 < len(tokens) && tokens[i+1] == "(") {
+			return fmt.Errorf("%s is not allowed, only read-only queries (SELECT, WITH, VALUES, EXPLAIN) can be run", tok)
+		}
+	}
+	switch tokens[0] {
+	case "SELECT", "WITH", "VALUES", "EXPLAIN":
+		return nil
+	}
+	return fmt.Errorf("%s is not allowed, only read-only queries (SELECT, WITH, VALUES, EXPLAIN) can be run", tokens[0])
+}
+
+// sqlTokens splits SQL into upper-cased keywords and identifiers and the
+// punctuation ";" and "(". Literals, quoted identifiers and comments are
+// skipped, as SQLite's tokenizer does.
+func sqlTokens(query string) []string {
+	var tokens []string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			i++
+			for i < len(query) {
+				if query[i] == end {
+					// A doubled quote is an escaped quote.
+					if end != ']' && i+1 < len(query) && query[i+1] == end {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+		case c == ';' || c == '(':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '_' || c == '$' || c >= 0x80 || (c|0x20 >= 'a' && c|0x20 <= 'z') || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(query) {
+				c := query[i]
+				if !(c == '_' || c == '$' || c >= 0x80 || (c|0x20 >= 'a' && c|0x20 <= 'z') || (c >= '0' && c <= '9')) {
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, strings.ToUpper(query[start:i]))
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+func (s *dataSession) query(ctx context.Context, query string, limit int) ([]string, [][]string, bool, error) {
+	if err := checkReadOnlySQL(query); err != nil {
+		return nil, nil, false, err
+	}
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var out [][]string
+	more := false
+	err = scanRows(rows, func(rec []string) bool {
+		if limit > 0 && len(out) == limit {
+			more = true
+			return false
+		}
+		out = append(out, rec)
+		return true
+	})
+	return cols, out, more, err
+}
+
+// scanRows converts every row to strings, NULL becoming empty, until fn
+// returns false.
+func scanRows(rows *sql.Rows, fn func([]string) bool) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		rec := make([]string, len(cols))
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+			case []byte:
+				rec[i] = string(v)
+			case float64:
+				rec[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			case time.Time:
+				rec[i] = v.Format(time.RFC3339)
+			default:
+				rec[i] = fmt.Sprint(v)
+			}
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+// describe lists the tables of the session with their columns.
+func (s *dataSession) describe(ctx context.Context, highlight []string) (string, error) {
+	type entry struct {
+		schema, table string
+	}
+	var entries []entry
+	names := make([]string, 0, len(s.tables))
+	for _, t := range s.tables {
+		names = append(names, t.name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var attached bool
+		for _, t := range s.tables {
+			if t.name == name {
+				attached = t.attached
+			}
+		}
+		if !attached {
+			entries = append(entries, entry{"main", name})
+			continue
+		}
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT name FROM %s.sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%%' ORDER BY name", quoteIdent(name)))
+		if err != nil {
+			return "", err
+		}
+		err = scanRows(rows, func(rec []string) bool {
+			entries = append(entries, entry{name, rec[0]})
+			return true
+		})
+		rows.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(entries) == 0 {
+		return "No files loaded. Pass files to load CSV, TSV, JSON Lines or SQLite files.", nil
+	}
+
+	var sb strings.Builder
+	for _, e := range entries {
+		qualified := quoteIdent(e.table)
+		label := e.table
+		if e.schema != "main" {
+			qualified = quoteIdent(e.schema) + "." + qualified
+			label = e.schema + "." + e.table
+		}
+		var count int64
+		s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+qualified).Scan(&count)
+		sb.WriteString(fmt.Sprintf("%s (%d rows)\n", label, count))
+
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT name, type FROM %s.pragma_table_info(?)", quoteIdent(e.schema)), e.table)
+		if err != nil {
+			return "", err
+		}
+		err = scanRows(rows, func(rec []string) bool {
+			typ := rec[1]
+			if typ == "" {
+				typ = "ANY"
+			}
+			sb.WriteString(fmt.Sprintf("  - %s %s\n", rec[0], typ))
+			return true
+		})
+		rows.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// export writes every row of the query to a new file.
+func (t *DataQueryTool) export(ctx context.Context, s *dataSession, query, output string) (string, error) {
+	if err := checkReadOnlySQL(query); err != nil {
+		return "", err
+	}
+	path, err := t.Policy.CheckWrite(t.Name(), output)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s already exists, choose a new file name", output)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	var count int
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".csv", ".tsv", ".txt":
+		w := csv.NewWriter(&buf)
+		if ext == ".tsv" {
+			w.Comma = '\t'
+		}
+		w.Write(cols)
+		err = scanRows(rows, func(rec []string) bool {
+			count++
+			return w.Write(rec) == nil
+		})
+		w.Flush()
+	case ".jsonl", ".ndjson", ".json":
+		var records []map[string]string
+		err = scanRows(rows, func(rec []string) bool {
+			count++
+			obj := make(map[string]string, len(cols))
+			for i, c := range cols {
+				obj[c] = rec[i]
+			}
+			if ext == ".json" {
+				records = append(records, obj)
+				return true
+			}
+			line, _ := json.Marshal(obj)
+			buf.Write(line)
+			buf.WriteByte('\n')
+			return true
+		})
+		if ext == ".json" {
+			data, _ := json.MarshalIndent(records, "", "  ")
+			buf.Write(data)
+		}
+	case ".md":
+		all := [][]string{cols}
+		err = scanRows(rows, func(rec []string) bool {
+			count++
+			all = append(all, rec)
+			return true
+		})
+		buf.WriteString(renderTable(all, "markdown") + "\n")
+	default:
+		return "", fmt.Errorf("unsupported output format %q (use .csv, .tsv, .jsonl, .json or .md)", ext)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := t.Journal.WriteFile(ctx, t.Name(), path, buf.Bytes()); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Exported %d rows (%d columns) to %s", count, len(cols), path), nil
+}
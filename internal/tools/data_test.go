@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xq-agent/internal/config"
+)
+
+// dataWorkspace returns a data_query tool confined to a new workspace that
+// holds a CSV file and a SQLite database.
+func dataWorkspace(t *testing.T, readOnly bool) (*DataQueryTool, string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "orders.csv"), []byte("id,item,qty\n1,tea,3\n2,cups,12\n"), 0644)
+
+	db, err := sql.Open("sqlite", filepath.Join(root, "shop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE customers (name TEXT); INSERT INTO customers VALUES ('Ann'), ('Bo')"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	policy, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{root}, ReadOnly: readOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := &DataQueryTool{Policy: policy}
+	t.Cleanup(func() {
+		for _, s := range tool.sessions {
+			s.db.Close()
+		}
+	})
+	return tool, root
+}
+
+func runData(t *testing.T, tool *DataQueryTool, args map[string]interface{}) (string, error) {
+	t.Helper()
+	data, _ := json.Marshal(args)
+	return tool.Execute(data)
+}
+
+func TestDataQuery(t *testing.T) {
+	tool, _ := dataWorkspace(t, true)
+	files := []map[string]string{{"path": "orders.csv"}, {"path": "shop.db"}}
+
+	out, err := runData(t, tool, map[string]interface{}{
+		"files": files,
+		"sql":   "WITH big AS (SELECT item FROM orders WHERE qty > 5) SELECT replace(item, 'c', 'C') AS item FROM big; ",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "| Cups |") {
+		t.Errorf("query result:\n%s", out)
+	}
+
+	// The SQLite file is attached as a schema.
+	out, err = runData(t, tool, map[string]interface{}{"files": files, "sql": "SELECT count(*) AS n FROM shop.customers"})
+	if err != nil || !strings.Contains(out, "| 2 |") {
+		t.Errorf("query of the attached database: %q, %v", out, err)
+	}
+}
+
+func TestDataQueryRefusesWrites(t *testing.T) {
+	tool, root := dataWorkspace(t, false)
+	outside := t.TempDir()
+	attached := filepath.Join(outside, "attached.db")
+	vacuumed := filepath.Join(outside, "copy.db")
+
+	for _, query := range []string{
+		"ATTACH DATABASE '" + attached + "' AS x",
+		"attach '" + attached + "' as x",
+		"VACUUM INTO '" + vacuumed + "'",
+		"/* comment */ vacuum main INTO '" + vacuumed + "'",
+		"SELECT 1; ATTACH DATABASE '" + attached + "' AS x",
+		"EXPLAIN VACUUM INTO '" + vacuumed + "'",
+		"WITH t AS (SELECT 1) INSERT INTO orders SELECT * FROM t",
+		"DETACH DATABASE shop",
+		"PRAGMA query_only = 0",
+		"CREATE TABLE notes (text)",
+		"DELETE FROM orders",
+	} {
+		args := map[string]interface{}{"files": []map[string]string{{"path": "orders.csv"}, {"path": "shop.db"}}, "sql": query}
+		if out, err := runData(t, tool, args); err == nil {
+			t.Errorf("%q was run: %s", query, out)
+		}
+		args["output"] = "out.csv"
+		if out, err := runData(t, tool, args); err == nil {
+			t.Errorf("%q was exported: %s", query, out)
+		}
+	}
+	for _, path := range []string{attached, vacuumed, filepath.Join(root, "out.csv")} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s was created", path)
+		}
+	}
+
+	// Keywords inside literals, quoted names and comments are harmless.
+	out, err := runData(t, tool, map[string]interface{}{
+		"files": []map[string]string{{"path": "orders.csv"}},
+		"sql":   `SELECT 'DROP TABLE orders; ATTACH' AS "delete", item -- VACUUM` + "\nFROM orders ORDER BY id LIMIT 1",
+	})
+	if err != nil || !strings.Contains(out, "DROP TABLE orders; ATTACH") {
+		t.Errorf("query with keywords in literals: %q, %v", out, err)
+	}
+}
@@ -0,0 +1,367 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// documentLimit is how many characters document_read returns per call.
+const documentLimit = 8000
+
+// Document is the text extracted from a PDF or Office file, split into the
+// units a reader would navigate by: pages, slides or sheets.
+type Document struct {
+	Format string
+	Unit   string // "page", "slide" or "sheet"
+	Meta   []MetaField
+	Parts  []DocumentPart
+}
+
+type MetaField struct {
+	Name, Value string
+}
+
+type DocumentPart struct {
+	Title string // sheet name or slide title, may be empty
+	Text  string
+}
+
+func (d *Document) addMeta(name, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		d.Meta = append(d.Meta, MetaField{name, value})
+	}
+}
+
+// ReadDocument extracts the text of a .pdf, .docx, .xlsx or .pptx file.
+// tableFormat is "markdown" (default) or "csv".
+func ReadDocument(path, tableFormat string) (*Document, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return readPDF(path)
+	case ".docx", ".docm", ".dotx":
+		return readDOCX(path, tableFormat)
+	case ".xlsx", ".xlsm":
+		return readXLSX(path, tableFormat)
+	case ".pptx", ".pptm":
+		return readPPTX(path, tableFormat)
+	case ".doc", ".xls", ".ppt":
+		return nil, fmt.Errorf("legacy binary Office files are not supported, save the file as %sx first", filepath.Ext(path))
+	}
+	return nil, fmt.Errorf("unsupported document type %q, use file_read for plain text", filepath.Ext(path))
+}
+
+func readPDF(path string) (doc *Document, err error) {
+	// The PDF reader panics on some malformed files.
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("failed to parse PDF: %v", r)
+		}
+	}()
+
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %v", err)
+	}
+	defer f.Close()
+
+	doc = &Document{Format: "PDF", Unit: "page"}
+	info := r.Trailer().Key("Info")
+	doc.addMeta("Title", info.Key("Title").Text())
+	doc.addMeta("Author", info.Key("Author").Text())
+	doc.addMeta("Subject", info.Key("Subject").Text())
+	doc.addMeta("Creator", info.Key("Creator").Text())
+	doc.addMeta("Producer", info.Key("Producer").Text())
+	doc.addMeta("Created", pdfDate(info.Key("CreationDate").Text()))
+	doc.addMeta("Modified", pdfDate(info.Key("ModDate").Text()))
+
+	n := r.NumPage()
+	doc.addMeta("Pages", strconv.Itoa(n))
+	empty := 0
+	for i := 1; i <= n; i++ {
+		text, err := pdfPageText(r.Page(i))
+		if err != nil {
+			text = fmt.Sprintf("(failed to extract text: %v)", err)
+		}
+		text = cleanLines(text)
+		if text == "" {
+			empty++
+		}
+		doc.Parts = append(doc.Parts, DocumentPart{Text: text})
+	}
+	if n > 0 && empty == n {
+		doc.addMeta("Note", "no text layer found, the PDF is probably scanned images")
+	}
+	return doc, nil
+}
+
+// pdfPageText lays out the characters of a page in content order, starting
+// new lines when the baseline moves and inserting spaces at wide gaps, since
+// many PDFs position words individually instead of storing spaces.
+func pdfPageText(p pdf.Page) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	var sb strings.Builder
+	var prev pdf.Text
+	for _, t := range p.Content().Text {
+		// The reader ends each TJ with a zero-width byte 0x0A decoded in the
+		// current font: a newline, or Ω in TeX's OT1 encoding.
+		if t.S == "" || t.S == "\uFFFD" || (t.W == 0 && (t.S == "\n" || t.S == "Ω")) {
+			continue
+		}
+		size := t.FontSize
+		if size <= 0 {
+			size = 10
+		}
+		if sb.Len() > 0 {
+			end := prev.X + prev.W
+			switch {
+			case math.Abs(t.Y-prev.Y) > size*0.5 || t.X < end-size:
+				sb.WriteString("\n")
+				if prev.Y-t.Y > size*2 {
+					sb.WriteString("\n")
+				}
+			case t.X-end > size*0.15 && t.S != " " && prev.S != " ":
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(t.S)
+		prev = t
+	}
+	return sb.String(), nil
+}
+
+// pdfDate turns "D:20240131120000+08'00'" into "2024-01-31 12:00:00".
+func pdfDate(s string) string {
+	s = strings.TrimPrefix(s, "D:")
+	if len(s) < 8 {
+		return s
+	}
+	layouts := []string{"20060102150405", "200601021504", "2006010215", "20060102"}
+	for _, layout := range layouts {
+		if len(s) >= len(layout) {
+			if t, err := time.Parse(layout, s[:len(layout)]); err == nil {
+				return t.Format("2006-01-02 15:04:05")
+			}
+		}
+	}
+	return s
+}
+
+// cleanLines trims every line and drops runs of blank lines.
+func cleanLines(s string) string {
+	var out []string
+	blank := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// parsePageRange reads "3", "2-5", "4-" or "1,3,7-8" into sorted 1-based
+// indexes no greater than max.
+func parsePageRange(spec string, max int) ([]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		pages := make([]int, max)
+		for i := range pages {
+			pages[i] = i + 1
+		}
+		return pages, nil
+	}
+	seen := make(map[int]bool)
+	var pages []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid page range %q", spec)
+		}
+		end := start
+		if isRange {
+			if strings.TrimSpace(to) == "" {
+				end = max
+			} else if end, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+				return nil, fmt.Errorf("invalid page range %q", spec)
+			}
+		}
+		for i := start; i <= end && i <= max; i++ {
+			if i >= 1 && !seen[i] {
+				seen[i] = true
+				pages = append(pages, i)
+			}
+		}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages in %q, the document has %d", spec, max)
+	}
+	return pages, nil
+}
+
+type DocumentReadTool struct {
+	Policy *PathPolicy
+}
+
+func (t *DocumentReadTool) Name() string { return "document_read" }
+func (t *DocumentReadTool) Description() string {
+	return "Extract text, tables and metadata from PDF, Word (.docx), Excel (.xlsx) and PowerPoint (.pptx) files, page by page. " +
+		"Spreadsheets are returned one sheet per page as Markdown tables or CSV. Long documents are returned in parts; follow the hint at the end to continue."
+}
+func (t *DocumentReadTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "The path to the document",
+			},
+			"pages": map[string]interface{}{
+				"type":        "string",
+				"description": "Pages, slides or sheets to read, e.g. '3', '2-5', '4-' or '1,3' (default all)",
+			},
+			"sheet": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the spreadsheet sheet to read",
+			},
+			"table_format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"markdown", "csv"},
+				"description": "How tables and sheets are returned (default markdown)",
+			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Character offset within a single long page to continue from",
+			},
+			"metadata_only": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Only return metadata such as page count, author and sheet names",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+func (t *DocumentReadTool) Execute(args json.RawMessage) (string, error) {
+	var input struct {
+		Path         string `json:"path"`
+		Pages        string `json:"pages"`
+		Sheet        string `json:"sheet"`
+		TableFormat  string `json:"table_format"`
+		Offset       int    `json:"offset"`
+		MetadataOnly bool   `json:"metadata_only"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	path, err := t.Policy.CheckRead(t.Name(), input.Path)
+	if err != nil {
+		return "", err
+	}
+	doc, err := ReadDocument(path, input.TableFormat)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	unit := doc.Unit
+	if len(doc.Parts) != 1 {
+		unit += "s"
+	}
+	sb.WriteString(fmt.Sprintf("Document: %s (%s, %d %s)\n", path, doc.Format, len(doc.Parts), unit))
+	for _, m := range doc.Meta {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", m.Name, m.Value))
+	}
+	if input.MetadataOnly || len(doc.Parts) == 0 {
+		return strings.TrimRight(sb.String(), "\n"), nil
+	}
+
+	var pages []int
+	if input.Sheet != "" {
+		for i, part := range doc.Parts {
+			if strings.EqualFold(part.Title, input.Sheet) {
+				pages = append(pages, i+1)
+			}
+		}
+		if len(pages) == 0 {
+			return "", fmt.Errorf("no %s named %q", doc.Unit, input.Sheet)
+		}
+	} else if pages, err = parsePageRange(input.Pages, len(doc.Parts)); err != nil {
+		return "", err
+	}
+
+	// A single page is windowed by offset; several pages are returned until
+	// the limit, with a hint for the next range.
+	if len(pages) == 1 || input.Offset > 0 {
+		n := pages[0]
+		text := doc.Parts[n-1].Text
+		sb.WriteString("\n" + partHeading(doc, n) + "\n\n")
+		if input.Offset > 0 || utf8.RuneCountInString(text) > documentLimit {
+			text = offsetWindow(text, input.Offset, documentLimit)
+		}
+		sb.WriteString(text)
+		return sb.String(), nil
+	}
+
+	used := 0
+	for i, n := range pages {
+		text := doc.Parts[n-1].Text
+		size := utf8.RuneCountInString(text)
+		if i > 0 && used+size > documentLimit {
+			sb.WriteString(fmt.Sprintf("\n\n(%d of %d requested %ss shown, use pages=%s to continue)", i, len(pages), doc.Unit, remainingRange(pages[i:])))
+			break
+		}
+		sb.WriteString("\n" + partHeading(doc, n) + "\n\n")
+		if size > documentLimit {
+			text = offsetWindow(text, 0, documentLimit)
+			text = strings.Replace(text, "use offset=", fmt.Sprintf("use pages=%d and offset=", n), 1)
+		}
+		if text == "" {
+			text = "(no text)"
+		}
+		sb.WriteString(text + "\n")
+		used += size
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func partHeading(doc *Document, n int) string {
+	heading := fmt.Sprintf("## %s%s %d", strings.ToUpper(doc.Unit[:1]), doc.Unit[1:], n)
+	if title := doc.Parts[n-1].Title; title != "" {
+		heading += ": " + title
+	}
+	return heading
+}
+
+// remainingRange formats the pages still to read compactly, e.g. "5-9" when
+// they are consecutive.
+func remainingRange(pages []int) string {
+	if pages[len(pages)-1]-pages[0] == len(pages)-1 {
+		if len(pages) == 1 {
+			return strconv.Itoa(pages[0])
+		}
+		return fmt.Sprintf("%d-%d", pages[0], pages[len(pages)-1])
+	}
+	parts := make([]string, len(pages))
+	for i, p := range pages {
+		parts[i] = strconv.Itoa(p)
+	}
+	return strings.Join(parts, ",")
+}
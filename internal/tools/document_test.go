@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name, tableFormat string) *Document {
+	t.Helper()
+	doc, err := ReadDocument("testdata/"+name, tableFormat)
+	if err != nil {
+		t.Fatalf("ReadDocument(%s): %v", name, err)
+	}
+	return doc
+}
+
+func metaValue(doc *Document, name string) string {
+	for _, m := range doc.Meta {
+		if m.Name == name {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+func TestReadDOCX(t *testing.T) {
+	doc := readFixture(t, "report.docx", "markdown")
+
+	if doc.Format != "DOCX" || doc.Unit != "page" {
+		t.Errorf("format = %s/%s, want DOCX/page", doc.Format, doc.Unit)
+	}
+	if got := metaValue(doc, "Title"); got != "Quarterly Report" {
+		t.Errorf("title = %q", got)
+	}
+	if got := metaValue(doc, "Author"); got != "Test Author" {
+		t.Errorf("author = %q", got)
+	}
+	// The explicit page break splits the document in two.
+	if len(doc.Parts) != 2 {
+		t.Fatalf("got %d pages, want 2", len(doc.Parts))
+	}
+
+	want := "# Quarterly Report\n\n" +
+		"# Summary\n\n" +
+		"Sales grew 12% over the quarter.\n\n" +
+		"- New customers\n\n" +
+		"- Fewer returns\n\n" +
+		"| Region | Sales |\n" +
+		"| --- | --- |\n" +
+		"| North | 120 |\n" +
+		"| South | 95 |"
+	if doc.Parts[0].Text != want {
+		t.Errorf("page 1:\n%s\nwant:\n%s", doc.Parts[0].Text, want)
+	}
+	if want := "## Outlook\n\nNext quarter looks stable."; doc.Parts[1].Text != want {
+		t.Errorf("page 2:\n%s\nwant:\n%s", doc.Parts[1].Text, want)
+	}
+}
+
+func TestReadDOCXTableCSV(t *testing.T) {
+	doc := readFixture(t, "report.docx", "csv")
+	if !strings.HasSuffix(doc.Parts[0].Text, "Region,Sales\nNorth,120\nSouth,95") {
+		t.Errorf("page 1 lacks the CSV table:\n%s", doc.Parts[0].Text)
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	doc := readFixture(t, "orders.xlsx", "markdown")
+
+	if doc.Format != "XLSX" || doc.Unit != "sheet" {
+		t.Errorf("format = %s/%s, want XLSX/sheet", doc.Format, doc.Unit)
+	}
+	if got, want := metaValue(doc, "Sheets"), "Orders [3 rows x 4 columns]; Lookup (hidden) [0 rows x 0 columns]"; got != want {
+		t.Errorf("sheets = %q, want %q", got, want)
+	}
+	if len(doc.Parts) != 2 {
+		t.Fatalf("got %d sheets, want 2", len(doc.Parts))
+	}
+
+	// Shared, rich and inline strings, dates, numbers and booleans, with the
+	// empty first row and column dropped.
+	want := "| Item | Date | Qty | Paid |\n" +
+		"| --- | --- | --- | --- |\n" +
+		"| Green tea | 2024-01-01 | 3 | TRUE |\n" +
+		"| Oolong \\| rolled | 2024-01-01 12:00:00 |  | FALSE |"
+	if part := doc.Parts[0]; part.Title != "Orders" || part.Text != want {
+		t.Errorf("sheet %q:\n%s\nwant:\n%s", part.Title, part.Text, want)
+	}
+	if part := doc.Parts[1]; part.Title != "Lookup" || part.Text != "(empty sheet)" {
+		t.Errorf("sheet %q: %q", part.Title, part.Text)
+	}
+}
+
+func TestReadXLSXCSV(t *testing.T) {
+	doc := readFixture(t, "orders.xlsx", "csv")
+	want := "Item,Date,Qty,Paid\n" +
+		"Green tea,2024-01-01,3,TRUE\n" +
+		"Oolong | rolled,2024-01-01 12:00:00,,FALSE"
+	if doc.Parts[0].Text != want {
+		t.Errorf("sheet 1:\n%s\nwant:\n%s", doc.Parts[0].Text, want)
+	}
+}
+
+func TestReadPPTX(t *testing.T) {
+	doc := readFixture(t, "deck.pptx", "markdown")
+
+	if doc.Format != "PPTX" || doc.Unit != "slide" {
+		t.Errorf("format = %s/%s, want PPTX/slide", doc.Format, doc.Unit)
+	}
+	if got := metaValue(doc, "Title"); got != "Tea Tasting" {
+		t.Errorf("title = %q", got)
+	}
+	if got := metaValue(doc, "Author"); got != "Test Author" {
+		t.Errorf("author = %q", got)
+	}
+
+	// Slides follow the presentation order, not the part names; notes are
+	// appended without the slide number placeholder.
+	want := []DocumentPart{
+		{Title: "Tea Tasting", Text: "# Tea Tasting\n\nSpring menu 2024"},
+		{Title: "Menu", Text: "# Menu\n\nGreen tea\n\nOolong\n\nServed at 80°C\n\nNotes:\nMention the oolong is new."},
+	}
+	if !reflect.DeepEqual(doc.Parts, want) {
+		t.Errorf("slides = %q\nwant %q", doc.Parts, want)
+	}
+}
+
+func TestReadPDF(t *testing.T) {
+	doc := readFixture(t, "invoice.pdf", "")
+
+	if doc.Format != "PDF" || doc.Unit != "page" {
+		t.Errorf("format = %s/%s, want PDF/page", doc.Format, doc.Unit)
+	}
+	for name, want := range map[string]string{
+		"Title":   "Invoice 2024-001",
+		"Author":  "Tea Shop",
+		"Created": "2024-01-31 12:00:00",
+		"Pages":   "2",
+	} {
+		if got := metaValue(doc, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	var pages []string
+	for _, p := range doc.Parts {
+		pages = append(pages, p.Text)
+	}
+	want := []string{"Invoice 2024-001\nTotal due: 42 EUR", "Thank you for your order."}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %q, want %q", pages, want)
+	}
+}
+
+func TestReadDocumentUnsupported(t *testing.T) {
+	if _, err := ReadDocument("testdata/old.doc", ""); err == nil || !strings.Contains(err.Error(), "save the file as .docx") {
+		t.Errorf("legacy .doc: %v", err)
+	}
+	if _, err := ReadDocument("testdata/article.html", ""); err == nil {
+		t.Error("HTML was read as a document")
+	}
+}
+
+func TestParsePageRange(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"", []int{1, 2, 3, 4, 5}},
+		{"3", []int{3}},
+		{"2-4", []int{2, 3, 4}},
+		{"4-", []int{4, 5}},
+		{"1,3-4,3", []int{1, 3, 4}},
+		{"4-9", []int{4, 5}},
+	}
+	for _, tt := range tests {
+		got, err := parsePageRange(tt.spec, 5)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePageRange(%q) = %v, %v; want %v", tt.spec, got, err, tt.want)
+		}
+	}
+	for _, spec := range []string{"x", "7", "2-y"} {
+		if _, err := parsePageRange(spec, 5); err == nil {
+			t.Errorf("parsePageRange(%q) succeeded", spec)
+		}
+	}
+}
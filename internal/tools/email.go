@@ -0,0 +1,852 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+
+	"xq-agent/internal/audit"
+	"xq-agent/internal/config"
+)
+
+const (
+	defaultEmailTimeout     = 60 * time.Second
+	defaultEmailAttachments = 20 << 20
+	defaultEmailSearchLimit = 10
+	maxEmailSearchLimit     = 50
+)
+
+func init() {
+	// Decode non-UTF-8 subjects and names in IMAP envelopes (GBK, Big5, ...).
+	imap.CharsetReader = charset.Reader
+}
+
+// Email connects to the mailbox configured under tools.email for the
+// email_* tools. Credentials stay in the configuration and are never shown
+// to the model.
+type Email struct {
+	Config  config.EmailConfig
+	Policy  *PathPolicy
+	Journal *Journal
+}
+
+func NewEmail(cfg config.EmailConfig, policy *PathPolicy, journal *Journal) *Email {
+	return &Email{Config: cfg, Policy: policy, Journal: journal}
+}
+
+func (e *Email) timeout() time.Duration {
+	if e.Config.Timeout > 0 {
+		return e.Config.Timeout
+	}
+	return defaultEmailTimeout
+}
+
+func (e *Email) maxAttachmentBytes() int64 {
+	if e.Config.MaxAttachmentBytes > 0 {
+		return e.Config.MaxAttachmentBytes
+	}
+	return defaultEmailAttachments
+}
+
+// login returns the user name and password, expanding ${ENV} references.
+func (e *Email) login() (string, string) {
+	user := os.ExpandEnv(e.Config.Username)
+	if user == "" {
+		user = e.Config.Address
+	}
+	return user, os.ExpandEnv(e.Config.Password)
+}
+
+// mailServer fills in the port and security defaults: implicit TLS on tlsPort,
+// STARTTLS on anything else.
+func mailServer(s config.EmailServerConfig, tlsPort, starttlsPort int, security string) (string, string, error) {
+	if s.Host == "" {
+		return "", "", fmt.Errorf("no server configured")
+	}
+	switch {
+	case s.Security != "":
+		security = strings.ToLower(s.Security)
+	case s.Port == tlsPort:
+		security = "tls"
+	case s.Port != 0:
+		security = "starttls"
+	}
+	port := s.Port
+	switch security {
+	case "tls":
+		if port == 0 {
+			port = tlsPort
+		}
+	case "starttls", "none":
+		if port == 0 {
+			port = starttlsPort
+		}
+	default:
+		return "", "", fmt.Errorf("unknown security %q, use tls, starttls or none", s.Security)
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(port)), security, nil
+}
+
+// dial opens a connection to addr, already wrapped in TLS when security is
+// "tls". The connection gives up after the configured timeout and is closed
+// when ctx is done; call the returned stop function once finished with it.
+func (e *Email) dial(ctx context.Context, addr, security string) (net.Conn, func() bool, error) {
+	dialer := &net.Dialer{Timeout: e.timeout()}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(e.timeout()))
+	if security == "tls" {
+		host, _, _ := net.SplitHostPort(addr)
+		tc := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		conn = tc
+	}
+	return conn, context.AfterFunc(ctx, func() { conn.Close() }), nil
+}
+
+// send delivers msg to every recipient over SMTP.
+func (e *Email) send(ctx context.Context, recipients []string, msg []byte) error {
+	addr, security, err := mailServer(e.Config.SMTP, 465, 587, "starttls")
+	if err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	conn, stop, err := e.dial(ctx, addr, security)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	defer stop()
+	host := e.Config.SMTP.Host
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %v", err)
+	}
+	defer c.Close()
+
+	if security == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not offer STARTTLS, set security to tls or none", addr)
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("smtp starttls: %v", err)
+		}
+	}
+	if user, pass := e.login(); pass != "" {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(smtp.PlainAuth("", user, pass, host)); err != nil {
+				return fmt.Errorf("smtp login failed: %v", err)
+			}
+		}
+	}
+	if err := c.Mail(e.Config.Address); err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	for _, r := range recipients {
+		if err := c.Rcpt(r); err != nil {
+			return fmt.Errorf("recipient %s rejected: %v", r, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message not accepted: %v", err)
+	}
+	return c.Quit()
+}
+
+// openIMAP logs in to the IMAP server. The returned function logs out.
+func (e *Email) openIMAP(ctx context.Context) (*client.Client, func(), error) {
+	addr, security, err := mailServer(e.Config.IMAP, 993, 143, "tls")
+	if err != nil {
+		return nil, nil, fmt.Errorf("imap: %v", err)
+	}
+	conn, stop, err := e.dial(ctx, addr, security)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	c, err := client.New(conn)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, nil, fmt.Errorf("imap: %v", err)
+	}
+	done := func() {
+		c.Logout()
+		stop()
+	}
+	if security == "starttls" {
+		if err := c.StartTLS(&tls.Config{ServerName: e.Config.IMAP.Host}); err != nil {
+			done()
+			return nil, nil, fmt.Errorf("imap starttls: %v", err)
+		}
+	}
+	user, pass := e.login()
+	if err := c.Login(user, pass); err != nil {
+		done()
+		return nil, nil, fmt.Errorf("imap login failed: %v", err)
+	}
+	return c, done, nil
+}
+
+// selectFolder opens folder read-only, so reading never changes flags.
+func selectFolder(c *client.Client, folder string) (string, *imap.MailboxStatus, error) {
+	if folder == "" {
+		folder = "INBOX"
+	}
+	status, err := c.Select(folder, true)
+	if err != nil {
+		return folder, nil, fmt.Errorf("cannot open folder %q: %v (use list_folders to see the folders)", folder, err)
+	}
+	return folder, status, nil
+}
+
+// parseAddresses reads comma-separated addresses like "Bob <bob@example.com>".
+func parseAddresses(list []string) ([]*mail.Address, error) {
+	var out []*mail.Address
+	for _, s := range list {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		addrs, err := mail.ParseAddressList(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %v", s, err)
+		}
+		out = append(out, addrs...)
+	}
+	return out, nil
+}
+
+func formatAddresses(addrs []*mail.Address) string {
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		if a.Name != "" {
+			parts[i] = fmt.Sprintf("%s <%s>", a.Name, a.Address)
+		} else {
+			parts[i] = a.Address
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func envelopeSender(env *imap.Envelope) string {
+	if env == nil || len(env.From) == 0 {
+		return ""
+	}
+	a := env.From[0]
+	if a.PersonalName != "" {
+		return a.PersonalName + " <" + a.Address() + ">"
+	}
+	return a.Address()
+}
+
+var emailFolderProperty = map[string]interface{}{
+	"type":        "string",
+	"description": "Mailbox folder, default INBOX",
+}
+
+// EmailSendTool sends a message from the configured address.
+type EmailSendTool struct{ Email *Email }
+
+func (t *EmailSendTool) Name() string { return "email_send" }
+func (t *EmailSendTool) Description() string {
+	return "Send an email from the configured mailbox over SMTP, optionally as HTML and with file attachments."
+}
+func (t *EmailSendTool) Schema() interface{} {
+	addresses := func(desc string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": desc,
+		}
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"to":      addresses("Recipients, e.g. 'Bob <bob@example.com>'"),
+			"cc":      addresses("Carbon copy recipients"),
+			"bcc":     addresses("Blind carbon copy recipients, not shown to the others"),
+			"subject": map[string]interface{}{"type": "string"},
+			"body":    map[string]interface{}{"type": "string"},
+			"html": map[string]interface{}{
+				"type":        "boolean",
+				"description": "The body is HTML; a plain text version is added automatically",
+			},
+			"attachments": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Paths of files to attach",
+			},
+		},
+		"required": []string{"to", "subject", "body"},
+	}
+}
+
+func (t *EmailSendTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *EmailSendTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		To          []string `json:"to"`
+		Cc          []string `json:"cc"`
+		Bcc         []string `json:"bcc"`
+		Subject     string   `json:"subject"`
+		Body        string   `json:"body"`
+		HTML        bool     `json:"html"`
+		Attachments []string `json:"attachments"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	e := t.Email
+	if e.Config.Address == "" {
+		return "", fmt.Errorf("no sender address configured (tools.email.address)")
+	}
+	to, err := parseAddresses(input.To)
+	if err != nil {
+		return "", err
+	}
+	cc, err := parseAddresses(input.Cc)
+	if err != nil {
+		return "", err
+	}
+	bcc, err := parseAddresses(input.Bcc)
+	if err != nil {
+		return "", err
+	}
+	if len(to)+len(cc)+len(bcc) == 0 {
+		return "", fmt.Errorf("no recipients")
+	}
+
+	var files []string
+	var total int64
+	for _, a := range input.Attachments {
+		path, err := e.Policy.CheckRead(t.Name(), a)
+		if err != nil {
+			return "", err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("attachment %s: %v", a, err)
+		}
+		if info.IsDir() {
+			return "", fmt.Errorf("attachment %s is a directory, use the archive tool to pack it first", a)
+		}
+		total += info.Size()
+		if total > e.maxAttachmentBytes() {
+			return "", fmt.Errorf("attachments exceed %s", formatSize(e.maxAttachmentBytes()))
+		}
+		files = append(files, path)
+	}
+
+	msg, err := buildMessage(e.Config, to, cc, input.Subject, input.Body, input.HTML, files)
+	if err != nil {
+		return "", err
+	}
+	var recipients []string
+	for _, list := range [][]*mail.Address{to, cc, bcc} {
+		for _, a := range list {
+			recipients = append(recipients, a.Address)
+		}
+	}
+	if err := e.send(ctx, recipients, msg); err != nil {
+		return "", err
+	}
+	audit.Record(audit.Event{
+		Kind:   "email_sent",
+		Tool:   t.Name(),
+		Target: strings.Join(recipients, ", "),
+		Reason: input.Subject,
+	})
+
+	result := fmt.Sprintf("Sent %q to %s", input.Subject, countNoun(len(recipients), "recipient"))
+	if len(files) > 0 {
+		result += fmt.Sprintf(" with %s (%s)", countNoun(len(files), "attachment"), formatSize(total))
+	}
+	return result, nil
+}
+
+// buildMessage composes a MIME message. HTML bodies get a plain text
+// alternative for clients that do not render HTML.
+func buildMessage(cfg config.EmailConfig, to, cc []*mail.Address, subject, body string, isHTML bool, files []string) ([]byte, error) {
+	var h mail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{{Name: cfg.Name, Address: cfg.Address}})
+	if len(to) > 0 {
+		h.SetAddressList("To", to)
+	}
+	if len(cc) > 0 {
+		h.SetAddressList("Cc", cc)
+	}
+	h.SetSubject(subject)
+	if err := h.GenerateMessageID(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	mw, err := mail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, err
+	}
+	iw, err := mw.CreateInline()
+	if err != nil {
+		return nil, err
+	}
+	text := body
+	if isHTML {
+		if text, err = PageToMarkdown(strings.NewReader(body), ""); err != nil {
+			return nil, fmt.Errorf("failed to convert the HTML body: %v", err)
+		}
+	}
+	parts := []struct{ typ, content string }{{"text/plain", text}}
+	if isHTML {
+		parts = append(parts, struct{ typ, content string }{"text/html", body})
+	}
+	for _, p := range parts {
+		var ph mail.InlineHeader
+		ph.SetContentType(p.typ, map[string]string{"charset": "utf-8"})
+		w, err := iw.CreatePart(ph)
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(w, p.content)
+		w.Close()
+	}
+	if err := iw.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, path := range files {
+		var ah mail.AttachmentHeader
+		typ, params, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+		if err != nil {
+			typ, params = "application/octet-stream", nil
+		}
+		ah.SetContentType(typ, params)
+		ah.SetFilename(filepath.Base(path))
+		w, err := mw.CreateAttachment(ah)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %v", err)
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		w.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %v", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EmailSearchTool lists folders or finds messages in one.
+type EmailSearchTool struct{ Email *Email }
+
+func (t *EmailSearchTool) Name() string { return "email_search" }
+func (t *EmailSearchTool) Description() string {
+	return "Search the configured mailbox over IMAP, newest first. Returns UIDs for email_read. " +
+		"Set list_folders to see the available folders."
+}
+func (t *EmailSearchTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"folder": emailFolderProperty,
+			"list_folders": map[string]interface{}{
+				"type":        "boolean",
+				"description": "List the mailbox folders instead of searching",
+			},
+			"from":    map[string]interface{}{"type": "string", "description": "Sender contains"},
+			"to":      map[string]interface{}{"type": "string", "description": "Recipient contains"},
+			"subject": map[string]interface{}{"type": "string", "description": "Subject contains"},
+			"text":    map[string]interface{}{"type": "string", "description": "Headers or body contain"},
+			"since": map[string]interface{}{
+				"type":        "string",
+				"description": "Received on or after, e.g. '2025-03-01' or 'last monday'",
+			},
+			"before": map[string]interface{}{
+				"type":        "string",
+				"description": "Received before",
+			},
+			"unread": map[string]interface{}{"type": "boolean", "description": "Only unread messages"},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Default %d, at most %d", defaultEmailSearchLimit, maxEmailSearchLimit),
+			},
+		},
+	}
+}
+
+func (t *EmailSearchTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *EmailSearchTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Folder      string `json:"folder"`
+		ListFolders bool   `json:"list_folders"`
+		From        string `json:"from"`
+		To          string `json:"to"`
+		Subject     string `json:"subject"`
+		Text        string `json:"text"`
+		Since       string `json:"since"`
+		Before      string `json:"before"`
+		Unread      bool   `json:"unread"`
+		Limit       int    `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	criteria := imap.NewSearchCriteria()
+	for _, f := range []struct{ key, value string }{{"From", input.From}, {"To", input.To}, {"Subject", input.Subject}} {
+		if f.value != "" {
+			criteria.Header.Add(f.key, f.value)
+		}
+	}
+	if input.Text != "" {
+		criteria.Text = []string{input.Text}
+	}
+	now := time.Now()
+	if input.Since != "" {
+		since, err := ParseTime(input.Since, now)
+		if err != nil {
+			return "", fmt.Errorf("invalid since: %v", err)
+		}
+		criteria.Since = since
+	}
+	if input.Before != "" {
+		before, err := ParseTime(input.Before, now)
+		if err != nil {
+			return "", fmt.Errorf("invalid before: %v", err)
+		}
+		criteria.Before = before
+	}
+	if input.Unread {
+		criteria.WithoutFlags = []string{imap.SeenFlag}
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultEmailSearchLimit
+	}
+	if limit > maxEmailSearchLimit {
+		limit = maxEmailSearchLimit
+	}
+
+	c, logout, err := t.Email.openIMAP(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer logout()
+
+	if input.ListFolders {
+		return listFolders(c)
+	}
+	folder, _, err := selectFolder(c, input.Folder)
+	if err != nil {
+		return "", err
+	}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return "", fmt.Errorf("search failed: %v", err)
+	}
+	if len(uids) == 0 {
+		return fmt.Sprintf("No matching messages in %s.", folder), nil
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+	found := len(uids)
+	if len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	messages := make(chan *imap.Message, len(uids))
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchFlags, imap.FetchInternalDate}
+	if err := c.UidFetch(seqset, items, messages); err != nil {
+		return "", fmt.Errorf("fetch failed: %v", err)
+	}
+	byUID := make(map[uint32]*imap.Message)
+	for m := range messages {
+		byUID[m.Uid] = m
+	}
+
+	rows := [][]string{{"UID", "Date", "From", "Subject", "Unread"}}
+	for _, uid := range uids {
+		m, ok := byUID[uid]
+		if !ok {
+			continue
+		}
+		date := m.InternalDate
+		subject := ""
+		if m.Envelope != nil {
+			if !m.Envelope.Date.IsZero() {
+				date = m.Envelope.Date
+			}
+			subject = m.Envelope.Subject
+		}
+		unread := "yes"
+		for _, f := range m.Flags {
+			if f == imap.SeenFlag {
+				unread = ""
+			}
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(uid), 10),
+			date.Local().Format("2006-01-02 15:04"),
+			envelopeSender(m.Envelope),
+			subject,
+			unread,
+		})
+	}
+	header := fmt.Sprintf("%s in %s", countNoun(found, "message"), folder)
+	if found > len(uids) {
+		header += fmt.Sprintf(", showing the newest %d", len(uids))
+	}
+	return header + ":\n\n" + renderTable(rows, "markdown") + "\n\nUse email_read with a UID to open a message.", nil
+}
+
+func listFolders(c *client.Client) (string, error) {
+	mailboxes := make(chan *imap.MailboxInfo, 16)
+	done := make(chan error, 1)
+	go func() { done <- c.List("", "*", mailboxes) }()
+	var names []string
+	for m := range mailboxes {
+		name := m.Name
+		for _, attr := range m.Attributes {
+			switch attr {
+			case imap.SentAttr, imap.DraftsAttr, imap.TrashAttr, imap.JunkAttr, imap.ArchiveAttr, imap.FlaggedAttr:
+				name += " (" + strings.TrimPrefix(attr, `\`) + ")"
+			}
+		}
+		names = append(names, name)
+	}
+	if err := <-done; err != nil {
+		return "", fmt.Errorf("failed to list folders: %v", err)
+	}
+	sort.Strings(names)
+	return "Folders:\n" + strings.Join(names, "\n"), nil
+}
+
+// EmailReadTool shows one message and can save its attachments.
+type EmailReadTool struct{ Email *Email }
+
+func (t *EmailReadTool) Name() string { return "email_read" }
+func (t *EmailReadTool) Description() string {
+	return "Read an email by the UID from email_search. HTML is rendered as text; attachments are listed and can be saved. " +
+		"Reading does not mark the message as read."
+}
+func (t *EmailReadTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"folder": emailFolderProperty,
+			"uid":    map[string]interface{}{"type": "integer"},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Character offset to continue reading a long message",
+			},
+			"save_attachments": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to save the attachments in",
+			},
+			"overwrite": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Replace existing files when saving attachments",
+			},
+		},
+		"required": []string{"uid"},
+	}
+}
+
+func (t *EmailReadTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *EmailReadTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Folder          string `json:"folder"`
+		UID             uint32 `json:"uid"`
+		Offset          int    `json:"offset"`
+		SaveAttachments string `json:"save_attachments"`
+		Overwrite       bool   `json:"overwrite"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if input.UID == 0 {
+		return "", fmt.Errorf("uid is required")
+	}
+
+	c, logout, err := t.Email.openIMAP(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer logout()
+	folder, _, err := selectFolder(c, input.Folder)
+	if err != nil {
+		return "", err
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(input.UID)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 1)
+	if err := c.UidFetch(seqset, []imap.FetchItem{section.FetchItem()}, messages); err != nil {
+		return "", fmt.Errorf("fetch failed: %v", err)
+	}
+	var raw io.Reader
+	for m := range messages {
+		raw = m.GetBody(section)
+	}
+	if raw == nil {
+		return "", fmt.Errorf("no message with UID %d in %s", input.UID, folder)
+	}
+	return t.render(ctx, raw, input.Offset, input.SaveAttachments, input.Overwrite)
+}
+
+// render prints the headers, attachments and body of a raw message.
+func (t *EmailReadTool) render(ctx context.Context, raw io.Reader, offset int, saveDir string, overwrite bool) (string, error) {
+	mr, err := mail.CreateReader(raw)
+	if err != nil && !message.IsUnknownCharset(err) {
+		return "", fmt.Errorf("failed to parse the message: %v", err)
+	}
+	defer mr.Close()
+
+	var sb strings.Builder
+	if from, _ := mr.Header.AddressList("From"); len(from) > 0 {
+		fmt.Fprintf(&sb, "From: %s\n", formatAddresses(from))
+	}
+	for _, key := range []string{"To", "Cc"} {
+		if list, _ := mr.Header.AddressList(key); len(list) > 0 {
+			fmt.Fprintf(&sb, "%s: %s\n", key, formatAddresses(list))
+		}
+	}
+	if date, err := mr.Header.Date(); err == nil {
+		fmt.Fprintf(&sb, "Date: %s\n", date.Local().Format("2006-01-02 15:04 MST"))
+	}
+	subject, _ := mr.Header.Subject()
+	fmt.Fprintf(&sb, "Subject: %s\n", subject)
+
+	var plain, htmlBody string
+	var attachments, saved []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if message.IsUnknownCharset(err) {
+				continue
+			}
+			return "", fmt.Errorf("failed to parse the message: %v", err)
+		}
+		switch h := p.Header.(type) {
+		case *mail.InlineHeader:
+			typ, _, _ := h.ContentType()
+			data, err := io.ReadAll(io.LimitReader(p.Body, t.Email.maxAttachmentBytes()))
+			if err != nil {
+				continue
+			}
+			switch {
+			case typ == "text/plain" && plain == "":
+				plain = string(data)
+			case typ == "text/html" && htmlBody == "":
+				htmlBody = string(data)
+			}
+		case *mail.AttachmentHeader:
+			name, _ := h.Filename()
+			if name == "" {
+				name = "attachment"
+			}
+			data, err := io.ReadAll(io.LimitReader(p.Body, t.Email.maxAttachmentBytes()+1))
+			if err != nil {
+				return "", fmt.Errorf("failed to read attachment %s: %v", name, err)
+			}
+			attachments = append(attachments, fmt.Sprintf("%s (%s)", name, formatSize(int64(len(data)))))
+			if saveDir == "" {
+				continue
+			}
+			if int64(len(data)) > t.Email.maxAttachmentBytes() {
+				return "", fmt.Errorf("attachment %s exceeds %s", name, formatSize(t.Email.maxAttachmentBytes()))
+			}
+			path, err := t.save(ctx, saveDir, name, data, overwrite)
+			if err != nil {
+				return "", err
+			}
+			saved = append(saved, path)
+		}
+	}
+
+	if len(attachments) > 0 {
+		fmt.Fprintf(&sb, "Attachments: %s\n", strings.Join(attachments, ", "))
+	}
+	if len(saved) > 0 {
+		fmt.Fprintf(&sb, "Saved: %s\n", strings.Join(saved, ", "))
+	}
+	body := strings.TrimSpace(plain)
+	if body == "" && htmlBody != "" {
+		body, err = PageToMarkdown(strings.NewReader(htmlBody), "")
+		if err != nil {
+			return "", fmt.Errorf("failed to convert the HTML body: %v", err)
+		}
+	}
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if offset > 0 || len([]rune(body)) > documentLimit {
+		body = offsetWindow(body, offset, documentLimit)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(body)
+	return sb.String(), nil
+}
+
+// save writes an attachment into dir through the journal.
+func (t *EmailReadTool) save(ctx context.Context, dir, name string, data []byte, overwrite bool) (string, error) {
+	name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = "attachment"
+	}
+	path, err := t.Email.Policy.CheckWrite(t.Name(), filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil && !overwrite {
+		return "", fmt.Errorf("%s already exists (set overwrite to replace it)", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := t.Email.Journal.WriteFile(ctx, t.Name(), path, data); err != nil {
+		return "", err
+	}
+	return path, nil
+}
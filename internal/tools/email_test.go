@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+
+	"xq-agent/internal/config"
+)
+
+// smtpStub accepts one message per session and records what it was told.
+type smtpStub struct {
+	mu         sync.Mutex
+	auth       string
+	from       string
+	recipients []string
+	data       string
+}
+
+func startSMTPStub(t *testing.T) (*smtpStub, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	stub := &smtpStub{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub, ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		s.mu.Lock()
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-stub\r\n250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = arg
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.from = arg
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.recipients = append(s.recipients, arg)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			s.mu.Unlock()
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+		s.mu.Unlock()
+	}
+}
+
+// startIMAPStub serves an in-memory mailbox holding the backend's sample
+// message (UID 6, read) plus the given messages, which get UIDs from 7.
+func startIMAPStub(t *testing.T, messages ...string) int {
+	t.Helper()
+	be := memory.New()
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range messages {
+		date := time.Date(2025, 3, 1+i, 9, 0, 0, 0, time.UTC)
+		if err := inbox.CreateMessage(nil, date, bytes.NewBufferString(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := user.CreateMailbox("Archive"); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func testEmail(t *testing.T, smtpPort, imapPort int) *Email {
+	t.Helper()
+	dir := t.TempDir()
+	policy, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEmail(config.EmailConfig{
+		Address:  "me@example.com",
+		Name:     "Me",
+		Username: "username",
+		Password: "password",
+		SMTP:     config.EmailServerConfig{Host: "127.0.0.1", Port: smtpPort, Security: "none"},
+		IMAP:     config.EmailServerConfig{Host: "127.0.0.1", Port: imapPort, Security: "none"},
+		Timeout:  10 * time.Second,
+	}, policy, NewJournal(config.JournalConfig{}))
+}
+
+func runTool(t *testing.T, tool Tool, args map[string]interface{}) string {
+	t.Helper()
+	data, _ := json.Marshal(args)
+	out, err := tool.Execute(data)
+	if err != nil {
+		t.Fatalf("%s: %v", tool.Name(), err)
+	}
+	return out
+}
+
+func TestEmailSend(t *testing.T) {
+	stub, port := startSMTPStub(t)
+	e := testEmail(t, port, 0)
+	attachment := filepath.Join(e.Policy.roots[0], "notes.txt")
+	if err := os.WriteFile(attachment, []byte("see you there"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runTool(t, &EmailSendTool{Email: e}, map[string]interface{}{
+		"to":          []string{"Bob <bob@example.com>"},
+		"cc":          []string{"carol@example.com"},
+		"bcc":         []string{"dave@example.com"},
+		"subject":     "Lunch",
+		"body":        "<p>Lunch at <b>noon</b>?</p>",
+		"html":        true,
+		"attachments": []string{attachment},
+	})
+	if !strings.HasPrefix(out, `Sent "Lunch" to 3 recipients with 1 attachment`) {
+		t.Errorf("result = %q", out)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	wantAuth := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00username\x00password"))
+	if stub.auth != wantAuth {
+		t.Errorf("auth = %q, want %q", stub.auth, wantAuth)
+	}
+	if stub.from != "FROM:<me@example.com>" {
+		t.Errorf("mail from = %q", stub.from)
+	}
+	if got := strings.Join(stub.recipients, " "); got != "TO:<bob@example.com> TO:<carol@example.com> TO:<dave@example.com>" {
+		t.Errorf("recipients = %q", got)
+	}
+	for _, want := range []string{
+		"Subject: Lunch",
+		`From: "Me" <me@example.com>`,
+		`To: "Bob" <bob@example.com>`,
+		"Cc: <carol@example.com>",
+		"Content-Type: text/plain",
+		"Lunch at **noon**?",
+		"Content-Type: text/html",
+		`filename=notes.txt`,
+	} {
+		if !strings.Contains(stub.data, want) {
+			t.Errorf("message lacks %q:\n%s", want, stub.data)
+		}
+	}
+	// Blind copies stay out of the headers.
+	if strings.Contains(stub.data, "dave@example.com") {
+		t.Errorf("message reveals the bcc recipient:\n%s", stub.data)
+	}
+}
+
+func TestEmailSendRejectsOutsideAttachments(t *testing.T) {
+	_, port := startSMTPStub(t)
+	e := testEmail(t, port, 0)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("x"), 0644)
+
+	args, _ := json.Marshal(map[string]interface{}{
+		"to": []string{"bob@example.com"}, "subject": "s", "body": "b", "attachments": []string{outside},
+	})
+	if _, err := (&EmailSendTool{Email: e}).Execute(args); err == nil {
+		t.Error("attached a file outside the workspace")
+	}
+}
+
+const bobMessage = "From: Bob <bob@example.com>\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Quarterly numbers\r\n" +
+	"Date: Sat, 01 Mar 2025 09:00:00 +0000\r\n" +
+	"Message-ID: <1@example.com>\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"The numbers are in.\r\n"
+
+const aliceMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Invoice\r\n" +
+	"Date: Sun, 02 Mar 2025 09:00:00 +0000\r\n" +
+	"Message-ID: <2@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Please find the <b>invoice</b> attached.</p>\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.txt\"\r\n" +
+	"\r\n" +
+	"Total: 42 EUR\r\n" +
+	"--outer--\r\n"
+
+func TestEmailSearch(t *testing.T) {
+	e := testEmail(t, 0, startIMAPStub(t, bobMessage, aliceMessage))
+	tool := &EmailSearchTool{Email: e}
+
+	out := runTool(t, tool, map[string]interface{}{})
+	if !strings.HasPrefix(out, "3 messages in INBOX:") {
+		t.Errorf("search all:\n%s", out)
+	}
+	// Newest first, with UIDs for email_read.
+	alice := strings.Index(out, "| 8 |")
+	bob := strings.Index(out, "| 7 |")
+	sample := strings.Index(out, "| 6 |")
+	if alice < 0 || bob < alice || sample < bob {
+		t.Errorf("messages out of order:\n%s", out)
+	}
+	if !strings.Contains(out, "| Alice <alice@example.com> | Invoice | yes |") {
+		t.Errorf("search lacks the unread invoice:\n%s", out)
+	}
+
+	out = runTool(t, tool, map[string]interface{}{"from": "bob", "limit": 1})
+	if !strings.HasPrefix(out, "1 message in INBOX:") || !strings.Contains(out, "Quarterly numbers") {
+		t.Errorf("search from bob:\n%s", out)
+	}
+
+	out = runTool(t, tool, map[string]interface{}{"limit": 2})
+	if !strings.HasPrefix(out, "3 messages in INBOX, showing the newest 2:") || strings.Contains(out, "| 6 |") {
+		t.Errorf("search with limit:\n%s", out)
+	}
+
+	out = runTool(t, tool, map[string]interface{}{"subject": "holiday"})
+	if out != "No matching messages in INBOX." {
+		t.Errorf("search without matches: %q", out)
+	}
+}
+
+func TestEmailListFolders(t *testing.T) {
+	e := testEmail(t, 0, startIMAPStub(t))
+	out := runTool(t, &EmailSearchTool{Email: e}, map[string]interface{}{"list_folders": true})
+	if out != "Folders:\nArchive\nINBOX" {
+		t.Errorf("folders: %q", out)
+	}
+}
+
+func TestEmailRead(t *testing.T) {
+	e := testEmail(t, 0, startIMAPStub(t, bobMessage, aliceMessage))
+	tool := &EmailReadTool{Email: e}
+
+	out := runTool(t, tool, map[string]interface{}{"uid": 7})
+	for _, want := range []string{
+		"From: Bob <bob@example.com>\n",
+		"To: me@example.com\n",
+		"Subject: Quarterly numbers\n",
+		"\nThe numbers are in.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("message 7 lacks %q:\n%s", want, out)
+		}
+	}
+
+	// The HTML body is rendered and the attachment listed, then saved.
+	out = runTool(t, tool, map[string]interface{}{"uid": 8, "save_attachments": "files"})
+	for _, want := range []string{
+		"Attachments: invoice.txt (",
+		"Please find the **invoice** attached.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("message 8 lacks %q:\n%s", want, out)
+		}
+	}
+	saved := filepath.Join(e.Policy.roots[0], "files", "invoice.txt")
+	if data, err := os.ReadFile(saved); err != nil || strings.TrimSpace(string(data)) != "Total: 42 EUR" {
+		t.Errorf("saved attachment = %q, %v", data, err)
+	}
+
+	args, _ := json.Marshal(map[string]interface{}{"uid": 99})
+	if _, err := tool.Execute(args); err == nil || !strings.Contains(err.Error(), "no message with UID 99") {
+		t.Errorf("missing UID: %v", err)
+	}
+}
+
+func TestEmailReadDoesNotMarkSeen(t *testing.T) {
+	e := testEmail(t, 0, startIMAPStub(t, bobMessage))
+	runTool(t, &EmailReadTool{Email: e}, map[string]interface{}{"uid": 7})
+	out := runTool(t, &EmailSearchTool{Email: e}, map[string]interface{}{"unread": true})
+	if !strings.HasPrefix(out, "1 message in INBOX:") || !strings.Contains(out, "| 7 |") {
+		t.Errorf("message was marked read:\n%s", out)
+	}
+}
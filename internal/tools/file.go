@@ -1,12 +1,16 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
-type FileReadTool struct{}
+type FileReadTool struct {
+	Policy *PathPolicy
+}
 
 func (t *FileReadTool) Name() string        { return "file_read" }
 func (t *FileReadTool) Description() string { return "Read the contents of a file." }
@@ -29,14 +33,20 @@ func (t *FileReadTool) Execute(args json.RawMessage) (string, error) {
 	if err := json.Unmarshal(args, &input); err != nil {
 		return "", fmt.Errorf("invalid arguments: %v", err)
 	}
-	content, err := os.ReadFile(input.Path)
+	path, err := t.Policy.CheckRead(t.Name(), input.Path)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
 	return string(content), nil
 }
 
-type FileListTool struct{}
+type FileListTool struct {
+	Policy *PathPolicy
+}
 
 func (t *FileListTool) Name() string        { return "file_list" }
 func (t *FileListTool) Description() string { return "List files in a directory." }
@@ -59,19 +69,29 @@ func (t *FileListTool) Execute(args json.RawMessage) (string, error) {
 	if err := json.Unmarshal(args, &input); err != nil {
 		return "", fmt.Errorf("invalid arguments: %v", err)
 	}
-	entries, err := os.ReadDir(input.Path)
+	dir, err := t.Policy.CheckRead(t.Name(), input.Path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return "", err
 	}
 	var result string
 	for _, entry := range entries {
+		if t.Policy.Denied(filepath.Join(dir, entry.Name())) {
+			continue
+		}
 		info, _ := entry.Info()
 		result += fmt.Sprintf("%s (%d bytes)\n", entry.Name(), info.Size())
 	}
 	return result, nil
 }
 
-type FileWriteTool struct{}
+type FileWriteTool struct {
+	Policy  *PathPolicy
+	Journal *Journal
+}
 
 func (t *FileWriteTool) Name() string        { return "file_write" }
 func (t *FileWriteTool) Description() string { return "Write content to a file (overwrite)." }
@@ -92,6 +112,9 @@ func (t *FileWriteTool) Schema() interface{} {
 	}
 }
 func (t *FileWriteTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *FileWriteTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
 	var input struct {
 		Path    string `json:"path"`
 		Content string `json:"content"`
@@ -99,7 +122,11 @@ func (t *FileWriteTool) Execute(args json.RawMessage) (string, error) {
 	if err := json.Unmarshal(args, &input); err != nil {
 		return "", fmt.Errorf("invalid arguments: %v", err)
 	}
-	err := os.WriteFile(input.Path, []byte(input.Content), 0644)
+	path, err := t.Policy.CheckWrite(t.Name(), input.Path)
+	if err != nil {
+		return "", err
+	}
+	err = t.Journal.WriteFile(ctx, t.Name(), path, []byte(input.Content))
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,1153 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"xq-agent/internal/audit"
+	"xq-agent/internal/config"
+)
+
+const defaultDiffBytes = 20000
+
+// Git runs git for the git_* tools. Repositories must lie inside the
+// workspace, and files the path policy denies are left out of diffs and
+// commits.
+type Git struct {
+	Config config.GitConfig
+	Policy *PathPolicy
+}
+
+func NewGit(cfg config.GitConfig, policy *PathPolicy) *Git {
+	return &Git{Config: cfg, Policy: policy}
+}
+
+// repo resolves the repository containing path (default the workspace root)
+// and returns its top-level directory.
+func (g *Git) repo(ctx context.Context, tool, path string, write bool) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	check := g.Policy.CheckRead
+	if write {
+		check = g.Policy.CheckWrite
+	}
+	dir, err := check(tool, path)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	top, err := g.run(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not in a git repository", path)
+	}
+	top = filepath.FromSlash(strings.TrimSpace(top))
+	// The repository may start above the workspace root.
+	if _, err := check(tool, top); err != nil {
+		return "", err
+	}
+	return top, nil
+}
+
+// run executes git in dir and returns its standard output.
+func (g *Git) run(ctx context.Context, dir string, args ...string) (string, error) {
+	name := args[0]
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			name = a
+			break
+		}
+	}
+	args = append([]string{"-c", "core.quotepath=off", "-c", "color.ui=false"}, args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_PAGER=cat", "GIT_EDITOR=true", "LC_ALL=C")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), fmt.Errorf("git %s: %s", name, msg)
+	}
+	return stdout.String(), nil
+}
+
+// refuse records and reports an operation the policy does not allow.
+func (g *Git) refuse(tool, target, reason string) error {
+	audit.Record(audit.Event{
+		Kind:   "git_denied",
+		Tool:   tool,
+		Target: target,
+		Reason: reason,
+	})
+	return fmt.Errorf("refused: %s (set tools.git.allow_destructive to permit)", reason)
+}
+
+// checkDestructive refuses operations that lose work or rewrite shared
+// history unless the configuration allows them.
+func (g *Git) checkDestructive(tool, target, what string) error {
+	if g.Config.AllowDestructive {
+		audit.Record(audit.Event{Kind: "git_destructive", Tool: tool, Target: target, Reason: what})
+		return nil
+	}
+	return g.refuse(tool, target, what+" is a destructive operation")
+}
+
+func (g *Git) maxDiffBytes(requested int) int {
+	limit := g.Config.MaxDiffBytes
+	if limit <= 0 {
+		limit = defaultDiffBytes
+	}
+	if requested > 0 && requested < limit {
+		return requested
+	}
+	return limit
+}
+
+// checkRef rejects revisions that git would parse as options.
+func checkRef(ref string) error {
+	if strings.HasPrefix(ref, "-") || strings.ContainsAny(ref, " \t\n\x00") {
+		return fmt.Errorf("invalid revision %q", ref)
+	}
+	return nil
+}
+
+// pathspecs checks the paths given by the model and turns them into
+// arguments for after "--".
+func (g *Git) pathspecs(tool, top string, paths []string, write bool) ([]string, error) {
+	specs := []string{"--"}
+	check := g.Policy.CheckRead
+	if write {
+		check = g.Policy.CheckWrite
+	}
+	for _, p := range paths {
+		abs := p
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(top, p)
+		}
+		resolved, err := check(tool, abs)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(top, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is outside the repository", p)
+		}
+		specs = append(specs, filepath.ToSlash(rel))
+	}
+	return specs, nil
+}
+
+// withoutDenied adds exclusions to specs for the files among names that the
+// path policy denies, so their content never reaches the model.
+func (g *Git) withoutDenied(top string, specs, names []string) []string {
+	if g.Policy == nil {
+		return specs
+	}
+	var excludes []string
+	for _, name := range names {
+		if g.denied(top, name) {
+			excludes = append(excludes, ":(exclude,literal)"+name)
+		}
+	}
+	if len(excludes) == 0 {
+		return specs
+	}
+	if len(specs) == 1 {
+		specs = append(specs, ".")
+	}
+	return append(specs, excludes...)
+}
+
+func (g *Git) denied(top, name string) bool {
+	return g.Policy.Denied(filepath.Join(top, filepath.FromSlash(name)))
+}
+
+// names runs a git command printing NUL-separated file names.
+func (g *Git) names(ctx context.Context, top string, args ...string) []string {
+	out, err := g.run(ctx, top, args...)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// changedFiles lists every file with staged, unstaged or untracked changes.
+func (g *Git) changedFiles(ctx context.Context, top string) []string {
+	files := g.names(ctx, top, "diff", "HEAD", "--name-only", "-z")
+	files = append(files, g.names(ctx, top, "ls-files", "--others", "--exclude-standard", "-z")...)
+	return files
+}
+
+// truncateDiff cuts a patch at file boundaries once it exceeds limit bytes,
+// naming the files left out.
+func truncateDiff(patch string, limit int) string {
+	if len(patch) <= limit {
+		return patch
+	}
+	var sb strings.Builder
+	var omitted []string
+	for i, file := range splitDiff(patch) {
+		if sb.Len()+len(file) <= limit {
+			sb.WriteString(file)
+			continue
+		}
+		if i == 0 || sb.Len() < limit/2 {
+			// Show the start of a large file rather than nothing.
+			room := limit - sb.Len()
+			cut := strings.LastIndex(file[:room], "\n") + 1
+			sb.WriteString(file[:cut])
+			sb.WriteString(fmt.Sprintf("... (%d more bytes of this file)\n", len(file)-cut))
+			continue
+		}
+		omitted = append(omitted, diffFileName(file))
+	}
+	if len(omitted) > 0 {
+		sb.WriteString(fmt.Sprintf("... (diff truncated at %d bytes, not shown: %s; pass paths to see them)\n", limit, strings.Join(omitted, ", ")))
+	}
+	return sb.String()
+}
+
+func splitDiff(patch string) []string {
+	var files []string
+	for {
+		next := strings.Index(patch[1:], "\ndiff --git ")
+		if next < 0 {
+			return append(files, patch)
+		}
+		files = append(files, patch[:next+2])
+		patch = patch[next+2:]
+	}
+}
+
+func diffFileName(file string) string {
+	line, _, _ := strings.Cut(file, "\n")
+	if i := strings.LastIndex(line, " b/"); i >= 0 {
+		return line[i+3:]
+	}
+	return strings.TrimPrefix(line, "diff --git ")
+}
+
+func repoSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "string",
+		"description": "Path inside the repository (default the workspace root)",
+	}
+}
+
+func pathsSchema(desc string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": desc,
+	}
+}
+
+type GitStatusTool struct {
+	Git *Git
+}
+
+func (t *GitStatusTool) Name() string { return "git_status" }
+func (t *GitStatusTool) Description() string {
+	return "Show the current branch, its upstream and the staged, unstaged, untracked and conflicted files of a git repository."
+}
+func (t *GitStatusTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+		},
+	}
+}
+func (t *GitStatusTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitStatusTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo string `json:"repo"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, false)
+	if err != nil {
+		return "", err
+	}
+	out, err := t.Git.run(ctx, top, "--no-optional-locks", "status", "--porcelain=v2", "--branch", "-z", "--untracked-files=all")
+	if err != nil {
+		return "", err
+	}
+
+	var branch, upstream, ab string
+	var staged, unstaged, untracked, conflicts []string
+	add := func(list *[]string, code, path string) {
+		if t.Git.Policy == nil || !t.Git.denied(top, path) {
+			*list = append(*list, strings.TrimSpace(code+" "+path))
+		}
+	}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		switch {
+		case strings.HasPrefix(e, "# branch.head "):
+			branch = strings.TrimPrefix(e, "# branch.head ")
+		case strings.HasPrefix(e, "# branch.upstream "):
+			upstream = strings.TrimPrefix(e, "# branch.upstream ")
+		case strings.HasPrefix(e, "# branch.ab "):
+			ab = strings.TrimPrefix(e, "# branch.ab ")
+		case strings.HasPrefix(e, "1 "), strings.HasPrefix(e, "2 "):
+			// "1 XY sub mH mI mW hH hI path", renames add a score field and
+			// are followed by the original path.
+			n := 9
+			if e[0] == '2' {
+				n = 10
+			}
+			fields := strings.SplitN(e, " ", n)
+			if len(fields) < n {
+				continue
+			}
+			path := fields[n-1]
+			shown := path
+			if e[0] == '2' && i+1 < len(entries) {
+				i++
+				shown = entries[i] + " -> " + path
+			}
+			if t.Git.Policy != nil && t.Git.denied(top, path) {
+				continue
+			}
+			if x := fields[1][0]; x != '.' {
+				staged = append(staged, string(x)+" "+shown)
+			}
+			if y := fields[1][1]; y != '.' {
+				unstaged = append(unstaged, string(y)+" "+shown)
+			}
+		case strings.HasPrefix(e, "u "):
+			if fields := strings.SplitN(e, " ", 11); len(fields) == 11 {
+				add(&conflicts, fields[1], fields[10])
+			}
+		case strings.HasPrefix(e, "? "):
+			add(&untracked, "", e[2:])
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Repository: %s\nBranch: %s", top, branch))
+	if upstream != "" {
+		sb.WriteString(" (upstream " + upstream)
+		var ahead, behind int
+		fmt.Sscanf(ab, "+%d -%d", &ahead, &behind)
+		if ahead > 0 || behind > 0 {
+			sb.WriteString(fmt.Sprintf(", ahead %d, behind %d", ahead, behind))
+		} else {
+			sb.WriteString(", up to date")
+		}
+		sb.WriteString(")")
+	}
+	sb.WriteString("\n")
+	section := func(title string, list []string) {
+		if len(list) == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("%s (%d):\n", title, len(list)))
+		for _, item := range list {
+			sb.WriteString("  " + item + "\n")
+		}
+	}
+	section("Conflicts", conflicts)
+	section("Staged", staged)
+	section("Unstaged", unstaged)
+	section("Untracked", untracked)
+	if len(staged)+len(unstaged)+len(untracked)+len(conflicts) == 0 {
+		sb.WriteString("Working tree clean\n")
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+type GitDiffTool struct {
+	Git *Git
+}
+
+func (t *GitDiffTool) Name() string { return "git_diff" }
+func (t *GitDiffTool) Description() string {
+	return "Show changes as a unified diff with a per-file summary: unstaged changes by default, staged changes with staged=true, " +
+		"or against a revision such as 'HEAD~3' or 'main...feature'. Large diffs are cut off; pass paths to narrow them down."
+}
+func (t *GitDiffTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+			"staged": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Show staged changes instead of unstaged ones",
+			},
+			"ref": map[string]interface{}{
+				"type":        "string",
+				"description": "Compare the working tree (or the index with staged) against this revision, or give a range 'a..b' / 'a...b'",
+			},
+			"paths": pathsSchema("Only show these files or directories"),
+			"stat_only": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Only list changed files with line counts",
+			},
+			"context": map[string]interface{}{
+				"type":        "integer",
+				"description": "Lines of context around changes (default 3)",
+			},
+			"max_bytes": map[string]interface{}{
+				"type":        "integer",
+				"description": "Cut the patch off after this many bytes (default and maximum set by the configuration)",
+			},
+		},
+	}
+}
+func (t *GitDiffTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitDiffTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo     string   `json:"repo"`
+		Staged   bool     `json:"staged"`
+		Ref      string   `json:"ref"`
+		Paths    []string `json:"paths"`
+		StatOnly bool     `json:"stat_only"`
+		Context  *int     `json:"context"`
+		MaxBytes int      `json:"max_bytes"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	if err := checkRef(input.Ref); err != nil {
+		return "", err
+	}
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, false)
+	if err != nil {
+		return "", err
+	}
+	specs, err := t.Git.pathspecs(t.Name(), top, input.Paths, false)
+	if err != nil {
+		return "", err
+	}
+
+	base := []string{"diff", "--no-ext-diff", "--find-renames"}
+	if input.Staged {
+		base = append(base, "--cached")
+	}
+	if input.Ref != "" {
+		base = append(base, input.Ref)
+	}
+	names := t.Git.names(ctx, top, append(append(append([]string{}, base...), "--name-only", "-z"), specs...)...)
+	specs = t.Git.withoutDenied(top, specs, names)
+	stat, err := t.Git.run(ctx, top, append(append(append([]string{}, base...), "--stat=120"), specs...)...)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(stat) == "" {
+		return "No changes.", nil
+	}
+	if input.StatOnly {
+		return strings.TrimRight(stat, "\n"), nil
+	}
+	if input.Context != nil && *input.Context >= 0 {
+		base = append(base, fmt.Sprintf("--unified=%d", *input.Context))
+	}
+	patch, err := t.Git.run(ctx, top, append(base, specs...)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(stat+"\n"+truncateDiff(patch, t.Git.maxDiffBytes(input.MaxBytes)), "\n"), nil
+}
+
+type GitLogTool struct {
+	Git *Git
+}
+
+func (t *GitLogTool) Name() string { return "git_log" }
+func (t *GitLogTool) Description() string {
+	return "List commits, one per line as 'hash date author: subject', optionally filtered by path, author, message or date."
+}
+func (t *GitLogTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+			"ref": map[string]interface{}{
+				"type":        "string",
+				"description": "Revision or range to list, e.g. 'main' or 'main..feature' (default HEAD)",
+			},
+			"paths": pathsSchema("Only commits touching these files or directories"),
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of commits (default 20, at most 200)",
+			},
+			"author": map[string]interface{}{"type": "string"},
+			"grep": map[string]interface{}{
+				"type":        "string",
+				"description": "Only commits whose message matches this pattern",
+			},
+			"since": map[string]interface{}{
+				"type":        "string",
+				"description": "e.g. '2024-01-01' or '2 weeks ago'",
+			},
+			"until": map[string]interface{}{"type": "string"},
+			"stat": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Add the number of files and lines changed by each commit",
+			},
+		},
+	}
+}
+func (t *GitLogTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitLogTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo   string   `json:"repo"`
+		Ref    string   `json:"ref"`
+		Paths  []string `json:"paths"`
+		Limit  int      `json:"limit"`
+		Author string   `json:"author"`
+		Grep   string   `json:"grep"`
+		Since  string   `json:"since"`
+		Until  string   `json:"until"`
+		Stat   bool     `json:"stat"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	if err := checkRef(input.Ref); err != nil {
+		return "", err
+	}
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, false)
+	if err != nil {
+		return "", err
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	cmd := []string{"log", "--no-color", "--date=short", "--pretty=format:%h %ad %an: %s", fmt.Sprintf("--max-count=%d", limit+1)}
+	if input.Stat {
+		cmd = append(cmd, "--shortstat")
+	}
+	for flag, value := range map[string]string{"--author": input.Author, "--grep": input.Grep, "--since": input.Since, "--until": input.Until} {
+		if value != "" {
+			cmd = append(cmd, flag+"="+value)
+		}
+	}
+	if input.Grep != "" {
+		cmd = append(cmd, "--regexp-ignore-case")
+	}
+	if input.Ref != "" {
+		cmd = append(cmd, input.Ref)
+	}
+	if len(input.Paths) > 0 {
+		specs, err := t.Git.pathspecs(t.Name(), top, input.Paths, false)
+		if err != nil {
+			return "", err
+		}
+		cmd = append(cmd, specs...)
+	}
+	out, err := t.Git.run(ctx, top, cmd...)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not have any commits") {
+			return "No commits yet.", nil
+		}
+		return "", err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if input.Stat && strings.Contains(line, "changed") && len(lines) > 0 {
+			lines[len(lines)-1] += " [" + line + "]"
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "No matching commits.", nil
+	}
+	more := ""
+	if len(lines) > limit {
+		lines = lines[:limit]
+		more = fmt.Sprintf("\n(more commits exist, raise limit above %d or narrow the range)", limit)
+	}
+	return strings.Join(lines, "\n") + more, nil
+}
+
+type GitShowTool struct {
+	Git *Git
+}
+
+func (t *GitShowTool) Name() string { return "git_show" }
+func (t *GitShowTool) Description() string {
+	return "Show a commit (message, changed files and patch), or the content of a file at a given revision."
+}
+func (t *GitShowTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+			"ref": map[string]interface{}{
+				"type":        "string",
+				"description": "Commit, branch or tag (default HEAD)",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Show this file as it was at ref instead of the commit",
+			},
+			"stat_only": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Omit the patch",
+			},
+			"max_bytes": map[string]interface{}{
+				"type":        "integer",
+				"description": "Cut the output off after this many bytes",
+			},
+		},
+	}
+}
+func (t *GitShowTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitShowTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo     string `json:"repo"`
+		Ref      string `json:"ref"`
+		Path     string `json:"path"`
+		StatOnly bool   `json:"stat_only"`
+		MaxBytes int    `json:"max_bytes"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	ref := input.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := checkRef(ref); err != nil {
+		return "", err
+	}
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, false)
+	if err != nil {
+		return "", err
+	}
+	limit := t.Git.maxDiffBytes(input.MaxBytes)
+
+	if input.Path != "" {
+		specs, err := t.Git.pathspecs(t.Name(), top, []string{input.Path}, false)
+		if err != nil {
+			return "", err
+		}
+		out, err := t.Git.run(ctx, top, "show", ref+":"+specs[1])
+		if err != nil {
+			return "", err
+		}
+		if len(out) > limit {
+			out = out[:limit] + fmt.Sprintf("\n... (%d more bytes)", len(out)-limit)
+		}
+		return out, nil
+	}
+
+	header, err := t.Git.run(ctx, top, "show", "--no-patch", "--date=iso", "--pretty=format:commit %H%nAuthor: %an <%ae>%nDate:   %ad%n%n%B", ref)
+	if err != nil {
+		return "", err
+	}
+	names := t.Git.names(ctx, top, "show", "--format=", "--name-only", "-z", ref)
+	specs := t.Git.withoutDenied(top, []string{"--"}, names)
+	stat, err := t.Git.run(ctx, top, append([]string{"show", "--format=", "--stat=120", ref}, specs...)...)
+	if err != nil {
+		return "", err
+	}
+	result := strings.TrimRight(header, "\n") + "\n\n" + strings.TrimRight(stat, "\n")
+	if input.StatOnly {
+		return result, nil
+	}
+	patch, err := t.Git.run(ctx, top, append([]string{"show", "--format=", "--no-ext-diff", "--find-renames", ref}, specs...)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(result+"\n\n"+truncateDiff(patch, limit), "\n"), nil
+}
+
+type GitBranchTool struct {
+	Git *Git
+}
+
+func (t *GitBranchTool) Name() string { return "git_branch" }
+func (t *GitBranchTool) Description() string {
+	return "List, create, switch to or delete git branches. Deleting a branch that is not fully merged requires force, which the policy may refuse."
+}
+func (t *GitBranchTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"list", "create", "switch", "delete"},
+			},
+			"name": map[string]interface{}{"type": "string"},
+			"start_point": map[string]interface{}{
+				"type":        "string",
+				"description": "Revision the new branch starts from (default HEAD)",
+			},
+			"remote": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Include remote-tracking branches in the list",
+			},
+			"force": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Delete even if not merged",
+			},
+		},
+	}
+}
+func (t *GitBranchTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitBranchTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo       string `json:"repo"`
+		Action     string `json:"action"`
+		Name       string `json:"name"`
+		StartPoint string `json:"start_point"`
+		Remote     bool   `json:"remote"`
+		Force      bool   `json:"force"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	if err := checkRef(input.Name); err != nil {
+		return "", err
+	}
+	if err := checkRef(input.StartPoint); err != nil {
+		return "", err
+	}
+	write := input.Action != "" && input.Action != "list"
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, write)
+	if err != nil {
+		return "", err
+	}
+	if write && input.Name == "" {
+		return "", fmt.Errorf("name is required for %s", input.Action)
+	}
+
+	switch input.Action {
+	case "", "list":
+		cmd := []string{"branch", "--format=%(HEAD) %(refname:short)%09%(objectname:short)%09%(upstream:short)%09%(upstream:track)%09%(committerdate:short) %(subject)"}
+		if input.Remote {
+			cmd = append(cmd, "--all")
+		}
+		out, err := t.Git.run(ctx, top, cmd...)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+			fields := strings.SplitN(line, "\t", 5)
+			if len(fields) < 5 {
+				continue
+			}
+			sb.WriteString(fields[0] + " " + fields[1])
+			if fields[2] != "" {
+				sb.WriteString(" -> " + fields[2])
+				if fields[3] != "" {
+					sb.WriteString(" " + fields[3])
+				}
+			}
+			sb.WriteString(" | " + fields[4] + "\n")
+		}
+		if sb.Len() == 0 {
+			return "No branches yet.", nil
+		}
+		return strings.TrimRight(sb.String(), "\n"), nil
+
+	case "create":
+		cmd := []string{"switch", "--create", input.Name}
+		if input.StartPoint != "" {
+			cmd = append(cmd, input.StartPoint)
+		}
+		if _, err := t.Git.run(ctx, top, cmd...); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Created and switched to branch %s", input.Name), nil
+
+	case "switch":
+		if _, err := t.Git.run(ctx, top, "switch", input.Name); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Switched to branch %s", input.Name), nil
+
+	case "delete":
+		flag := "--delete"
+		if input.Force {
+			if err := t.Git.checkDestructive(t.Name(), top+" "+input.Name, "force-deleting a branch"); err != nil {
+				return "", err
+			}
+			flag = "-D"
+		}
+		out, err := t.Git.run(ctx, top, "branch", flag, input.Name)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(out), nil
+	}
+	return "", fmt.Errorf("unknown action %q", input.Action)
+}
+
+type GitCommitTool struct {
+	Git *Git
+}
+
+func (t *GitCommitTool) Name() string { return "git_commit" }
+func (t *GitCommitTool) Description() string {
+	return "Stage files and create a commit. Give paths to stage specific files, or all=true to stage every change; otherwise the already staged changes are committed."
+}
+func (t *GitCommitTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "The commit message",
+			},
+			"paths": pathsSchema("Files to stage before committing"),
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Stage all changes, including new and deleted files",
+			},
+			"amend": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Replace the last commit instead of adding one",
+			},
+		},
+		"required": []string{"message"},
+	}
+}
+func (t *GitCommitTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitCommitTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo    string   `json:"repo"`
+		Message string   `json:"message"`
+		Paths   []string `json:"paths"`
+		All     bool     `json:"all"`
+		Amend   bool     `json:"amend"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(input.Message) == "" {
+		return "", fmt.Errorf("message is required")
+	}
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, true)
+	if err != nil {
+		return "", err
+	}
+	if input.Amend {
+		if err := t.Git.checkDestructive(t.Name(), top, "amending a commit"); err != nil {
+			return "", err
+		}
+	}
+
+	if input.All || len(input.Paths) > 0 {
+		specs, err := t.Git.pathspecs(t.Name(), top, input.Paths, true)
+		if err != nil {
+			return "", err
+		}
+		specs = t.Git.withoutDenied(top, specs, t.Git.changedFiles(ctx, top))
+		if _, err := t.Git.run(ctx, top, append([]string{"add", "--all"}, specs...)...); err != nil {
+			return "", err
+		}
+	}
+	if t.Git.Policy != nil {
+		// Never commit files the policy hides, even if staged earlier.
+		for _, f := range t.Git.names(ctx, top, "diff", "--cached", "--name-only", "-z") {
+			if t.Git.denied(top, f) {
+				return "", t.Git.refuse(t.Name(), f, "staged file matches a workspace deny pattern")
+			}
+		}
+	}
+
+	cmd := []string{"commit", "--message", input.Message}
+	if input.Amend {
+		cmd = append(cmd, "--amend")
+	}
+	if _, err := t.Git.run(ctx, top, cmd...); err != nil {
+		if strings.Contains(err.Error(), "nothing to commit") || strings.Contains(err.Error(), "no changes added") {
+			return "", fmt.Errorf("nothing staged to commit, pass paths or all=true")
+		}
+		return "", err
+	}
+	out, err := t.Git.run(ctx, top, "show", "--stat=120", "--format=Committed %h: %s", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+type GitStashTool struct {
+	Git *Git
+}
+
+func (t *GitStashTool) Name() string { return "git_stash" }
+func (t *GitStashTool) Description() string {
+	return "Set uncommitted changes aside and restore them later: push, list, show, apply, pop or drop stash entries."
+}
+func (t *GitStashTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"list", "push", "show", "apply", "pop", "drop"},
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "Description for push",
+			},
+			"index": map[string]interface{}{
+				"type":        "integer",
+				"description": "Stash entry for show, apply, pop and drop (default 0, the latest)",
+			},
+			"include_untracked": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Also stash untracked files",
+			},
+		},
+	}
+}
+func (t *GitStashTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitStashTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo             string `json:"repo"`
+		Action           string `json:"action"`
+		Message          string `json:"message"`
+		Index            int    `json:"index"`
+		IncludeUntracked bool   `json:"include_untracked"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	write := input.Action != "" && input.Action != "list" && input.Action != "show"
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, write)
+	if err != nil {
+		return "", err
+	}
+	entry := "stash@{" + strconv.Itoa(input.Index) + "}"
+
+	var out string
+	switch input.Action {
+	case "", "list":
+		out, err = t.Git.run(ctx, top, "stash", "list", "--date=short", "--pretty=format:%gd %cd %gs")
+		if err == nil && strings.TrimSpace(out) == "" {
+			return "No stash entries.", nil
+		}
+	case "push":
+		cmd := []string{"stash", "push"}
+		if input.IncludeUntracked {
+			cmd = append(cmd, "--include-untracked")
+		}
+		if input.Message != "" {
+			cmd = append(cmd, "--message", input.Message)
+		}
+		out, err = t.Git.run(ctx, top, cmd...)
+	case "show":
+		args := []string{"stash", "show", "--stat", "--patch", entry}
+		for _, f := range t.Git.names(ctx, top, "stash", "show", "--name-only", "-z", entry) {
+			if t.Git.Policy != nil && t.Git.denied(top, f) {
+				args = []string{"stash", "show", "--stat", entry} // no content of denied files
+				break
+			}
+		}
+		out, err = t.Git.run(ctx, top, args...)
+		out = truncateDiff(out, t.Git.maxDiffBytes(0))
+	case "apply", "pop":
+		out, err = t.Git.run(ctx, top, "stash", input.Action, entry)
+	case "drop":
+		if err := t.Git.checkDestructive(t.Name(), top+" "+entry, "dropping a stash entry"); err != nil {
+			return "", err
+		}
+		out, err = t.Git.run(ctx, top, "stash", "drop", entry)
+	default:
+		return "", fmt.Errorf("unknown action %q", input.Action)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+type GitPushTool struct {
+	Git *Git
+}
+
+func (t *GitPushTool) Name() string { return "git_push" }
+func (t *GitPushTool) Description() string {
+	return "Push the current (or given) branch to its remote. Force pushes are refused unless the policy allows them."
+}
+func (t *GitPushTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repo": repoSchema(),
+			"remote": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of a configured remote (default the upstream's, or origin); URLs and paths are not accepted",
+			},
+			"branch": map[string]interface{}{
+				"type":        "string",
+				"description": "Branch to push (default the current branch)",
+			},
+			"set_upstream": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Make the pushed branch the upstream of the local one",
+			},
+			"force": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Overwrite the remote branch (with lease)",
+			},
+		},
+	}
+}
+func (t *GitPushTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *GitPushTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Repo        string `json:"repo"`
+		Remote      string `json:"remote"`
+		Branch      string `json:"branch"`
+		SetUpstream bool   `json:"set_upstream"`
+		Force       bool   `json:"force"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	for _, s := range []string{input.Remote, input.Branch} {
+		if err := checkRef(s); err != nil {
+			return "", err
+		}
+	}
+	// A refspec like ":main" or "+main" deletes or overwrites the remote branch.
+	if strings.ContainsAny(input.Branch, ":+") {
+		return "", t.Git.refuse(t.Name(), input.Branch, "refspecs are not accepted, give a branch name")
+	}
+	top, err := t.Git.repo(ctx, t.Name(), input.Repo, false)
+	if err != nil {
+		return "", err
+	}
+	if input.Force {
+		if err := t.Git.checkDestructive(t.Name(), top, "force-pushing"); err != nil {
+			return "", err
+		}
+	}
+
+	branch := input.Branch
+	if branch == "" {
+		out, err := t.Git.run(ctx, top, "symbolic-ref", "--short", "HEAD")
+		if err != nil {
+			return "", fmt.Errorf("not on a branch, give branch explicitly")
+		}
+		branch = strings.TrimSpace(out)
+	}
+	remote := input.Remote
+	if remote == "" {
+		out, _ := t.Git.run(ctx, top, "config", "branch."+branch+".remote")
+		if remote = strings.TrimSpace(out); remote == "" {
+			remote = "origin"
+		}
+	}
+	// Only configured remotes: a URL or path would send the repository
+	// anywhere the model likes.
+	if err := t.checkRemote(ctx, top, remote); err != nil {
+		return "", err
+	}
+
+	cmd := []string{"push", "--porcelain"}
+	if input.SetUpstream {
+		cmd = append(cmd, "--set-upstream")
+	}
+	if input.Force {
+		cmd = append(cmd, "--force-with-lease")
+	}
+	cmd = append(cmd, remote, branch)
+	out, err := t.Git.run(ctx, top, cmd...)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" && line != "Done" && !strings.HasPrefix(line, "To ") {
+			lines = append(lines, line)
+		}
+	}
+	return fmt.Sprintf("Pushed %s to %s\n%s", branch, remote, strings.Join(lines, "\n")), nil
+}
+
+// checkRemote accepts the names listed by git remote.
+func (t *GitPushTool) checkRemote(ctx context.Context, top, remote string) error {
+	out, err := t.Git.run(ctx, top, "remote")
+	if err != nil {
+		return err
+	}
+	remotes := strings.Fields(out)
+	for _, r := range remotes {
+		if r == remote {
+			return nil
+		}
+	}
+	audit.Record(audit.Event{Kind: "git_denied", Tool: t.Name(), Target: remote, Reason: "not a configured remote"})
+	if len(remotes) == 0 {
+		return fmt.Errorf("the repository has no remotes, %q cannot be pushed to", remote)
+	}
+	return fmt.Errorf("%q is not a configured remote, use one of: %s", remote, strings.Join(remotes, ", "))
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xq-agent/internal/config"
+)
+
+// gitCmd runs git in dir and fails the test on errors.
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// gitWorkspace creates a repository with one commit as the workspace root,
+// with a bare repository outside the workspace as its origin.
+func gitWorkspace(t *testing.T) (*Git, string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	gitCmd(t, root, "init", "--bare", origin)
+	gitCmd(t, root, "init")
+	if err := os.WriteFile(filepath.Join(root, "README"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, root, "add", "README")
+	gitCmd(t, root, "commit", "-m", "first")
+	gitCmd(t, root, "remote", "add", "origin", origin)
+
+	policy, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGit(config.GitConfig{}, policy), root, origin
+}
+
+func TestGitPushRemotes(t *testing.T) {
+	git, root, origin := gitWorkspace(t)
+	push := &GitPushTool{Git: git}
+	run := func(args map[string]interface{}) (string, error) {
+		data, _ := json.Marshal(args)
+		return push.Execute(data)
+	}
+
+	if out, err := run(map[string]interface{}{"remote": "origin"}); err != nil || !strings.HasPrefix(out, "Pushed main to origin") {
+		t.Fatalf("push to origin: %q, %v", out, err)
+	}
+	if got := gitCmd(t, origin, "log", "--format=%s", "main"); got != "first\n" {
+		t.Errorf("origin has %q", got)
+	}
+
+	other := filepath.Join(t.TempDir(), "other.git")
+	gitCmd(t, root, "init", "--bare", other)
+	for _, remote := range []string{other, "file://" + other, "https://attacker.example/repo.git", "upstream"} {
+		if out, err := run(map[string]interface{}{"remote": remote}); err == nil {
+			t.Errorf("pushed to %s: %s", remote, out)
+		}
+	}
+	if got := gitCmd(t, other, "for-each-ref"); got != "" {
+		t.Errorf("the other repository received %q", got)
+	}
+
+	// The default comes from the branch configuration, which must name a remote as well.
+	gitCmd(t, root, "config", "branch.main.remote", other)
+	if out, err := run(map[string]interface{}{}); err == nil {
+		t.Errorf("pushed to the configured path: %s", out)
+	}
+}
+
+func TestCheckDestructive(t *testing.T) {
+	g := &Git{}
+	if err := g.checkDestructive("git_push", "/repo", "force-pushing"); err == nil || !strings.Contains(err.Error(), "allow_destructive") {
+		t.Errorf("force push allowed by default: %v", err)
+	}
+	g.Config.AllowDestructive = true
+	if err := g.checkDestructive("git_push", "/repo", "force-pushing"); err != nil {
+		t.Errorf("force push refused with allow_destructive: %v", err)
+	}
+}
+
+func TestWithoutDenied(t *testing.T) {
+	top, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{top}, Deny: []string{"**/.env", "secrets/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGit(config.GitConfig{}, policy)
+	names := []string{"main.go", "conf/.env", "secrets/key.pem", "docs/env.md"}
+
+	// Without paths, the exclusions apply to the whole tree.
+	want := []string{"--", ".", ":(exclude,literal)conf/.env", ":(exclude,literal)secrets/key.pem"}
+	if got := g.withoutDenied(top, []string{"--"}, names); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutDenied = %q, want %q", got, want)
+	}
+	want = []string{"--", "conf", ":(exclude,literal)conf/.env", ":(exclude,literal)secrets/key.pem"}
+	if got := g.withoutDenied(top, []string{"--", "conf"}, names); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutDenied with a path = %q, want %q", got, want)
+	}
+	if got := g.withoutDenied(top, []string{"--"}, []string{"main.go"}); !reflect.DeepEqual(got, []string{"--"}) {
+		t.Errorf("withoutDenied without denied files = %q", got)
+	}
+	if got := (&Git{}).withoutDenied(top, []string{"--"}, names); !reflect.DeepEqual(got, []string{"--"}) {
+		t.Errorf("withoutDenied without a policy = %q", got)
+	}
+}
+
+func TestTruncateDiff(t *testing.T) {
+	file := func(name string, lines int) string {
+		return "diff --git a/" + name + " b/" + name + "\n--- a/" + name + "\n+++ b/" + name + "\n" +
+			strings.Repeat("+line\n", lines)
+	}
+	small, big, last := file("small.go", 2), file("big.go", 100), file("last.go", 2)
+	patch := small + big + last
+
+	if got := truncateDiff(patch, len(patch)); got != patch {
+		t.Error("a diff within the limit was changed")
+	}
+
+	// The large file is cut at a line, the rest is named.
+	got := truncateDiff(patch, 200)
+	if !strings.HasPrefix(got, small+file("big.go", 0)) {
+		t.Errorf("the diff does not start with the small file:\n%s", got)
+	}
+	if !strings.Contains(got, "more bytes of this file)\n") || !strings.HasSuffix(got, "not shown: last.go; pass paths to see them)\n") {
+		t.Errorf("truncated diff:\n%s", got)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+		if strings.HasPrefix(line, "+") && line != "+line" && !strings.HasPrefix(line, "+++ ") {
+			t.Errorf("a line was cut in two:\n%s", got)
+		}
+	}
+
+	// Files that do not fit after a large part has been shown are named only.
+	got = truncateDiff(big+small+last, len(big)+10)
+	if !strings.HasPrefix(got, big) || !strings.Contains(got, "not shown: small.go, last.go;") {
+		t.Errorf("truncated diff:\n%s", got)
+	}
+}
@@ -0,0 +1,389 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"xq-agent/internal/config"
+)
+
+// HTTPRequestTool calls web APIs directly, without a browser.
+type HTTPRequestTool struct {
+	Config  config.HTTPConfig
+	Policy  *PathPolicy
+	Journal *Journal
+}
+
+func (t *HTTPRequestTool) Name() string { return "http_request" }
+func (t *HTTPRequestTool) Description() string {
+	desc := "Send an HTTP request (e.g. to a JSON API) and return the status, headers and body. " +
+		"JSON is pretty-printed and HTML converted to Markdown; binary bodies can be saved to a file."
+	if names := t.credentialNames(); len(names) > 0 {
+		desc += " Available credentials: " + strings.Join(names, ", ") + "."
+	}
+	return desc
+}
+func (t *HTTPRequestTool) Schema() interface{} {
+	stringMap := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"method": map[string]interface{}{
+				"type":        "string",
+				"description": "HTTP method (default GET)",
+			},
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "The URL to request",
+			},
+			"headers": withDescription(stringMap, "Request headers"),
+			"query":   withDescription(stringMap, "Query parameters added to the URL"),
+			"json": map[string]interface{}{
+				"description": "Request body sent as JSON",
+			},
+			"form": withDescription(stringMap, "Request body sent as application/x-www-form-urlencoded"),
+			"body": map[string]interface{}{
+				"type":        "string",
+				"description": "Raw request body",
+			},
+			"credential": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of a configured credential to authenticate with",
+			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "Request timeout in seconds",
+			},
+			"redirects": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"follow", "same_host", "none"},
+				"description": "Redirect policy (default follow)",
+			},
+			"save_to": map[string]interface{}{
+				"type":        "string",
+				"description": "Save the response body to this file instead of returning it",
+			},
+			"page": map[string]interface{}{
+				"type":        "integer",
+				"description": "Page of a long response body to return, starting at 1",
+			},
+		},
+		"required": []string{"url"},
+	}
+}
+
+func withDescription(schema map[string]interface{}, desc string) map[string]interface{} {
+	out := map[string]interface{}{"description": desc}
+	for k, v := range schema {
+		out[k] = v
+	}
+	return out
+}
+
+func (t *HTTPRequestTool) credentialNames() []string {
+	names := make([]string, 0, len(t.Config.Credentials))
+	for name := range t.Config.Credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *HTTPRequestTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *HTTPRequestTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Method     string            `json:"method"`
+		URL        string            `json:"url"`
+		Headers    map[string]string `json:"headers"`
+		Query      map[string]string `json:"query"`
+		JSON       json.RawMessage   `json:"json"`
+		Form       map[string]string `json:"form"`
+		Body       string            `json:"body"`
+		Credential string            `json:"credential"`
+		Timeout    int               `json:"timeout_seconds"`
+		Redirects  string            `json:"redirects"`
+		SaveTo     string            `json:"save_to"`
+		Page       int               `json:"page"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(input.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	u, err := url.Parse(strings.TrimSpace(input.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid url %q: only http and https are supported", input.URL)
+	}
+	q := u.Query()
+	for k, v := range input.Query {
+		q.Set(k, v)
+	}
+
+	var body io.Reader
+	contentType := ""
+	switch {
+	case len(input.JSON) > 0 && string(input.JSON) != "null":
+		body = bytes.NewReader(input.JSON)
+		contentType = "application/json"
+	case len(input.Form) > 0:
+		form := url.Values{}
+		for k, v := range input.Form {
+			form.Set(k, v)
+		}
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case input.Body != "":
+		body = strings.NewReader(input.Body)
+	}
+
+	timeout := t.Config.Timeout
+	if input.Timeout > 0 {
+		timeout = time.Duration(input.Timeout) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var secrets []string
+	var cred *config.HTTPCredential
+	if input.Credential != "" {
+		c, ok := t.Config.Credentials[input.Credential]
+		if !ok {
+			return "", fmt.Errorf("unknown credential %q", input.Credential)
+		}
+		if len(c.Hosts) == 0 {
+			return "", fmt.Errorf("credential %q has no hosts configured", input.Credential)
+		}
+		if !hostAllowed(u.Hostname(), c.Hosts) {
+			return "", fmt.Errorf("credential %q may not be sent to %s", input.Credential, u.Hostname())
+		}
+		cred = &c
+		if c.Type == "query" {
+			value := os.ExpandEnv(c.Value)
+			q.Set(c.Name, value)
+			secrets = append(secrets, value)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range input.Headers {
+		req.Header.Set(k, v)
+	}
+	if cred != nil && cred.Type != "query" {
+		added, err := applyCredential(req, *cred)
+		if err != nil {
+			return "", err
+		}
+		secrets = append(secrets, added...)
+	}
+
+	client := &http.Client{CheckRedirect: redirectPolicy(input.Redirects, u.Host, cred)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", redact(fmt.Errorf("request failed: %v", err), secrets)
+	}
+	defer resp.Body.Close()
+
+	limit := t.Config.MaxBodyBytes
+	if limit <= 0 {
+		limit = 10 << 20
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %v", err)
+	}
+	truncated := int64(len(data)) > limit
+	if truncated {
+		data = data[:limit]
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("HTTP %s\n", resp.Status))
+	if resp.Request.URL.String() != u.String() {
+		sb.WriteString(fmt.Sprintf("Final URL: %s\n", resp.Request.URL))
+	}
+	for _, name := range []string{"Content-Type", "Content-Length", "Location", "Last-Modified", "Retry-After"} {
+		if v := resp.Header.Get(name); v != "" {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", name, v))
+		}
+	}
+	if truncated {
+		sb.WriteString(fmt.Sprintf("(body truncated at %d bytes)\n", limit))
+	}
+	sb.WriteString("\n")
+
+	if input.SaveTo != "" {
+		if truncated {
+			return "", fmt.Errorf("response exceeds the %d byte limit, not saved", limit)
+		}
+		path, err := t.Policy.CheckWrite(t.Name(), input.SaveTo)
+		if err != nil {
+			return "", err
+		}
+		if err := t.Journal.WriteFile(ctx, t.Name(), path, data); err != nil {
+			return "", err
+		}
+		sb.WriteString(fmt.Sprintf("Saved %d bytes (%s) to %s", len(data), mediaType, path))
+		return redactString(sb.String(), secrets), nil
+	}
+
+	var text string
+	switch {
+	case isJSONType(mediaType):
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, data, "", "  ") == nil {
+			text = pretty.String()
+		} else {
+			text = string(data)
+		}
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		md, err := PageToMarkdown(bytes.NewReader(data), resp.Request.URL.String())
+		if err != nil {
+			text = string(data)
+		} else {
+			text = md
+		}
+	case isTextType(mediaType):
+		text = string(data)
+	default:
+		sb.WriteString(fmt.Sprintf("Binary body of %d bytes (%s). Use save_to to store it in a file.", len(data), mediaType))
+		return redactString(sb.String(), secrets), nil
+	}
+	sb.WriteString(pageWindow(text, input.Page, 0, 0))
+	return redactString(sb.String(), secrets), nil
+}
+
+// applyCredential authenticates req and returns the secrets it added, so
+// they can be scrubbed from anything shown to the model.
+func applyCredential(req *http.Request, c config.HTTPCredential) ([]string, error) {
+	switch c.Type {
+	case "bearer", "":
+		token := os.ExpandEnv(c.Token)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return []string{token}, nil
+	case "basic":
+		user, pass := os.ExpandEnv(c.Username), os.ExpandEnv(c.Password)
+		req.SetBasicAuth(user, pass)
+		return []string{base64.StdEncoding.EncodeToString([]byte(user + ":" + pass)), pass}, nil
+	case "header":
+		value := os.ExpandEnv(c.Value)
+		req.Header.Set(c.Name, value)
+		return []string{value}, nil
+	}
+	return nil, fmt.Errorf("unsupported credential type %q", c.Type)
+}
+
+// stripCredential removes a credential from a redirected request.
+func stripCredential(req *http.Request, c config.HTTPCredential) {
+	switch c.Type {
+	case "bearer", "", "basic":
+		req.Header.Del("Authorization")
+	case "header":
+		req.Header.Del(c.Name)
+	case "query":
+		q := req.URL.Query()
+		if q.Has(c.Name) {
+			q.Del(c.Name)
+			req.URL.RawQuery = q.Encode()
+		}
+	}
+}
+
+// hostAllowed reports whether host matches one of the allowed hosts; an
+// empty list allows none.
+func hostAllowed(host string, allowed []string) bool {
+	for _, h := range allowed {
+		if strings.EqualFold(h, host) || (strings.HasPrefix(h, "*.") && strings.HasSuffix(strings.ToLower(host), strings.ToLower(h[1:]))) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectPolicy follows redirects as policy says. A credential is dropped
+// when a redirect leads to a host it may not be sent to.
+func redirectPolicy(policy, host string, cred *config.HTTPCredential) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if cred != nil && !hostAllowed(req.URL.Hostname(), cred.Hosts) {
+			stripCredential(req, *cred)
+		}
+		switch policy {
+		case "none":
+			return http.ErrUseLastResponse
+		case "same_host":
+			if req.URL.Host != host {
+				return http.ErrUseLastResponse
+			}
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+func isJSONType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "application/x-ndjson"
+}
+
+func isTextType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/xml", "application/javascript", "application/x-www-form-urlencoded", "application/yaml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+xml")
+}
+
+// redactString hides the secrets in s, including their URL-escaped forms
+// found in query strings and paths.
+func redactString(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if len(secret) < 4 {
+			continue
+		}
+		for _, form := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret)} {
+			s = strings.ReplaceAll(s, form, "[REDACTED]")
+		}
+	}
+	return s
+}
+
+func redact(err error, secrets []string) error {
+	return fmt.Errorf("%s", redactString(err.Error(), secrets))
+}
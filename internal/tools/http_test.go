@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"xq-agent/internal/config"
+)
+
+// recordingServer answers every request with "ok" and keeps the requests.
+type recordingServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func startRecordingServer(t *testing.T, handler http.HandlerFunc) *recordingServer {
+	t.Helper()
+	s := &recordingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Clone(r.Context()))
+		s.mu.Unlock()
+		if handler != nil {
+			handler(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *recordingServer) last() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return nil
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func callHTTP(t *testing.T, tool *HTTPRequestTool, args map[string]interface{}) (string, error) {
+	t.Helper()
+	data, _ := json.Marshal(args)
+	return tool.Execute(data)
+}
+
+func TestHTTPRequestCredentials(t *testing.T) {
+	srv := startRecordingServer(t, nil)
+	t.Setenv("TEST_API_TOKEN", "tok-123456")
+	tool := &HTTPRequestTool{Config: config.HTTPConfig{Credentials: map[string]config.HTTPCredential{
+		"api":    {Type: "bearer", Token: "${TEST_API_TOKEN}", Hosts: []string{"127.0.0.1"}},
+		"login":  {Type: "basic", Username: "me", Password: "pass-word", Hosts: []string{"127.0.0.1"}},
+		"header": {Type: "header", Name: "X-Api-Key", Value: "key-abcdef", Hosts: []string{"127.0.0.1"}},
+		"query":  {Type: "query", Name: "api_key", Value: "q/secret+1", Hosts: []string{"127.0.0.1"}},
+		"other":  {Type: "bearer", Token: "tok-other", Hosts: []string{"example.com"}},
+		"nohost": {Type: "bearer", Token: "tok-nohost"},
+	}}}
+	if desc := tool.Description(); !strings.Contains(desc, "api, header, login, nohost, other, query") {
+		t.Errorf("description does not list the credentials: %s", desc)
+	}
+
+	check := func(credential string, ok func(r *http.Request) bool) {
+		t.Helper()
+		if _, err := callHTTP(t, tool, map[string]interface{}{"url": srv.URL + "/v1", "credential": credential}); err != nil {
+			t.Errorf("credential %s: %v", credential, err)
+			return
+		}
+		if r := srv.last(); !ok(r) {
+			t.Errorf("credential %s was not applied: %v %v", credential, r.URL, r.Header)
+		}
+	}
+	check("api", func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer tok-123456" })
+	check("login", func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "me" && pass == "pass-word"
+	})
+	check("header", func(r *http.Request) bool { return r.Header.Get("X-Api-Key") == "key-abcdef" })
+	check("query", func(r *http.Request) bool { return r.URL.Query().Get("api_key") == "q/secret+1" })
+
+	for _, name := range []string{"other", "nohost", "missing"} {
+		if _, err := callHTTP(t, tool, map[string]interface{}{"url": srv.URL, "credential": name}); err == nil {
+			t.Errorf("credential %s was sent to %s", name, srv.URL)
+		}
+	}
+}
+
+func TestHTTPRequestStripsCredentialOnRedirect(t *testing.T) {
+	// The same server under another host name, which the credential may not reach.
+	foreign := startRecordingServer(t, nil)
+	foreignURL := strings.Replace(foreign.URL, "127.0.0.1", "localhost", 1)
+	srv := startRecordingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, foreignURL+"/landing?"+r.URL.RawQuery, http.StatusFound)
+	})
+
+	for _, cred := range []config.HTTPCredential{
+		{Type: "bearer", Token: "tok-123456", Hosts: []string{"127.0.0.1"}},
+		{Type: "header", Name: "X-Api-Key", Value: "key-abcdef", Hosts: []string{"127.0.0.1"}},
+		{Type: "query", Name: "api_key", Value: "key-abcdef", Hosts: []string{"127.0.0.1"}},
+	} {
+		tool := &HTTPRequestTool{Config: config.HTTPConfig{Credentials: map[string]config.HTTPCredential{"api": cred}}}
+		if _, err := callHTTP(t, tool, map[string]interface{}{"url": srv.URL, "credential": "api"}); err != nil {
+			t.Fatal(err)
+		}
+		r := foreign.last()
+		if r == nil {
+			t.Fatal("the redirect was not followed")
+		}
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-Api-Key") != "" || r.URL.Query().Has("api_key") {
+			t.Errorf("%s credential followed the redirect: %v %v", cred.Type, r.URL, r.Header)
+		}
+	}
+
+	// Without following redirects the first response is returned.
+	tool := &HTTPRequestTool{}
+	out, err := callHTTP(t, tool, map[string]interface{}{"url": srv.URL, "redirects": "none"})
+	if err != nil || !strings.HasPrefix(out, "HTTP 302") {
+		t.Errorf("redirects=none: %q, %v", out, err)
+	}
+}
+
+func TestHTTPRequestRedactsEscapedSecrets(t *testing.T) {
+	srv := startRecordingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/next?"+r.URL.RawQuery, http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("echo " + r.URL.RawQuery))
+	})
+	secret := "s3cret/key+=!"
+	tool := &HTTPRequestTool{Config: config.HTTPConfig{Credentials: map[string]config.HTTPCredential{
+		"api": {Type: "query", Name: "api_key", Value: secret, Hosts: []string{"127.0.0.1"}},
+	}}}
+	out, err := callHTTP(t, tool, map[string]interface{}{"url": srv.URL, "credential": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Final URL:") || !strings.Contains(out, "[REDACTED]") {
+		t.Errorf("output lacks the redacted final URL:\n%s", out)
+	}
+	for _, leak := range []string{"s3cret", "key%2B"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("output leaks the secret:\n%s", out)
+		}
+	}
+
+	// Errors name the URL, with the secret escaped.
+	srv.Close()
+	_, err = callHTTP(t, tool, map[string]interface{}{"url": srv.URL, "credential": "api"})
+	if err == nil || strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("error leaks the secret: %v", err)
+	}
+}
+
+func TestRedactString(t *testing.T) {
+	secret := "a b/c+d"
+	got := redactString("raw a b/c+d query a+b%2Fc%2Bd path a%20b%2Fc+d short abc", []string{secret, "abc"})
+	if want := "raw [REDACTED] query [REDACTED] path [REDACTED] short abc"; got != want {
+		t.Errorf("redactString = %q, want %q", got, want)
+	}
+}
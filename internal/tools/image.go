@@ -0,0 +1,204 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultImageSize is the longest side, in pixels, images are scaled down to
+// before they are sent to the model.
+const DefaultImageSize = 1024
+
+// Image is picture content a tool hands back to the model alongside its text
+// result.
+type Image struct {
+	MIMEType string
+	Data     []byte
+	Source   string // File path or URL, used in text-only fallbacks
+	Width    int
+	Height   int
+}
+
+// File is a file a tool produced for the user, such as a chart or a report.
+type File struct {
+	Name string
+	Path string
+	Size int64
+}
+
+// Attachments collects the images and files tools attach during one tool
+// call.
+type Attachments struct {
+	mu     sync.Mutex
+	images []Image
+	files  []File
+}
+
+type attachmentsKey struct{}
+
+// WithAttachments returns a context that collects images attached by tools.
+func WithAttachments(ctx context.Context) (context.Context, *Attachments) {
+	a := &Attachments{}
+	return context.WithValue(ctx, attachmentsKey{}, a), a
+}
+
+// AttachImage hands an image to the model. It is a no-op when the caller does
+// not collect attachments.
+func AttachImage(ctx context.Context, img Image) {
+	if a, ok := ctx.Value(attachmentsKey{}).(*Attachments); ok {
+		a.mu.Lock()
+		a.images = append(a.images, img)
+		a.mu.Unlock()
+	}
+}
+
+// AttachFile offers a file to the user. Channels that can send files forward
+// it, the others show its path.
+func AttachFile(ctx context.Context, f File) {
+	if a, ok := ctx.Value(attachmentsKey{}).(*Attachments); ok {
+		a.mu.Lock()
+		a.files = append(a.files, f)
+		a.mu.Unlock()
+	}
+}
+
+// Files returns the attached files.
+func (a *Attachments) Files() []File {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]File(nil), a.files...)
+}
+
+// Images returns the attached images.
+func (a *Attachments) Images() []Image {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Image(nil), a.images...)
+}
+
+// Describe is the text stand-in for an image shown to models without vision.
+func (img Image) Describe() string {
+	return fmt.Sprintf("[Image %s: %dx%d %s, not shown because the model cannot view images]", img.Source, img.Width, img.Height, img.MIMEType)
+}
+
+// LoadImage decodes PNG, JPEG, GIF or WebP data and scales it down so that its
+// longest side is at most maxSide pixels. The result is re-encoded as PNG, or
+// JPEG for photos.
+func LoadImage(data []byte, source string, maxSide int) (Image, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("unsupported image: %v", err)
+	}
+	if maxSide <= 0 {
+		maxSide = DefaultImageSize
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			w, h = maxSide, h*maxSide/w
+		} else {
+			w, h = w*maxSide/h, maxSide
+		}
+		if w < 1 {
+			w = 1
+		}
+		if h < 1 {
+			h = 1
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+		src = dst
+	} else if format == "png" || format == "jpeg" {
+		// Small enough already, send as is.
+		return Image{MIMEType: "image/" + format, Data: data, Source: source, Width: w, Height: h}, nil
+	}
+
+	var buf bytes.Buffer
+	img := Image{Source: source, Width: w, Height: h}
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, src, &jpeg.Options{Quality: 85})
+		img.MIMEType = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, src)
+		img.MIMEType = "image/png"
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	img.Data = buf.Bytes()
+	return img, nil
+}
+
+type ImageViewTool struct {
+	Policy *PathPolicy
+}
+
+func (t *ImageViewTool) Name() string { return "image_view" }
+func (t *ImageViewTool) Description() string {
+	return "Look at a local image file (PNG, JPEG, GIF or WebP). Large images are scaled down automatically."
+}
+func (t *ImageViewTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "The path to the image file",
+			},
+			"max_size": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Longest side in pixels after scaling (default %d)", DefaultImageSize),
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+func (t *ImageViewTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *ImageViewTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Path    string `json:"path"`
+		MaxSize int    `json:"max_size"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	path, err := t.Policy.CheckRead(t.Name(), input.Path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("unsupported image: %v", err)
+	}
+	img, err := LoadImage(data, filepath.Base(path), input.MaxSize)
+	if err != nil {
+		return "", err
+	}
+	AttachImage(ctx, img)
+
+	result := fmt.Sprintf("Image %s: %s, %dx%d", path, format, cfg.Width, cfg.Height)
+	if img.Width != cfg.Width {
+		result += fmt.Sprintf(" (scaled to %dx%d)", img.Width, img.Height)
+	}
+	return result, nil
+}
@@ -0,0 +1,403 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xq-agent/internal/config"
+)
+
+var errNothingToUndo = errors.New("nothing to undo")
+
+// errCannotRevert marks changes Undo dropped from the journal without
+// reverting them.
+var errCannotRevert = errors.New("cannot undo")
+
+// JournalEntry is a before/after snapshot of one file modification.
+type JournalEntry struct {
+	ID      int
+	Tool    string
+	Path    string
+	Time    time.Time
+	Existed bool        // false when the change created the file
+	Mode    os.FileMode // mode of the original file
+	Before  []byte
+	After   []byte   // nil when the new content was larger than MaxFileSize
+	Sum     [32]byte // SHA-256 of the new content, to detect later edits
+	Skipped bool     // original was larger than MaxFileSize, no snapshot kept
+}
+
+// Journal records every file the agent writes, per session, so changes can be
+// reviewed and undone.
+type Journal struct {
+	mu          sync.Mutex
+	maxEntries  int
+	maxAge      time.Duration
+	maxFileSize int64
+	nextID      int
+	sessions    map[string][]*JournalEntry
+}
+
+func NewJournal(cfg config.JournalConfig) *Journal {
+	j := &Journal{
+		maxEntries:  cfg.MaxEntries,
+		maxAge:      cfg.MaxAge,
+		maxFileSize: cfg.MaxFileSize,
+		sessions:    make(map[string][]*JournalEntry),
+	}
+	if j.maxEntries <= 0 {
+		j.maxEntries = 100
+	}
+	if j.maxAge <= 0 {
+		j.maxAge = 24 * time.Hour
+	}
+	if j.maxFileSize <= 0 {
+		j.maxFileSize = 5 << 20
+	}
+	return j
+}
+
+// WriteFile atomically replaces path with data and records the change in the
+// session journal. A nil journal only performs the atomic write.
+func (j *Journal) WriteFile(ctx context.Context, tool, path string, data []byte) error {
+	if j == nil {
+		return writeFileAtomic(path, data, 0644)
+	}
+
+	entry := &JournalEntry{Tool: tool, Path: path, Time: time.Now(), After: data, Sum: sha256.Sum256(data)}
+	if info, err := os.Stat(path); err == nil {
+		entry.Existed = true
+		entry.Mode = info.Mode().Perm()
+		if info.Size() > j.maxFileSize {
+			entry.Skipped = true
+		} else if entry.Before, err = os.ReadFile(path); err != nil {
+			return err
+		}
+	}
+	if len(data) > int(j.maxFileSize) {
+		entry.After = nil
+	}
+
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return err
+	}
+	j.record(SessionFrom(ctx), entry)
+	return nil
+}
+
+func (j *Journal) record(session string, e *JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.nextID++
+	e.ID = j.nextID
+	entries := append(j.sessions[session], e)
+
+	cutoff := time.Now().Add(-j.maxAge)
+	for len(entries) > 0 && (len(entries) > j.maxEntries || entries[0].Time.Before(cutoff)) {
+		entries = entries[1:]
+	}
+	j.sessions[session] = entries
+}
+
+// Entries returns the retained changes of a session, oldest first.
+func (j *Journal) Entries(session string) []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var result []JournalEntry
+	for _, e := range j.sessions[session] {
+		result = append(result, *e)
+	}
+	return result
+}
+
+// Undo reverts the most recent change of the session. A change that can
+// never be reverted is dropped all the same, so earlier ones stay reachable;
+// the entry is returned with an error wrapping errCannotRevert.
+func (j *Journal) Undo(session string) (*JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := j.sessions[session]
+	if len(entries) == 0 {
+		return nil, errNothingToUndo
+	}
+	last := entries[len(entries)-1]
+	err := restore(last)
+	if err != nil && !errors.Is(err, errCannotRevert) {
+		return nil, err
+	}
+	j.sessions[session] = entries[:len(entries)-1]
+	return last, err
+}
+
+// UndoAll reverts every retained change of the session, newest first.
+// Changes that cannot be reverted are skipped and reported in the error.
+func (j *Journal) UndoAll(session string) ([]JournalEntry, error) {
+	var undone []JournalEntry
+	var skipped []string
+	for {
+		e, err := j.Undo(session)
+		switch {
+		case err == errNothingToUndo:
+			if len(skipped) > 0 {
+				return undone, fmt.Errorf("%d change(s) skipped:\n%s", len(skipped), strings.Join(skipped, "\n"))
+			}
+			return undone, nil
+		case errors.Is(err, errCannotRevert):
+			skipped = append(skipped, err.Error())
+		case err != nil:
+			return undone, err
+		default:
+			undone = append(undone, *e)
+		}
+	}
+}
+
+func restore(e *JournalEntry) error {
+	if e.Skipped {
+		return fmt.Errorf("%w change to %s: original was too large to snapshot", errCannotRevert, e.Path)
+	}
+	current, err := os.ReadFile(e.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err != nil || sha256.Sum256(current) != e.Sum {
+		return fmt.Errorf("%w change to %s: file was modified since", errCannotRevert, e.Path)
+	}
+	if !e.Existed {
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(e.Path, e.Before, e.Mode)
+}
+
+// Diff renders a unified diff of every file changed in the session, comparing
+// each file's state before the first change with its state after the last.
+func (j *Journal) Diff(session string) string {
+	entries := j.Entries(session)
+	if len(entries) == 0 {
+		return "No file changes in this session."
+	}
+
+	first := make(map[string]JournalEntry)
+	last := make(map[string]JournalEntry)
+	for _, e := range entries {
+		if _, ok := first[e.Path]; !ok {
+			first[e.Path] = e
+		}
+		last[e.Path] = e
+	}
+	paths := make([]string, 0, len(first))
+	for p := range first {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, p := range paths {
+		before, after := first[p], last[p]
+		oldName := filepath.ToSlash(p)
+		if !before.Existed {
+			oldName = "/dev/null"
+		}
+		switch {
+		case before.Skipped || after.After == nil:
+			sb.WriteString(fmt.Sprintf("File %s changed (too large to diff)\n", p))
+		case isBinary(before.Before) || isBinary(after.After):
+			sb.WriteString(fmt.Sprintf("Binary file %s changed\n", p))
+		default:
+			sb.WriteString(unifiedDiff(oldName, filepath.ToSlash(p), string(before.Before), string(after.After)))
+		}
+	}
+	return sb.String()
+}
+
+// UndoCommand implements the /undo slash command ("/undo" or "/undo all").
+func (j *Journal) UndoCommand(session, args string) (string, error) {
+	if strings.TrimSpace(args) == "all" {
+		undone, err := j.UndoAll(session)
+		msg := fmt.Sprintf("Reverted %d change(s).", len(undone))
+		if err != nil {
+			return msg, err
+		}
+		return msg, nil
+	}
+	e, err := j.Undo(session)
+	if errors.Is(err, errCannotRevert) {
+		return "", fmt.Errorf("%v; dropped it from the journal, /undo again reverts the change before it", err)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !e.Existed {
+		return fmt.Sprintf("Removed %s (it was created by %s).", e.Path, e.Tool), nil
+	}
+	return fmt.Sprintf("Restored %s to its state before %s.", e.Path, e.Tool), nil
+}
+
+// DiffCommand implements the /diff slash command.
+func (j *Journal) DiffCommand(session, args string) (string, error) {
+	return "```diff\n" + j.Diff(session) + "```", nil
+}
+
+// writeFileAtomic writes to a temporary file next to path and renames it into
+// place, keeping the mode of an existing file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// unifiedDiff produces a unified diff with three lines of context. It uses a
+// plain LCS table, so very large files fall back to a summary.
+func unifiedDiff(oldName, newName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	x, y := splitLines(a), splitLines(b)
+	header := fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName)
+	if len(x)*len(y) > 4_000_000 {
+		return header + fmt.Sprintf("@@ file too large to diff: %d -> %d lines @@\n", len(x), len(y))
+	}
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		op   byte // ' ', '-', '+'
+		text string
+		i, j int // 0-based positions in x and y before this line
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i], i, j})
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, line{'+', y[j], i, j})
+			j++
+		default:
+			lines = append(lines, line{'-', x[i], i, j})
+			i++
+		}
+	}
+
+	const contextLines = 3
+	var sb strings.Builder
+	sb.WriteString(header)
+	for start := 0; start < len(lines); {
+		// Find the next change.
+		for start < len(lines) && lines[start].op == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+		from := start - contextLines
+		if from < 0 {
+			from = 0
+		}
+		// Extend the hunk while changes are within 2*contextLines of each other.
+		end, gap := start, 0
+		for k := start; k < len(lines) && gap <= 2*contextLines; k++ {
+			if lines[k].op == ' ' {
+				gap++
+			} else {
+				gap = 0
+				end = k
+			}
+		}
+		to := end + contextLines + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		oldCount, newCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+		}
+		oldStart, newStart := lines[from].i, lines[from].j
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount))
+		for _, l := range lines[from:to] {
+			sb.WriteByte(l.op)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,707 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Office Open XML files are zip archives of XML parts. Word and PowerPoint
+// share the DrawingML names for paragraphs (p), runs of text (t) and tables
+// (tbl, tr, tc), so one walker handles both.
+
+type ooxmlFile struct {
+	*zip.ReadCloser
+	files map[string]*zip.File
+}
+
+func openOOXML(name string) (*ooxmlFile, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid Office file: %v", err)
+	}
+	f := &ooxmlFile{ReadCloser: r, files: make(map[string]*zip.File)}
+	for _, zf := range r.File {
+		f.files[zf.Name] = zf
+	}
+	return f, nil
+}
+
+func (f *ooxmlFile) read(name string) ([]byte, error) {
+	zf, ok := f.files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing part %s", name)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// Guard against zip bombs; real parts are far smaller.
+	return io.ReadAll(io.LimitReader(rc, 256<<20))
+}
+
+// rels maps relationship IDs of a part to the paths of their targets.
+func (f *ooxmlFile) rels(part string) map[string]string {
+	dir, file := path.Split(part)
+	data, err := f.read(dir + "_rels/" + file + ".rels")
+	if err != nil {
+		return nil
+	}
+	var doc struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if xml.Unmarshal(data, &doc) != nil {
+		return nil
+	}
+	out := make(map[string]string)
+	for _, r := range doc.Rels {
+		target := r.Target
+		if strings.HasPrefix(target, "/") {
+			target = target[1:]
+		} else {
+			target = path.Clean(dir + target)
+		}
+		out[r.ID] = target
+		// Also index by type so callers can find e.g. the notes slide.
+		out[r.Type[strings.LastIndex(r.Type, "/")+1:]] = target
+	}
+	return out
+}
+
+// properties adds the core and extended document properties to doc.
+func (f *ooxmlFile) properties(doc *Document) {
+	if data, err := f.read("docProps/core.xml"); err == nil {
+		var core struct {
+			Title          string `xml:"title"`
+			Subject        string `xml:"subject"`
+			Creator        string `xml:"creator"`
+			LastModifiedBy string `xml:"lastModifiedBy"`
+			Created        string `xml:"created"`
+			Modified       string `xml:"modified"`
+		}
+		if xml.Unmarshal(data, &core) == nil {
+			doc.addMeta("Title", core.Title)
+			doc.addMeta("Subject", core.Subject)
+			doc.addMeta("Author", core.Creator)
+			doc.addMeta("Last modified by", core.LastModifiedBy)
+			doc.addMeta("Created", core.Created)
+			doc.addMeta("Modified", core.Modified)
+		}
+	}
+	if data, err := f.read("docProps/app.xml"); err == nil {
+		var app struct {
+			Application string `xml:"Application"`
+			Pages       string `xml:"Pages"`
+			Words       string `xml:"Words"`
+		}
+		if xml.Unmarshal(data, &app) == nil {
+			doc.addMeta("Application", app.Application)
+			doc.addMeta("Pages (as last saved)", app.Pages)
+			doc.addMeta("Words", app.Words)
+		}
+	}
+}
+
+// textWalker turns WordprocessingML or DrawingML into Markdown-ish text.
+type textWalker struct {
+	tableFormat string
+	splitPages  bool // start a new part at rendered page breaks (Word)
+
+	parts  []string
+	out    strings.Builder
+	para   strings.Builder
+	prefix string
+	inText bool
+	tables []*tableBuilder
+	title  string // first title placeholder text (PowerPoint)
+	isHead bool   // current shape is a title placeholder
+}
+
+type tableBuilder struct {
+	rows [][]string
+	row  []string
+	cell strings.Builder
+}
+
+func (w *textWalker) walk(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XML: %v", err)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			w.start(el)
+		case xml.EndElement:
+			w.end(el)
+		case xml.CharData:
+			if w.inText {
+				w.para.Write(el)
+			}
+		}
+	}
+	w.pageBreak()
+	return nil
+}
+
+func (w *textWalker) start(el xml.StartElement) {
+	switch el.Name.Local {
+	case "t":
+		w.inText = true
+	case "tab":
+		if len(w.tables) > 0 || w.para.Len() > 0 {
+			w.para.WriteString("\t")
+		}
+	case "br", "cr":
+		if attrValue(el, "type") == "page" && w.splitPages && len(w.tables) == 0 {
+			w.endParagraph()
+			w.pageBreak()
+		} else {
+			w.para.WriteString("\n")
+		}
+	case "lastRenderedPageBreak":
+		if w.splitPages && len(w.tables) == 0 && w.para.Len() == 0 {
+			w.pageBreak()
+		}
+	case "pStyle":
+		style := strings.ToLower(attrValue(el, "val"))
+		if style == "title" {
+			w.prefix = "# "
+		} else if strings.HasPrefix(style, "heading") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(style, "heading")); err == nil && n >= 1 && n <= 6 {
+				w.prefix = strings.Repeat("#", n) + " "
+			}
+		}
+	case "numPr":
+		if w.prefix == "" {
+			w.prefix = "- "
+		}
+	case "ph":
+		switch attrValue(el, "type") {
+		case "title", "ctrTitle":
+			w.isHead = true
+		}
+	case "tbl":
+		w.endParagraph()
+		w.tables = append(w.tables, &tableBuilder{})
+	case "tr":
+		if t := w.table(); t != nil {
+			t.row = nil
+		}
+	case "tc":
+		if t := w.table(); t != nil {
+			t.cell.Reset()
+		}
+	}
+}
+
+func (w *textWalker) end(el xml.EndElement) {
+	switch el.Name.Local {
+	case "t":
+		w.inText = false
+	case "p":
+		w.endParagraph()
+	case "sp":
+		w.isHead = false
+	case "tc":
+		if t := w.table(); t != nil {
+			t.row = append(t.row, strings.TrimSpace(t.cell.String()))
+		}
+	case "tr":
+		if t := w.table(); t != nil {
+			t.rows = append(t.rows, t.row)
+		}
+	case "tbl":
+		t := w.table()
+		if t == nil {
+			return
+		}
+		w.tables = w.tables[:len(w.tables)-1]
+		if parent := w.table(); parent != nil {
+			// Nested tables are flattened into the outer cell.
+			for _, row := range t.rows {
+				parent.cell.WriteString(strings.Join(row, " | ") + " ")
+			}
+			return
+		}
+		w.block(renderTable(t.rows, w.tableFormat))
+	}
+}
+
+func (w *textWalker) table() *tableBuilder {
+	if len(w.tables) == 0 {
+		return nil
+	}
+	return w.tables[len(w.tables)-1]
+}
+
+func (w *textWalker) endParagraph() {
+	text := strings.TrimSpace(w.para.String())
+	w.para.Reset()
+	prefix := w.prefix
+	w.prefix = ""
+	if text == "" {
+		return
+	}
+	if t := w.table(); t != nil {
+		if t.cell.Len() > 0 {
+			t.cell.WriteString(" ")
+		}
+		t.cell.WriteString(text)
+		return
+	}
+	if w.isHead {
+		if w.title == "" {
+			w.title = text
+		}
+		prefix = "# "
+	}
+	w.block(prefix + text)
+}
+
+func (w *textWalker) block(s string) {
+	if w.out.Len() > 0 {
+		w.out.WriteString("\n\n")
+	}
+	w.out.WriteString(s)
+}
+
+func (w *textWalker) pageBreak() {
+	if w.out.Len() > 0 || !w.splitPages {
+		w.parts = append(w.parts, w.out.String())
+	}
+	w.out.Reset()
+}
+
+func attrValue(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// renderTable writes rows as a Markdown table (first row as header) or CSV.
+func renderTable(rows [][]string, format string) string {
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width == 0 {
+		return ""
+	}
+	if format == "csv" {
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		for _, row := range rows {
+			cw.Write(row)
+		}
+		cw.Flush()
+		return strings.TrimRight(buf.String(), "\n")
+	}
+
+	cell := func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		s = strings.ReplaceAll(s, "\r", "")
+		return strings.ReplaceAll(s, "\n", "<br>")
+	}
+	var sb strings.Builder
+	for i, row := range rows {
+		sb.WriteString("|")
+		for j := 0; j < width; j++ {
+			v := ""
+			if j < len(row) {
+				v = row[j]
+			}
+			sb.WriteString(" " + cell(v) + " |")
+		}
+		sb.WriteString("\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func readDOCX(name, tableFormat string) (*Document, error) {
+	f, err := openOOXML(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	main := "word/document.xml"
+	if target, ok := f.rels("")["officeDocument"]; ok {
+		main = target
+	}
+	data, err := f.read(main)
+	if err != nil {
+		return nil, err
+	}
+	w := &textWalker{tableFormat: tableFormat, splitPages: true}
+	if err := w.walk(data); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Format: "DOCX", Unit: "page"}
+	f.properties(doc)
+	for _, p := range w.parts {
+		doc.Parts = append(doc.Parts, DocumentPart{Text: p})
+	}
+	if len(doc.Parts) <= 1 {
+		doc.addMeta("Note", "the file records no page breaks, the whole document is one page")
+	}
+	return doc, nil
+}
+
+func readPPTX(name, tableFormat string) (*Document, error) {
+	f, err := openOOXML(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	const presentation = "ppt/presentation.xml"
+	data, err := f.read(presentation)
+	if err != nil {
+		return nil, err
+	}
+	var pres struct {
+		Slides []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	if err := xml.Unmarshal(data, &pres); err != nil {
+		return nil, fmt.Errorf("invalid presentation: %v", err)
+	}
+	rels := f.rels(presentation)
+
+	doc := &Document{Format: "PPTX", Unit: "slide"}
+	f.properties(doc)
+	for _, s := range pres.Slides {
+		slide := rels[s.RID]
+		data, err := f.read(slide)
+		if err != nil {
+			continue
+		}
+		w := &textWalker{tableFormat: tableFormat}
+		if err := w.walk(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", slide, err)
+		}
+		text := strings.Join(w.parts, "\n\n")
+
+		if notes, ok := f.rels(slide)["notesSlide"]; ok {
+			if data, err := f.read(notes); err == nil {
+				nw := &textWalker{tableFormat: tableFormat}
+				if nw.walk(data) == nil {
+					if n := notesText(nw.parts); n != "" {
+						text += "\n\nNotes:\n" + n
+					}
+				}
+			}
+		}
+		doc.Parts = append(doc.Parts, DocumentPart{Title: w.title, Text: strings.TrimSpace(text)})
+	}
+	return doc, nil
+}
+
+// notesText drops the slide number placeholder that notes pages repeat.
+func notesText(parts []string) string {
+	var lines []string
+	for _, block := range strings.Split(strings.Join(parts, "\n\n"), "\n\n") {
+		if _, err := strconv.Atoi(strings.TrimSpace(block)); err == nil {
+			continue
+		}
+		lines = append(lines, block)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n\n"))
+}
+
+func readXLSX(name, tableFormat string) (*Document, error) {
+	f, err := openOOXML(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	const workbook = "xl/workbook.xml"
+	data, err := f.read(workbook)
+	if err != nil {
+		return nil, err
+	}
+	var wb struct {
+		Props struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name  string `xml:"name,attr"`
+			State string `xml:"state,attr"`
+			RID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(data, &wb); err != nil {
+		return nil, fmt.Errorf("invalid workbook: %v", err)
+	}
+	rels := f.rels(workbook)
+	shared := f.sharedStrings(rels["sharedStrings"])
+	dates := f.dateStyles(rels["styles"])
+	date1904 := wb.Props.Date1904 == "1" || wb.Props.Date1904 == "true"
+
+	doc := &Document{Format: "XLSX", Unit: "sheet"}
+	f.properties(doc)
+	var names []string
+	for _, s := range wb.Sheets {
+		data, err := f.read(rels[s.RID])
+		if err != nil {
+			continue
+		}
+		rows, err := parseSheet(data, shared, dates, date1904)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %v", s.Name, err)
+		}
+		label := s.Name
+		if s.State == "hidden" || s.State == "veryHidden" {
+			label += " (hidden)"
+		}
+		cols := 0
+		for _, row := range rows {
+			if len(row) > cols {
+				cols = len(row)
+			}
+		}
+		names = append(names, fmt.Sprintf("%s [%d rows x %d columns]", label, len(rows), cols))
+		text := renderTable(rows, tableFormat)
+		if text == "" {
+			text = "(empty sheet)"
+		}
+		doc.Parts = append(doc.Parts, DocumentPart{Title: s.Name, Text: text})
+	}
+	doc.addMeta("Sheets", strings.Join(names, "; "))
+	return doc, nil
+}
+
+func (f *ooxmlFile) sharedStrings(part string) []string {
+	data, err := f.read(part)
+	if err != nil {
+		return nil
+	}
+	var sst struct {
+		Items []struct {
+			T    string `xml:"t"`
+			Runs []struct {
+				T string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if xml.Unmarshal(data, &sst) != nil {
+		return nil
+	}
+	out := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		s := si.T
+		for _, r := range si.Runs {
+			s += r.T
+		}
+		out[i] = s
+	}
+	return out
+}
+
+var dateFormatRe = regexp.MustCompile(`[dmyhs]`)
+
+// dateStyles reports, per cell style index, whether the number format shows
+// a date or time.
+func (f *ooxmlFile) dateStyles(part string) map[int]bool {
+	data, err := f.read(part)
+	if err != nil {
+		return nil
+	}
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		Xfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if xml.Unmarshal(data, &styles) != nil {
+		return nil
+	}
+	isDate := map[int]bool{}
+	for id := 14; id <= 22; id++ {
+		isDate[id] = true
+	}
+	for _, id := range []int{27, 30, 36, 45, 46, 47, 50, 57} {
+		isDate[id] = true
+	}
+	quoted := regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+	for _, nf := range styles.NumFmts {
+		code := strings.ToLower(quoted.ReplaceAllString(nf.Code, ""))
+		isDate[nf.ID] = dateFormatRe.MatchString(code)
+	}
+	out := make(map[int]bool)
+	for i, xf := range styles.Xfs {
+		if isDate[xf.NumFmtID] {
+			out[i] = true
+		}
+	}
+	return out
+}
+
+func parseSheet(data []byte, shared []string, dates map[int]bool, date1904 bool) ([][]string, error) {
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Style  int    `xml:"s,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					T    string `xml:"t"`
+					Runs []struct {
+						T string `xml:"t"`
+					} `xml:"r"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(data, &sheet); err != nil {
+		return nil, fmt.Errorf("invalid XML: %v", err)
+	}
+
+	grid := map[int]map[int]string{}
+	maxRow, maxCol := -1, -1
+	for ri, row := range sheet.Rows {
+		r := ri
+		if row.R > 0 {
+			r = row.R - 1
+		}
+		for ci, c := range row.Cells {
+			col := ci
+			if c.Ref != "" {
+				col, _ = cellColumn(c.Ref)
+			}
+			var v string
+			switch c.Type {
+			case "s":
+				if i, err := strconv.Atoi(c.Value); err == nil && i >= 0 && i < len(shared) {
+					v = shared[i]
+				}
+			case "inlineStr":
+				v = c.Inline.T
+				for _, run := range c.Inline.Runs {
+					v += run.T
+				}
+			case "b":
+				v = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			case "str", "e":
+				v = c.Value
+			default:
+				v = c.Value
+				if dates[c.Style] && v != "" {
+					if serial, err := strconv.ParseFloat(v, 64); err == nil {
+						v = excelDate(serial, date1904)
+					}
+				}
+			}
+			if v == "" {
+				continue
+			}
+			if grid[r] == nil {
+				grid[r] = map[int]string{}
+			}
+			grid[r][col] = v
+			if r > maxRow {
+				maxRow = r
+			}
+			if col > maxCol {
+				maxCol = col
+			}
+		}
+	}
+
+	// Leading empty rows and columns are dropped, as is everything empty at
+	// the end.
+	minRow, minCol := maxRow, maxCol
+	for r, cols := range grid {
+		if r < minRow {
+			minRow = r
+		}
+		for c := range cols {
+			if c < minCol {
+				minCol = c
+			}
+		}
+	}
+	var rows [][]string
+	for r := minRow; r <= maxRow && maxRow >= 0; r++ {
+		row := make([]string, maxCol-minCol+1)
+		for c, v := range grid[r] {
+			row[c-minCol] = v
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// cellColumn returns the zero-based column of a reference such as "AB12".
+func cellColumn(ref string) (int, error) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A'+1)
+			n++
+		} else if r >= 'a' && r <= 'z' {
+			col = col*26 + int(r-'a'+1)
+			n++
+		} else {
+			break
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// excelDate converts a serial date number to text.
+func excelDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(serial)
+	secs := math.Round((serial - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second)
+	switch {
+	case days == 0 && !date1904:
+		return t.Format("15:04:05")
+	case secs == 0:
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
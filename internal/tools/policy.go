@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"xq-agent/internal/audit"
+	"xq-agent/internal/config"
+)
+
+// ErrPathDenied is returned (wrapped) whenever the path policy refuses an access.
+var ErrPathDenied = errors.New("access denied")
+
+// DefaultDenyPatterns apply when the config does not list any deny patterns.
+var DefaultDenyPatterns = []string{"**/.env", "~/.ssh/**"}
+
+// PathPolicy confines the file tools to the workspace roots.
+// A nil *PathPolicy permits every path.
+type PathPolicy struct {
+	roots    []string // absolute, symlinks resolved
+	deny     []string // slash-separated glob patterns
+	readOnly bool
+}
+
+// NewPathPolicy builds the policy from the workspace config. The protected
+// files, such as the audit log, are denied in addition to the patterns.
+func NewPathPolicy(cfg config.WorkspaceConfig, protected ...string) (*PathPolicy, error) {
+	roots := cfg.Roots
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	deny := cfg.Deny
+	if deny == nil {
+		deny = DefaultDenyPatterns
+	}
+
+	p := &PathPolicy{readOnly: cfg.ReadOnly}
+	for _, r := range roots {
+		abs, err := filepath.Abs(expandHome(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace root %q: %v", r, err)
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		p.roots = append(p.roots, abs)
+	}
+	for _, d := range deny {
+		d = filepath.ToSlash(expandHome(d))
+		// Relative patterns match at any depth.
+		if !strings.HasPrefix(d, "/") && !filepath.IsAbs(d) && !strings.HasPrefix(d, "**") {
+			d = "**/" + d
+		}
+		for _, segment := range splitPath(d) {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid deny pattern %q: %v", d, err)
+			}
+		}
+		p.deny = append(p.deny, d)
+	}
+	for _, f := range protected {
+		if f == "" {
+			continue
+		}
+		abs, err := filepath.Abs(expandHome(f))
+		if err != nil {
+			return nil, fmt.Errorf("invalid protected file %q: %v", f, err)
+		}
+		p.deny = append(p.deny, escapeGlob(filepath.ToSlash(abs)))
+		if real, err := resolveExisting(abs); err == nil && real != abs {
+			p.deny = append(p.deny, escapeGlob(filepath.ToSlash(real)))
+		}
+	}
+	return p, nil
+}
+
+// escapeGlob quotes the characters path.Match treats specially.
+func escapeGlob(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`*?[]\`, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Root returns the primary workspace directory. Relative paths given to the
+// file tools are resolved against it.
+func (p *PathPolicy) Root() string {
+	if p == nil || len(p.roots) == 0 {
+		wd, _ := os.Getwd()
+		return wd
+	}
+	return p.roots[0]
+}
+
+// ReadOnly reports whether every write is refused.
+func (p *PathPolicy) ReadOnly() bool {
+	return p != nil && p.readOnly
+}
+
+// CheckRead validates a path the tool is about to read and returns the
+// resolved absolute path that should be used instead.
+func (p *PathPolicy) CheckRead(tool, name string) (string, error) {
+	return p.check(tool, name, false)
+}
+
+// CheckWrite is like CheckRead but also enforces read-only mode.
+func (p *PathPolicy) CheckWrite(tool, name string) (string, error) {
+	return p.check(tool, name, true)
+}
+
+// Denied reports whether an already-resolved path matches a deny pattern.
+// Listings use it to hide entries the model could not open anyway.
+func (p *PathPolicy) Denied(abs string) bool {
+	return p != nil && p.matchDeny(abs) != ""
+}
+
+// DeniedPaths lists the files and directories the deny patterns name
+// literally, such as ~/.ssh for "~/.ssh/**" or the audit log. Patterns with
+// wildcards elsewhere, like "**/.env", are left out.
+func (p *PathPolicy) DeniedPaths() []string {
+	if p == nil {
+		return nil
+	}
+	var paths []string
+	for _, pattern := range p.deny {
+		segments := splitPath(pattern)
+		if n := len(segments); n > 1 && segments[n-1] == "**" {
+			segments = segments[:n-1]
+		}
+		if len(segments) == 0 || !strings.HasPrefix(pattern, "/") {
+			continue
+		}
+		literal := true
+		for i, s := range segments {
+			if segments[i], literal = unescapeGlob(s); !literal {
+				break
+			}
+		}
+		if literal {
+			paths = append(paths, filepath.FromSlash("/"+strings.Join(segments, "/")))
+		}
+	}
+	return paths
+}
+
+// unescapeGlob undoes escapeGlob. It reports false if the segment has
+// unescaped wildcards.
+func unescapeGlob(segment string) (string, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(segment); i++ {
+		switch c := segment[i]; c {
+		case '\\':
+			if i++; i < len(segment) {
+				sb.WriteByte(segment[i])
+			}
+		case '*', '?', '[':
+			return "", false
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), true
+}
+
+func (p *PathPolicy) check(tool, name string, write bool) (string, error) {
+	name = expandHome(strings.TrimSpace(name))
+	if name == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(p.Root(), name)
+	}
+	abs := filepath.Clean(name)
+	if p == nil {
+		return abs, nil
+	}
+
+	if write && p.readOnly {
+		return "", p.refuse(tool, abs, "workspace is read-only")
+	}
+
+	real, err := resolveExisting(abs)
+	if err != nil {
+		return "", p.refuse(tool, abs, err.Error())
+	}
+	if !p.inRoots(real) {
+		reason := "outside workspace roots"
+		if p.inRoots(abs) {
+			reason = "symlink escapes workspace roots"
+		}
+		return "", p.refuse(tool, abs, reason)
+	}
+	for _, candidate := range []string{abs, real} {
+		if pattern := p.matchDeny(candidate); pattern != "" {
+			return "", p.refuse(tool, abs, fmt.Sprintf("matches deny pattern %q", pattern))
+		}
+	}
+	return real, nil
+}
+
+func (p *PathPolicy) refuse(tool, target, reason string) error {
+	audit.Record(audit.Event{
+		Kind:   "path_denied",
+		Tool:   tool,
+		Target: target,
+		Reason: reason,
+	})
+	return fmt.Errorf("%w: %s (%s)", ErrPathDenied, target, reason)
+}
+
+func (p *PathPolicy) inRoots(abs string) bool {
+	for _, root := range p.roots {
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PathPolicy) matchDeny(abs string) string {
+	name := splitPath(filepath.ToSlash(abs))
+	for _, pattern := range p.deny {
+		if matchSegments(splitPath(pattern), name) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// resolveExisting evaluates symlinks on the longest existing prefix of abs,
+// so paths of files that are about to be created are resolved as well.
+func resolveExisting(abs string) (string, error) {
+	cur, rest := abs, ""
+	for {
+		if _, err := os.Lstat(cur); err == nil {
+			resolved, err := filepath.EvalSymlinks(cur)
+			if err != nil {
+				return "", fmt.Errorf("cannot resolve symlink %s: %v", cur, err)
+			}
+			return filepath.Join(resolved, rest), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(cur), rest)
+		cur = parent
+	}
+}
+
+func expandHome(name string) string {
+	if name != "~" && !strings.HasPrefix(name, "~/") && !strings.HasPrefix(name, `~\`) {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, name[1:])
+}
+
+func splitPath(name string) []string {
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// matchSegments matches slash-separated glob segments, where "**" spans any
+// number of directories (including none).
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"xq-agent/internal/config"
+)
+
+// testPolicy creates a workspace with a few files and a policy confining
+// the tools to it.
+func testPolicy(t *testing.T, cfg config.WorkspaceConfig, protected ...string) (*PathPolicy, string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"notes.txt", ".env", "app/.env", "secrets/keys/id.pem", "src/main.go"} {
+		full := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.Roots = []string{root}
+	p, err := NewPathPolicy(cfg, protected...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, root
+}
+
+func TestPathPolicyDenyPatterns(t *testing.T) {
+	p, root := testPolicy(t, config.WorkspaceConfig{Deny: []string{"**/.env", "secrets/**", "*.pem"}})
+
+	tests := []struct {
+		name    string
+		allowed bool
+	}{
+		{"notes.txt", true},
+		{"src/main.go", true},
+		{filepath.Join(root, "src/main.go"), true},
+		{"new/file.txt", true}, // Not created yet
+		{".env", false},
+		{"app/.env", false},
+		{"secrets", false},
+		{"secrets/keys/id.pem", false},
+		{"other/key.pem", false},
+	}
+	for _, tt := range tests {
+		got, err := p.CheckRead("read_file", tt.name)
+		if tt.allowed {
+			if err != nil {
+				t.Errorf("CheckRead(%q): %v", tt.name, err)
+			} else if !filepath.IsAbs(got) {
+				t.Errorf("CheckRead(%q) = %q, want an absolute path", tt.name, got)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrPathDenied) {
+			t.Errorf("CheckRead(%q) = %q, %v; want it denied", tt.name, got, err)
+		}
+	}
+	if !p.Denied(filepath.Join(root, "app/.env")) || p.Denied(filepath.Join(root, "notes.txt")) {
+		t.Error("Denied does not follow the deny patterns")
+	}
+}
+
+func TestPathPolicyDefaultDeny(t *testing.T) {
+	p, _ := testPolicy(t, config.WorkspaceConfig{})
+	if _, err := p.CheckRead("read_file", "app/.env"); !errors.Is(err, ErrPathDenied) {
+		t.Errorf(".env readable with the default patterns: %v", err)
+	}
+}
+
+func TestPathPolicyInvalidPattern(t *testing.T) {
+	_, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{t.TempDir()}, Deny: []string{"logs/[a-"}})
+	if err == nil {
+		t.Error("a malformed glob was accepted")
+	}
+}
+
+func TestPathPolicyOutsideRoots(t *testing.T) {
+	p, root := testPolicy(t, config.WorkspaceConfig{})
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+
+	for _, name := range []string{
+		"../outside.txt",
+		"src/../../outside.txt",
+		filepath.Join(outside, "secret.txt"),
+		"/etc/passwd",
+	} {
+		if _, err := p.CheckRead("read_file", name); !errors.Is(err, ErrPathDenied) {
+			t.Errorf("CheckRead(%q) outside the root: %v", name, err)
+		}
+	}
+	// Traversal that stays inside the root is fine.
+	if got, err := p.CheckRead("read_file", "src/../notes.txt"); err != nil || got != filepath.Join(root, "notes.txt") {
+		t.Errorf("CheckRead(src/../notes.txt) = %q, %v", got, err)
+	}
+}
+
+func TestPathPolicySymlinks(t *testing.T) {
+	p, root := testPolicy(t, config.WorkspaceConfig{Deny: []string{"**/.env"}})
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	links := map[string]string{
+		"escape":      outside,
+		"escape.txt":  filepath.Join(outside, "secret.txt"),
+		"innocent":    filepath.Join(root, ".env"),
+		"src/up/file": filepath.Join(root, "notes.txt"),
+	}
+	for link, target := range links {
+		full := filepath.Join(root, link)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.Symlink(target, full); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+
+	for _, name := range []string{"escape/secret.txt", "escape.txt", "escape/new.txt"} {
+		if _, err := p.CheckWrite("write_file", name); !errors.Is(err, ErrPathDenied) {
+			t.Errorf("CheckWrite(%q) through a symlink out of the root: %v", name, err)
+		}
+	}
+	// A link to a denied file is denied as well.
+	if _, err := p.CheckRead("read_file", "innocent"); !errors.Is(err, ErrPathDenied) {
+		t.Errorf("read .env through a symlink: %v", err)
+	}
+	// Links inside the root resolve to their target.
+	if got, err := p.CheckRead("read_file", "src/up/file"); err != nil || got != filepath.Join(root, "notes.txt") {
+		t.Errorf("CheckRead(src/up/file) = %q, %v", got, err)
+	}
+}
+
+func TestPathPolicyReadOnly(t *testing.T) {
+	p, _ := testPolicy(t, config.WorkspaceConfig{ReadOnly: true})
+	if !p.ReadOnly() {
+		t.Error("ReadOnly() = false")
+	}
+	if _, err := p.CheckRead("read_file", "notes.txt"); err != nil {
+		t.Errorf("read in a read-only workspace: %v", err)
+	}
+	for _, name := range []string{"notes.txt", "new.txt"} {
+		if _, err := p.CheckWrite("write_file", name); !errors.Is(err, ErrPathDenied) {
+			t.Errorf("CheckWrite(%q) in a read-only workspace: %v", name, err)
+		}
+	}
+}
+
+func TestPathPolicyProtectsAuditLog(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "audit[1].log")
+	os.WriteFile(log, nil, 0600)
+	os.WriteFile(filepath.Join(dir, "audit1.log"), nil, 0600)
+	link := filepath.Join(dir, "link.log")
+	os.Symlink(log, link)
+
+	p, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{dir}, Deny: []string{}}, log, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{log, "audit[1].log", "link.log"} {
+		if _, err := p.CheckWrite("write_file", name); !errors.Is(err, ErrPathDenied) {
+			t.Errorf("CheckWrite(%q) on the audit log: %v", name, err)
+		}
+	}
+	// The name is matched literally, not as a glob.
+	if _, err := p.CheckWrite("write_file", "audit1.log"); err != nil {
+		t.Errorf("CheckWrite(audit1.log): %v", err)
+	}
+}
+
+func TestNilPathPolicy(t *testing.T) {
+	var p *PathPolicy
+	if got, err := p.CheckWrite("write_file", "/etc/../tmp/x"); err != nil || got != "/tmp/x" {
+		t.Errorf("nil policy CheckWrite = %q, %v", got, err)
+	}
+	if p.ReadOnly() || p.Denied("/etc/passwd") {
+		t.Error("a nil policy restricts access")
+	}
+}
+
+func TestPathPolicyDeniedPaths(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	p, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{dir}, Deny: []string{"~/.ssh/**", "**/.env", "/srv/*/keys", "/etc/app.conf"}},
+		filepath.Join(dir, "audit[1].log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(home, ".ssh"), "/etc/app.conf", filepath.Join(dir, "audit[1].log")}
+	if got := p.DeniedPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DeniedPaths() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,717 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Article is the readable main content of a web page, converted to Markdown.
+type Article struct {
+	Title    string
+	Markdown string
+}
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|header|menu|modal|nav|pager|pagination|popup|promo|related|remark|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|ad-break|advert`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow|post|entry|story|text`)
+	positiveHints      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|text|blog|story`)
+	negativeHints      = regexp.MustCompile(`(?i)combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|shoutbox|sidebar|sponsor|shopping|tags|tool|widget`)
+	blankLines         = regexp.MustCompile(`\n{3,}`)
+)
+
+// junkTags never contain readable content.
+var junkTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Svg: true, atom.Canvas: true, atom.Template: true, atom.Object: true,
+	atom.Embed: true, atom.Button: true, atom.Input: true, atom.Select: true,
+	atom.Textarea: true, atom.Nav: true, atom.Footer: true, atom.Aside: true,
+	atom.Link: true, atom.Meta: true,
+}
+
+// ExtractArticle finds the main content of an HTML document, readability
+// style, and converts it to Markdown. Relative links are resolved against
+// pageURL.
+func ExtractArticle(r io.Reader, pageURL string) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	base, _ := url.Parse(pageURL)
+
+	article := &Article{Title: documentTitle(doc)}
+	body := findFirst(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	removeJunk(body)
+
+	var parts []string
+	for _, n := range mainContent(body) {
+		if md := HTMLToMarkdown(n, base); md != "" {
+			parts = append(parts, md)
+		}
+	}
+	article.Markdown = strings.Join(parts, "\n\n")
+	// A bad guess yields next to nothing; the whole body is better than that.
+	if utf8.RuneCountInString(article.Markdown) < 250 {
+		article.Markdown = HTMLToMarkdown(body, base)
+	}
+	if article.Title != "" && !strings.HasPrefix(article.Markdown, "# ") {
+		article.Markdown = "# " + article.Title + "\n\n" + article.Markdown
+	}
+	return article, nil
+}
+
+// PageToMarkdown converts a whole HTML document to Markdown without
+// main-content detection.
+func PageToMarkdown(r io.Reader, pageURL string) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	base, _ := url.Parse(pageURL)
+	body := findFirst(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	removeJunk(body)
+	return HTMLToMarkdown(body, base), nil
+}
+
+func documentTitle(doc *html.Node) string {
+	var title string
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if n.DataAtom == atom.Meta && (attr(n, "property") == "og:title" || attr(n, "name") == "twitter:title") {
+			if c := strings.TrimSpace(attr(n, "content")); c != "" {
+				title = c
+				return false
+			}
+		}
+		if n.DataAtom == atom.Title && title == "" {
+			title = collapseSpace(textContent(n))
+		}
+		return true
+	})
+	return title
+}
+
+// removeJunk drops scripts, navigation and elements whose class or id mark
+// them as boilerplate.
+func removeJunk(root *html.Node) {
+	var remove []*html.Node
+	walk(root, func(n *html.Node) bool {
+		if n.Type == html.CommentNode {
+			remove = append(remove, n)
+			return false
+		}
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if junkTags[n.DataAtom] || hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+			remove = append(remove, n)
+			return false
+		}
+		switch n.DataAtom {
+		case atom.Body, atom.Article, atom.Main, atom.A, atom.Table, atom.Tbody, atom.Tr, atom.Td, atom.Th:
+			return true
+		}
+		hints := attr(n, "class") + " " + attr(n, "id") + " " + attr(n, "role")
+		if unlikelyCandidates.MatchString(hints) && !maybeCandidate.MatchString(hints) {
+			remove = append(remove, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range remove {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+// mainContent scores block elements by the paragraphs they contain and
+// returns the best one together with related siblings, in document order.
+func mainContent(body *html.Node) []*html.Node {
+	scores := make(map[*html.Node]float64)
+	initialize := func(n *html.Node) {
+		if _, ok := scores[n]; ok || n.Type != html.ElementNode {
+			return
+		}
+		score := classWeight(n)
+		switch n.DataAtom {
+		case atom.Div, atom.Article, atom.Main, atom.Section:
+			score += 5
+		case atom.Pre, atom.Td, atom.Blockquote:
+			score += 3
+		case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+			score -= 3
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+			score -= 5
+		}
+		if n.DataAtom == atom.Article || n.DataAtom == atom.Main || attr(n, "role") == "main" {
+			score += 10
+		}
+		scores[n] = score
+	}
+
+	walk(body, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		switch n.DataAtom {
+		case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+		default:
+			return true
+		}
+		text := collapseSpace(textContent(n))
+		length := utf8.RuneCountInString(text)
+		if length < 25 {
+			return true
+		}
+		// Commas in both Latin and CJK text indicate prose.
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")+strings.Count(text, "。"))
+		score += math.Min(float64(length)/100, 3)
+
+		if parent := n.Parent; parent != nil && parent.Type == html.ElementNode {
+			initialize(parent)
+			scores[parent] += score
+			if grand := parent.Parent; grand != nil && grand.Type == html.ElementNode {
+				initialize(grand)
+				scores[grand] += score / 2
+			}
+		}
+		return false
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for n, score := range scores {
+		score *= 1 - linkDensity(n)
+		scores[n] = score
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil || best == body {
+		return nil
+	}
+
+	// Siblings that scored well (or are solid paragraphs) belong to the article.
+	parent := best.Parent
+	if parent == nil {
+		return []*html.Node{best}
+	}
+	threshold := math.Max(10, bestScore*0.2)
+	var keep []*html.Node
+	for s := parent.FirstChild; s != nil; s = s.NextSibling {
+		if s == best {
+			keep = append(keep, s)
+			continue
+		}
+		if s.Type != html.ElementNode {
+			continue
+		}
+		if score, ok := scores[s]; ok && score >= threshold {
+			keep = append(keep, s)
+			continue
+		}
+		if s.DataAtom == atom.P {
+			text := collapseSpace(textContent(s))
+			if ld := linkDensity(s); (len(text) > 80 && ld < 0.25) || (len(text) > 0 && ld == 0 && strings.ContainsAny(text, ".。")) {
+				keep = append(keep, s)
+			}
+		}
+	}
+	return keep
+}
+
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, value := range []string{attr(n, "class"), attr(n, "id")} {
+		if value == "" {
+			continue
+		}
+		if negativeHints.MatchString(value) {
+			weight -= 25
+		}
+		if positiveHints.MatchString(value) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+func linkDensity(n *html.Node) float64 {
+	total := utf8.RuneCountInString(collapseSpace(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linked += utf8.RuneCountInString(collapseSpace(textContent(c)))
+			return false
+		}
+		return true
+	})
+	return float64(linked) / float64(total)
+}
+
+// HTMLToMarkdown renders a node and its children as Markdown, keeping
+// headings, emphasis, links, lists, code blocks and tables.
+func HTMLToMarkdown(n *html.Node, base *url.URL) string {
+	w := &mdWriter{base: base}
+	if n.Type == html.ElementNode {
+		w.node(n)
+	} else {
+		w.children(n)
+	}
+	out := blankLines.ReplaceAllString(w.String(), "\n\n")
+	return strings.TrimSpace(out)
+}
+
+// mdWriter accumulates Markdown. Whitespace in text is collapsed the way a
+// browser would, block elements are separated by blank lines.
+type mdWriter struct {
+	buf          []byte
+	base         *url.URL
+	pendingSpace bool
+}
+
+func (w *mdWriter) String() string { return string(w.buf) }
+
+func (w *mdWriter) sub() *mdWriter { return &mdWriter{base: w.base} }
+
+func (w *mdWriter) atLineStart() bool {
+	return len(w.buf) == 0 || w.buf[len(w.buf)-1] == '\n'
+}
+
+// raw writes s verbatim, preceded by a pending inline space.
+func (w *mdWriter) raw(s string) {
+	if s == "" {
+		return
+	}
+	if w.pendingSpace && !w.atLineStart() {
+		w.buf = append(w.buf, ' ')
+	}
+	w.pendingSpace = false
+	w.buf = append(w.buf, s...)
+}
+
+func (w *mdWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		w.pendingSpace = true
+		return
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	if unicode.IsSpace(first) {
+		w.pendingSpace = true
+	}
+	w.raw(strings.Join(words, " "))
+	last, _ := utf8.DecodeLastRuneInString(s)
+	w.pendingSpace = unicode.IsSpace(last)
+}
+
+func (w *mdWriter) trimRight() {
+	for len(w.buf) > 0 {
+		c := w.buf[len(w.buf)-1]
+		if c != ' ' && c != '\n' && c != '\t' {
+			break
+		}
+		w.buf = w.buf[:len(w.buf)-1]
+	}
+}
+
+// block ends the current paragraph.
+func (w *mdWriter) block() {
+	w.pendingSpace = false
+	w.trimRight()
+	if len(w.buf) > 0 {
+		w.buf = append(w.buf, "\n\n"...)
+	}
+}
+
+func (w *mdWriter) lineBreak() {
+	w.pendingSpace = false
+	for len(w.buf) > 0 && w.buf[len(w.buf)-1] == ' ' {
+		w.buf = w.buf[:len(w.buf)-1]
+	}
+	w.buf = append(w.buf, '\n')
+}
+
+func (w *mdWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+// inline renders n's children into a single line.
+func (w *mdWriter) inline(n *html.Node) string {
+	s := w.sub()
+	s.children(n)
+	return strings.Join(strings.Fields(s.String()), " ")
+}
+
+func (w *mdWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+	if junkTags[n.DataAtom] {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		if text := w.inline(n); text != "" {
+			w.block()
+			w.raw(strings.Repeat("#", level) + " " + text)
+			w.block()
+		}
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header,
+		atom.Figure, atom.Figcaption, atom.Dl, atom.Dd, atom.Dt, atom.Address, atom.Details, atom.Summary:
+		w.block()
+		w.children(n)
+		w.block()
+	case atom.Br:
+		w.lineBreak()
+	case atom.Hr:
+		w.block()
+		w.raw("---")
+		w.block()
+	case atom.Strong, atom.B:
+		if text := w.inline(n); text != "" {
+			w.raw("**" + text + "**")
+		}
+	case atom.Em, atom.I:
+		if text := w.inline(n); text != "" {
+			w.raw("*" + text + "*")
+		}
+	case atom.Del, atom.S, atom.Strike:
+		if text := w.inline(n); text != "" {
+			w.raw("~~" + text + "~~")
+		}
+	case atom.Code, atom.Kbd, atom.Samp:
+		if text := strings.TrimSpace(textContent(n)); text != "" {
+			w.raw("`" + text + "`")
+		}
+	case atom.Pre:
+		w.block()
+		lang := ""
+		if code := findFirst(n, atom.Code); code != nil {
+			for _, class := range strings.Fields(attr(code, "class")) {
+				if strings.HasPrefix(class, "language-") {
+					lang = strings.TrimPrefix(class, "language-")
+				}
+			}
+		}
+		w.raw("```" + lang + "\n" + strings.Trim(textContent(n), "\n") + "\n```")
+		w.block()
+	case atom.A:
+		text := w.inline(n)
+		href := strings.TrimSpace(attr(n, "href"))
+		switch {
+		case text == "":
+		case href == "" || strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "#"):
+			// Checked before resolving, which makes fragments absolute.
+			w.raw(text)
+		default:
+			w.raw("[" + text + "](" + w.resolve(href) + ")")
+		}
+	case atom.Img:
+		src := w.resolve(attr(n, "src"))
+		if src != "" && !strings.HasPrefix(src, "data:") {
+			w.raw("![" + strings.TrimSpace(attr(n, "alt")) + "](" + src + ")")
+		}
+	case atom.Ul, atom.Ol:
+		w.list(n)
+	case atom.Blockquote:
+		s := w.sub()
+		s.children(n)
+		body := strings.TrimSpace(blankLines.ReplaceAllString(s.String(), "\n\n"))
+		if body == "" {
+			return
+		}
+		w.block()
+		quoted := "> " + strings.ReplaceAll(body, "\n", "\n> ")
+		w.raw(strings.ReplaceAll(quoted, "> \n", ">\n"))
+		w.block()
+	case atom.Table:
+		w.table(n)
+	default:
+		w.children(n)
+	}
+}
+
+func (w *mdWriter) list(n *html.Node) {
+	w.block()
+	index := 1
+	if start := attr(n, "start"); start != "" {
+		fmt.Sscan(start, &index)
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", index)
+			index++
+		}
+		s := w.sub()
+		s.children(li)
+		item := strings.TrimSpace(blankLines.ReplaceAllString(s.String(), "\n\n"))
+		item = strings.ReplaceAll(item, "\n\n", "\n")
+		indent := strings.Repeat(" ", len(marker))
+		w.raw(marker + strings.ReplaceAll(item, "\n", "\n"+indent))
+		w.lineBreak()
+	}
+	w.block()
+}
+
+func (w *mdWriter) table(n *html.Node) {
+	var rows [][]string
+	header := false
+	walk(n, func(c *html.Node) bool {
+		if c.Type != html.ElementNode {
+			return true
+		}
+		if c.DataAtom == atom.Table && c != n {
+			return false // nested tables are flattened into their cell
+		}
+		if c.DataAtom != atom.Tr {
+			return true
+		}
+		var row []string
+		for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+				continue
+			}
+			if cell.DataAtom == atom.Th && len(rows) == 0 {
+				header = true
+			}
+			text := strings.ReplaceAll(w.inline(cell), "|", `\|`)
+			row = append(row, text)
+			span := 1
+			fmt.Sscan(attr(cell, "colspan"), &span)
+			for i := 1; i < span && i < 50; i++ {
+				row = append(row, "")
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+		return false
+	})
+	if len(rows) == 0 {
+		return
+	}
+	// Layout tables with a single column read better as paragraphs.
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	w.block()
+	if width == 1 {
+		for _, row := range rows {
+			w.raw(row[0])
+			w.block()
+		}
+		return
+	}
+	if !header {
+		// Markdown tables need a header row; use an empty one.
+		rows = append([][]string{make([]string, width)}, rows...)
+	}
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		w.raw("| " + strings.Join(row, " | ") + " |")
+		w.lineBreak()
+		if i == 0 {
+			w.raw("|" + strings.Repeat(" --- |", width))
+			w.lineBreak()
+		}
+	}
+	w.block()
+}
+
+func (w *mdWriter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || w.base == nil {
+		return href
+	}
+	u, err := w.base.Parse(href)
+	if err != nil {
+		return href
+	}
+	return u.String()
+}
+
+// Paginate splits text into pages of roughly size characters, breaking at
+// paragraph boundaries where possible. page is 1-based; it returns the
+// requested page and the total number of pages.
+func Paginate(text string, page, size int) (string, int) {
+	if size <= 0 {
+		size = 4000
+	}
+	var pages []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			pages = append(pages, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	for _, para := range strings.Split(text, "\n\n") {
+		for utf8.RuneCountInString(para) > size {
+			flush()
+			runes := []rune(para)
+			pages = append(pages, string(runes[:size]))
+			para = string(runes[size:])
+		}
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(para) > size {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(para)
+	}
+	flush()
+
+	if len(pages) == 0 {
+		return "", 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > len(pages) {
+		return "", len(pages)
+	}
+	return pages[page-1], len(pages)
+}
+
+// pageWindow returns the text for a page/offset request with a footer telling
+// the model how to continue reading.
+func pageWindow(text string, page, offset, size int) string {
+	if size <= 0 {
+		size = 4000
+	}
+	if offset > 0 {
+		return offsetWindow(text, offset, size)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	chunk, total := Paginate(text, page, size)
+	if page > total {
+		return fmt.Sprintf("(page %d does not exist, the content has %d pages)", page, total)
+	}
+	if total == 1 {
+		return chunk
+	}
+	footer := fmt.Sprintf("\n\n(page %d of %d", page, total)
+	if page < total {
+		footer += fmt.Sprintf(", use page=%d to continue", page+1)
+	}
+	return chunk + footer + ")"
+}
+
+// offsetWindow returns size characters of text starting at offset.
+func offsetWindow(text string, offset, size int) string {
+	runes := []rune(text)
+	if offset >= len(runes) {
+		return fmt.Sprintf("(offset %d is past the end, the content has %d characters)", offset, len(runes))
+	}
+	end := offset + size
+	if end >= len(runes) {
+		return string(runes[offset:]) + "\n\n(end of content)"
+	}
+	return string(runes[offset:end]) + fmt.Sprintf("\n\n(characters %d-%d of %d, use offset=%d to continue)", offset, end, len(runes), end)
+}
+
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling // visit may detach c
+		walk(c, visit)
+		c = next
+	}
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+		return !(c.Type == html.ElementNode && junkTags[c.DataAtom])
+	})
+	return sb.String()
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,170 @@
+package tools
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveFixture serves testdata/article.html under /posts/tea.
+func serveFixture(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/article.html")
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/posts/tea"
+}
+
+func fetchFixture(t *testing.T, pageURL string) *http.Response {
+	t.Helper()
+	resp, err := http.Get(pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestExtractArticle(t *testing.T) {
+	pageURL := serveFixture(t)
+	article, err := ExtractArticle(fetchFixture(t, pageURL).Body, pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if article.Title != "Brewing Tea at Home" {
+		t.Errorf("title = %q, want the og:title", article.Title)
+	}
+	md := article.Markdown
+	if !strings.HasPrefix(md, "# Brewing Tea at Home\n\n") {
+		t.Errorf("markdown does not start with the title:\n%s", md)
+	}
+	for _, want := range []string{
+		"## Choosing leaves",
+		"Whole leaves keep their aroma far longer",
+		"**never squeeze the bag**",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+	for _, junk := range []string{"trackVisitor", "font-family", "Shop", "newsletter", "Copyright", "members-only"} {
+		if strings.Contains(md, junk) {
+			t.Errorf("markdown contains boilerplate %q:\n%s", junk, md)
+		}
+	}
+}
+
+func TestExtractArticleTable(t *testing.T) {
+	pageURL := serveFixture(t)
+	article, err := ExtractArticle(fetchFixture(t, pageURL).Body, pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "| Tea | Water | Minutes |\n" +
+		"| --- | --- | --- |\n" +
+		"| Green | 80 °C | 2 |\n" +
+		"| Black | 95 °C | 4 |\n" +
+		"| Oolong \\| rolled | 90 °C | 3 |\n"
+	if !strings.Contains(article.Markdown, want) {
+		t.Errorf("markdown lacks the table\n%s\ngot:\n%s", want, article.Markdown)
+	}
+}
+
+func TestExtractArticleLinks(t *testing.T) {
+	pageURL := serveFixture(t)
+	article, err := ExtractArticle(fetchFixture(t, pageURL).Body, pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := article.Markdown
+
+	// Relative links resolve against the page URL.
+	base := strings.TrimSuffix(pageURL, "/posts/tea")
+	if want := "[temperature guide](" + base + "/guides/temperature)"; !strings.Contains(md, want) {
+		t.Errorf("markdown lacks %q:\n%s", want, md)
+	}
+	// Script and fragment links keep only their text.
+	if strings.Contains(md, "javascript:") || strings.Contains(md, "#top") {
+		t.Errorf("markdown links to a script or fragment:\n%s", md)
+	}
+	if !strings.Contains(md, "Share Back to top") {
+		t.Errorf("markdown lacks the link texts:\n%s", md)
+	}
+}
+
+func TestPageToMarkdown(t *testing.T) {
+	pageURL := serveFixture(t)
+	md, err := PageToMarkdown(fetchFixture(t, pageURL).Body, pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The whole body is kept apart from junk elements.
+	if !strings.Contains(md, "## Choosing leaves") || !strings.Contains(md, "| Green | 80 °C | 2 |") {
+		t.Errorf("markdown lacks the content:\n%s", md)
+	}
+	for _, junk := range []string{"trackVisitor", "Shop", "newsletter", "Copyright"} {
+		if strings.Contains(md, junk) {
+			t.Errorf("markdown contains boilerplate %q:\n%s", junk, md)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	paras := []string{
+		strings.Repeat("a", 40),
+		strings.Repeat("b", 40),
+		strings.Repeat("c", 40),
+	}
+	text := strings.Join(paras, "\n\n")
+
+	tests := []struct {
+		page      int
+		size      int
+		want      string
+		wantTotal int
+	}{
+		{page: 1, size: 1000, want: text, wantTotal: 1},
+		// Pages break between paragraphs.
+		{page: 1, size: 90, want: paras[0] + "\n\n" + paras[1], wantTotal: 2},
+		{page: 2, size: 90, want: paras[2], wantTotal: 2},
+		{page: 0, size: 50, want: paras[0], wantTotal: 3},
+		{page: 4, size: 50, want: "", wantTotal: 3},
+		// Paragraphs longer than a page are cut.
+		{page: 2, size: 30, want: strings.Repeat("a", 10), wantTotal: 6},
+	}
+	for _, tt := range tests {
+		got, total := Paginate(text, tt.page, tt.size)
+		if got != tt.want || total != tt.wantTotal {
+			t.Errorf("Paginate(page=%d, size=%d) = %q, %d; want %q, %d", tt.page, tt.size, got, total, tt.want, tt.wantTotal)
+		}
+	}
+
+	if got, total := Paginate("", 1, 10); got != "" || total != 1 {
+		t.Errorf("Paginate of empty text = %q, %d; want \"\", 1", got, total)
+	}
+	// Sizes count characters, not bytes.
+	if _, total := Paginate(strings.Repeat("茶", 100), 1, 100); total != 1 {
+		t.Errorf("100 characters took %d pages of 100", total)
+	}
+}
+
+func TestPageWindow(t *testing.T) {
+	text := strings.Repeat("x", 50) + "\n\n" + strings.Repeat("y", 50)
+
+	if got := pageWindow(text, 1, 0, 60); !strings.HasSuffix(got, "(page 1 of 2, use page=2 to continue)") {
+		t.Errorf("first page footer: %q", got)
+	}
+	if got := pageWindow(text, 2, 0, 60); !strings.HasSuffix(got, "(page 2 of 2)") {
+		t.Errorf("last page footer: %q", got)
+	}
+	if got := pageWindow(text, 3, 0, 60); got != "(page 3 does not exist, the content has 2 pages)" {
+		t.Errorf("missing page: %q", got)
+	}
+	if got := pageWindow(text, 0, 90, 60); got != strings.Repeat("y", 12)+"\n\n(end of content)" {
+		t.Errorf("offset window: %q", got)
+	}
+}
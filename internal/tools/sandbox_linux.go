@@ -0,0 +1,157 @@
+//go:build linux
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxArg makes the binary act as the sandbox helper: it sets up the
+// mounts of a snippet's namespaces, then executes the snippet.
+const sandboxArg = "__xq-agent-sandbox"
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == sandboxArg {
+		if err := runSandboxHelper(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		}
+		os.Exit(127)
+	}
+}
+
+// sandboxProcess puts cmd in its own process group, killed as a whole when
+// the run is cancelled. With a spec, cmd runs through the sandbox helper in
+// new user and mount namespaces, and without network in a network namespace
+// that contains nothing but a loopback interface.
+func sandboxProcess(cmd *exec.Cmd, spec *sandboxSpec) {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if spec != nil && sandboxError() == nil {
+		isolate(cmd, attr, spec)
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+func isolate(cmd *exec.Cmd, attr *syscall.SysProcAttr, spec *sandboxSpec) {
+	attr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	if !spec.network {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+
+	self, err := os.Executable()
+	if err != nil {
+		self = "/proc/self/exe"
+	}
+	args := []string{self, sandboxArg, spec.dir, strconv.Itoa(len(spec.hide))}
+	args = append(args, spec.hide...)
+	args = append(args, cmd.Path)
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = self
+}
+
+var (
+	sandboxOnce sync.Once
+	sandboxErr  error
+)
+
+// sandboxError reports why snippets cannot be isolated, or nil if they can.
+// The first call tries it once; the result is kept.
+func sandboxError() error {
+	sandboxOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "xq-agent-sandbox-")
+		if err != nil {
+			sandboxErr = err
+			return
+		}
+		defer os.RemoveAll(dir)
+		cmd := exec.Command("/bin/sh", "-c", "echo ok > probe")
+		cmd.Dir = dir
+		attr := &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+		isolate(cmd, attr, &sandboxSpec{dir: dir})
+		cmd.SysProcAttr = attr
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			_, err = os.Stat(filepath.Join(dir, "probe"))
+		}
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				err = fmt.Errorf("%v: %s", err, msg)
+			}
+			sandboxErr = fmt.Errorf("cannot create user and mount namespaces (%v); unprivileged user namespaces may be disabled, see the kernel.unprivileged_userns_clone and kernel.apparmor_restrict_unprivileged_userns sysctls", err)
+		}
+	})
+	return sandboxErr
+}
+
+// runSandboxHelper runs in the new namespaces with the arguments set by
+// isolate: the scratch directory, the number of hidden paths, the paths, and
+// the command. It makes every mount read-only, hides the paths behind empty
+// ones, leaves only the scratch directory writable and executes the command.
+func runSandboxHelper(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("missing arguments")
+	}
+	dir := args[0]
+	n, err := strconv.Atoi(args[1])
+	if err != nil || len(args) < 3+n {
+		return fmt.Errorf("invalid arguments")
+	}
+	hide, command := args[2:2+n], args[2+n:]
+
+	// Mounts made here must not propagate back to the host.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %v", err)
+	}
+	// Keep a handle on the scratch directory, which may be inside a hidden one.
+	scratch, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range hide {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			err = unix.Mount("tmpfs", p, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=16k,mode=755")
+		} else {
+			err = unix.Mount("/dev/null", p, "", unix.MS_BIND, "")
+		}
+		if err != nil {
+			return fmt.Errorf("hide %s: %v", p, err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	err = unix.MountSetattr(-1, "/", unix.AT_RECURSIVE, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY})
+	if err != nil {
+		return fmt.Errorf("make mounts read-only: %v", err)
+	}
+	// The bind mount copies the read-only flag of its source, so it is
+	// cleared again.
+	if err := unix.Mount(fmt.Sprintf("/proc/self/fd/%d", scratch.Fd()), dir, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("mount %s: %v", dir, err)
+	}
+	scratch.Close()
+	if err := unix.MountSetattr(-1, dir, 0, &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return fmt.Errorf("make %s writable: %v", dir, err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	return syscall.Exec(command[0], command, os.Environ())
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xq-agent/internal/config"
+)
+
+func TestSandboxConfinesWrites(t *testing.T) {
+	if err := sandboxError(); err != nil {
+		t.Skip(err)
+	}
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := filepath.Join(root, "secrets")
+	os.Mkdir(secrets, 0755)
+	os.WriteFile(filepath.Join(secrets, "key"), []byte("hunter2"), 0600)
+	policy, err := NewPathPolicy(config.WorkspaceConfig{Roots: []string{root}, Deny: []string{secrets + "/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := &CodeRunTool{Config: config.CodeConfig{Dir: t.TempDir()}, Policy: policy}
+	dir, err := tool.scratchDir("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+
+	script := `echo ok > inside.txt
+echo escaped > ` + filepath.Join(root, "notes.txt") + `
+echo escaped > ` + filepath.Join(outside, "escape.txt") + `
+cat ` + filepath.Join(secrets, "key") + `
+tail -n +3 /proc/net/dev | cut -d: -f1`
+	stdout, stderr, err := tool.run(context.Background(), dir, &codeLanguage{}, "/bin/sh", "-c", script)
+	if err != nil {
+		t.Logf("exit: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "inside.txt")); err != nil || string(data) != "ok\n" {
+		t.Errorf("the scratch directory is not writable: %v\n%s", err, stderr)
+	}
+	for _, name := range []string{filepath.Join(root, "notes.txt"), filepath.Join(outside, "escape.txt")} {
+		if _, err := os.Stat(name); err == nil {
+			t.Errorf("the snippet wrote %s", name)
+		}
+	}
+	if strings.Contains(stdout.String(), "hunter2") {
+		t.Error("the snippet read a denied directory")
+	}
+	if net := strings.Fields(stdout.String()); len(net) != 1 || net[0] != "lo" {
+		t.Errorf("network interfaces: %q", net)
+	}
+}
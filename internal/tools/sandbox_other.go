@@ -0,0 +1,18 @@
+//go:build !linux
+
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// sandboxProcess is a no-op outside Linux: snippets can reach the network
+// and the whole filesystem, and only the process itself is killed on timeout.
+func sandboxProcess(cmd *exec.Cmd, spec *sandboxSpec) {}
+
+// sandboxError reports why snippets cannot be isolated.
+func sandboxError() error {
+	return fmt.Errorf("cannot be isolated on %s", runtime.GOOS)
+}
@@ -0,0 +1,554 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var absoluteLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+var (
+	unixRe = regexp.MustCompile(`^\d{9,11}$`)
+
+	relativeRe = regexp.MustCompile(`(?:\bin\s+)?(\d+)\s*(seconds?|secs?|minutes?|mins?|hours?|hrs?|days?|weeks?|months?|years?|秒钟?|分钟|小时|个?钟头|天|日|个?星期|个?礼拜|周|个月|年)\s*(ago|later|from now|之后|以后|后|之前|以前|前)?`)
+
+	numericDateRe = regexp.MustCompile(`(?:(\d{4})\s*[-/年]\s*)?(\d{1,2})\s*[-/月]\s*(\d{1,2})\s*[日号]?`)
+	monthNameRe   = regexp.MustCompile(`\b(jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s*(\d{4}))?`)
+
+	dayWordRe   = regexp.MustCompile(`day after tomorrow|day before yesterday|tomorrow|yesterday|today|tonight|大后天|后天|明天|明早|明晚|今天|今早|今晚|昨天|前天`)
+	weekdayRe   = regexp.MustCompile(`\b(?:(this|next|last|coming)\s+)?(monday|tuesday|wednesday|thursday|friday|saturday|sunday|mon|tues|tue|wed|thurs|thur|thu|fri|sat|sun)\b`)
+	cnWeekdayRe = regexp.MustCompile(`(下下|下|上|这|本)?\s*个?(?:周|星期|礼拜)([一二三四五六日天1-7])`)
+	periodRe    = regexp.MustCompile(`\b(next|last|this)\s+(week|month|year)\b|(下下|下|上|这|本)个?(周|星期|礼拜|月)|(明|去|今)年`)
+
+	cnTimeRe  = regexp.MustCompile(`(凌晨|早上|早晨|上午|中午|下午|傍晚|晚上|夜里)?\s*(\d{1,2})\s*[点點时](?:\s*(半|1刻|3刻|(\d{1,2})\s*分?))?`)
+	clockRe   = regexp.MustCompile(`\b(\d{1,2}):(\d{2})(?::(\d{2}))?\s*(am|pm|a\.m\.|p\.m\.)?`)
+	ampmRe    = regexp.MustCompile(`\b(\d{1,2})\s*(am|pm|a\.m\.|p\.m\.)`)
+	atHourRe  = regexp.MustCompile(`\bat\s+(\d{1,2})\b`)
+	bareHour  = regexp.MustCompile(`^\s*(\d{1,2})\s*$`)
+	namedTime = regexp.MustCompile(`\b(noon|midday|midnight|morning|afternoon|evening)\b|中午|凌晨|早上|上午|下午|傍晚|晚上`)
+	cnNumRe   = regexp.MustCompile(`[零一二两三四五六七八九十]+`)
+	fillerRe  = regexp.MustCompile(`\b(at|on|the|of|by|from|now)\b|[,，的在]`)
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"一": time.Monday, "二": time.Tuesday, "三": time.Wednesday, "四": time.Thursday,
+	"五": time.Friday, "六": time.Saturday, "日": time.Sunday, "天": time.Sunday,
+	"1": time.Monday, "2": time.Tuesday, "3": time.Wednesday, "4": time.Thursday,
+	"5": time.Friday, "6": time.Saturday, "7": time.Sunday,
+}
+
+var monthNames = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "sept": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// ParseTime reads an absolute time ("2025-03-01 14:00", RFC 3339, unix
+// seconds) or a natural expression such as "next friday 9am", "in 3 days",
+// "tomorrow at 18:30" or "下周五下午3点", relative to now and in its location.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	loc := now.Location()
+	for _, layout := range absoluteLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	if unixRe.MatchString(s) {
+		sec, _ := strconv.ParseInt(s, 10, 64)
+		return time.Unix(sec, 0).In(loc), nil
+	}
+	switch strings.ToLower(s) {
+	case "now", "现在":
+		return now, nil
+	}
+	if t, ok := parseNatural(strings.ToLower(s), now); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("could not understand time %q, use e.g. '2025-03-01 14:00', 'tomorrow 9am' or 'in 2 hours'", s)
+}
+
+// naturalTime accumulates the pieces found in an expression.
+type naturalTime struct {
+	base    time.Time // date (and for relative offsets, time) before the clock is set
+	dateSet bool
+	hour    int
+	minute  int
+	second  int
+	timeSet bool
+	evening bool // a pm hint for bare hours
+}
+
+func parseNatural(s string, now time.Time) (time.Time, bool) {
+	n := naturalTime{base: now}
+	rest := s
+	matched := false
+	// take applies fn to every match of re and removes the matches.
+	take := func(re *regexp.Regexp, fn func(m []string)) {
+		rest = re.ReplaceAllStringFunc(rest, func(match string) string {
+			fn(re.FindStringSubmatch(match))
+			matched = true
+			return " "
+		})
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	setDate := func(d time.Time) {
+		n.base = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, d.Location())
+		n.dateSet = true
+	}
+	// setDay sets a month and day; without a year it is the next such day.
+	setDay := func(year string, month time.Month, day int) {
+		d := time.Date(now.Year(), month, day, 0, 0, 0, 0, now.Location())
+		if year != "" {
+			y, _ := strconv.Atoi(year)
+			d = time.Date(y, month, day, 0, 0, 0, 0, now.Location())
+		} else if d.Before(today) {
+			d = d.AddDate(1, 0, 0)
+		}
+		setDate(d)
+	}
+
+	take(monthNameRe, func(m []string) {
+		day, _ := strconv.Atoi(m[2])
+		setDay(m[3], monthNames[m[1]], day)
+	})
+	take(numericDateRe, func(m []string) {
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		setDay(m[1], time.Month(month), day)
+	})
+	take(dayWordRe, func(m []string) {
+		switch m[0] {
+		case "today", "今天":
+			setDate(today)
+		case "tonight", "今晚":
+			setDate(today)
+			n.evening = true
+		case "今早":
+			setDate(today)
+			n.hour, n.timeSet = 9, true
+		case "tomorrow", "明天":
+			setDate(today.AddDate(0, 0, 1))
+		case "明早":
+			setDate(today.AddDate(0, 0, 1))
+			n.hour, n.timeSet = 9, true
+		case "明晚":
+			setDate(today.AddDate(0, 0, 1))
+			n.evening = true
+		case "day after tomorrow", "后天":
+			setDate(today.AddDate(0, 0, 2))
+		case "大后天":
+			setDate(today.AddDate(0, 0, 3))
+		case "yesterday", "昨天":
+			setDate(today.AddDate(0, 0, -1))
+		case "day before yesterday", "前天":
+			setDate(today.AddDate(0, 0, -2))
+		}
+	})
+	take(weekdayRe, func(m []string) {
+		wd := weekdayNames[m[2][:3]]
+		switch m[1] {
+		case "this":
+			setDate(startOfISOWeek(today).AddDate(0, 0, isoOffset(wd)))
+		case "last":
+			d := today.AddDate(0, 0, -1)
+			for d.Weekday() != wd {
+				d = d.AddDate(0, 0, -1)
+			}
+			setDate(d)
+		default: // "friday", "next friday" and "coming friday" mean the next one after today
+			d := today.AddDate(0, 0, 1)
+			for d.Weekday() != wd {
+				d = d.AddDate(0, 0, 1)
+			}
+			setDate(d)
+		}
+	})
+	take(cnWeekdayRe, func(m []string) {
+		wd := weekdayNames[m[2]]
+		monday := startOfISOWeek(today)
+		switch m[1] {
+		case "下":
+			setDate(monday.AddDate(0, 0, 7+isoOffset(wd)))
+		case "下下":
+			setDate(monday.AddDate(0, 0, 14+isoOffset(wd)))
+		case "上":
+			setDate(monday.AddDate(0, 0, -7+isoOffset(wd)))
+		case "这", "本":
+			setDate(monday.AddDate(0, 0, isoOffset(wd)))
+		default: // bare 周五 is the coming one, today included
+			d := today
+			for d.Weekday() != wd {
+				d = d.AddDate(0, 0, 1)
+			}
+			setDate(d)
+		}
+	})
+	take(periodRe, func(m []string) {
+		rel, unit := m[1], m[2]
+		switch m[3] {
+		case "下":
+			rel = "next"
+		case "下下":
+			rel = "after next"
+		case "上":
+			rel = "last"
+		case "这", "本":
+			rel = "this"
+		}
+		switch m[4] {
+		case "周", "星期", "礼拜":
+			unit = "week"
+		case "月":
+			unit = "month"
+		}
+		switch m[5] {
+		case "明":
+			rel, unit = "next", "year"
+		case "去":
+			rel, unit = "last", "year"
+		case "今":
+			rel, unit = "this", "year"
+		}
+		step := map[string]int{"this": 0, "next": 1, "after next": 2, "last": -1}[rel]
+		switch unit {
+		case "week":
+			setDate(startOfISOWeek(today).AddDate(0, 0, 7*step))
+		case "month":
+			setDate(time.Date(now.Year(), now.Month()+time.Month(step), 1, 0, 0, 0, 0, now.Location()))
+		case "year":
+			setDate(time.Date(now.Year()+step, time.January, 1, 0, 0, 0, 0, now.Location()))
+		}
+	})
+
+	// Chinese numerals are converted only now, after 周一 etc. have been
+	// consumed, so that 三天后 and 下午三点 work.
+	rest = cnNumRe.ReplaceAllStringFunc(rest, func(s string) string { return strconv.Itoa(cnNumber(s)) })
+	take(relativeRe, func(m []string) {
+		count, _ := strconv.Atoi(m[1])
+		switch m[3] {
+		case "ago", "之前", "以前", "前":
+			count = -count
+		}
+		n.base = addUnit(n.base, count, m[2])
+		n.dateSet = true
+	})
+	setClock := func(h, m, sec int) {
+		n.hour, n.minute, n.second, n.timeSet = h, m, sec, true
+	}
+	take(cnTimeRe, func(m []string) {
+		h, _ := strconv.Atoi(m[2])
+		min := 0
+		switch m[3] {
+		case "半":
+			min = 30
+		case "1刻":
+			min = 15
+		case "3刻":
+			min = 45
+		default:
+			min, _ = strconv.Atoi(m[4])
+		}
+		switch m[1] {
+		case "下午", "傍晚", "晚上", "夜里":
+			if h < 12 {
+				h += 12
+			}
+		case "中午":
+			if h < 6 {
+				h += 12
+			}
+		case "凌晨":
+			if h == 12 {
+				h = 0
+			}
+		}
+		setClock(h, min, 0)
+	})
+	take(clockRe, func(m []string) {
+		h, _ := strconv.Atoi(m[1])
+		min, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.Atoi(m[3])
+		setClock(applyAMPM(h, m[4]), min, sec)
+	})
+	take(ampmRe, func(m []string) {
+		h, _ := strconv.Atoi(m[1])
+		setClock(applyAMPM(h, m[2]), 0, 0)
+	})
+	take(atHourRe, func(m []string) {
+		h, _ := strconv.Atoi(m[1])
+		setClock(h, 0, 0)
+	})
+	take(namedTime, func(m []string) {
+		switch m[0] {
+		case "noon", "midday", "中午":
+			if !n.timeSet {
+				setClock(12, 0, 0)
+			}
+		case "midnight":
+			setClock(0, 0, 0)
+			if n.dateSet {
+				n.base = n.base.AddDate(0, 0, 1)
+			} else {
+				setDate(today.AddDate(0, 0, 1))
+			}
+		case "morning", "早上", "上午", "凌晨":
+			if !n.timeSet {
+				setClock(9, 0, 0)
+			}
+		case "afternoon", "下午":
+			if !n.timeSet {
+				setClock(15, 0, 0)
+			}
+			n.evening = true
+		case "evening", "傍晚", "晚上":
+			if !n.timeSet {
+				setClock(19, 0, 0)
+			}
+			n.evening = true
+		}
+	})
+
+	rest = fillerRe.ReplaceAllString(rest, " ")
+	// A bare number after a day, as in "tonight 8", is the hour.
+	if m := bareHour.FindStringSubmatch(rest); m != nil && n.dateSet && !n.timeSet {
+		h, _ := strconv.Atoi(m[1])
+		setClock(h, 0, 0)
+		rest = ""
+	}
+	if !matched || strings.TrimSpace(rest) != "" {
+		return time.Time{}, false
+	}
+	if !n.timeSet {
+		return n.base, true
+	}
+	if n.evening && n.hour < 12 {
+		n.hour += 12
+	}
+	if n.hour > 23 || n.minute > 59 || n.second > 59 {
+		return time.Time{}, false
+	}
+	b := n.base
+	t := time.Date(b.Year(), b.Month(), b.Day(), n.hour, n.minute, n.second, 0, b.Location())
+	// A bare "9am" means the next 9am.
+	if !n.dateSet && t.Before(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+func applyAMPM(h int, marker string) int {
+	switch strings.ReplaceAll(marker, ".", "") {
+	case "pm":
+		if h < 12 {
+			return h + 12
+		}
+	case "am":
+		if h == 12 {
+			return 0
+		}
+	}
+	return h
+}
+
+// isoOffset is the number of days from Monday to wd.
+func isoOffset(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+// cnNumber converts Chinese numerals up to 99, e.g. 十二 or 两.
+func cnNumber(s string) int {
+	digits := map[rune]int{'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	n, cur := 0, 0
+	for _, r := range s {
+		if r == '十' {
+			if cur == 0 {
+				cur = 1
+			}
+			n += cur * 10
+			cur = 0
+			continue
+		}
+		cur = digits[r]
+	}
+	return n + cur
+}
+
+func addUnit(t time.Time, n int, unit string) time.Time {
+	switch {
+	case strings.HasPrefix(unit, "sec") || strings.HasPrefix(unit, "秒"):
+		return t.Add(time.Duration(n) * time.Second)
+	case strings.HasPrefix(unit, "min") || unit == "分钟":
+		return t.Add(time.Duration(n) * time.Minute)
+	case strings.HasPrefix(unit, "h") || unit == "小时" || strings.HasSuffix(unit, "钟头"):
+		return t.Add(time.Duration(n) * time.Hour)
+	case strings.HasPrefix(unit, "day") || unit == "天" || unit == "日":
+		return t.AddDate(0, 0, n)
+	case strings.HasPrefix(unit, "week") || strings.HasSuffix(unit, "星期") || strings.HasSuffix(unit, "礼拜") || unit == "周":
+		return t.AddDate(0, 0, 7*n)
+	case strings.HasPrefix(unit, "month") || unit == "个月":
+		return t.AddDate(0, n, 0)
+	case strings.HasPrefix(unit, "year") || unit == "年":
+		return t.AddDate(n, 0, 0)
+	}
+	return t
+}
+
+var durationPartRe = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(years?|y|months?|mo|weeks?|w|days?|d|hours?|hrs?|h|minutes?|mins?|m|seconds?|secs?|s)`)
+
+// AddDuration adds a duration such as "1h30m", "-3d", "2 weeks" or "1y2mo" to
+// t. Years, months, weeks and days follow the calendar, so adding a day
+// across a DST change keeps the wall clock time.
+func AddDuration(t time.Time, s string) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if d, err := time.ParseDuration(s); err == nil {
+		return t.Add(d), nil
+	}
+	sign := 1
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	parts := durationPartRe.FindAllStringSubmatch(s, -1)
+	if len(parts) == 0 || strings.TrimSpace(durationPartRe.ReplaceAllString(s, "")) != "" {
+		return time.Time{}, fmt.Errorf("invalid duration %q, use e.g. '90m', '1h30m', '3d', '-2w' or '1y2mo'", s)
+	}
+	for _, p := range parts {
+		value, _ := strconv.ParseFloat(p[1], 64)
+		unit := p[2]
+		switch {
+		case unit == "mo" || strings.HasPrefix(unit, "month"),
+			unit == "y" || strings.HasPrefix(unit, "year"),
+			unit == "w" || strings.HasPrefix(unit, "week"),
+			unit == "d" || strings.HasPrefix(unit, "day"):
+			if value != float64(int(value)) {
+				return time.Time{}, fmt.Errorf("calendar units need whole numbers: %q", p[0])
+			}
+			n := sign * int(value)
+			switch unit[0] {
+			case 'y':
+				t = t.AddDate(n, 0, 0)
+			case 'm':
+				t = t.AddDate(0, n, 0)
+			case 'w':
+				t = t.AddDate(0, 0, 7*n)
+			case 'd':
+				t = t.AddDate(0, 0, n)
+			}
+		default:
+			var size time.Duration
+			switch unit[0] {
+			case 'h':
+				size = time.Hour
+			case 'm':
+				size = time.Minute
+			case 's':
+				size = time.Second
+			}
+			t = t.Add(time.Duration(float64(sign) * value * float64(size)))
+		}
+	}
+	return t, nil
+}
+
+// strftime formats t with C strftime directives.
+func strftime(t time.Time, format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			sb.WriteString(strconv.Itoa(t.Year()))
+		case 'y':
+			sb.WriteString(t.Format("06"))
+		case 'C':
+			fmt.Fprintf(&sb, "%02d", t.Year()/100)
+		case 'm':
+			sb.WriteString(t.Format("01"))
+		case 'd':
+			sb.WriteString(t.Format("02"))
+		case 'e':
+			sb.WriteString(t.Format("_2"))
+		case 'H':
+			sb.WriteString(t.Format("15"))
+		case 'I':
+			sb.WriteString(t.Format("03"))
+		case 'M':
+			sb.WriteString(t.Format("04"))
+		case 'S':
+			sb.WriteString(t.Format("05"))
+		case 'f':
+			fmt.Fprintf(&sb, "%06d", t.Nanosecond()/1000)
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'a':
+			sb.WriteString(t.Format("Mon"))
+		case 'A':
+			sb.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			sb.WriteString(t.Format("Jan"))
+		case 'B':
+			sb.WriteString(t.Format("January"))
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'u':
+			sb.WriteString(strconv.Itoa(isoOffset(t.Weekday()) + 1))
+		case 'w':
+			sb.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'V':
+			_, week := t.ISOWeek()
+			fmt.Fprintf(&sb, "%02d", week)
+		case 'G':
+			year, _ := t.ISOWeek()
+			sb.WriteString(strconv.Itoa(year))
+		case 'Z':
+			sb.WriteString(t.Format("MST"))
+		case 'z':
+			sb.WriteString(t.Format("-0700"))
+		case 's':
+			sb.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'F':
+			sb.WriteString(t.Format("2006-01-02"))
+		case 'T':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'R':
+			sb.WriteString(t.Format("15:04"))
+		case 'D':
+			sb.WriteString(t.Format("01/02/06"))
+		case 'c':
+			sb.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(format[i])
+		}
+	}
+	return sb.String()
+}
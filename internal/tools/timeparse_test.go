@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParseTime(t *testing.T) {
+	shanghai := mustLocation(t, "Asia/Shanghai")
+	// Monday 2026-10-19 10:00
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, shanghai)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, shanghai)
+	}
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		// Absolute times, in now's location unless they name a zone.
+		{"2026-11-01 14:00", at(11, 1, 14, 0)},
+		{"2026/11/01", at(11, 1, 0, 0)},
+		{"2026-11-01T14:00:00+09:00", at(11, 1, 13, 0)},
+		{"1792375200", time.Unix(1792375200, 0)},
+		{"now", now},
+		{"现在", now},
+
+		// Days and clock times.
+		{"tomorrow 9am", at(10, 20, 9, 0)},
+		{"tomorrow at 18:30", at(10, 20, 18, 30)},
+		{"day after tomorrow", at(10, 21, 0, 0)},
+		{"yesterday noon", at(10, 18, 12, 0)},
+		{"9am", at(10, 20, 9, 0)}, // already past today
+		{"9:15 pm", at(10, 19, 21, 15)},
+		{"12am", at(10, 20, 0, 0)},
+		{"midnight", at(10, 20, 0, 0)},
+		{"tomorrow evening", at(10, 20, 19, 0)},
+		{"tonight at 8", at(10, 19, 20, 0)},
+		{"tonight 8", at(10, 19, 20, 0)},
+		{"tomorrow 7", at(10, 20, 7, 0)},
+
+		// Weekdays and periods.
+		{"friday", at(10, 23, 0, 0)},
+		{"next friday 9am", at(10, 23, 9, 0)},
+		{"monday", at(10, 26, 0, 0)},
+		{"last monday", at(10, 12, 0, 0)},
+		{"this sunday", at(10, 25, 0, 0)},
+		{"next week", at(10, 26, 0, 0)},
+		{"next month", at(11, 1, 0, 0)},
+		{"last year", time.Date(2025, 1, 1, 0, 0, 0, 0, shanghai)},
+
+		// Relative offsets keep the time of day.
+		{"in 3 days", at(10, 22, 10, 0)},
+		{"2 hours ago", at(10, 19, 8, 0)},
+		{"in 90 minutes", at(10, 19, 11, 30)},
+
+		// Dates without a year are the next such day.
+		{"march 3", time.Date(2027, 3, 3, 0, 0, 0, 0, shanghai)},
+		{"march 3, 2026", time.Date(2026, 3, 3, 0, 0, 0, 0, shanghai)},
+		{"dec 25th 6pm", at(12, 25, 18, 0)},
+		{"oct 19", at(10, 19, 0, 0)},
+		{"10/18", time.Date(2027, 10, 18, 0, 0, 0, 0, shanghai)},
+
+		// Chinese.
+		{"今晚8点", at(10, 19, 20, 0)},
+		{"明天下午3点", at(10, 20, 15, 0)},
+		{"明早", at(10, 20, 9, 0)},
+		{"后天上午十点半", at(10, 21, 10, 30)},
+		{"三天后", at(10, 22, 10, 0)},
+		{"两小时前", at(10, 19, 8, 0)},
+		{"周五", at(10, 23, 0, 0)},
+		{"下周五下午3点", at(10, 30, 15, 0)},
+		{"上周一", at(10, 12, 0, 0)},
+		{"下个月", at(11, 1, 0, 0)},
+		{"明年", time.Date(2027, 1, 1, 0, 0, 0, 0, shanghai)},
+		{"3月3日", time.Date(2027, 3, 3, 0, 0, 0, 0, shanghai)},
+		{"2026年12月1日 9:00", at(12, 1, 9, 0)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "whenever", "banana 8", "tonight 25", "tomorrow 9:75", "8"} {
+		if got, err := ParseTime(in, now); err == nil {
+			t.Errorf("ParseTime(%q) = %s, want an error", in, got)
+		}
+	}
+}
+
+func TestParseTimeLocation(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, newYork)
+	got, err := ParseTime("tomorrow 9am", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 10, 20, 9, 0, 0, 0, newYork); !got.Equal(want) || got.Location() != newYork {
+		t.Errorf("ParseTime in New York = %s, want %s", got, want)
+	}
+}
+
+func TestAddDuration(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	// The day before daylight saving time ends.
+	start := time.Date(2026, 10, 31, 12, 0, 0, 0, newYork)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"90m", start.Add(90 * time.Minute)},
+		{"1h30m", start.Add(90 * time.Minute)},
+		{"1.5h", start.Add(90 * time.Minute)},
+		{"-3d", time.Date(2026, 10, 28, 12, 0, 0, 0, newYork)},
+		{"2 weeks", time.Date(2026, 11, 14, 12, 0, 0, 0, newYork)},
+		{"1y2mo", time.Date(2027, 12, 31, 12, 0, 0, 0, newYork)},
+		{"+1 day 2 hours", time.Date(2026, 11, 1, 14, 0, 0, 0, newYork)},
+		// Days keep the wall clock across the change, hours do not.
+		{"1d", time.Date(2026, 11, 1, 12, 0, 0, 0, newYork)},
+		{"24h", time.Date(2026, 11, 1, 11, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		got, err := AddDuration(start, tt.in)
+		if err != nil {
+			t.Errorf("AddDuration(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("AddDuration(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "soon", "1.5d", "3 fortnights"} {
+		if _, err := AddDuration(start, in); err == nil {
+			t.Errorf("AddDuration(%q) succeeded", in)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tm := time.Date(2026, 1, 4, 21, 5, 9, 123456000, mustLocation(t, "Asia/Shanghai"))
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "2026-01-04 21:05:09 Sunday (CST +08:00)"},
+		{"rfc3339", "2026-01-04T21:05:09+08:00"},
+		{"unix", "1767531909"},
+		{"2006/01/02 3:04PM", "2026/01/04 9:05PM"},
+		{"%Y-%m-%d %H:%M:%S", "2026-01-04 21:05:09"},
+		{"%y %C %e %I %p %f", "26 20  4 09 PM 123456"},
+		{"%a %A %b %B %h", "Sun Sunday Jan January Jan"},
+		{"%j %u %w", "004 7 0"},
+		{"%G-W%V", "2026-W01"},
+		{"%Z %z %s", "CST +0800 1767531909"},
+		{"%F %T %R %D", "2026-01-04 21:05:09 21:05 01/04/26"},
+		{"%c", "Sun Jan  4 21:05:09 2026"},
+		{"100%% %q%", "100% %q%"},
+	}
+	for _, tt := range tests {
+		if got := FormatTime(tm, tt.format); got != tt.want {
+			t.Errorf("FormatTime(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Todo statuses.
+const (
+	TodoPending    = "pending"
+	TodoInProgress = "in_progress"
+	TodoDone       = "done"
+)
+
+const maxTodos = 50
+
+// Todo is one step of a multi-step task.
+type Todo struct {
+	Content string `json:"content"`
+	Status  string `json:"status"`
+}
+
+// TodoList keeps the model's task list for each session. The agent shows it
+// to the user and repeats it to the model on every turn.
+type TodoList struct {
+	mu    sync.Mutex
+	lists map[string][]Todo
+}
+
+func NewTodoList() *TodoList {
+	return &TodoList{lists: make(map[string][]Todo)}
+}
+
+// Get returns a copy of the session's list.
+func (l *TodoList) Get(session string) []Todo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Todo(nil), l.lists[session]...)
+}
+
+// Set replaces the session's list. An empty list clears it.
+func (l *TodoList) Set(session string, todos []Todo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(todos) == 0 {
+		delete(l.lists, session)
+		return
+	}
+	l.lists[session] = append([]Todo(nil), todos...)
+}
+
+// Format renders the session's list as text, or "" when it is empty.
+func (l *TodoList) Format(session string) string {
+	return FormatTodos(l.Get(session))
+}
+
+// FormatTodos renders todos as a checklist: [x] done, [>] in progress,
+// [ ] pending.
+func FormatTodos(todos []Todo) string {
+	if len(todos) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	done := 0
+	for i, t := range todos {
+		mark := "[ ]"
+		switch t.Status {
+		case TodoInProgress:
+			mark = "[>]"
+		case TodoDone:
+			mark = "[x]"
+			done++
+		}
+		fmt.Fprintf(&sb, "%d. %s %s\n", i+1, mark, t.Content)
+	}
+	fmt.Fprintf(&sb, "(%d of %d done)", done, len(todos))
+	return sb.String()
+}
+
+// TodoWriteTool replaces the session's task list.
+type TodoWriteTool struct{ Todos *TodoList }
+
+func (t *TodoWriteTool) Name() string { return "todo_write" }
+func (t *TodoWriteTool) Description() string {
+	return "Plan and track a multi-step task. Write the whole list each time: add the steps up front, " +
+		"mark one step in_progress while working on it and done as soon as it is finished. " +
+		"The list is shown to the user and repeated to you every turn. Skip it for simple requests; write an empty list to clear it."
+}
+func (t *TodoWriteTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"todos": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"content": map[string]interface{}{
+							"type":        "string",
+							"description": "What the step does, in a few words",
+						},
+						"status": map[string]interface{}{
+							"type": "string",
+							"enum": []string{TodoPending, TodoInProgress, TodoDone},
+						},
+					},
+					"required": []string{"content", "status"},
+				},
+			},
+		},
+		"required": []string{"todos"},
+	}
+}
+
+func (t *TodoWriteTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *TodoWriteTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	var input struct {
+		Todos []Todo `json:"todos"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if len(input.Todos) > maxTodos {
+		return "", fmt.Errorf("too many steps (%d), keep the list under %d", len(input.Todos), maxTodos)
+	}
+	inProgress := 0
+	for i, todo := range input.Todos {
+		input.Todos[i].Content = strings.TrimSpace(todo.Content)
+		if input.Todos[i].Content == "" {
+			return "", fmt.Errorf("step %d has no content", i+1)
+		}
+		switch todo.Status {
+		case "", TodoPending:
+			input.Todos[i].Status = TodoPending
+		case TodoInProgress:
+			inProgress++
+		case TodoDone:
+		default:
+			return "", fmt.Errorf("step %d has unknown status %q, use pending, in_progress or done", i+1, todo.Status)
+		}
+	}
+
+	session := SessionFrom(ctx)
+	t.Todos.Set(session, input.Todos)
+	if len(input.Todos) == 0 {
+		return "Todo list cleared.", nil
+	}
+	result := "Todo list updated:\n" + t.Todos.Format(session)
+	if inProgress > 1 {
+		result += "\nNote: several steps are in progress, finish one before starting the next."
+	}
+	return result, nil
+}
+
+// TodoReadTool shows the session's task list.
+type TodoReadTool struct{ Todos *TodoList }
+
+func (t *TodoReadTool) Name() string { return "todo_read" }
+func (t *TodoReadTool) Description() string {
+	return "Show the current todo list of this conversation."
+}
+func (t *TodoReadTool) Schema() interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+func (t *TodoReadTool) Execute(args json.RawMessage) (string, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+func (t *TodoReadTool) ExecuteContext(ctx context.Context, args json.RawMessage) (string, error) {
+	list := t.Todos.Format(SessionFrom(ctx))
+	if list == "" {
+		return "The todo list is empty.", nil
+	}
+	return list, nil
+}
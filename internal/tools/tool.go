@@ -1,6 +1,9 @@
 package tools
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+)
 
 type Tool interface {
 	Name() string
@@ -8,3 +11,36 @@ type Tool interface {
 	Execute(args json.RawMessage) (string, error)
 	Schema() interface{} // Return a struct that can be marshaled to JSON Schema
 }
+
+// ContextTool is implemented by tools that need the calling session or
+// should stop when the turn is cancelled.
+type ContextTool interface {
+	Tool
+	ExecuteContext(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// Execute runs t, passing ctx along when the tool supports it.
+func Execute(ctx context.Context, t Tool, args json.RawMessage) (string, error) {
+	if ct, ok := t.(ContextTool); ok {
+		return ct.ExecuteContext(ctx, args)
+	}
+	return t.Execute(args)
+}
+
+type sessionKey struct{}
+
+// DefaultSession is used when a tool runs outside of any conversation.
+const DefaultSession = "default"
+
+// WithSession tags ctx with the conversation the tool call belongs to.
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFrom returns the conversation ID stored by WithSession.
+func SessionFrom(ctx context.Context) string {
+	if s, ok := ctx.Value(sessionKey{}).(string); ok && s != "" {
+		return s
+	}
+	return DefaultSession
+}